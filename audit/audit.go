@@ -0,0 +1,167 @@
+// Package audit records security relevant events.
+package audit
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+)
+
+type Outcome string
+
+const (
+	Allowed   Outcome = "allowed"
+	Denied    Outcome = "denied"
+	Succeeded Outcome = "succeeded"
+	Failed    Outcome = "failed"
+)
+
+// Entry is a single audited event: who did what to which resource and how
+// it ended.
+type Entry struct {
+	Time      time.Time
+	ActorID   string
+	ActorKind string
+	RequestID string
+	IP        string
+	Action    string
+	Resource  string
+	Outcome   Outcome
+	Detail    string
+	// Changes holds the fields of the resource the event changed.
+	Changes map[string]Change
+}
+
+// Change is the value of a field before and after an event. Before is nil
+// for created resources and After for deleted ones.
+type Change struct {
+	Before interface{} `json:"before"`
+	After  interface{} `json:"after"`
+}
+
+// New returns an entry for action on resource, filled in with the principal
+// and the request found in ctx.
+func New(ctx context.Context, action, resource string, outcome Outcome) Entry {
+	e := Entry{
+		Time:     time.Now().UTC(),
+		Action:   action,
+		Resource: resource,
+		Outcome:  outcome,
+	}
+
+	if p, ok := auth.FromContext(ctx); ok {
+		e.ActorID, e.ActorKind = p.Subject, string(p.Kind)
+	}
+
+	if r, ok := RequestFromContext(ctx); ok {
+		e.RequestID, e.IP = r.ID, r.IP
+	}
+
+	return e
+}
+
+// Diff compares the JSON encodings of two states of a resource, either of
+// which may be nil, and returns the top level fields that differ.
+func Diff(before, after interface{}) (map[string]Change, error) {
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := make(map[string]Change)
+
+	for k, v := range b {
+		if w, ok := a[k]; !ok || !reflect.DeepEqual(v, w) {
+			changes[k] = Change{Before: v, After: w}
+		}
+	}
+
+	for k, w := range a {
+		if _, ok := b[k]; !ok {
+			changes[k] = Change{After: w}
+		}
+	}
+
+	return changes, nil
+}
+
+func fields(v interface{}) (map[string]interface{}, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+
+	var m map[string]interface{}
+	if err := json.Unmarshal(b, &m); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// Request identifies the HTTP request an entry is recorded for.
+type Request struct {
+	ID string
+	IP string
+}
+
+type contextKey struct{}
+
+func WithRequest(ctx context.Context, r Request) context.Context {
+	return context.WithValue(ctx, contextKey{}, r)
+}
+
+func RequestFromContext(ctx context.Context) (Request, bool) {
+	r, ok := ctx.Value(contextKey{}).(Request)
+
+	return r, ok
+}
+
+type Recorder interface {
+	Record(ctx context.Context, e Entry) error
+}
+
+// LogRecorder writes entries to a logger.
+type LogRecorder struct {
+	logger logging.Logger
+}
+
+func NewLogRecorder(logger logging.Logger) *LogRecorder {
+	return &LogRecorder{logger: logger}
+}
+
+func (r *LogRecorder) Record(ctx context.Context, e Entry) error {
+	changed := make([]string, 0, len(e.Changes))
+	for k := range e.Changes {
+		changed = append(changed, k)
+	}
+
+	sort.Strings(changed)
+
+	r.logger.WithFields(logging.Fields{
+		"audit":      "true",
+		"time":       e.Time.Format(time.RFC3339Nano),
+		"actor_id":   e.ActorID,
+		"actor_kind": e.ActorKind,
+		"request_id": e.RequestID,
+		"ip":         e.IP,
+		"action":     e.Action,
+		"resource":   e.Resource,
+		"outcome":    string(e.Outcome),
+		"detail":     e.Detail,
+		"changed":    strings.Join(changed, ","),
+	}).Info("audit")
+
+	return nil
+}
@@ -0,0 +1,58 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+const apiKeyPrefix = "xak"
+
+var prefixEncoding = base32.NewEncoding("abcdefghijklmnopqrstuvwxyz234567").WithPadding(base32.NoPadding)
+
+// NewAPIKey generates a key of the form xak_<prefix>_<secret>. The prefix
+// identifies the key and may be shown; the secret carries 256 bits of
+// entropy.
+func NewAPIKey() (key, prefix string, err error) {
+	b := make([]byte, 5+32)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	prefix = prefixEncoding.EncodeToString(b[:5])
+	key = apiKeyPrefix + "_" + prefix + "_" + base64.RawURLEncoding.EncodeToString(b[5:])
+
+	return key, prefix, nil
+}
+
+// ParseAPIKey returns the prefix of a key that is well formed.
+func ParseAPIKey(key string) (string, bool) {
+	parts := strings.SplitN(key, "_", 3)
+	if len(parts) != 3 || parts[0] != apiKeyPrefix || len(parts[1]) != 8 || parts[2] == "" {
+		return "", false
+	}
+
+	return parts[1], true
+}
+
+// HashAPIKey returns the hex encoded SHA-256 of a key. Keys are random, so
+// a fast hash is as good as a password hash and keeps verification cheap.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// NewClientSecret generates an OAuth client secret carrying 256 bits of
+// entropy. Like keys, secrets are stored as HashAPIKey(secret).
+func NewClientSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
@@ -0,0 +1,64 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestNewAPIKey(t *testing.T) {
+	key, prefix, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.HasPrefix(key, "xak_"+prefix+"_") {
+		t.Errorf("NewAPIKey() = %q, %q, want a key starting with its prefix", key, prefix)
+	}
+
+	if got, ok := ParseAPIKey(key); !ok || got != prefix {
+		t.Errorf("ParseAPIKey(%q) = %q, %v, want %q", key, got, ok, prefix)
+	}
+
+	other, _, err := NewAPIKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if other == key || HashAPIKey(other) == HashAPIKey(key) {
+		t.Errorf("NewAPIKey() returned %q twice", key)
+	}
+}
+
+func TestParseAPIKey(t *testing.T) {
+	tests := []struct {
+		key        string
+		wantPrefix string
+		wantOK     bool
+	}{
+		{key: "xak_abcdefgh_c2VjcmV0", wantPrefix: "abcdefgh", wantOK: true},
+		{key: "xak_abcdefgh_sec_ret", wantPrefix: "abcdefgh", wantOK: true},
+		{key: "xak_abcdefgh_"},
+		{key: "xak_abcdefg_c2VjcmV0"},
+		{key: "xak_abcdefghi_c2VjcmV0"},
+		{key: "xyz_abcdefgh_c2VjcmV0"},
+		{key: "xak_abcdefgh"},
+		{key: ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.key, func(t *testing.T) {
+			prefix, ok := ParseAPIKey(tt.key)
+			if prefix != tt.wantPrefix || ok != tt.wantOK {
+				t.Errorf("ParseAPIKey() = %q, %v, want %q, %v", prefix, ok, tt.wantPrefix, tt.wantOK)
+			}
+		})
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	const want = "2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b"
+
+	if got := HashAPIKey("secret"); got != want {
+		t.Errorf("HashAPIKey() = %q, want %q", got, want)
+	}
+}
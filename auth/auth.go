@@ -0,0 +1,65 @@
+// Package auth authenticates requests and carries the authenticated
+// principal through the request context.
+package auth
+
+import (
+	"context"
+	"errors"
+)
+
+// ErrUnauthenticated is wrapped by errors caused by missing or invalid
+// credentials, as opposed to failures to check them.
+var ErrUnauthenticated = errors.New("auth: unauthenticated")
+
+type Kind string
+
+const (
+	KindUser Kind = "user"
+	// KindOperator is a person or system holding static credentials from
+	// the configuration.
+	KindOperator Kind = "operator"
+	// KindAPIKey is a machine client holding an API key. Its subject is the
+	// id of the key.
+	KindAPIKey Kind = "api_key"
+	// KindClient is a machine client holding a token issued by the OAuth
+	// token endpoint. Its subject is the id of the client.
+	KindClient Kind = "client"
+)
+
+// Principal is the identity a request was authenticated as.
+type Principal struct {
+	Subject string
+	Kind    Kind
+	Scopes  []string
+}
+
+// HasScope reports whether the principal was granted scope.
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Authenticator verifies the credentials of an Authorization header that
+// uses its scheme.
+type Authenticator interface {
+	Scheme() string
+	Authenticate(ctx context.Context, credentials string) (*Principal, error)
+}
+
+type contextKey struct{}
+
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, contextKey{}, p)
+}
+
+// FromContext returns the principal of an authenticated request.
+func FromContext(ctx context.Context) (*Principal, bool) {
+	p, ok := ctx.Value(contextKey{}).(*Principal)
+
+	return p, ok
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"bufio"
+	"context"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyHash is compared against when the user is unknown, so that unknown
+// and known users take the same time to reject.
+var dummyHash, _ = bcrypt.GenerateFromPassword([]byte("x-api"), bcrypt.DefaultCost)
+
+type htpasswdEntry struct {
+	user string
+	hash []byte
+}
+
+// BasicAuthenticator checks HTTP Basic credentials against htpasswd entries
+// with bcrypt hashes, as written by htpasswd -B.
+type BasicAuthenticator struct {
+	entries []htpasswdEntry
+}
+
+// NewBasicAuthenticator parses "user:hash" entries.
+func NewBasicAuthenticator(entries []string) (*BasicAuthenticator, error) {
+	a := &BasicAuthenticator{}
+
+	for i, e := range entries {
+		user, hash, ok := strings.Cut(strings.TrimSpace(e), ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("auth: htpasswd entry %d is not user:hash", i)
+		}
+
+		if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+			return nil, fmt.Errorf("auth: htpasswd entry for %q is not a bcrypt hash: %w", user, err)
+		}
+
+		a.entries = append(a.entries, htpasswdEntry{user: user, hash: []byte(hash)})
+	}
+
+	if len(a.entries) == 0 {
+		return nil, errors.New("auth: no htpasswd entries")
+	}
+
+	return a, nil
+}
+
+// ReadHtpasswd reads the entries of an htpasswd file, skipping blank lines
+// and comments.
+func ReadHtpasswd(r io.Reader) ([]string, error) {
+	var entries []string
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		entries = append(entries, line)
+	}
+
+	return entries, scanner.Err()
+}
+
+func (a *BasicAuthenticator) Scheme() string {
+	return "Basic"
+}
+
+func (a *BasicAuthenticator) Authenticate(ctx context.Context, credentials string) (*Principal, error) {
+	b, err := base64.StdEncoding.DecodeString(credentials)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed basic credentials", ErrUnauthenticated)
+	}
+
+	user, pw, ok := strings.Cut(string(b), ":")
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed basic credentials", ErrUnauthenticated)
+	}
+
+	// Every entry is compared so that the position of the user in the list
+	// does not show in the response time.
+	hash := dummyHash
+	found := 0
+
+	for _, e := range a.entries {
+		if subtle.ConstantTimeCompare([]byte(user), []byte(e.user)) == 1 {
+			hash, found = e.hash, 1
+		}
+	}
+
+	if err := bcrypt.CompareHashAndPassword(hash, []byte(pw)); err != nil || found == 0 {
+		return nil, fmt.Errorf("%w: invalid username or password", ErrUnauthenticated)
+	}
+
+	return &Principal{
+		Subject: user,
+		Kind:    KindOperator,
+	}, nil
+}
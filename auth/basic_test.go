@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func htpasswdEntryFor(t *testing.T, user, password string) string {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return user + ":" + string(hash)
+}
+
+func TestBasicAuthenticator(t *testing.T) {
+	a, err := NewBasicAuthenticator([]string{
+		htpasswdEntryFor(t, "admin", "s3cret"),
+		htpasswdEntryFor(t, "metrics", "sc:rape"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	basic := func(s string) string {
+		return base64.StdEncoding.EncodeToString([]byte(s))
+	}
+
+	tests := []struct {
+		name        string
+		credentials string
+		wantSubject string
+	}{
+		{name: "valid", credentials: basic("admin:s3cret"), wantSubject: "admin"},
+		{name: "password with a colon", credentials: basic("metrics:sc:rape"), wantSubject: "metrics"},
+		{name: "wrong password", credentials: basic("admin:wrong")},
+		{name: "password of another user", credentials: basic("admin:sc:rape")},
+		{name: "unknown user", credentials: basic("root:s3cret")},
+		{name: "empty user", credentials: basic(":s3cret")},
+		{name: "no colon", credentials: basic("admin")},
+		{name: "not base64", credentials: "admin:s3cret"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := a.Authenticate(context.Background(), tt.credentials)
+			if tt.wantSubject == "" {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Authenticate() error = %v, want ErrUnauthenticated", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if p.Subject != tt.wantSubject || p.Kind != KindOperator {
+				t.Errorf("Authenticate() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestNewBasicAuthenticator(t *testing.T) {
+	tests := []struct {
+		name    string
+		entries []string
+		wantErr bool
+	}{
+		{name: "valid", entries: []string{htpasswdEntryFor(t, "admin", "s3cret")}},
+		{name: "no entries", wantErr: true},
+		{name: "no hash", entries: []string{"admin"}, wantErr: true},
+		{name: "no user", entries: []string{htpasswdEntryFor(t, "", "s3cret")}, wantErr: true},
+		{name: "not bcrypt", entries: []string{"admin:{SHA}W6ph5Mm5Pz8GgiULbPgzG37mj9g="}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewBasicAuthenticator(tt.entries)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewBasicAuthenticator() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestReadHtpasswd(t *testing.T) {
+	entries, err := ReadHtpasswd(strings.NewReader("# operators\nadmin:$2y$05$abc\n\n  metrics:$2y$05$def  \n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"admin:$2y$05$abc", "metrics:$2y$05$def"}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("ReadHtpasswd() = %q, want %q", entries, want)
+	}
+}
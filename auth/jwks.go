@@ -0,0 +1,132 @@
+package auth
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+)
+
+type jwks struct {
+	Keys []jwk `json:"keys"`
+}
+
+// jwk is an RFC 7517 JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Alg string `json:"alg"`
+	Use string `json:"use"`
+	// RSA
+	N string `json:"n"`
+	E string `json:"e"`
+	// EC
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+	// Symmetric
+	K string `json:"k"`
+}
+
+// ParseJWKS reads the signature keys of a JSON Web Key Set. Keys for other
+// uses, such as encryption, are skipped.
+func ParseJWKS(b []byte) ([]Key, error) {
+	var set jwks
+	if err := json.Unmarshal(b, &set); err != nil {
+		return nil, fmt.Errorf("auth: invalid jwks: %w", err)
+	}
+
+	keys := make([]Key, 0, len(set.Keys))
+
+	for i, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+
+		key, err := k.parse()
+		if err != nil {
+			return nil, fmt.Errorf("auth: jwks key %d: %w", i, err)
+		}
+
+		keys = append(keys, key)
+	}
+
+	return keys, nil
+}
+
+func (k jwk) parse() (Key, error) {
+	key := Key{ID: k.Kid, Algorithm: k.Alg}
+
+	switch k.Kty {
+	case "oct":
+		secret, err := decodeB64(k.K)
+		if err != nil {
+			return key, err
+		}
+
+		key.Key = secret
+		key.Algorithm = defaultAlg(key.Algorithm, HS256)
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return key, err
+		}
+
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return key, err
+		}
+
+		key.Key = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		key.Algorithm = defaultAlg(key.Algorithm, RS256)
+	case "EC":
+		if k.Crv != "P-256" {
+			return key, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return key, err
+		}
+
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return key, err
+		}
+
+		if !elliptic.P256().IsOnCurve(x, y) {
+			return key, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+
+		key.Key = &ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}
+		key.Algorithm = defaultAlg(key.Algorithm, ES256)
+	default:
+		return key, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+
+	return key, nil
+}
+
+func defaultAlg(alg, def string) string {
+	if alg == "" {
+		return def
+	}
+
+	return alg
+}
+
+func decodeB64(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	b, err := decodeB64(s)
+	if err != nil {
+		return nil, err
+	}
+
+	return new(big.Int).SetBytes(b), nil
+}
@@ -0,0 +1,237 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	ES256 = "ES256"
+)
+
+// Key is a key tokens can be verified with. Key holds a []byte secret for
+// HS256, an *rsa.PublicKey for RS256 and an *ecdsa.PublicKey for ES256.
+type Key struct {
+	ID        string
+	Algorithm string
+	Key       interface{}
+}
+
+type JWTOptions struct {
+	Keys   []Key
+	Issuer string
+	// Audience lists the accepted audiences. A token must be issued for at
+	// least one of them.
+	Audience []string
+	// Leeway is the clock skew tolerated when checking exp and nbf.
+	Leeway time.Duration
+	// Clients verifies the tokens of the OAuth token endpoint, which
+	// authenticate clients. Keys and Issuer verify the tokens of users.
+	Clients *ClientTokens
+}
+
+// ClientTokens are the tokens the OAuth token endpoint issues. They are
+// signed with Key and carry Issuer, which are only used for them. Without a
+// Resolver, the tokens of revoked clients are accepted until they expire.
+type ClientTokens struct {
+	Key      Key
+	Issuer   string
+	Resolver ClientResolver
+}
+
+// ClientResolver reports whether a client exists and is not revoked.
+type ClientResolver interface {
+	ClientActive(ctx context.Context, clientID string) (bool, error)
+}
+
+// JWTVerifier authenticates bearer tokens.
+type JWTVerifier struct {
+	opts   JWTOptions
+	keys   []verifierKey
+	parser *jwt.Parser
+}
+
+// verifierKey is a key with the issuer and the kind of principal of the
+// tokens it verifies.
+type verifierKey struct {
+	key    Key
+	issuer string
+	kind   Kind
+}
+
+func NewJWTVerifier(opts JWTOptions) (*JWTVerifier, error) {
+	if len(opts.Keys) == 0 {
+		return nil, errors.New("auth: no jwt keys")
+	}
+
+	if opts.Issuer == "" || len(opts.Audience) == 0 {
+		return nil, errors.New("auth: jwt issuer and audience are required")
+	}
+
+	keys := make([]verifierKey, 0, len(opts.Keys)+1)
+	for _, k := range opts.Keys {
+		keys = append(keys, verifierKey{key: k, issuer: opts.Issuer, kind: KindUser})
+	}
+
+	if c := opts.Clients; c != nil {
+		if c.Issuer == "" || c.Issuer == opts.Issuer {
+			return nil, errors.New("auth: client token issuer is required and must differ from the jwt issuer")
+		}
+
+		keys = append(keys, verifierKey{key: c.Key, issuer: c.Issuer, kind: KindClient})
+	}
+
+	methods := make(map[string]bool)
+	for _, k := range keys {
+		switch k.key.Algorithm {
+		case HS256, RS256, ES256:
+			methods[k.key.Algorithm] = true
+		default:
+			return nil, fmt.Errorf("auth: unsupported jwt algorithm %q", k.key.Algorithm)
+		}
+	}
+
+	valid := make([]string, 0, len(methods))
+	for m := range methods {
+		valid = append(valid, m)
+	}
+
+	return &JWTVerifier{
+		opts: opts,
+		keys: keys,
+		parser: jwt.NewParser(
+			jwt.WithValidMethods(valid),
+			jwt.WithLeeway(opts.Leeway),
+		),
+	}, nil
+}
+
+func (v *JWTVerifier) Scheme() string {
+	return "Bearer"
+}
+
+// Claims are the claims read from a token. Scope holds space separated
+// scopes as defined by RFC 8693. Kind is not a claim, as anyone the issuer
+// lets set claims could claim any kind: Verify sets it from the key that
+// verified the token.
+type Claims struct {
+	jwt.RegisteredClaims
+	Scope string `json:"scope,omitempty"`
+	Kind  Kind   `json:"-"`
+}
+
+func (v *JWTVerifier) Authenticate(ctx context.Context, token string) (*Principal, error) {
+	claims, err := v.Verify(token)
+	if err != nil {
+		return nil, err
+	}
+
+	if claims.Kind == KindClient && v.opts.Clients.Resolver != nil {
+		active, err := v.opts.Clients.Resolver.ClientActive(ctx, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+
+		if !active {
+			return nil, fmt.Errorf("%w: client is revoked", ErrUnauthenticated)
+		}
+	}
+
+	return &Principal{
+		Subject: claims.Subject,
+		Kind:    claims.Kind,
+		Scopes:  strings.Fields(claims.Scope),
+	}, nil
+}
+
+// Verify checks the signature and claims of a token and returns its
+// claims. It does not check whether the client of a client token was
+// revoked. Errors wrap ErrUnauthenticated.
+func (v *JWTVerifier) Verify(token string) (*Claims, error) {
+	var (
+		claims Claims
+		key    *verifierKey
+	)
+
+	_, err := v.parser.ParseWithClaims(token, &claims, func(t *jwt.Token) (interface{}, error) {
+		var err error
+		if key, err = v.key(t); err != nil {
+			return nil, err
+		}
+
+		return key.key.Key, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthenticated, err)
+	}
+
+	if claims.ExpiresAt == nil {
+		return nil, fmt.Errorf("%w: token has no exp claim", ErrUnauthenticated)
+	}
+
+	if claims.Subject == "" {
+		return nil, fmt.Errorf("%w: token has no sub claim", ErrUnauthenticated)
+	}
+
+	if !v.audienceAllowed(claims.Audience) {
+		return nil, fmt.Errorf("%w: token has invalid audience", ErrUnauthenticated)
+	}
+
+	claims.Kind = key.kind
+
+	return &claims, nil
+}
+
+// key selects the verification key by the iss claim and the kid header.
+// Only the keys of the issuer are candidates, so that a token signed with
+// the key of one issuer cannot claim to be of the other. Tokens without
+// kid are accepted when exactly one of them uses their algorithm. The key
+// must be of the algorithm in the header, which prevents algorithm
+// confusion.
+func (v *JWTVerifier) key(t *jwt.Token) (*verifierKey, error) {
+	alg := t.Method.Alg()
+	kid, _ := t.Header["kid"].(string)
+
+	iss, err := t.Claims.GetIssuer()
+	if err != nil {
+		return nil, err
+	}
+
+	var found *verifierKey
+	for i, k := range v.keys {
+		if k.issuer != iss || k.key.Algorithm != alg || (kid != "" && k.key.ID != kid) {
+			continue
+		}
+
+		if found != nil {
+			return nil, errors.New("token does not identify its key")
+		}
+
+		found = &v.keys[i]
+	}
+
+	if found == nil {
+		return nil, errors.New("no key matches the token")
+	}
+
+	return found, nil
+}
+
+func (v *JWTVerifier) audienceAllowed(aud jwt.ClaimStrings) bool {
+	for _, a := range aud {
+		for _, allowed := range v.opts.Audience {
+			if a == allowed {
+				return true
+			}
+		}
+	}
+
+	return false
+}
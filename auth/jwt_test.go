@@ -0,0 +1,455 @@
+package auth
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer   = "https://x-api.test"
+	testAudience = "x-api"
+)
+
+var testSecret = []byte("0123456789abcdef0123456789abcdef")
+
+type testKeys struct {
+	rsa   *rsa.PrivateKey
+	ecdsa *ecdsa.PrivateKey
+}
+
+func newTestKeys(t *testing.T) testKeys {
+	t.Helper()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return testKeys{rsa: rsaKey, ecdsa: ecKey}
+}
+
+func (k testKeys) verifier(t *testing.T) *JWTVerifier {
+	t.Helper()
+
+	v, err := NewJWTVerifier(JWTOptions{
+		Keys: []Key{
+			{ID: "hs", Algorithm: HS256, Key: testSecret},
+			{ID: "rs", Algorithm: RS256, Key: &k.rsa.PublicKey},
+			{ID: "es", Algorithm: ES256, Key: &k.ecdsa.PublicKey},
+		},
+		Issuer:   testIssuer,
+		Audience: []string{testAudience, "other"},
+		Leeway:   time.Minute,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return v
+}
+
+// sign signs claims with key, setting kid unless it is empty.
+func sign(t *testing.T, method jwt.SigningMethod, kid string, key interface{}, claims jwt.Claims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+
+	s, err := token.SignedString(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+func validClaims() jwt.MapClaims {
+	now := time.Now()
+
+	return jwt.MapClaims{
+		"iss":   testIssuer,
+		"aud":   []string{testAudience},
+		"sub":   "user-1",
+		"exp":   now.Add(time.Hour).Unix(),
+		"iat":   now.Unix(),
+		"scope": "users:read users:write",
+	}
+}
+
+func with(claims jwt.MapClaims, key string, value interface{}) jwt.MapClaims {
+	c := jwt.MapClaims{}
+	for k, v := range claims {
+		c[k] = v
+	}
+
+	if value == nil {
+		delete(c, key)
+	} else {
+		c[key] = value
+	}
+
+	return c
+}
+
+func TestJWTVerifierAuthenticate(t *testing.T) {
+	keys := newTestKeys(t)
+	v := keys.verifier(t)
+
+	rsaPublic, err := x509.MarshalPKIXPublicKey(&keys.rsa.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rsaPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: rsaPublic})
+	past := time.Now().Add(-time.Hour).Unix()
+	future := time.Now().Add(time.Hour).Unix()
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr bool
+	}{
+		{
+			name:  "HS256",
+			token: sign(t, jwt.SigningMethodHS256, "hs", testSecret, validClaims()),
+		},
+		{
+			name:  "RS256",
+			token: sign(t, jwt.SigningMethodRS256, "rs", keys.rsa, validClaims()),
+		},
+		{
+			name:  "ES256",
+			token: sign(t, jwt.SigningMethodES256, "es", keys.ecdsa, validClaims()),
+		},
+		{
+			name:  "without kid",
+			token: sign(t, jwt.SigningMethodRS256, "", keys.rsa, validClaims()),
+		},
+		{
+			name:  "one of the audiences",
+			token: sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "aud", []string{"unknown", "other"})),
+		},
+		{
+			name:  "expired within leeway",
+			token: sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "exp", time.Now().Add(-30*time.Second).Unix())),
+		},
+		{
+			name:    "HS256 signed with the RSA public key",
+			token:   sign(t, jwt.SigningMethodHS256, "rs", rsaPEM, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "HS256 signed with the RSA public key without kid",
+			token:   sign(t, jwt.SigningMethodHS256, "", rsaPEM, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "none",
+			token:   sign(t, jwt.SigningMethodNone, "", jwt.UnsafeAllowNoneSignatureType, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "unsupported algorithm",
+			token:   sign(t, jwt.SigningMethodHS512, "hs", testSecret, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "kid of another key",
+			token:   sign(t, jwt.SigningMethodRS256, "es", keys.rsa, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "unknown kid",
+			token:   sign(t, jwt.SigningMethodHS256, "gone", testSecret, validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "wrong secret",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", []byte("fedcba9876543210fedcba9876543210"), validClaims()),
+			wantErr: true,
+		},
+		{
+			name:    "wrong issuer",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "iss", "https://evil.test")),
+			wantErr: true,
+		},
+		{
+			name:    "no issuer",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "iss", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "wrong audience",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "aud", []string{"unknown"})),
+			wantErr: true,
+		},
+		{
+			name:    "no audience",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "aud", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "exp", past)),
+			wantErr: true,
+		},
+		{
+			name:    "no expiry",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "exp", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "not yet valid",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "nbf", future)),
+			wantErr: true,
+		},
+		{
+			name:    "no subject",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "sub", nil)),
+			wantErr: true,
+		},
+		{
+			name:    "malformed",
+			token:   "not.a.token",
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Authenticate(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Authenticate() error = %v, want ErrUnauthenticated", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if p.Subject != "user-1" || p.Kind != KindUser || !p.HasScope("users:write") {
+				t.Errorf("Authenticate() = %+v", p)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierKindClaim(t *testing.T) {
+	v := newTestKeys(t).verifier(t)
+
+	// Only the verifying key decides the kind of the principal.
+	for _, kind := range []Kind{KindOperator, KindClient, KindAPIKey} {
+		t.Run(string(kind), func(t *testing.T) {
+			token := sign(t, jwt.SigningMethodHS256, "hs", testSecret, with(validClaims(), "kind", string(kind)))
+
+			p, err := v.Authenticate(context.Background(), token)
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if p.Kind != KindUser {
+				t.Errorf("Authenticate() kind = %q, want %q", p.Kind, KindUser)
+			}
+		})
+	}
+}
+
+func TestJWTSignerRoundTrip(t *testing.T) {
+	keys := newTestKeys(t)
+	v := keys.verifier(t)
+
+	tests := []struct {
+		name string
+		key  Key
+	}{
+		{name: "HS256", key: Key{ID: "hs", Algorithm: HS256, Key: testSecret}},
+		{name: "RS256", key: Key{ID: "rs", Algorithm: RS256, Key: keys.rsa}},
+		{name: "ES256", key: Key{ID: "es", Algorithm: ES256, Key: keys.ecdsa}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, err := NewJWTSigner(tt.key, testIssuer, []string{testAudience})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			token, err := s.Sign(Claims{
+				RegisteredClaims: jwt.RegisteredClaims{
+					Subject:   "user-1",
+					ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+				},
+				Scope: "users:read",
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			claims, err := v.Verify(token)
+			if err != nil {
+				t.Fatalf("Verify() error = %v", err)
+			}
+
+			if claims.Subject != "user-1" || claims.Scope != "users:read" || claims.Kind != KindUser {
+				t.Errorf("Verify() = %+v", claims)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifier(t *testing.T) {
+	key := Key{ID: "hs", Algorithm: HS256, Key: testSecret}
+
+	tests := []struct {
+		name    string
+		opts    JWTOptions
+		wantErr bool
+	}{
+		{name: "valid", opts: JWTOptions{Keys: []Key{key}, Issuer: testIssuer, Audience: []string{testAudience}}},
+		{name: "no keys", opts: JWTOptions{Issuer: testIssuer, Audience: []string{testAudience}}, wantErr: true},
+		{name: "no issuer", opts: JWTOptions{Keys: []Key{key}, Audience: []string{testAudience}}, wantErr: true},
+		{name: "no audience", opts: JWTOptions{Keys: []Key{key}, Issuer: testIssuer}, wantErr: true},
+		{
+			name:    "unsupported algorithm",
+			opts:    JWTOptions{Keys: []Key{{ID: "hs", Algorithm: "HS512", Key: testSecret}}, Issuer: testIssuer, Audience: []string{testAudience}},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewJWTVerifier(tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("NewJWTVerifier() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+type clientResolver map[string]bool
+
+func (r clientResolver) ClientActive(_ context.Context, clientID string) (bool, error) {
+	return r[clientID], nil
+}
+
+func TestJWTVerifierClientTokens(t *testing.T) {
+	const clientIssuer = "https://x-api.test/oauth"
+
+	clientSecret := []byte("fedcba9876543210fedcba9876543210")
+
+	v, err := NewJWTVerifier(JWTOptions{
+		Keys:     []Key{{ID: "hs", Algorithm: HS256, Key: testSecret}},
+		Issuer:   testIssuer,
+		Audience: []string{testAudience},
+		Clients: &ClientTokens{
+			Key:      Key{ID: "oauth", Algorithm: HS256, Key: clientSecret},
+			Issuer:   clientIssuer,
+			Resolver: clientResolver{"client-1": true, "client-2": false},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	client := func(sub string) jwt.MapClaims {
+		return with(with(validClaims(), "iss", clientIssuer), "sub", sub)
+	}
+
+	tests := []struct {
+		name     string
+		token    string
+		wantKind Kind
+		wantErr  bool
+	}{
+		{
+			name:     "user token",
+			token:    sign(t, jwt.SigningMethodHS256, "hs", testSecret, validClaims()),
+			wantKind: KindUser,
+		},
+		{
+			name:     "client token",
+			token:    sign(t, jwt.SigningMethodHS256, "oauth", clientSecret, client("client-1")),
+			wantKind: KindClient,
+		},
+		{
+			name:     "client token without kid",
+			token:    sign(t, jwt.SigningMethodHS256, "", clientSecret, client("client-1")),
+			wantKind: KindClient,
+		},
+		{
+			name:    "revoked client",
+			token:   sign(t, jwt.SigningMethodHS256, "oauth", clientSecret, client("client-2")),
+			wantErr: true,
+		},
+		{
+			name:    "unknown client",
+			token:   sign(t, jwt.SigningMethodHS256, "oauth", clientSecret, client("client-3")),
+			wantErr: true,
+		},
+		{
+			name:    "user key claiming the client issuer",
+			token:   sign(t, jwt.SigningMethodHS256, "hs", testSecret, client("client-1")),
+			wantErr: true,
+		},
+		{
+			name:    "client key claiming the user issuer",
+			token:   sign(t, jwt.SigningMethodHS256, "oauth", clientSecret, validClaims()),
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Authenticate(context.Background(), tt.token)
+			if tt.wantErr {
+				if !errors.Is(err, ErrUnauthenticated) {
+					t.Errorf("Authenticate() error = %v, want ErrUnauthenticated", err)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Authenticate() error = %v", err)
+			}
+
+			if p.Kind != tt.wantKind {
+				t.Errorf("Authenticate() kind = %q, want %q", p.Kind, tt.wantKind)
+			}
+		})
+	}
+}
+
+func TestNewJWTVerifierClientIssuer(t *testing.T) {
+	for _, issuer := range []string{"", testIssuer} {
+		_, err := NewJWTVerifier(JWTOptions{
+			Keys:     []Key{{ID: "hs", Algorithm: HS256, Key: testSecret}},
+			Issuer:   testIssuer,
+			Audience: []string{testAudience},
+			Clients:  &ClientTokens{Key: Key{ID: "oauth", Algorithm: HS256, Key: testSecret}, Issuer: issuer},
+		})
+		if err == nil {
+			t.Errorf("NewJWTVerifier() with client issuer %q succeeded, want an error", issuer)
+		}
+	}
+}
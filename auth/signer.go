@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// JWTSigner issues tokens. A JWTVerifier with the matching key, issuer and
+// audience accepts them.
+type JWTSigner struct {
+	key      Key
+	method   jwt.SigningMethod
+	issuer   string
+	audience []string
+}
+
+// NewJWTSigner returns a signer for key, whose Key holds a []byte secret for
+// HS256, an *rsa.PrivateKey for RS256 and an *ecdsa.PrivateKey for ES256.
+func NewJWTSigner(key Key, issuer string, audience []string) (*JWTSigner, error) {
+	if issuer == "" || len(audience) == 0 {
+		return nil, errors.New("auth: jwt issuer and audience are required")
+	}
+
+	var method jwt.SigningMethod
+	switch key.Algorithm {
+	case HS256:
+		method = jwt.SigningMethodHS256
+	case RS256:
+		method = jwt.SigningMethodRS256
+	case ES256:
+		method = jwt.SigningMethodES256
+	default:
+		return nil, fmt.Errorf("auth: unsupported jwt algorithm %q", key.Algorithm)
+	}
+
+	return &JWTSigner{
+		key:      key,
+		method:   method,
+		issuer:   issuer,
+		audience: audience,
+	}, nil
+}
+
+func (s *JWTSigner) Issuer() string {
+	return s.issuer
+}
+
+// Sign returns a signed token carrying claims, with the issuer and audience
+// of the signer.
+func (s *JWTSigner) Sign(claims Claims) (string, error) {
+	claims.Issuer = s.issuer
+	claims.Audience = s.audience
+
+	t := jwt.NewWithClaims(s.method, claims)
+	if s.key.ID != "" {
+		t.Header["kid"] = s.key.ID
+	}
+
+	return t.SignedString(s.key.Key)
+}
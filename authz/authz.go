@@ -0,0 +1,273 @@
+// Package authz decides whether an authenticated principal may perform an
+// action.
+//
+// Permissions have the form resource:action, such as users:read. Users are
+// granted the permissions of the roles their groups hold. Other principals
+// are granted their scopes, so an API key created with the scope users:read
+// may read users. Operators, whose credentials come from the configuration,
+// are granted everything.
+//
+// The decisions made for a user are cached per user and permission for
+// CacheTTL, along with the roles they were made from. Forget drops them
+// when the roles of the user change. API keys and clients need no cache,
+// as their scopes come with the principal.
+//
+// Cache entries of a user are scoped to a generation, which Forget starts
+// anew. A request that resolved the roles before a change can then only
+// cache its outdated decision in a generation no longer read.
+package authz
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/google/uuid"
+)
+
+// DefaultCacheTTL bounds how long a change to the roles of a group takes to
+// affect its members.
+const DefaultCacheTTL = time.Minute
+
+// RoleResolver returns the roles a user holds.
+type RoleResolver interface {
+	UserRoles(ctx context.Context, userID string) ([]string, error)
+}
+
+type Options struct {
+	// Roles maps role names to the permissions they grant.
+	Roles    map[string][]string
+	Resolver RoleResolver
+	Cache    caching.Cache
+	CacheTTL time.Duration
+	Logger   logging.Logger
+}
+
+type Authorizer struct {
+	roles    map[string][]string
+	resolver RoleResolver
+	cache    caching.Cache
+	ttl      time.Duration
+	logger   logging.Logger
+	// version identifies the role definitions, so that instances
+	// configured differently do not share decisions.
+	version string
+}
+
+func New(opts Options) *Authorizer {
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+
+	return &Authorizer{
+		roles:    opts.Roles,
+		resolver: opts.Resolver,
+		cache:    opts.Cache,
+		ttl:      opts.CacheTTL,
+		logger:   opts.Logger,
+		version:  rolesVersion(opts.Roles),
+	}
+}
+
+// rolesVersion returns a digest of role definitions.
+func rolesVersion(roles map[string][]string) string {
+	names := make([]string, 0, len(roles))
+	for name := range roles {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	h := sha256.New()
+	for _, name := range names {
+		h.Write([]byte(name + "=" + strings.Join(roles[name], " ") + "\n"))
+	}
+
+	return hex.EncodeToString(h.Sum(nil))[:12]
+}
+
+// HasRole reports whether role is defined.
+func (a *Authorizer) HasRole(role string) bool {
+	_, ok := a.roles[role]
+
+	return ok
+}
+
+// Allowed reports whether p was granted permission.
+func (a *Authorizer) Allowed(ctx context.Context, p *auth.Principal, permission string) (bool, error) {
+	switch p.Kind {
+	case auth.KindOperator:
+		return true, nil
+	case auth.KindUser:
+	default:
+		return allowed(p.Scopes, permission), nil
+	}
+
+	gen := a.generation(ctx, p.Subject)
+
+	key := a.cacheKey(p.Subject, gen, "decision:"+permission)
+	if v, ok := a.cached(ctx, gen, key); ok {
+		return v == "1", nil
+	}
+
+	roles, err := a.userRoles(ctx, p.Subject, gen)
+	if err != nil {
+		return false, err
+	}
+
+	var granted []string
+	for _, role := range roles {
+		granted = append(granted, a.roles[role]...)
+	}
+
+	ok := allowed(granted, permission)
+
+	v := "0"
+	if ok {
+		v = "1"
+	}
+
+	a.store(ctx, gen, key, v)
+
+	return ok, nil
+}
+
+func allowed(granted []string, permission string) bool {
+	for _, g := range granted {
+		if Match(g, permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Match reports whether the granted permission covers permission.
+func Match(granted, permission string) bool {
+	if granted == "*" || granted == permission {
+		return true
+	}
+
+	resource, action, ok := strings.Cut(granted, ":")
+	if !ok || action != "*" {
+		return false
+	}
+
+	return strings.HasPrefix(permission, resource+":")
+}
+
+// Forget drops the cached roles and decisions of a user, so that a change
+// to its roles takes effect on the next request.
+func (a *Authorizer) Forget(ctx context.Context, userID string) error {
+	if a.cache == nil {
+		return nil
+	}
+
+	return a.cache.Delete(ctx, generationKey(userID))
+}
+
+func generationKey(userID string) string {
+	return "authz:user:" + userID
+}
+
+func (a *Authorizer) cacheKey(userID, gen, name string) string {
+	return "authz:user:" + userID + ":" + gen + ":" + a.version + ":" + name
+}
+
+// generation returns the current cache generation of a user, starting one
+// when there is none. It returns "" when the cache is unavailable, which
+// disables caching for the request.
+func (a *Authorizer) generation(ctx context.Context, userID string) string {
+	if a.cache == nil {
+		return ""
+	}
+
+	for i := 0; i < 2; i++ {
+		gen, err := a.cache.Get(ctx, generationKey(userID))
+		if err == nil {
+			return gen
+		}
+
+		if !errors.Is(err, caching.ErrMiss) {
+			logging.FromContext(ctx, a.logger).Error(err)
+			return ""
+		}
+
+		gen = uuid.NewString()
+
+		added, err := a.cache.Add(ctx, generationKey(userID), gen, a.ttl)
+		if err != nil {
+			logging.FromContext(ctx, a.logger).Error(err)
+			return ""
+		}
+
+		// Another request started a generation first, which the next
+		// iteration reads.
+		if added {
+			return gen
+		}
+	}
+
+	return ""
+}
+
+// cached reads key in generation gen. Cache failures are logged and
+// treated as misses.
+func (a *Authorizer) cached(ctx context.Context, gen, key string) (string, bool) {
+	if gen == "" {
+		return "", false
+	}
+
+	v, err := a.cache.Get(ctx, key)
+	if err != nil {
+		if !errors.Is(err, caching.ErrMiss) {
+			logging.FromContext(ctx, a.logger).Error(err)
+		}
+
+		return "", false
+	}
+
+	return v, true
+}
+
+func (a *Authorizer) store(ctx context.Context, gen, key, value string) {
+	if gen == "" {
+		return
+	}
+
+	if err := a.cache.Set(ctx, key, value, a.ttl); err != nil {
+		logging.FromContext(ctx, a.logger).Error(err)
+	}
+}
+
+// userRoles reads the roles of a user from the cache, falling back to the
+// resolver.
+func (a *Authorizer) userRoles(ctx context.Context, userID, gen string) ([]string, error) {
+	key := a.cacheKey(userID, gen, "roles")
+
+	if v, ok := a.cached(ctx, gen, key); ok {
+		var roles []string
+		if err := json.Unmarshal([]byte(v), &roles); err == nil {
+			return roles, nil
+		}
+	}
+
+	roles, err := a.resolver.UserRoles(ctx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if b, err := json.Marshal(roles); err == nil {
+		a.store(ctx, gen, key, string(b))
+	}
+
+	return roles, nil
+}
@@ -0,0 +1,287 @@
+package authz
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/caching"
+)
+
+func TestMatch(t *testing.T) {
+	tests := []struct {
+		granted    string
+		permission string
+		want       bool
+	}{
+		{"*", "users:read", true},
+		{"users:read", "users:read", true},
+		{"users:*", "users:read", true},
+		{"users:*", "users:admin", true},
+		{"users:read", "users:write", false},
+		{"users:*", "groups:read", false},
+		{"users:*", "users", false},
+		{"user:*", "users:read", false},
+		{"users", "users:read", false},
+		{"*:read", "users:read", false},
+		{"", "users:read", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.granted+" "+tt.permission, func(t *testing.T) {
+			if got := Match(tt.granted, tt.permission); got != tt.want {
+				t.Errorf("Match(%q, %q) = %v, want %v", tt.granted, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+type roleResolver struct {
+	mu    sync.Mutex
+	roles map[string][]string
+	calls int
+	// resolved, when set, runs once after the roles of a user were read.
+	resolved func()
+}
+
+func (r *roleResolver) UserRoles(_ context.Context, userID string) ([]string, error) {
+	r.mu.Lock()
+	r.calls++
+	roles, resolved := r.roles[userID], r.resolved
+	r.resolved = nil
+	r.mu.Unlock()
+
+	if userID == "broken" {
+		return nil, errors.New("database is down")
+	}
+
+	if resolved != nil {
+		resolved()
+	}
+
+	return roles, nil
+}
+
+func (r *roleResolver) set(userID string, roles []string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.roles[userID] = roles
+}
+
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: make(map[string]string)}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.values[key]
+	if !ok {
+		return "", caching.ErrMiss
+	}
+
+	return v, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+
+	return nil
+}
+
+func (c *memoryCache) Add(ctx context.Context, key, value string, dur time.Duration) (bool, error) {
+	if _, err := c.Get(ctx, key); err == nil {
+		return false, nil
+	}
+
+	return true, c.Set(ctx, key, value, dur)
+}
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+var testRoles = map[string][]string{
+	"admin":  {"*"},
+	"editor": {"users:*", "groups:read"},
+	"viewer": {"users:read"},
+}
+
+func TestAllowed(t *testing.T) {
+	a := New(Options{
+		Roles: testRoles,
+		Resolver: &roleResolver{roles: map[string][]string{
+			"alice": {"admin"},
+			"bob":   {"viewer", "editor"},
+			"carol": {"viewer", "gone"},
+		}},
+	})
+
+	var (
+		alice    = &auth.Principal{Subject: "alice", Kind: auth.KindUser}
+		bob      = &auth.Principal{Subject: "bob", Kind: auth.KindUser}
+		carol    = &auth.Principal{Subject: "carol", Kind: auth.KindUser}
+		dave     = &auth.Principal{Subject: "dave", Kind: auth.KindUser}
+		operator = &auth.Principal{Subject: "ops", Kind: auth.KindOperator}
+		apiKey   = &auth.Principal{Subject: "key-1", Kind: auth.KindAPIKey, Scopes: []string{"users:read"}}
+		client   = &auth.Principal{Subject: "client-1", Kind: auth.KindClient, Scopes: []string{"groups:*"}}
+		scoped   = &auth.Principal{Subject: "bob", Kind: auth.KindUser, Scopes: []string{"*"}}
+	)
+
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		permission string
+		want       bool
+	}{
+		{"admin role", alice, "roles:write", true},
+		{"one of the roles", bob, "users:write", true},
+		{"other of the roles", bob, "groups:read", true},
+		{"not granted by roles", bob, "groups:write", false},
+		{"undefined role", carol, "users:read", true},
+		{"undefined role grants nothing", carol, "users:write", false},
+		{"no roles", dave, "users:read", false},
+		{"operator", operator, "roles:write", true},
+		{"api key scope", apiKey, "users:read", true},
+		{"api key without scope", apiKey, "users:write", false},
+		{"client scope", client, "groups:write", true},
+		{"client without scope", client, "users:read", false},
+		// The scopes of users do not grant permissions, their roles do.
+		{"user scopes", scoped, "roles:write", false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := a.Allowed(context.Background(), tt.principal, tt.permission)
+			if err != nil {
+				t.Fatalf("Allowed() error = %v", err)
+			}
+
+			if got != tt.want {
+				t.Errorf("Allowed(%s, %q) = %v, want %v", tt.principal.Subject, tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowedResolverError(t *testing.T) {
+	a := New(Options{Roles: testRoles, Resolver: &roleResolver{}})
+
+	ok, err := a.Allowed(context.Background(), &auth.Principal{Subject: "broken", Kind: auth.KindUser}, "users:read")
+	if err == nil || ok {
+		t.Errorf("Allowed() = %v, %v, want an error", ok, err)
+	}
+}
+
+func TestCache(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		cache    = newMemoryCache()
+		resolver = &roleResolver{roles: map[string][]string{"bob": {"viewer"}}}
+		a        = New(Options{Roles: testRoles, Resolver: resolver, Cache: cache})
+		bob      = &auth.Principal{Subject: "bob", Kind: auth.KindUser}
+	)
+
+	steps := []struct {
+		name       string
+		roles      []string
+		forget     bool
+		resolved   func()
+		permission string
+		want       bool
+		wantCalls  int
+	}{
+		{name: "resolved", permission: "users:read", want: true, wantCalls: 1},
+		{name: "decision cached", permission: "users:read", want: true, wantCalls: 1},
+		{name: "roles cached", permission: "users:write", want: false, wantCalls: 1},
+		{name: "stale until forgotten", roles: []string{"editor"}, permission: "users:write", want: false, wantCalls: 1},
+		{name: "forgotten", forget: true, permission: "users:write", want: true, wantCalls: 2},
+		{name: "other decision forgotten", permission: "users:read", want: true, wantCalls: 2},
+		{
+			// The roles change after this request read them, so its decision
+			// is outdated and must not outlive it.
+			name:   "forgotten while resolving",
+			forget: true,
+			resolved: func() {
+				resolver.set("bob", nil)
+
+				if err := a.Forget(ctx, "bob"); err != nil {
+					t.Fatal(err)
+				}
+			},
+			permission: "groups:read",
+			want:       true,
+			wantCalls:  3,
+		},
+		{name: "after forgotten while resolving", permission: "groups:read", want: false, wantCalls: 4},
+	}
+
+	for _, s := range steps {
+		if s.roles != nil {
+			resolver.set("bob", s.roles)
+		}
+
+		if s.forget {
+			if err := a.Forget(ctx, "bob"); err != nil {
+				t.Fatalf("%s: Forget() error = %v", s.name, err)
+			}
+		}
+
+		resolver.mu.Lock()
+		resolver.resolved = s.resolved
+		resolver.mu.Unlock()
+
+		got, err := a.Allowed(ctx, bob, s.permission)
+		if err != nil {
+			t.Fatalf("%s: Allowed() error = %v", s.name, err)
+		}
+
+		if got != s.want {
+			t.Errorf("%s: Allowed(%q) = %v, want %v", s.name, s.permission, got, s.want)
+		}
+
+		if resolver.calls != s.wantCalls {
+			t.Errorf("%s: resolver called %d times, want %d", s.name, resolver.calls, s.wantCalls)
+		}
+	}
+}
+
+func TestCacheRoleDefinitions(t *testing.T) {
+	var (
+		ctx      = context.Background()
+		cache    = newMemoryCache()
+		resolver = &roleResolver{roles: map[string][]string{"bob": {"viewer"}}}
+		bob      = &auth.Principal{Subject: "bob", Kind: auth.KindUser}
+	)
+
+	before := New(Options{Roles: testRoles, Resolver: resolver, Cache: cache})
+	after := New(Options{Roles: map[string][]string{"viewer": {"users:read", "groups:read"}}, Resolver: resolver, Cache: cache})
+
+	if ok, err := before.Allowed(ctx, bob, "groups:read"); err != nil || ok {
+		t.Fatalf("Allowed() before = %v, %v, want false", ok, err)
+	}
+
+	// Instances with other role definitions share the cache but not the
+	// decisions.
+	if ok, err := after.Allowed(ctx, bob, "groups:read"); err != nil || !ok {
+		t.Errorf("Allowed() after = %v, %v, want true", ok, err)
+	}
+}
@@ -2,10 +2,21 @@ package caching
 
 import (
 	"context"
+	"errors"
 	"time"
 )
 
+// ErrMiss is returned by Get when the key is not cached. Providers
+// translate their own sentinel errors to it.
+var ErrMiss = errors.New("caching: cache miss")
+
 type Cache interface {
 	Get(ctx context.Context, key string) (string, error)
 	Set(ctx context.Context, key string, value string, dur time.Duration) error
+	// Add sets a key only if it is not cached yet, atomically, and reports
+	// whether it did.
+	Add(ctx context.Context, key string, value string, dur time.Duration) (bool, error)
+	// Delete removes a key. Deleting a key that is not cached is not an
+	// error.
+	Delete(ctx context.Context, key string) error
 }
@@ -2,9 +2,11 @@ package memcached
 
 import (
 	"context"
+	"errors"
 	"time"
 
 	"github.com/bradfitz/gomemcache/memcache"
+	"github.com/edalmi/x-api/caching"
 )
 
 func New(addr []string) (*Cache, error) {
@@ -17,16 +19,38 @@ type Cache struct {
 	client *memcache.Client
 }
 
+// maxRelativeExpiration is the longest expiration memcached reads as
+// relative. Longer ones must be given as a Unix time.
+const maxRelativeExpiration = 30 * 24 * time.Hour
+
 func (c Cache) Set(ctx context.Context, key, value string, expiration time.Duration) error {
 	return c.client.Set(&memcache.Item{
 		Key:        key,
 		Value:      []byte(value),
-		Expiration: int32(expiration),
+		Expiration: expirationSeconds(expiration),
 	})
 }
 
+// expirationSeconds converts an expiration to memcached's format: whole
+// seconds, or a Unix time beyond 30 days. Zero means no expiration, so
+// shorter positive durations are rounded up to a second.
+func expirationSeconds(d time.Duration) int32 {
+	switch {
+	case d <= 0:
+		return 0
+	case d > maxRelativeExpiration:
+		return int32(time.Now().Add(d).Unix())
+	default:
+		return int32((d + time.Second - 1) / time.Second)
+	}
+}
+
 func (c Cache) Get(ctx context.Context, key string) (string, error) {
 	value, err := c.client.Get(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return "", caching.ErrMiss
+	}
+
 	if err != nil {
 		return "", err
 	}
@@ -34,6 +58,28 @@ func (c Cache) Get(ctx context.Context, key string) (string, error) {
 	return string(value.Value), nil
 }
 
+func (c Cache) Add(ctx context.Context, key, value string, expiration time.Duration) (bool, error) {
+	err := c.client.Add(&memcache.Item{
+		Key:        key,
+		Value:      []byte(value),
+		Expiration: expirationSeconds(expiration),
+	})
+	if errors.Is(err, memcache.ErrNotStored) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (c Cache) Delete(ctx context.Context, key string) error {
+	err := c.client.Delete(key)
+	if errors.Is(err, memcache.ErrCacheMiss) {
+		return nil
+	}
+
+	return err
+}
+
 func (c Cache) Close() error {
 	return c.client.Close()
 }
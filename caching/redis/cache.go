@@ -2,8 +2,10 @@ package redis
 
 import (
 	"context"
+	"errors"
 	"time"
 
+	"github.com/edalmi/x-api/caching"
 	"github.com/redis/go-redis/v9"
 )
 
@@ -18,13 +20,32 @@ type Cache struct {
 }
 
 func (c Cache) Get(ctx context.Context, key string) (string, error) {
-	return c.client.Get(ctx, key).Result()
+	value, err := c.client.Get(ctx, key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", caching.ErrMiss
+	}
+
+	return value, err
 }
 
 func (c Cache) Set(ctx context.Context, key string, value string, expiration time.Duration) error {
 	return c.client.Set(ctx, key, value, expiration).Err()
 }
 
+func (c Cache) Add(ctx context.Context, key string, value string, expiration time.Duration) (bool, error) {
+	return c.client.SetNX(ctx, key, value, expiration).Result()
+}
+
+func (c Cache) Delete(ctx context.Context, key string) error {
+	return c.client.Del(ctx, key).Err()
+}
+
+// Client returns the client of the cache, for features such as rate
+// limiting that need more than caching.Cache.
+func (c Cache) Client() *redis.Client {
+	return c.client
+}
+
 func (c Cache) Close() error {
 	return c.client.Close()
 }
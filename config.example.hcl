@@ -10,24 +10,183 @@
 
 "db" "sqlite" {
   "path" = "/tmp/db.sqlite"
+  "batch_size" = 500
+}
+
+"prometheus" {
+  "namespace" = "xapi"
+  "duration_buckets" = [0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10]
+  "size_buckets" = [100, 1000, 10000, 100000, 1000000, 10000000]
 }
 
 "serve" "admin" {
   "host" = "0.0.0.0"
   "port" = 12340
+  "stack_traces" = false
+
+  "access_log" {
+    "sample_rate" = 1
+  }
+
+  "auth" "basic" {
+    "users" = ["admin:$2a$10$s.aoNHCbnlecuolJATWEqeRc72t/s5.6PTYkhjc/fmHfB0cj.GTvG"]
+  }
 }
 
 "serve" "metrics" {
   "host" = "0.0.0.0"
   "port" = 12341
+
+  "access_log" {
+    "exclude" = ["/metrics"]
+  }
 }
 
 "serve" "public" {
   "host" = "0.0.0.0"
   "port" = 12342
+  "stack_traces" = false
+
+  "access_log" {
+    "sample_rate" = 1
+  }
+
+  "auth" "jwt" {
+    "issuer" = "https://auth.example.com"
+    "audience" = ["x-api"]
+    "leeway" = "30s"
+
+    "keys" {
+      "id" = "dev"
+      "algorithm" = "HS256"
+      "secret" = "change-me-to-a-secret-of-at-least-32-bytes"
+    }
+  }
+
+  "auth" "api_keys" {
+    "cache_ttl" = "1m"
+  }
+
+  "auth" "oauth" {
+    "issuer" = "https://x-api.example.com"
+    "token_ttl" = "5m"
+
+    "key" {
+      "id" = "oauth"
+      "algorithm" = "HS256"
+      "secret" = "change-me-to-another-secret-of-at-least-32-bytes"
+    }
+  }
+
+  "sessions" {
+    "cookie_name" = "xapi_session"
+    "idle_timeout" = "30m"
+    "lifetime" = "12h"
+    "same_site" = "lax"
+  }
+
+  "cors" {
+    "allowed_origins" = [
+      "https://app.example.com",
+      "https://*.example.com",
+      "^https://pr-[0-9]+\\.preview\\.example\\.com$",
+    ]
+    "allowed_methods" = ["GET", "POST", "PUT", "PATCH", "DELETE"]
+    "allowed_headers" = [
+      "Authorization",
+      "Content-Type",
+      "If-Match",
+      "If-None-Match",
+      "Idempotency-Key",
+      "X-Request-ID",
+    ]
+    "exposed_headers" = [
+      "ETag",
+      "Link",
+      "Location",
+      "Retry-After",
+      "RateLimit-Limit",
+      "RateLimit-Remaining",
+      "RateLimit-Reset",
+      "Idempotent-Replayed",
+      "X-Request-ID",
+    ]
+    "allow_credentials" = true
+    "max_age" = "10m"
+  }
+
+  "idempotency" {
+    "ttl" = "24h"
+    "lock_timeout" = "1m"
+  }
+
+  "response_cache" {
+    "ttl" = "1m"
+  }
+
+  "rate_limit" {
+    "store" = "redis"
+    "requests" = 600
+    "period" = "1m"
+
+    "routes" {
+      "method" = "POST"
+      "path" = "/session"
+      "requests" = 10
+      "period" = "1m"
+    }
+
+    "routes" {
+      "method" = "POST"
+      "path" = "/oauth/token"
+      "requests" = 30
+      "period" = "1m"
+    }
+  }
 }
 
 "serve" "healthz" {
   "host" = "0.0.0.0"
   "port" = 12343
+
+  "access_log" {
+    "exclude" = ["/healthz/live", "/healthz/ready"]
+  }
+}
+
+"worker" "purge" {
+  "interval" = "1h"
+  "retention" = "720h"
+  "batch_size" = 500
+}
+
+"password" {
+  "algorithm" = "argon2id"
+
+  "argon2" {
+    "memory" = 65536
+    "iterations" = 3
+    "parallelism" = 2
+    "salt_length" = 16
+    "key_length" = 32
+  }
+
+  "bcrypt" {
+    "cost" = 12
+  }
+
+  "policy" {
+    "min_length" = 12
+    "max_length" = 128
+  }
+}
+
+"rbac" {
+  "cache_ttl" = "1m"
+
+  "roles" {
+    "viewer" = ["users:read", "groups:read"]
+    "editor" = ["users:read", "users:write", "groups:read", "groups:write"]
+    "admin" = ["*"]
+  }
 }
@@ -0,0 +1,29 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// AccessLog logs the requests of a server. SampleRate is the share of them
+// that is logged, from 0 to 1; unset, every request is. Server errors are
+// logged regardless. Requests for the paths in Exclude are never logged.
+type AccessLog struct {
+	SampleRate float64  `mapstructure:"sample_rate"`
+	Exclude    []string `mapstructure:"exclude"`
+}
+
+func (a AccessLog) Validate() error {
+	if a.SampleRate < 0 || a.SampleRate > 1 {
+		return errors.New("access log sample rate must be between 0 and 1")
+	}
+
+	for _, path := range a.Exclude {
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("access log excluded path %q must start with /", path)
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,176 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Auth configures how requests to a server are authenticated. Servers
+// without it accept anonymous requests, except for the routes of the public
+// server that require permissions, which refuse them.
+type Auth struct {
+	JWT     *JWT     `mapstructure:"jwt"`
+	Basic   *Basic   `mapstructure:"basic"`
+	APIKeys *APIKeys `mapstructure:"api_keys"`
+	OAuth   *OAuth   `mapstructure:"oauth"`
+}
+
+func (a Auth) Validate() error {
+	if a.JWT != nil {
+		if err := a.JWT.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if a.Basic != nil {
+		if err := a.Basic.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if a.APIKeys != nil {
+		if err := a.APIKeys.Validate(); err != nil {
+			return err
+		}
+	}
+
+	if a.OAuth != nil {
+		return a.OAuth.Validate(a.JWT)
+	}
+
+	return nil
+}
+
+// OAuth enables the OAuth token endpoint, which issues tokens for the client
+// credentials grant. Tokens are signed with Key and carry Issuer, both only
+// used for them, so that no other token can pass for a client token. They
+// are issued for the JWT audience and valid for TokenTTL, five minutes by
+// default.
+type OAuth struct {
+	Issuer   string        `mapstructure:"issuer"`
+	Key      JWTKey        `mapstructure:"key"`
+	TokenTTL time.Duration `mapstructure:"token_ttl"`
+}
+
+func (o OAuth) Validate(jwt *JWT) error {
+	if o.TokenTTL < 0 {
+		return errors.New("oauth token ttl must not be negative")
+	}
+
+	if jwt == nil {
+		return errors.New("oauth requires jwt authentication")
+	}
+
+	if o.Issuer == "" || o.Issuer == jwt.Issuer {
+		return errors.New("oauth issuer is required and must differ from the jwt issuer")
+	}
+
+	k := o.Key
+	if k.ID == "" {
+		return errors.New("oauth key id is required")
+	}
+
+	switch k.Algorithm {
+	case "HS256":
+		if len(k.Secret) < 32 {
+			return errors.New("oauth key: HS256 secret must be at least 32 bytes")
+		}
+	case "RS256", "ES256":
+		if k.PrivateKeyFile == "" {
+			return errors.New("oauth key: private key file is required")
+		}
+	default:
+		return fmt.Errorf("oauth key: unsupported algorithm %q", k.Algorithm)
+	}
+
+	for _, jk := range jwt.Keys {
+		if jk.ID == k.ID || (k.Secret != "" && jk.Secret == k.Secret) || (k.PrivateKeyFile != "" && jk.PrivateKeyFile == k.PrivateKeyFile) {
+			return fmt.Errorf("oauth key %q must not be a jwt key", k.ID)
+		}
+	}
+
+	return nil
+}
+
+// APIKeys enables authentication with API keys issued on the admin server.
+// CacheTTL is how long key lookups are cached; it defaults to a minute.
+type APIKeys struct {
+	CacheTTL time.Duration `mapstructure:"cache_ttl"`
+}
+
+func (k APIKeys) Validate() error {
+	if k.CacheTTL < 0 {
+		return errors.New("api keys cache ttl must not be negative")
+	}
+
+	return nil
+}
+
+// Basic configures HTTP Basic authentication. Users are htpasswd entries
+// with bcrypt hashes, as written by htpasswd -B, given inline, in
+// HtpasswdFile, or both.
+type Basic struct {
+	Users        []string `mapstructure:"users"`
+	HtpasswdFile string   `mapstructure:"htpasswd_file"`
+}
+
+func (b Basic) Validate() error {
+	if len(b.Users) == 0 && b.HtpasswdFile == "" {
+		return errors.New("basic auth users or htpasswd file are required")
+	}
+
+	return nil
+}
+
+// JWT configures bearer token authentication. Keys are read from Keys, from
+// the JSON Web Key Set in JWKSFile, or both.
+type JWT struct {
+	Issuer   string        `mapstructure:"issuer"`
+	Audience []string      `mapstructure:"audience"`
+	Leeway   time.Duration `mapstructure:"leeway"`
+	Keys     []JWTKey      `mapstructure:"keys"`
+	JWKSFile string        `mapstructure:"jwks_file"`
+}
+
+// JWTKey is a verification key. HS256 keys use Secret, RS256 and ES256
+// keys read a PEM encoded public key from PublicKeyFile, or derive it from
+// the PEM encoded private key in PrivateKeyFile.
+type JWTKey struct {
+	ID             string `mapstructure:"id"`
+	Algorithm      string `mapstructure:"algorithm"`
+	Secret         string `mapstructure:"secret"`
+	PublicKeyFile  string `mapstructure:"public_key_file"`
+	PrivateKeyFile string `mapstructure:"private_key_file"`
+}
+
+func (j JWT) Validate() error {
+	if j.Issuer == "" {
+		return errors.New("jwt issuer is required")
+	}
+
+	if len(j.Audience) == 0 {
+		return errors.New("jwt audience is required")
+	}
+
+	if len(j.Keys) == 0 && j.JWKSFile == "" {
+		return errors.New("jwt keys or jwks file are required")
+	}
+
+	for i, k := range j.Keys {
+		switch k.Algorithm {
+		case "HS256":
+			if len(k.Secret) < 32 {
+				return fmt.Errorf("jwt key %d: HS256 secret must be at least 32 bytes", i)
+			}
+		case "RS256", "ES256":
+			if k.PublicKeyFile == "" && k.PrivateKeyFile == "" {
+				return fmt.Errorf("jwt key %d: public or private key file is required", i)
+			}
+		default:
+			return fmt.Errorf("jwt key %d: unsupported algorithm %q", i, k.Algorithm)
+		}
+	}
+
+	return nil
+}
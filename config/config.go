@@ -50,6 +50,34 @@ func DefaultConfig() Config {
 				Port: portHealthz,
 			},
 		},
+		Worker: &Worker{
+			Purge: &Purge{
+				Interval:  defaultPurgeInterval,
+				Retention: defaultPurgeRetention,
+				BatchSize: defaultPurgeBatchSize,
+			},
+		},
+		Password: &Password{
+			Algorithm: "argon2id",
+			Argon2: &Argon2{
+				Memory:      defaultArgon2Memory,
+				Iterations:  defaultArgon2Iterations,
+				Parallelism: defaultArgon2Parallelism,
+				SaltLength:  defaultArgon2SaltLength,
+				KeyLength:   defaultArgon2KeyLength,
+			},
+			Bcrypt: &Bcrypt{
+				Cost: defaultBcryptCost,
+			},
+			Policy: &PasswordPolicy{
+				MinLength: defaultPasswordMinLength,
+				MaxLength: defaultPasswordMaxLength,
+			},
+		},
+		RBAC: &RBAC{
+			CacheTTL: defaultRBACCacheTTL,
+			Roles:    defaultRoles(),
+		},
 	}
 }
 
@@ -64,6 +92,9 @@ type Config struct {
 	DB         *DB         `mapstructure:"db"`
 	Prometheus *Prometheus `mapstructure:"prometheus"`
 	Otel       *Otel       `mapstructure:"otel"`
+	Worker     *Worker     `mapstructure:"worker"`
+	Password   *Password   `mapstructure:"password"`
+	RBAC       *RBAC       `mapstructure:"rbac"`
 }
 
 func (c Config) Validate() error {
@@ -75,6 +106,8 @@ func (c Config) Validate() error {
 		c.Queue,
 		c.DB,
 		c.Prometheus,
+		c.Password,
+		c.RBAC,
 	}
 
 	for _, i := range parts {
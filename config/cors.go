@@ -0,0 +1,97 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// CORS lets browsers call a server from other origins. AllowedOrigins lists
+// exact origins such as https://app.example.com, wildcard subdomains such as
+// https://*.example.com, regular expressions anchored with ^ and $, or * for
+// any origin. AllowedMethods defaults to GET, HEAD and POST. MaxAge is how
+// long browsers may cache the answers to preflight requests.
+type CORS struct {
+	AllowedOrigins   []string      `mapstructure:"allowed_origins"`
+	AllowedMethods   []string      `mapstructure:"allowed_methods"`
+	AllowedHeaders   []string      `mapstructure:"allowed_headers"`
+	ExposedHeaders   []string      `mapstructure:"exposed_headers"`
+	AllowCredentials bool          `mapstructure:"allow_credentials"`
+	MaxAge           time.Duration `mapstructure:"max_age"`
+}
+
+func (c CORS) Validate() error {
+	if len(c.AllowedOrigins) == 0 {
+		return errors.New("cors allowed origins must not be empty")
+	}
+
+	for _, origin := range c.AllowedOrigins {
+		if err := validateOrigin(origin); err != nil {
+			return err
+		}
+	}
+
+	// Browsers ignore * with credentials, and allowing every origin to send
+	// them would expose the sessions of users to any site.
+	if c.AllowCredentials {
+		for _, list := range [][]string{c.AllowedOrigins, c.AllowedMethods, c.AllowedHeaders, c.ExposedHeaders} {
+			for _, v := range list {
+				if v == "*" {
+					return errors.New("cors must not allow * with credentials")
+				}
+			}
+		}
+	}
+
+	for _, method := range c.AllowedMethods {
+		if method == "" || strings.ContainsAny(method, " ,") {
+			return fmt.Errorf("cors allowed method %q is invalid", method)
+		}
+	}
+
+	if c.MaxAge < 0 {
+		return errors.New("cors max age must not be negative")
+	}
+
+	return nil
+}
+
+func validateOrigin(origin string) error {
+	switch {
+	case origin == "*":
+		return nil
+	case origin == "null":
+		// Sandboxed documents and local files all share the null origin.
+		return errors.New("cors must not allow the null origin")
+	case strings.HasPrefix(origin, "^"):
+		if !strings.HasSuffix(origin, "$") {
+			return fmt.Errorf("cors origin pattern %q must be anchored with ^ and $", origin)
+		}
+
+		if _, err := regexp.Compile(origin); err != nil {
+			return fmt.Errorf("cors origin pattern %q: %w", origin, err)
+		}
+
+		return nil
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" ||
+		u.Path != "" || u.RawQuery != "" || u.Fragment != "" || u.User != nil {
+		return fmt.Errorf("cors origin %q must be a scheme and a host", origin)
+	}
+
+	if strings.Contains(u.Host, "*") {
+		// Only a whole leftmost label may be a wildcard, and not of a top
+		// level domain.
+		rest := strings.TrimPrefix(u.Hostname(), "*.")
+		if !strings.HasPrefix(u.Host, "*.") || strings.Contains(rest, "*") || (!strings.Contains(rest, ".") && rest != "localhost") {
+			return fmt.Errorf("cors origin %q may only have a wildcard subdomain of a domain", origin)
+		}
+	}
+
+	return nil
+}
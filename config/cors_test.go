@@ -0,0 +1,56 @@
+package config
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCORSValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		cors    CORS
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			cors: CORS{
+				AllowedOrigins:   []string{"https://app.example.com", "http://localhost:3000", "https://*.example.com", `^https://pr-[0-9]+\.example\.com$`},
+				AllowedMethods:   []string{"GET", "POST"},
+				AllowedHeaders:   []string{"Authorization"},
+				AllowCredentials: true,
+				MaxAge:           time.Hour,
+			},
+		},
+		{name: "any origin", cors: CORS{AllowedOrigins: []string{"*"}, AllowedHeaders: []string{"*"}}},
+		{name: "wildcard subdomain of localhost", cors: CORS{AllowedOrigins: []string{"http://*.localhost"}}},
+		{name: "no origins", cors: CORS{}, wantErr: true},
+		{name: "null origin", cors: CORS{AllowedOrigins: []string{"null"}}, wantErr: true},
+		{name: "no scheme", cors: CORS{AllowedOrigins: []string{"app.example.com"}}, wantErr: true},
+		{name: "other scheme", cors: CORS{AllowedOrigins: []string{"ftp://app.example.com"}}, wantErr: true},
+		{name: "path", cors: CORS{AllowedOrigins: []string{"https://app.example.com/"}}, wantErr: true},
+		{name: "query", cors: CORS{AllowedOrigins: []string{"https://app.example.com?a=b"}}, wantErr: true},
+		{name: "user", cors: CORS{AllowedOrigins: []string{"https://user@app.example.com"}}, wantErr: true},
+		{name: "wildcard inside a label", cors: CORS{AllowedOrigins: []string{"https://app-*.example.com"}}, wantErr: true},
+		{name: "wildcard below the leftmost label", cors: CORS{AllowedOrigins: []string{"https://app.*.example.com"}}, wantErr: true},
+		{name: "wildcard subdomain of a top level domain", cors: CORS{AllowedOrigins: []string{"https://*.com"}}, wantErr: true},
+		{name: "unanchored pattern", cors: CORS{AllowedOrigins: []string{`^https://.*\.example\.com`}}, wantErr: true},
+		{name: "malformed pattern", cors: CORS{AllowedOrigins: []string{`^https://(example\.com$`}}, wantErr: true},
+		{name: "any origin with credentials", cors: CORS{AllowedOrigins: []string{"*"}, AllowCredentials: true}, wantErr: true},
+		{
+			name:    "any header with credentials",
+			cors:    CORS{AllowedOrigins: []string{"https://app.example.com"}, AllowedHeaders: []string{"*"}, AllowCredentials: true},
+			wantErr: true,
+		},
+		{name: "empty method", cors: CORS{AllowedOrigins: []string{"*"}, AllowedMethods: []string{""}}, wantErr: true},
+		{name: "list of methods", cors: CORS{AllowedOrigins: []string{"*"}, AllowedMethods: []string{"GET, POST"}}, wantErr: true},
+		{name: "negative max age", cors: CORS{AllowedOrigins: []string{"*"}, MaxAge: -time.Second}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.cors.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
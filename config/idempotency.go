@@ -0,0 +1,22 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// Idempotency stores the responses of POST requests with an Idempotency-Key
+// header in the cache provider for TTL, so that retries are replayed rather
+// than run again. LockTimeout bounds how long a request holds its key.
+type Idempotency struct {
+	TTL         time.Duration `mapstructure:"ttl"`
+	LockTimeout time.Duration `mapstructure:"lock_timeout"`
+}
+
+func (i Idempotency) Validate() error {
+	if i.TTL < 0 || i.LockTimeout < 0 {
+		return errors.New("idempotency ttl and lock timeout must not be negative")
+	}
+
+	return nil
+}
@@ -3,12 +3,13 @@ package config
 import "errors"
 
 type MariaDB struct {
-	Path     string `mapstructure:"path"`
-	DSN      string `mapstructure:"dsn"`
-	DB       string `mapstructure:"db"`
-	Host     string `mapstructure:"host"`
-	Port     int    `mapstructure:"port"`
-	Password string `mapstructure:"password"`
+	Path      string `mapstructure:"path"`
+	DSN       string `mapstructure:"dsn"`
+	DB        string `mapstructure:"db"`
+	Host      string `mapstructure:"host"`
+	Port      int    `mapstructure:"port"`
+	Password  string `mapstructure:"password"`
+	BatchSize int    `mapstructure:"batch_size"`
 }
 
 func (p MariaDB) GetDSN() string {
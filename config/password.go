@@ -0,0 +1,76 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+)
+
+const (
+	defaultArgon2Memory      = 64 * 1024
+	defaultArgon2Iterations  = 3
+	defaultArgon2Parallelism = 2
+	defaultArgon2SaltLength  = 16
+	defaultArgon2KeyLength   = 32
+	defaultBcryptCost        = 12
+	defaultPasswordMinLength = 12
+	defaultPasswordMaxLength = 128
+)
+
+// Password configures how user passwords are hashed and which passwords are
+// accepted. Changing the algorithm or its parameters only affects new
+// hashes; existing ones are upgraded when users log in.
+type Password struct {
+	Algorithm string          `mapstructure:"algorithm"`
+	Argon2    *Argon2         `mapstructure:"argon2"`
+	Bcrypt    *Bcrypt         `mapstructure:"bcrypt"`
+	Policy    *PasswordPolicy `mapstructure:"policy"`
+}
+
+// Argon2 holds the argon2id parameters. Memory is in KiB.
+type Argon2 struct {
+	Memory      uint32 `mapstructure:"memory"`
+	Iterations  uint32 `mapstructure:"iterations"`
+	Parallelism uint8  `mapstructure:"parallelism"`
+	SaltLength  uint32 `mapstructure:"salt_length"`
+	KeyLength   uint32 `mapstructure:"key_length"`
+}
+
+type Bcrypt struct {
+	Cost int `mapstructure:"cost"`
+}
+
+type PasswordPolicy struct {
+	MinLength     int  `mapstructure:"min_length"`
+	MaxLength     int  `mapstructure:"max_length"`
+	RequireUpper  bool `mapstructure:"require_upper"`
+	RequireLower  bool `mapstructure:"require_lower"`
+	RequireDigit  bool `mapstructure:"require_digit"`
+	RequireSymbol bool `mapstructure:"require_symbol"`
+}
+
+func (p Password) Validate() error {
+	switch p.Algorithm {
+	case "argon2id":
+		if p.Argon2 == nil {
+			return errors.New("password argon2 parameters are missing")
+		}
+	case "bcrypt":
+		if p.Bcrypt == nil {
+			return errors.New("password bcrypt parameters are missing")
+		}
+	default:
+		return fmt.Errorf("unknown password algorithm %q", p.Algorithm)
+	}
+
+	if p.Policy != nil {
+		if p.Policy.MinLength < 1 {
+			return errors.New("password min length must be positive")
+		}
+
+		if p.Policy.MaxLength != 0 && p.Policy.MaxLength < p.Policy.MinLength {
+			return errors.New("password max length must not be less than min length")
+		}
+	}
+
+	return nil
+}
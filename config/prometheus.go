@@ -2,10 +2,30 @@ package config
 
 import "errors"
 
+// Prometheus configures the metrics of the servers. Namespace prefixes their
+// names and defaults to the app name. DurationBuckets and SizeBuckets are
+// the buckets of the HTTP request duration, in seconds, and response size,
+// in bytes, histograms.
 type Prometheus struct {
-	Namespace string `mapstructure:"namespace"`
+	Namespace       string    `mapstructure:"namespace"`
+	DurationBuckets []float64 `mapstructure:"duration_buckets"`
+	SizeBuckets     []float64 `mapstructure:"size_buckets"`
 }
 
 func (p Prometheus) Validate() error {
-	return errors.New("not implemented")
+	if !increasing(p.DurationBuckets) || !increasing(p.SizeBuckets) {
+		return errors.New("prometheus buckets must be positive and increasing")
+	}
+
+	return nil
+}
+
+func increasing(buckets []float64) bool {
+	for i, b := range buckets {
+		if b <= 0 || (i > 0 && b <= buckets[i-1]) {
+			return false
+		}
+	}
+
+	return true
 }
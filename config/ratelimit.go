@@ -0,0 +1,68 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// RateLimit limits the requests of every principal, or of every client IP
+// for anonymous requests. Requests and Period are the limit of routes that
+// no entry of Routes matches; without them those routes are not limited.
+// Store is memory, which limits each replica on its own, or redis, which
+// shares the limits through the redis cache provider. Authentication
+// limits the requests of every client IP before they are authenticated.
+type RateLimit struct {
+	Store          string                   `mapstructure:"store"`
+	Requests       int                      `mapstructure:"requests"`
+	Period         time.Duration            `mapstructure:"period"`
+	Routes         []RateLimitRoute         `mapstructure:"routes"`
+	Authentication *RateLimitAuthentication `mapstructure:"authentication"`
+}
+
+// RateLimitRoute is the limit of the requests whose path starts with Path
+// and, if set, whose method is Method. The longest matching path wins, and
+// of routes of the same path the one with a method.
+type RateLimitRoute struct {
+	Method   string        `mapstructure:"method"`
+	Path     string        `mapstructure:"path"`
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+}
+
+// RateLimitAuthentication throttles guessing credentials. It counts the
+// requests that carry credentials whether or not they are valid, so it must
+// allow for every client behind one address.
+type RateLimitAuthentication struct {
+	Requests int           `mapstructure:"requests"`
+	Period   time.Duration `mapstructure:"period"`
+}
+
+func (r RateLimit) Validate() error {
+	switch r.Store {
+	case "", "memory", "redis":
+	default:
+		return fmt.Errorf("rate limit store must be memory or redis, not %q", r.Store)
+	}
+
+	if r.Requests < 0 || r.Period < 0 || (r.Requests > 0) != (r.Period > 0) {
+		return errors.New("rate limit requests and period must both be positive or both be unset")
+	}
+
+	for _, route := range r.Routes {
+		if !strings.HasPrefix(route.Path, "/") {
+			return fmt.Errorf("rate limit route path %q must start with /", route.Path)
+		}
+
+		if route.Requests <= 0 || route.Period <= 0 {
+			return fmt.Errorf("rate limit route %q: requests and period must be positive", route.Path)
+		}
+	}
+
+	if a := r.Authentication; a != nil && (a.Requests <= 0 || a.Period <= 0) {
+		return errors.New("rate limit authentication requests and period must be positive")
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+const defaultRBACCacheTTL = time.Minute
+
+// RBAC maps the roles groups can hold to the permissions they grant.
+// Permissions have the form resource:action; resource:* grants every action
+// on a resource and * grants everything. Configured roles are added to the
+// default viewer, editor and admin roles, replacing those of the same name.
+type RBAC struct {
+	CacheTTL time.Duration       `mapstructure:"cache_ttl"`
+	Roles    map[string][]string `mapstructure:"roles"`
+}
+
+func (r RBAC) Validate() error {
+	if r.CacheTTL < 0 {
+		return errors.New("rbac cache ttl must not be negative")
+	}
+
+	for role, permissions := range r.Roles {
+		if role == "" || len(role) > 64 {
+			return fmt.Errorf("rbac role %q must be between 1 and 64 characters", role)
+		}
+
+		for _, p := range permissions {
+			if p != "*" && !strings.Contains(p, ":") {
+				return fmt.Errorf("rbac role %q: permission %q must have the form resource:action", role, p)
+			}
+		}
+	}
+
+	return nil
+}
+
+func defaultRoles() map[string][]string {
+	return map[string][]string{
+		"viewer": {"users:read", "groups:read"},
+		"editor": {"users:read", "users:write", "groups:read", "groups:write"},
+		"admin":  {"*"},
+	}
+}
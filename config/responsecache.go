@@ -0,0 +1,21 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+// ResponseCache caches the responses of GET /users/{id} and
+// GET /groups/{id} in the cache provider for TTL. Writes through the API
+// drop them, but changes made elsewhere show after up to TTL.
+type ResponseCache struct {
+	TTL time.Duration `mapstructure:"ttl"`
+}
+
+func (c ResponseCache) Validate() error {
+	if c.TTL < 0 {
+		return errors.New("response cache ttl must not be negative")
+	}
+
+	return nil
+}
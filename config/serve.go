@@ -12,12 +12,22 @@ type Servers struct {
 }
 
 type Server struct {
-	Host            string `mapstructure:"host"`
-	Port            int    `mapstructure:"port"`
-	TLS             *TLS   `mapstructure:"tls"`
-	ReadTimeout     int    `mapstructure:"read_timeout"`
-	WriteTimeout    int    `mapstructure:"write_timeout"`
-	ShutdownTimeout int    `mapstructure:"shutdown_timeout"`
+	Host            string         `mapstructure:"host"`
+	Port            int            `mapstructure:"port"`
+	TLS             *TLS           `mapstructure:"tls"`
+	ReadTimeout     int            `mapstructure:"read_timeout"`
+	WriteTimeout    int            `mapstructure:"write_timeout"`
+	ShutdownTimeout int            `mapstructure:"shutdown_timeout"`
+	Auth            *Auth          `mapstructure:"auth"`
+	Sessions        *Sessions      `mapstructure:"sessions"`
+	RateLimit       *RateLimit     `mapstructure:"rate_limit"`
+	Idempotency     *Idempotency   `mapstructure:"idempotency"`
+	ResponseCache   *ResponseCache `mapstructure:"response_cache"`
+	AccessLog       *AccessLog     `mapstructure:"access_log"`
+	CORS            *CORS          `mapstructure:"cors"`
+	// StackTraces returns the stacks of panics in their 500 responses. It
+	// is ignored outside of dev mode.
+	StackTraces bool `mapstructure:"stack_traces"`
 }
 
 func (s Server) Validate() error {
@@ -0,0 +1,36 @@
+package config
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// Sessions enables cookie sessions for browser clients. They are kept in
+// the cache provider, which must be configured. InsecureCookie lets the
+// cookie be sent over plain HTTP and is meant for development.
+type Sessions struct {
+	CookieName     string        `mapstructure:"cookie_name"`
+	IdleTimeout    time.Duration `mapstructure:"idle_timeout"`
+	Lifetime       time.Duration `mapstructure:"lifetime"`
+	SameSite       string        `mapstructure:"same_site"`
+	InsecureCookie bool          `mapstructure:"insecure_cookie"`
+}
+
+func (s Sessions) Validate() error {
+	if s.IdleTimeout < 0 || s.Lifetime < 0 {
+		return errors.New("session idle timeout and lifetime must not be negative")
+	}
+
+	if s.IdleTimeout > 0 && s.Lifetime > 0 && s.IdleTimeout > s.Lifetime {
+		return errors.New("session idle timeout must not exceed the lifetime")
+	}
+
+	switch s.SameSite {
+	case "", "lax", "strict":
+	default:
+		return fmt.Errorf("session same site must be lax or strict, not %q", s.SameSite)
+	}
+
+	return nil
+}
@@ -3,9 +3,10 @@ package config
 import "errors"
 
 type SQLite struct {
-	Path     string `mapstructure:"path"`
-	DSN      string `mapstructure:"dsn"`
-	InMemory string `mapstructure:"in-memory"`
+	Path      string `mapstructure:"path"`
+	DSN       string `mapstructure:"dsn"`
+	InMemory  string `mapstructure:"in-memory"`
+	BatchSize int    `mapstructure:"batch_size"`
 }
 
 func (p SQLite) GetDSN() string {
@@ -0,0 +1,39 @@
+package config
+
+import (
+	"errors"
+	"time"
+)
+
+const (
+	defaultPurgeInterval  = time.Hour
+	defaultPurgeRetention = 30 * 24 * time.Hour
+	defaultPurgeBatchSize = 500
+)
+
+type Worker struct {
+	Purge *Purge `mapstructure:"purge"`
+}
+
+// Purge configures the job that permanently removes soft deleted users.
+type Purge struct {
+	Interval  time.Duration `mapstructure:"interval"`
+	Retention time.Duration `mapstructure:"retention"`
+	BatchSize int           `mapstructure:"batch_size"`
+}
+
+func (p Purge) Validate() error {
+	if p.Interval <= 0 {
+		return errors.New("purge interval must be positive")
+	}
+
+	if p.Retention < 0 {
+		return errors.New("purge retention must not be negative")
+	}
+
+	if p.BatchSize <= 0 {
+		return errors.New("purge batch size must be positive")
+	}
+
+	return nil
+}
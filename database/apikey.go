@@ -0,0 +1,129 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/edalmi/x-api/pagination"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	apiKeyID        = pagination.Field{Name: "id"}
+	apiKeyName      = pagination.Field{Name: "name"}
+	apiKeyCreatedAt = pagination.Field{Name: "created_at", Type: pagination.Time}
+)
+
+// APIKeyPagination lists the fields API keys can be filtered and sorted by.
+var APIKeyPagination = pagination.Schema{
+	Key: apiKeyID,
+	Sorts: map[string]pagination.Field{
+		"id":         apiKeyID,
+		"name":       apiKeyName,
+		"created_at": apiKeyCreatedAt,
+	},
+	Filters: []pagination.Filter{
+		{Param: "name", Field: apiKeyName, Op: pagination.Eq},
+		{Param: "created_after", Field: apiKeyCreatedAt, Op: pagination.Gt},
+		{Param: "created_before", Field: apiKeyCreatedAt, Op: pagination.Lt},
+	},
+	DefaultSort: "created_at",
+}
+
+// APIKey is an issued API key. Only the hash of the key is stored; Prefix
+// is the visible part used to look the key up and to recognize it.
+type APIKey struct {
+	ID         string     `db:"id"`
+	Name       string     `db:"name"`
+	Prefix     string     `db:"prefix"`
+	KeyHash    string     `db:"key_hash"`
+	Scopes     string     `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	ExpiresAt  *time.Time `db:"expires_at"`
+	LastUsedAt *time.Time `db:"last_used_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+const apiKeyColumns = `id, name, prefix, key_hash, scopes, created_at, expires_at, last_used_at, revoked_at`
+
+func NewAPIKeyRepository(db *DB) *APIKeyRepository {
+	return &APIKeyRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+type APIKeyRepository struct {
+	db *DB
+	q  sqlx.ExtContext
+}
+
+func (r *APIKeyRepository) Create(ctx context.Context, k *APIKey) error {
+	query := r.db.Rebind(`
+		INSERT INTO api_keys (id, name, prefix, key_hash, scopes, created_at, expires_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`)
+
+	_, err := r.q.ExecContext(ctx, query, k.ID, k.Name, k.Prefix, k.KeyHash, k.Scopes, k.CreatedAt, k.ExpiresAt)
+
+	return r.db.translateError(err)
+}
+
+func (r *APIKeyRepository) Get(ctx context.Context, id string) (*APIKey, error) {
+	return r.get(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE id = ?`, id)
+}
+
+func (r *APIKeyRepository) GetByPrefix(ctx context.Context, prefix string) (*APIKey, error) {
+	return r.get(ctx, `SELECT `+apiKeyColumns+` FROM api_keys WHERE prefix = ?`, prefix)
+}
+
+func (r *APIKeyRepository) get(ctx context.Context, query, arg string) (*APIKey, error) {
+	var k APIKey
+	if err := sqlx.GetContext(ctx, r.q, &k, r.db.Rebind(query), arg); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return &k, nil
+}
+
+// List returns a page of API keys, revoked ones included, and the cursor of
+// the next page.
+func (r *APIKeyRepository) List(ctx context.Context, q *pagination.Query) ([]APIKey, string, error) {
+	query, args := q.Build(`SELECT ` + apiKeyColumns + ` FROM api_keys`)
+
+	keys := []APIKey{}
+	if err := sqlx.SelectContext(ctx, r.q, &keys, r.db.Rebind(query), args...); err != nil {
+		return nil, "", r.db.translateError(err)
+	}
+
+	return pagination.Paginate(q, keys)
+}
+
+// Revoke marks the key as revoked. Revoking a revoked key is a no-op.
+func (r *APIKeyRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	query := r.db.Rebind(`UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`)
+
+	res, err := r.q.ExecContext(ctx, query, at, id)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return r.db.translateError(exists(ctx, r.q, `SELECT 1 FROM api_keys WHERE id = ?`, id))
+	}
+
+	return nil
+}
+
+// Touch records that the key was used at the given time.
+func (r *APIKeyRepository) Touch(ctx context.Context, id string, at time.Time) error {
+	query := r.db.Rebind(`UPDATE api_keys SET last_used_at = ? WHERE id = ?`)
+
+	_, err := r.q.ExecContext(ctx, query, at, id)
+
+	return r.db.translateError(err)
+}
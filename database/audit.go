@@ -0,0 +1,107 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/edalmi/x-api/pagination"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	auditID         = pagination.Field{Name: "id"}
+	auditOccurredAt = pagination.Field{Name: "occurred_at", Type: pagination.Time}
+	auditActorID    = pagination.Field{Name: "actor_id"}
+	auditActorKind  = pagination.Field{Name: "actor_kind"}
+	auditRequestID  = pagination.Field{Name: "request_id"}
+	auditAction     = pagination.Field{Name: "action"}
+	auditResource   = pagination.Field{Name: "resource"}
+	auditOutcome    = pagination.Field{Name: "outcome"}
+)
+
+// AuditPagination lists the fields audit entries can be filtered and sorted
+// by. The newest entries come first by default.
+var AuditPagination = pagination.Schema{
+	Key: auditID,
+	Sorts: map[string]pagination.Field{
+		"occurred_at": auditOccurredAt,
+	},
+	Filters: []pagination.Filter{
+		{Param: "actor_id", Field: auditActorID, Op: pagination.Eq},
+		{Param: "actor_kind", Field: auditActorKind, Op: pagination.Eq},
+		{Param: "request_id", Field: auditRequestID, Op: pagination.Eq},
+		{Param: "action", Field: auditAction, Op: pagination.Eq},
+		{Param: "resource", Field: auditResource, Op: pagination.Eq},
+		{Param: "outcome", Field: auditOutcome, Op: pagination.Eq},
+		{Param: "occurred_after", Field: auditOccurredAt, Op: pagination.Gt},
+		{Param: "occurred_before", Field: auditOccurredAt, Op: pagination.Lt},
+	},
+	DefaultSort: "-occurred_at",
+}
+
+// AuditEntry is a row of the append-only audit log. Changes is the JSON
+// encoding of the changed fields, if any.
+type AuditEntry struct {
+	ID         string    `db:"id"`
+	OccurredAt time.Time `db:"occurred_at"`
+	ActorID    string    `db:"actor_id"`
+	ActorKind  string    `db:"actor_kind"`
+	RequestID  string    `db:"request_id"`
+	IP         string    `db:"ip"`
+	Action     string    `db:"action"`
+	Resource   string    `db:"resource"`
+	Outcome    string    `db:"outcome"`
+	Detail     string    `db:"detail"`
+	Changes    *string   `db:"changes"`
+}
+
+const auditColumns = `id, occurred_at, actor_id, actor_kind, request_id, ip, action, resource, outcome, detail, changes`
+
+func NewAuditRepository(db *DB) *AuditRepository {
+	return &AuditRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+// AuditRepository only appends and reads entries; the log is never updated.
+type AuditRepository struct {
+	db *DB
+	q  sqlx.ExtContext
+}
+
+func (r *AuditRepository) Create(ctx context.Context, e *AuditEntry) error {
+	query := r.db.Rebind(`
+		INSERT INTO audit_log (` + auditColumns + `)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`)
+
+	_, err := r.q.ExecContext(ctx, query,
+		e.ID, e.OccurredAt, e.ActorID, e.ActorKind, e.RequestID, e.IP,
+		e.Action, e.Resource, e.Outcome, e.Detail, e.Changes,
+	)
+
+	return r.db.translateError(err)
+}
+
+func (r *AuditRepository) Get(ctx context.Context, id string) (*AuditEntry, error) {
+	query := r.db.Rebind(`SELECT ` + auditColumns + ` FROM audit_log WHERE id = ?`)
+
+	var e AuditEntry
+	if err := sqlx.GetContext(ctx, r.q, &e, query, id); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return &e, nil
+}
+
+// List returns a page of entries and the cursor of the next page.
+func (r *AuditRepository) List(ctx context.Context, q *pagination.Query) ([]AuditEntry, string, error) {
+	query, args := q.Build(`SELECT ` + auditColumns + ` FROM audit_log`)
+
+	entries := []AuditEntry{}
+	if err := sqlx.SelectContext(ctx, r.q, &entries, r.db.Rebind(query), args...); err != nil {
+		return nil, "", r.db.translateError(err)
+	}
+
+	return pagination.Paginate(q, entries)
+}
@@ -0,0 +1,95 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Credential is the password of a user. PasswordHash is an encoded hash as
+// produced by the password package.
+type Credential struct {
+	UserID       string    `db:"user_id"`
+	PasswordHash string    `db:"password_hash"`
+	CreatedAt    time.Time `db:"created_at"`
+	UpdatedAt    time.Time `db:"updated_at"`
+}
+
+func NewCredentialRepository(db *DB) *CredentialRepository {
+	return &CredentialRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+type CredentialRepository struct {
+	db *DB
+	q  sqlx.ExtContext
+}
+
+// Tx returns a repository that runs its statements in tx.
+func (r *CredentialRepository) Tx(tx *sqlx.Tx) *CredentialRepository {
+	return &CredentialRepository{
+		db: r.db,
+		q:  tx,
+	}
+}
+
+// Get returns the credential of a user that has not been soft deleted.
+func (r *CredentialRepository) Get(ctx context.Context, userID string) (*Credential, error) {
+	query := r.db.Rebind(`
+		SELECT c.user_id, c.password_hash, c.created_at, c.updated_at
+		FROM user_credentials c
+		JOIN users u ON u.id = c.user_id
+		WHERE c.user_id = ? AND u.deleted_at IS NULL`)
+
+	var c Credential
+	if err := sqlx.GetContext(ctx, r.q, &c, query, userID); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return &c, nil
+}
+
+// Set creates or replaces the credential of a user.
+func (r *CredentialRepository) Set(ctx context.Context, c *Credential) error {
+	query := `
+		INSERT INTO user_credentials (user_id, password_hash, created_at, updated_at)
+		VALUES (?, ?, ?, ?)`
+
+	switch r.db.Dialect {
+	case MySQL, MariaDB:
+		query += `
+		ON DUPLICATE KEY UPDATE password_hash = VALUES(password_hash), updated_at = VALUES(updated_at)`
+	default:
+		query += `
+		ON CONFLICT (user_id) DO UPDATE SET password_hash = excluded.password_hash, updated_at = excluded.updated_at`
+	}
+
+	_, err := r.q.ExecContext(ctx, r.db.Rebind(query), c.UserID, c.PasswordHash, c.CreatedAt, c.UpdatedAt)
+
+	return r.db.translateError(err)
+}
+
+// Rehash replaces the hash of a user if it still is oldHash, so that a
+// concurrent password change is not overwritten. It reports whether the hash
+// was replaced.
+func (r *CredentialRepository) Rehash(ctx context.Context, userID, oldHash, newHash string, at time.Time) (bool, error) {
+	query := r.db.Rebind(`
+		UPDATE user_credentials
+		SET password_hash = ?, updated_at = ?
+		WHERE user_id = ? AND password_hash = ?`)
+
+	res, err := r.q.ExecContext(ctx, query, newHash, at, userID, oldHash)
+	if err != nil {
+		return false, r.db.translateError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return n > 0, nil
+}
@@ -1,7 +1,150 @@
 package database
 
-import "github.com/jmoiron/sqlx"
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type Dialect string
+
+const (
+	Postgres Dialect = "postgres"
+	MySQL    Dialect = "mysql"
+	MariaDB  Dialect = "mariadb"
+	SQLite   Dialect = "sqlite"
+)
+
+var (
+	ErrNotFound = errors.New("database: record not found")
+	ErrConflict = errors.New("database: record already exists")
+	// ErrVersionMismatch is returned when a row was modified after the
+	// version the caller based its change on.
+	ErrVersionMismatch = errors.New("database: record version mismatch")
+)
 
 type DB struct {
 	*sqlx.DB
+	Dialect Dialect
+
+	// IsUniqueViolation reports whether err was caused by a unique
+	// constraint. It is set by the dialect packages.
+	IsUniqueViolation func(err error) bool
+
+	// BatchSize is the number of rows written by a single bulk statement.
+	// Zero selects a default.
+	BatchSize int
+}
+
+const defaultBatchSize = 500
+
+// maxParams is the number of bind parameters a statement may carry.
+var maxParams = map[Dialect]int{
+	Postgres: 65535,
+	MySQL:    65535,
+	MariaDB:  65535,
+	SQLite:   32766,
+}
+
+// batchRows returns how many rows of the given number of columns a bulk
+// statement writes: BatchSize capped by the parameter limit of the dialect.
+func (db *DB) batchRows(columns int) int {
+	n := db.BatchSize
+	if n <= 0 {
+		n = defaultBatchSize
+	}
+
+	if max, ok := maxParams[db.Dialect]; ok && n*columns > max {
+		n = max / columns
+	}
+
+	return n
+}
+
+// InTx runs fn inside a transaction, committing when fn returns nil and
+// rolling back otherwise.
+func (db *DB) InTx(ctx context.Context, fn func(tx *sqlx.Tx) error) error {
+	tx, err := db.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := fn(tx); err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			return fmt.Errorf("%w (rollback: %v)", err, rbErr)
+		}
+
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// forUpdate returns the locking clause for SELECT statements that read rows
+// about to be modified in the same transaction. SQLite locks the whole
+// database on write and has no such clause.
+func (db *DB) forUpdate() string {
+	if db.Dialect == SQLite {
+		return ""
+	}
+
+	return " FOR UPDATE"
+}
+
+func (db *DB) translateError(err error) error {
+	if err == nil {
+		return nil
+	}
+
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+
+	if db.IsUniqueViolation != nil && db.IsUniqueViolation(err) {
+		return ErrConflict
+	}
+
+	return err
+}
+
+func expectRows(res sql.Result) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// expectVersion distinguishes a missing row from a stale version when a
+// statement guarded by a version check matched no rows. existsQuery selects
+// the row by id if it is still visible.
+func (db *DB) expectVersion(ctx context.Context, q sqlx.ExtContext, res sql.Result, existsQuery, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n > 0 {
+		return nil
+	}
+
+	if err := exists(ctx, q, existsQuery, id); err != nil {
+		return db.translateError(err)
+	}
+
+	return ErrVersionMismatch
+}
+
+func exists(ctx context.Context, q sqlx.ExtContext, query string, args ...interface{}) error {
+	var one int
+
+	return sqlx.GetContext(ctx, q, &one, q.Rebind(query), args...)
 }
@@ -0,0 +1,269 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/edalmi/x-api/pagination"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	groupID        = pagination.Field{Name: "id"}
+	groupName      = pagination.Field{Name: "name"}
+	groupCreatedAt = pagination.Field{Name: "created_at", Type: pagination.Time}
+	groupUpdatedAt = pagination.Field{Name: "updated_at", Type: pagination.Time}
+)
+
+// GroupPagination lists the fields groups can be filtered and sorted by.
+var GroupPagination = pagination.Schema{
+	Key: groupID,
+	Sorts: map[string]pagination.Field{
+		"id":         groupID,
+		"name":       groupName,
+		"created_at": groupCreatedAt,
+		"updated_at": groupUpdatedAt,
+	},
+	Filters: []pagination.Filter{
+		{Param: "name", Field: groupName, Op: pagination.Eq},
+		{Param: "created_after", Field: groupCreatedAt, Op: pagination.Gt},
+		{Param: "created_before", Field: groupCreatedAt, Op: pagination.Lt},
+	},
+	DefaultSort: "created_at",
+}
+
+type Group struct {
+	ID          string    `db:"id"`
+	Name        string    `db:"name"`
+	Description string    `db:"description"`
+	CreatedAt   time.Time `db:"created_at"`
+	UpdatedAt   time.Time `db:"updated_at"`
+	Version     int64     `db:"version"`
+}
+
+func NewGroupRepository(db *DB) *GroupRepository {
+	return &GroupRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+type GroupRepository struct {
+	db *DB
+	q  sqlx.ExtContext
+}
+
+// Tx returns a repository that runs its statements in tx.
+func (r *GroupRepository) Tx(tx *sqlx.Tx) *GroupRepository {
+	return &GroupRepository{
+		db: r.db,
+		q:  tx,
+	}
+}
+
+// inTx runs fn in the transaction of the repository, or in a new one when
+// the repository is not bound to a transaction.
+func (r *GroupRepository) inTx(ctx context.Context, fn func(q sqlx.ExtContext) error) error {
+	if tx, ok := r.q.(*sqlx.Tx); ok {
+		return fn(tx)
+	}
+
+	return r.db.InTx(ctx, func(tx *sqlx.Tx) error {
+		return fn(tx)
+	})
+}
+
+func (r *GroupRepository) Create(ctx context.Context, g *Group) error {
+	query := r.db.Rebind(`
+		INSERT INTO user_groups (id, name, description, created_at, updated_at, version)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+
+	_, err := r.q.ExecContext(ctx, query, g.ID, g.Name, g.Description, g.CreatedAt, g.UpdatedAt, g.Version)
+
+	return r.db.translateError(err)
+}
+
+func (r *GroupRepository) Get(ctx context.Context, id string) (*Group, error) {
+	query := r.db.Rebind(`
+		SELECT id, name, description, created_at, updated_at, version
+		FROM user_groups
+		WHERE id = ?`)
+
+	var g Group
+	if err := sqlx.GetContext(ctx, r.q, &g, query, id); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return &g, nil
+}
+
+// List returns a page of groups and the cursor of the next page.
+func (r *GroupRepository) List(ctx context.Context, q *pagination.Query) ([]Group, string, error) {
+	query, args := q.Build(`
+		SELECT id, name, description, created_at, updated_at, version
+		FROM user_groups`)
+
+	groups := []Group{}
+	if err := sqlx.SelectContext(ctx, r.q, &groups, r.db.Rebind(query), args...); err != nil {
+		return nil, "", r.db.translateError(err)
+	}
+
+	return pagination.Paginate(q, groups)
+}
+
+// Update writes g if its version is still current and bumps the version.
+func (r *GroupRepository) Update(ctx context.Context, g *Group) error {
+	query := r.db.Rebind(`
+		UPDATE user_groups
+		SET name = ?, description = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ?`)
+
+	res, err := r.q.ExecContext(ctx, query, g.Name, g.Description, g.UpdatedAt, g.ID, g.Version)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	if err := r.db.expectVersion(ctx, r.q, res, `SELECT 1 FROM user_groups WHERE id = ?`, g.ID); err != nil {
+		return err
+	}
+
+	g.Version++
+
+	return nil
+}
+
+// Delete removes the row. A non-zero version must match the stored one.
+func (r *GroupRepository) Delete(ctx context.Context, id string, version int64) error {
+	query, args := `DELETE FROM user_groups WHERE id = ?`, []interface{}{id}
+	if version != 0 {
+		query, args = query+` AND version = ?`, append(args, version)
+	}
+
+	res, err := r.q.ExecContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	return r.db.expectVersion(ctx, r.q, res, `SELECT 1 FROM user_groups WHERE id = ?`, id)
+}
+
+// AddMember adds the user to the group. It returns ErrNotFound when either
+// side does not exist and ErrConflict when the user is already a member.
+func (r *GroupRepository) AddMember(ctx context.Context, groupID, userID string, at time.Time) error {
+	err := r.inTx(ctx, func(q sqlx.ExtContext) error {
+		if err := exists(ctx, q, `SELECT 1 FROM user_groups WHERE id = ?`, groupID); err != nil {
+			return err
+		}
+
+		if err := exists(ctx, q, `SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL`, userID); err != nil {
+			return err
+		}
+
+		query := q.Rebind(`
+			INSERT INTO group_members (group_id, user_id, created_at)
+			VALUES (?, ?, ?)`)
+
+		_, err := q.ExecContext(ctx, query, groupID, userID, at)
+
+		return err
+	})
+
+	return r.db.translateError(err)
+}
+
+func (r *GroupRepository) RemoveMember(ctx context.Context, groupID, userID string) error {
+	query := r.db.Rebind(`DELETE FROM group_members WHERE group_id = ? AND user_id = ?`)
+
+	res, err := r.q.ExecContext(ctx, query, groupID, userID)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	return expectRows(res)
+}
+
+// ListMembers returns the members of the group ordered by the time they
+// joined it.
+func (r *GroupRepository) ListMembers(ctx context.Context, groupID string) ([]User, error) {
+	if err := exists(ctx, r.q, `SELECT 1 FROM user_groups WHERE id = ?`, groupID); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	query := r.db.Rebind(`
+		SELECT u.id, u.email, u.name, u.created_at, u.updated_at, u.version, u.deleted_at
+		FROM users u
+		JOIN group_members m ON m.user_id = u.id
+		WHERE m.group_id = ? AND u.deleted_at IS NULL
+		ORDER BY m.created_at, u.id`)
+
+	users := []User{}
+	if err := sqlx.SelectContext(ctx, r.q, &users, query, groupID); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return users, nil
+}
+
+// AddRole grants the role to the group. It returns ErrNotFound when the
+// group does not exist and ErrConflict when it already has the role.
+func (r *GroupRepository) AddRole(ctx context.Context, groupID, role string, at time.Time) error {
+	err := r.inTx(ctx, func(q sqlx.ExtContext) error {
+		if err := exists(ctx, q, `SELECT 1 FROM user_groups WHERE id = ?`, groupID); err != nil {
+			return err
+		}
+
+		query := q.Rebind(`INSERT INTO group_roles (group_id, role, created_at) VALUES (?, ?, ?)`)
+
+		_, err := q.ExecContext(ctx, query, groupID, role, at)
+
+		return err
+	})
+
+	return r.db.translateError(err)
+}
+
+func (r *GroupRepository) RemoveRole(ctx context.Context, groupID, role string) error {
+	query := r.db.Rebind(`DELETE FROM group_roles WHERE group_id = ? AND role = ?`)
+
+	res, err := r.q.ExecContext(ctx, query, groupID, role)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	return expectRows(res)
+}
+
+// ListRoles returns the roles of the group in alphabetical order.
+func (r *GroupRepository) ListRoles(ctx context.Context, groupID string) ([]string, error) {
+	if err := exists(ctx, r.q, `SELECT 1 FROM user_groups WHERE id = ?`, groupID); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	roles := []string{}
+	query := r.db.Rebind(`SELECT role FROM group_roles WHERE group_id = ? ORDER BY role`)
+
+	if err := sqlx.SelectContext(ctx, r.q, &roles, query, groupID); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return roles, nil
+}
+
+// UserRoles returns the roles a user holds through the groups it is a
+// member of. Soft deleted users hold no roles.
+func (r *GroupRepository) UserRoles(ctx context.Context, userID string) ([]string, error) {
+	query := r.db.Rebind(`
+		SELECT DISTINCT gr.role
+		FROM group_roles gr
+		JOIN group_members m ON m.group_id = gr.group_id
+		JOIN users u ON u.id = m.user_id
+		WHERE m.user_id = ? AND u.deleted_at IS NULL
+		ORDER BY gr.role`)
+
+	roles := []string{}
+	if err := sqlx.SelectContext(ctx, r.q, &roles, query, userID); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return roles, nil
+}
@@ -1,18 +1,43 @@
 package mariadb
 
 import (
+	"errors"
+
 	"github.com/edalmi/x-api/database"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jmoiron/sqlx"
 )
 
+const codeDuplicateEntry = 1062
+
 func New(dsn string) (*database.DB, error) {
-	db, err := sqlx.Connect("postgres", dsn)
+	cfg, err := mysql.ParseDSN(dsn)
+	if err != nil {
+		return nil, err
+	}
+
+	// Timestamps are scanned into time.Time values and updates report
+	// matched rather than changed rows.
+	cfg.ParseTime = true
+	cfg.ClientFoundRows = true
+
+	db, err := sqlx.Connect("mysql", cfg.FormatDSN())
 	if err != nil {
 		return nil, err
 	}
 
 	return &database.DB{
-		DB: db,
+		DB:                db,
+		Dialect:           database.MariaDB,
+		IsUniqueViolation: isUniqueViolation,
 	}, nil
 }
+
+func isUniqueViolation(err error) bool {
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == codeDuplicateEntry
+	}
+
+	return false
+}
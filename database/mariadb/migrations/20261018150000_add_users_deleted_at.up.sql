@@ -0,0 +1,12 @@
+ALTER TABLE users ADD COLUMN deleted_at DATETIME(6) NULL;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+-- Soft deleted users do not hold on to their email. There are no partial
+-- indexes, but live_email is NULL for them and a unique index admits any
+-- number of NULLs.
+ALTER TABLE users ADD COLUMN live_email VARCHAR(255) AS (CASE WHEN deleted_at IS NULL THEN email END) STORED;
+
+CREATE UNIQUE INDEX idx_users_live_email ON users (live_email);
+
+DROP INDEX idx_users_email ON users;
@@ -0,0 +1,7 @@
+CREATE TABLE group_roles (
+    group_id VARCHAR(36) NOT NULL,
+    role VARCHAR(64) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    PRIMARY KEY (group_id, role),
+    FOREIGN KEY (group_id) REFERENCES user_groups (id) ON DELETE CASCADE
+);
@@ -0,0 +1,11 @@
+CREATE TABLE users (
+    id VARCHAR(36) NOT NULL PRIMARY KEY,
+    email VARCHAR(255) NOT NULL,
+    name VARCHAR(255) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL
+);
+
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+CREATE INDEX idx_users_created_at ON users (created_at, id);
@@ -0,0 +1,9 @@
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+DROP INDEX idx_users_live_email ON users;
+
+ALTER TABLE users DROP COLUMN live_email;
+
+DROP INDEX idx_users_deleted_at ON users;
+
+ALTER TABLE users DROP COLUMN deleted_at;
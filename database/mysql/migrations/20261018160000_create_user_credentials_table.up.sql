@@ -0,0 +1,7 @@
+CREATE TABLE user_credentials (
+    user_id VARCHAR(36) NOT NULL PRIMARY KEY,
+    password_hash VARCHAR(255) NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    updated_at DATETIME(6) NOT NULL,
+    FOREIGN KEY (user_id) REFERENCES users (id) ON DELETE CASCADE
+);
@@ -0,0 +1,10 @@
+CREATE TABLE oauth_clients (
+    id VARCHAR(36) NOT NULL PRIMARY KEY,
+    name VARCHAR(255) NOT NULL,
+    secret_hash VARCHAR(64) NOT NULL,
+    scopes TEXT NOT NULL,
+    created_at DATETIME(6) NOT NULL,
+    revoked_at DATETIME(6) NULL
+);
+
+CREATE INDEX idx_oauth_clients_created_at ON oauth_clients (created_at, id);
@@ -0,0 +1,17 @@
+CREATE TABLE audit_log (
+    id VARCHAR(36) NOT NULL PRIMARY KEY,
+    occurred_at DATETIME(6) NOT NULL,
+    actor_id VARCHAR(255) NOT NULL,
+    actor_kind VARCHAR(32) NOT NULL,
+    request_id VARCHAR(128) NOT NULL,
+    ip VARCHAR(45) NOT NULL,
+    action VARCHAR(64) NOT NULL,
+    resource VARCHAR(255) NOT NULL,
+    outcome VARCHAR(16) NOT NULL,
+    detail TEXT NOT NULL,
+    changes TEXT NULL
+);
+
+CREATE INDEX idx_audit_log_occurred_at ON audit_log (occurred_at, id);
+CREATE INDEX idx_audit_log_resource ON audit_log (resource, occurred_at);
+CREATE INDEX idx_audit_log_actor_id ON audit_log (actor_id, occurred_at);
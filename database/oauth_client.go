@@ -0,0 +1,113 @@
+package database
+
+import (
+	"context"
+	"time"
+
+	"github.com/edalmi/x-api/pagination"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	oauthClientID        = pagination.Field{Name: "id"}
+	oauthClientName      = pagination.Field{Name: "name"}
+	oauthClientCreatedAt = pagination.Field{Name: "created_at", Type: pagination.Time}
+)
+
+// OAuthClientPagination lists the fields OAuth clients can be filtered and
+// sorted by.
+var OAuthClientPagination = pagination.Schema{
+	Key: oauthClientID,
+	Sorts: map[string]pagination.Field{
+		"id":         oauthClientID,
+		"name":       oauthClientName,
+		"created_at": oauthClientCreatedAt,
+	},
+	Filters: []pagination.Filter{
+		{Param: "name", Field: oauthClientName, Op: pagination.Eq},
+		{Param: "created_after", Field: oauthClientCreatedAt, Op: pagination.Gt},
+		{Param: "created_before", Field: oauthClientCreatedAt, Op: pagination.Lt},
+	},
+	DefaultSort: "created_at",
+}
+
+// OAuthClient is a client registered for the client credentials grant.
+// Only the hash of its secret is stored. Scopes are the scopes it may
+// request, separated by spaces.
+type OAuthClient struct {
+	ID         string     `db:"id"`
+	Name       string     `db:"name"`
+	SecretHash string     `db:"secret_hash"`
+	Scopes     string     `db:"scopes"`
+	CreatedAt  time.Time  `db:"created_at"`
+	RevokedAt  *time.Time `db:"revoked_at"`
+}
+
+const oauthClientColumns = `id, name, secret_hash, scopes, created_at, revoked_at`
+
+func NewOAuthClientRepository(db *DB) *OAuthClientRepository {
+	return &OAuthClientRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+type OAuthClientRepository struct {
+	db *DB
+	q  sqlx.ExtContext
+}
+
+func (r *OAuthClientRepository) Create(ctx context.Context, c *OAuthClient) error {
+	query := r.db.Rebind(`
+		INSERT INTO oauth_clients (id, name, secret_hash, scopes, created_at)
+		VALUES (?, ?, ?, ?, ?)`)
+
+	_, err := r.q.ExecContext(ctx, query, c.ID, c.Name, c.SecretHash, c.Scopes, c.CreatedAt)
+
+	return r.db.translateError(err)
+}
+
+func (r *OAuthClientRepository) Get(ctx context.Context, id string) (*OAuthClient, error) {
+	query := r.db.Rebind(`SELECT ` + oauthClientColumns + ` FROM oauth_clients WHERE id = ?`)
+
+	var c OAuthClient
+	if err := sqlx.GetContext(ctx, r.q, &c, query, id); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return &c, nil
+}
+
+// List returns a page of clients, revoked ones included, and the cursor of
+// the next page.
+func (r *OAuthClientRepository) List(ctx context.Context, q *pagination.Query) ([]OAuthClient, string, error) {
+	query, args := q.Build(`SELECT ` + oauthClientColumns + ` FROM oauth_clients`)
+
+	clients := []OAuthClient{}
+	if err := sqlx.SelectContext(ctx, r.q, &clients, r.db.Rebind(query), args...); err != nil {
+		return nil, "", r.db.translateError(err)
+	}
+
+	return pagination.Paginate(q, clients)
+}
+
+// Revoke marks the client as revoked. Revoking a revoked client is a no-op.
+func (r *OAuthClientRepository) Revoke(ctx context.Context, id string, at time.Time) error {
+	query := r.db.Rebind(`UPDATE oauth_clients SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL`)
+
+	res, err := r.q.ExecContext(ctx, query, at, id)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return r.db.translateError(exists(ctx, r.q, `SELECT 1 FROM oauth_clients WHERE id = ?`, id))
+	}
+
+	return nil
+}
@@ -1,18 +1,34 @@
 package postgres
 
 import (
+	"errors"
+
 	"github.com/edalmi/x-api/database"
+	"github.com/jackc/pgx/v5/pgconn"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 )
 
+const codeUniqueViolation = "23505"
+
 func New(dsn string) (*database.DB, error) {
-	db, err := sqlx.Connect("postgres", dsn)
+	db, err := sqlx.Connect("pgx", dsn)
 	if err != nil {
 		return nil, err
 	}
 
 	return &database.DB{
-		DB: db,
+		DB:                db,
+		Dialect:           database.Postgres,
+		IsUniqueViolation: isUniqueViolation,
 	}, nil
 }
+
+func isUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == codeUniqueViolation
+	}
+
+	return false
+}
@@ -0,0 +1,3 @@
+ALTER TABLE user_groups DROP COLUMN version;
+
+ALTER TABLE users DROP COLUMN version;
@@ -0,0 +1,8 @@
+ALTER TABLE users ADD COLUMN deleted_at TIMESTAMPTZ NULL;
+
+CREATE INDEX idx_users_deleted_at ON users (deleted_at);
+
+-- Soft deleted users do not hold on to their email.
+DROP INDEX idx_users_email;
+
+CREATE UNIQUE INDEX idx_users_live_email ON users (email) WHERE deleted_at IS NULL;
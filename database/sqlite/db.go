@@ -1,18 +1,47 @@
 package sqlite
 
 import (
+	"errors"
+	"strings"
+
 	"github.com/edalmi/x-api/database"
 	"github.com/jmoiron/sqlx"
-	_ "github.com/mattn/go-sqlite3"
+	"github.com/mattn/go-sqlite3"
 )
 
 func New(dsn string) (*database.DB, error) {
-	db, err := sqlx.Connect("sqlite3", dsn)
+	db, err := sqlx.Connect("sqlite3", withForeignKeys(dsn))
 	if err != nil {
 		return nil, err
 	}
 
 	return &database.DB{
-		DB: db,
+		DB:                db,
+		Dialect:           database.SQLite,
+		IsUniqueViolation: isUniqueViolation,
 	}, nil
 }
+
+func isUniqueViolation(err error) bool {
+	var liteErr sqlite3.Error
+	if errors.As(err, &liteErr) {
+		return liteErr.ExtendedCode == sqlite3.ErrConstraintUnique ||
+			liteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey
+	}
+
+	return false
+}
+
+// withForeignKeys enables foreign key enforcement, which SQLite leaves off
+// for every new connection unless asked.
+func withForeignKeys(dsn string) string {
+	if strings.Contains(dsn, "_foreign_keys=") || strings.Contains(dsn, "_fk=") {
+		return dsn
+	}
+
+	if strings.Contains(dsn, "?") {
+		return dsn + "&_foreign_keys=1"
+	}
+
+	return dsn + "?_foreign_keys=1"
+}
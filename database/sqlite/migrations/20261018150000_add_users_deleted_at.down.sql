@@ -0,0 +1,7 @@
+DROP INDEX idx_users_live_email;
+
+CREATE UNIQUE INDEX idx_users_email ON users (email);
+
+DROP INDEX idx_users_deleted_at;
+
+ALTER TABLE users DROP COLUMN deleted_at;
@@ -0,0 +1,321 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/pagination"
+	"github.com/jmoiron/sqlx"
+)
+
+var (
+	userID        = pagination.Field{Name: "id"}
+	userEmail     = pagination.Field{Name: "email"}
+	userName      = pagination.Field{Name: "name"}
+	userCreatedAt = pagination.Field{Name: "created_at", Type: pagination.Time}
+	userUpdatedAt = pagination.Field{Name: "updated_at", Type: pagination.Time}
+)
+
+// UserPagination lists the fields users can be filtered and sorted by.
+var UserPagination = pagination.Schema{
+	Key: userID,
+	Sorts: map[string]pagination.Field{
+		"id":         userID,
+		"email":      userEmail,
+		"name":       userName,
+		"created_at": userCreatedAt,
+		"updated_at": userUpdatedAt,
+	},
+	Filters: []pagination.Filter{
+		{Param: "email", Field: userEmail, Op: pagination.Eq},
+		{Param: "name", Field: userName, Op: pagination.Eq},
+		{Param: "created_after", Field: userCreatedAt, Op: pagination.Gt},
+		{Param: "created_before", Field: userCreatedAt, Op: pagination.Lt},
+	},
+	DefaultSort: "created_at",
+}
+
+type User struct {
+	ID        string     `db:"id"`
+	Email     string     `db:"email"`
+	Name      string     `db:"name"`
+	CreatedAt time.Time  `db:"created_at"`
+	UpdatedAt time.Time  `db:"updated_at"`
+	Version   int64      `db:"version"`
+	DeletedAt *time.Time `db:"deleted_at"`
+}
+
+const (
+	userColumns = `id, email, name, created_at, updated_at, version, deleted_at`
+
+	userExistsQuery = `SELECT 1 FROM users WHERE id = ? AND deleted_at IS NULL`
+
+	userInsertColumns = 6
+)
+
+func NewUserRepository(db *DB) *UserRepository {
+	return &UserRepository{
+		db: db,
+		q:  db,
+	}
+}
+
+type UserRepository struct {
+	db *DB
+	q  sqlx.ExtContext
+}
+
+// Tx returns a repository that runs its statements in tx.
+func (r *UserRepository) Tx(tx *sqlx.Tx) *UserRepository {
+	return &UserRepository{
+		db: r.db,
+		q:  tx,
+	}
+}
+
+func (r *UserRepository) Create(ctx context.Context, u *User) error {
+	query := r.db.Rebind(`
+		INSERT INTO users (id, email, name, created_at, updated_at, version)
+		VALUES (?, ?, ?, ?, ?, ?)`)
+
+	_, err := r.q.ExecContext(ctx, query, u.ID, u.Email, u.Name, u.CreatedAt, u.UpdatedAt, u.Version)
+
+	return r.db.translateError(err)
+}
+
+// BatchSize returns the maximum number of users CreateBatch inserts in one
+// statement.
+func (r *UserRepository) BatchSize() int {
+	return r.db.batchRows(userInsertColumns)
+}
+
+// CreateBatch inserts users with multi-row INSERT statements of at most
+// BatchSize rows each. It stops at the first failing statement, so callers
+// that need all or nothing must run it in a transaction.
+func (r *UserRepository) CreateBatch(ctx context.Context, users []User) error {
+	size := r.BatchSize()
+
+	for len(users) > 0 {
+		n := size
+		if n > len(users) {
+			n = len(users)
+		}
+
+		values := make([]string, 0, n)
+		args := make([]interface{}, 0, n*userInsertColumns)
+
+		for _, u := range users[:n] {
+			values = append(values, `(?, ?, ?, ?, ?, ?)`)
+			args = append(args, u.ID, u.Email, u.Name, u.CreatedAt, u.UpdatedAt, u.Version)
+		}
+
+		query := r.db.Rebind(`
+			INSERT INTO users (id, email, name, created_at, updated_at, version)
+			VALUES ` + strings.Join(values, ", "))
+
+		if _, err := r.q.ExecContext(ctx, query, args...); err != nil {
+			return r.db.translateError(err)
+		}
+
+		users = users[n:]
+	}
+
+	return nil
+}
+
+// FindConflicts returns the users whose id is among the given ones, soft
+// deleted ones included, and the live users whose email is.
+func (r *UserRepository) FindConflicts(ctx context.Context, ids, emails []string) ([]User, error) {
+	var (
+		conds []string
+		args  []interface{}
+	)
+
+	if len(ids) > 0 {
+		conds, args = append(conds, `id IN (?)`), append(args, ids)
+	}
+
+	if len(emails) > 0 {
+		conds, args = append(conds, `(email IN (?) AND deleted_at IS NULL)`), append(args, emails)
+	}
+
+	users := []User{}
+	if len(conds) == 0 {
+		return users, nil
+	}
+
+	query, args, err := sqlx.In(`SELECT `+userColumns+` FROM users WHERE `+strings.Join(conds, " OR "), args...)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := sqlx.SelectContext(ctx, r.q, &users, r.db.Rebind(query), args...); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return users, nil
+}
+
+// Get returns the user unless it has been soft deleted.
+func (r *UserRepository) Get(ctx context.Context, id string) (*User, error) {
+	return r.get(ctx, `SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`, id)
+}
+
+// GetByEmail returns the user with the email unless it has been soft
+// deleted.
+func (r *UserRepository) GetByEmail(ctx context.Context, email string) (*User, error) {
+	return r.get(ctx, `SELECT `+userColumns+` FROM users WHERE email = ? AND deleted_at IS NULL`, email)
+}
+
+// GetWithDeleted returns the user even if it has been soft deleted.
+func (r *UserRepository) GetWithDeleted(ctx context.Context, id string) (*User, error) {
+	return r.get(ctx, `SELECT `+userColumns+` FROM users WHERE id = ?`, id)
+}
+
+// GetForUpdate is like Get but locks the row until the surrounding
+// transaction ends.
+func (r *UserRepository) GetForUpdate(ctx context.Context, id string) (*User, error) {
+	return r.get(ctx, `SELECT `+userColumns+` FROM users WHERE id = ? AND deleted_at IS NULL`+r.db.forUpdate(), id)
+}
+
+func (r *UserRepository) get(ctx context.Context, query, id string) (*User, error) {
+	var u User
+	if err := sqlx.GetContext(ctx, r.q, &u, r.db.Rebind(query), id); err != nil {
+		return nil, r.db.translateError(err)
+	}
+
+	return &u, nil
+}
+
+// List returns a page of users and the cursor of the next page. Soft
+// deleted users are only included when withDeleted is set.
+func (r *UserRepository) List(ctx context.Context, q *pagination.Query, withDeleted bool) ([]User, string, error) {
+	var conds []pagination.Condition
+	if !withDeleted {
+		conds = append(conds, pagination.Where("deleted_at IS NULL"))
+	}
+
+	query, args := q.Build(`SELECT `+userColumns+` FROM users`, conds...)
+
+	users := []User{}
+	if err := sqlx.SelectContext(ctx, r.q, &users, r.db.Rebind(query), args...); err != nil {
+		return nil, "", r.db.translateError(err)
+	}
+
+	return pagination.Paginate(q, users)
+}
+
+// Update writes u if its version is still current and bumps the version.
+func (r *UserRepository) Update(ctx context.Context, u *User) error {
+	query := r.db.Rebind(`
+		UPDATE users
+		SET email = ?, name = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND version = ? AND deleted_at IS NULL`)
+
+	res, err := r.q.ExecContext(ctx, query, u.Email, u.Name, u.UpdatedAt, u.ID, u.Version)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	if err := r.db.expectVersion(ctx, r.q, res, userExistsQuery, u.ID); err != nil {
+		return err
+	}
+
+	u.Version++
+
+	return nil
+}
+
+// SoftDelete marks the user as deleted at the given time. A non-zero
+// version must match the stored one.
+func (r *UserRepository) SoftDelete(ctx context.Context, id string, version int64, at time.Time) error {
+	query, args := `
+		UPDATE users
+		SET deleted_at = ?, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NULL`, []interface{}{at, at, id}
+	if version != 0 {
+		query, args = query+` AND version = ?`, append(args, version)
+	}
+
+	res, err := r.q.ExecContext(ctx, r.db.Rebind(query), args...)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	return r.db.expectVersion(ctx, r.q, res, userExistsQuery, id)
+}
+
+// Restore clears the deletion mark of a soft deleted user. Restoring a
+// user that is not deleted is a no-op. It fails with ErrConflict when a
+// live user has taken the email in the meantime.
+func (r *UserRepository) Restore(ctx context.Context, id string, at time.Time) error {
+	query := r.db.Rebind(`
+		UPDATE users
+		SET deleted_at = NULL, updated_at = ?, version = version + 1
+		WHERE id = ? AND deleted_at IS NOT NULL`)
+
+	res, err := r.q.ExecContext(ctx, query, at, id)
+	if err != nil {
+		return r.db.translateError(err)
+	}
+
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return r.db.translateError(exists(ctx, r.q, `SELECT 1 FROM users WHERE id = ?`, id))
+	}
+
+	return nil
+}
+
+// Purge permanently removes users soft deleted before the given time, at
+// most batchSize rows per statement, and returns the number of rows removed.
+func (r *UserRepository) Purge(ctx context.Context, before time.Time, batchSize int) (int64, error) {
+	var total int64
+
+	for {
+		var ids []string
+
+		query := r.db.Rebind(fmt.Sprintf(`
+			SELECT id FROM users
+			WHERE deleted_at IS NOT NULL AND deleted_at < ?
+			ORDER BY deleted_at
+			LIMIT %d`, batchSize))
+
+		if err := sqlx.SelectContext(ctx, r.q, &ids, query, before); err != nil {
+			return total, r.db.translateError(err)
+		}
+
+		if len(ids) == 0 {
+			return total, nil
+		}
+
+		// A user restored and deleted again since the SELECT must not lose
+		// its retention period, so the predicate is repeated.
+		query, args, err := sqlx.In(`DELETE FROM users WHERE id IN (?) AND deleted_at IS NOT NULL AND deleted_at < ?`, ids, before)
+		if err != nil {
+			return total, err
+		}
+
+		res, err := r.q.ExecContext(ctx, r.db.Rebind(query), args...)
+		if err != nil {
+			return total, r.db.translateError(err)
+		}
+
+		n, err := res.RowsAffected()
+		if err != nil {
+			return total, err
+		}
+
+		total += n
+
+		if len(ids) < batchSize {
+			return total, nil
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// NewAPIKeyHandler serves the administration of API keys. It belongs on the
+// admin server.
+func NewAPIKeyHandler(opts HandlerOpts) *APIKeyHandler {
+	return &APIKeyHandler{
+		opts:    opts,
+		service: NewAPIKeyService(opts.DB(), opts.Cache(), DefaultAPIKeyCacheTTL, opts.Logger()),
+	}
+}
+
+type APIKeyHandler struct {
+	opts    HandlerOpts
+	service APIKeyService
+}
+
+// CreateAPIKey issues a key. The response is the only time the key itself
+// is disclosed.
+func (h APIKeyHandler) CreateAPIKey(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "apikeys.CreateAPIKey")
+	defer span.End()
+
+	var in APIKeyCreate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	key, err := h.service.CreateAPIKey(ctx, in)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Key("api_key_id").String(key.ID))
+
+	rw.Header().Set("Location", path.Join(r.URL.Path, url.PathEscape(key.ID)))
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusCreated, key)
+}
+
+func (h APIKeyHandler) ListAPIKeys(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "apikeys.ListAPIKeys")
+	defer span.End()
+
+	q, err := pagination.Parse(r.URL.Query(), database.APIKeyPagination)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	page, err := h.service.ListAPIKeys(ctx, q)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writePage(ctx, h.opts.Logger(), rw, r, page)
+}
+
+func (h APIKeyHandler) GetAPIKey(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "apikeys.GetAPIKey")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("api_key_id").String(id))
+
+	key, err := h.service.GetAPIKey(ctx, id)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusOK, key)
+}
+
+// RevokeAPIKey revokes a key. Revoked keys stay listed with revoked_at set.
+func (h APIKeyHandler) RevokeAPIKey(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "apikeys.RevokeAPIKey")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("api_key_id").String(id))
+
+	if err := h.service.RevokeAPIKey(ctx, id); err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h APIKeyHandler) Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/", h.ListAPIKeys)
+	r.Post("/", h.CreateAPIKey)
+	r.Get("/{id}", h.GetAPIKey)
+	r.Delete("/{id}", h.RevokeAPIKey)
+
+	return r
+}
+
+type APIKeyCreate struct {
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	ExpiresAt *time.Time `json:"expires_at"`
+}
+
+type APIKey struct {
+	ID         string     `json:"id"`
+	Name       string     `json:"name"`
+	Prefix     string     `json:"prefix"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"created_at"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+// APIKeyCreated is an issued key together with the key itself.
+type APIKeyCreated struct {
+	APIKey
+	Key string `json:"key"`
+}
@@ -0,0 +1,317 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultAPIKeyCacheTTL bounds how long a revoked key may still be
+	// accepted by a cache that missed the revocation.
+	DefaultAPIKeyCacheTTL = time.Minute
+
+	// lastUsedResolution limits how often last_used_at is written for a key
+	// in constant use.
+	lastUsedResolution = time.Minute
+
+	maxScopes = 64
+)
+
+// APIKeyService manages API keys and authenticates requests that carry one.
+type APIKeyService interface {
+	auth.Authenticator
+	CreateAPIKey(ctx context.Context, in APIKeyCreate) (*APIKeyCreated, error)
+	GetAPIKey(ctx context.Context, id string) (*APIKey, error)
+	ListAPIKeys(ctx context.Context, q *pagination.Query) (*pagination.Page[APIKey], error)
+	RevokeAPIKey(ctx context.Context, id string) error
+}
+
+func NewAPIKeyService(db *database.DB, cache caching.Cache, ttl time.Duration, logger logging.Logger) APIKeyService {
+	if ttl <= 0 {
+		ttl = DefaultAPIKeyCacheTTL
+	}
+
+	return &apiKeyService{
+		repo:   database.NewAPIKeyRepository(db),
+		cache:  cache,
+		ttl:    ttl,
+		logger: logger,
+	}
+}
+
+type apiKeyService struct {
+	repo   *database.APIKeyRepository
+	cache  caching.Cache
+	ttl    time.Duration
+	logger logging.Logger
+}
+
+func (s *apiKeyService) CreateAPIKey(ctx context.Context, in APIKeyCreate) (*APIKeyCreated, error) {
+	name := strings.TrimSpace(in.Name)
+
+	verr := problem.Fields{}
+	if name == "" {
+		verr.Add("name", "is required")
+	} else if len(name) > maxNameLength {
+		verr.Add("name", "is too long")
+	}
+
+	if len(in.Scopes) > maxScopes {
+		verr.Add("scopes", "has too many entries")
+	}
+
+	for _, scope := range in.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\r\n") {
+			verr.Add("scopes", "must not contain empty or blank separated scopes")
+			break
+		}
+	}
+
+	now := now()
+	if in.ExpiresAt != nil && !in.ExpiresAt.After(now) {
+		verr.Add("expires_at", "must be in the future")
+	}
+
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	key, prefix, err := auth.NewAPIKey()
+	if err != nil {
+		return nil, err
+	}
+
+	row := &database.APIKey{
+		ID:        uuid.NewString(),
+		Name:      name,
+		Prefix:    prefix,
+		KeyHash:   auth.HashAPIKey(key),
+		Scopes:    strings.Join(in.Scopes, " "),
+		CreatedAt: now,
+	}
+
+	if in.ExpiresAt != nil {
+		expiresAt := in.ExpiresAt.UTC().Truncate(time.Microsecond)
+		row.ExpiresAt = &expiresAt
+	}
+
+	if err := s.repo.Create(ctx, row); err != nil {
+		return nil, serviceError(err)
+	}
+
+	return &APIKeyCreated{APIKey: *toAPIKey(row), Key: key}, nil
+}
+
+func (s *apiKeyService) GetAPIKey(ctx context.Context, id string) (*APIKey, error) {
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toAPIKey(row), nil
+}
+
+func (s *apiKeyService) ListAPIKeys(ctx context.Context, q *pagination.Query) (*pagination.Page[APIKey], error) {
+	rows, next, err := s.repo.List(ctx, q)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	page := &pagination.Page[APIKey]{
+		Data:       make([]APIKey, 0, len(rows)),
+		NextCursor: next,
+	}
+
+	for i := range rows {
+		page.Data = append(page.Data, *toAPIKey(&rows[i]))
+	}
+
+	return page, nil
+}
+
+// RevokeAPIKey revokes the key and replaces its cache entry, so that the
+// revocation takes effect immediately wherever the cache is shared.
+func (s *apiKeyService) RevokeAPIKey(ctx context.Context, id string) error {
+	if err := s.repo.Revoke(ctx, id, now()); err != nil {
+		return serviceError(err)
+	}
+
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	s.store(ctx, row.Prefix, newAPIKeyEntry(row), true)
+
+	return nil
+}
+
+func (s *apiKeyService) Scheme() string {
+	return "ApiKey"
+}
+
+func (s *apiKeyService) Authenticate(ctx context.Context, key string) (*auth.Principal, error) {
+	prefix, ok := auth.ParseAPIKey(key)
+	if !ok {
+		return nil, fmt.Errorf("%w: malformed api key", auth.ErrUnauthenticated)
+	}
+
+	entry, err := s.lookup(ctx, prefix)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := auth.HashAPIKey(key)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(entry.KeyHash)) != 1 {
+		return nil, fmt.Errorf("%w: invalid api key", auth.ErrUnauthenticated)
+	}
+
+	now := now()
+
+	switch {
+	case entry.RevokedAt != nil:
+		return nil, fmt.Errorf("%w: api key has been revoked", auth.ErrUnauthenticated)
+	case entry.ExpiresAt != nil && !now.Before(*entry.ExpiresAt):
+		return nil, fmt.Errorf("%w: api key has expired", auth.ErrUnauthenticated)
+	}
+
+	if entry.LastUsedAt == nil || now.Sub(*entry.LastUsedAt) >= lastUsedResolution {
+		s.touch(ctx, entry, now)
+	}
+
+	return &auth.Principal{
+		Subject: entry.ID,
+		Kind:    auth.KindAPIKey,
+		Scopes:  entry.Scopes,
+	}, nil
+}
+
+// apiKeyEntry is what the cache holds for a prefix. Unknown prefixes are
+// cached too, with an empty KeyHash, so that guessing keys does not reach
+// the database.
+type apiKeyEntry struct {
+	ID         string     `json:"id,omitempty"`
+	KeyHash    string     `json:"key_hash,omitempty"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	ExpiresAt  *time.Time `json:"expires_at,omitempty"`
+	LastUsedAt *time.Time `json:"last_used_at,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func newAPIKeyEntry(row *database.APIKey) *apiKeyEntry {
+	return &apiKeyEntry{
+		ID:         row.ID,
+		KeyHash:    row.KeyHash,
+		Scopes:     strings.Fields(row.Scopes),
+		ExpiresAt:  row.ExpiresAt,
+		LastUsedAt: row.LastUsedAt,
+		RevokedAt:  row.RevokedAt,
+	}
+}
+
+func apiKeyCacheKey(prefix string) string {
+	return "apikey:" + prefix
+}
+
+// lookup reads the entry of a prefix from the cache, falling back to the
+// database. Cache failures are logged and treated as misses. An entry read
+// from the database is only added when the prefix is still not cached, so
+// that it cannot replace the entry stored by a concurrent revocation.
+func (s *apiKeyService) lookup(ctx context.Context, prefix string) (*apiKeyEntry, error) {
+	if s.cache != nil {
+		v, err := s.cache.Get(ctx, apiKeyCacheKey(prefix))
+		if err == nil {
+			var entry apiKeyEntry
+			if err := json.Unmarshal([]byte(v), &entry); err == nil {
+				return &entry, nil
+			}
+		} else if !errors.Is(err, caching.ErrMiss) {
+			logging.FromContext(ctx, s.logger).Error(err)
+		}
+	}
+
+	entry := &apiKeyEntry{}
+
+	row, err := s.repo.GetByPrefix(ctx, prefix)
+	switch {
+	case err == nil:
+		entry = newAPIKeyEntry(row)
+	case !errors.Is(err, database.ErrNotFound):
+		return nil, err
+	}
+
+	s.store(ctx, prefix, entry, false)
+
+	return entry, nil
+}
+
+// store caches the entry of a prefix. Unless replace is set, an entry that
+// is already cached is kept.
+func (s *apiKeyService) store(ctx context.Context, prefix string, entry *apiKeyEntry, replace bool) {
+	if s.cache == nil {
+		return
+	}
+
+	b, err := json.Marshal(entry)
+	if err == nil {
+		if replace {
+			err = s.cache.Set(ctx, apiKeyCacheKey(prefix), string(b), s.ttl)
+		} else {
+			_, err = s.cache.Add(ctx, apiKeyCacheKey(prefix), string(b), s.ttl)
+		}
+	}
+
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error(err)
+	}
+}
+
+// touch records the use of a key. Failures are logged but do not fail the
+// request. The cached entry is never rewritten, which could undo a
+// concurrent revocation; instead a key of its own limits the writes of a
+// key in constant use to one per lastUsedResolution.
+func (s *apiKeyService) touch(ctx context.Context, entry *apiKeyEntry, at time.Time) {
+	if s.cache != nil {
+		first, err := s.cache.Add(ctx, "apikey:used:"+entry.ID, at.Format(time.RFC3339Nano), lastUsedResolution)
+		if err != nil {
+			logging.FromContext(ctx, s.logger).Error(err)
+		} else if !first {
+			return
+		}
+	}
+
+	if err := s.repo.Touch(ctx, entry.ID, at); err != nil {
+		logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"api_key_id": entry.ID}).Error(err)
+	}
+}
+
+func toAPIKey(row *database.APIKey) *APIKey {
+	scopes := strings.Fields(row.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &APIKey{
+		ID:         row.ID,
+		Name:       row.Name,
+		Prefix:     row.Prefix,
+		Scopes:     scopes,
+		CreatedAt:  row.CreatedAt,
+		ExpiresAt:  row.ExpiresAt,
+		LastUsedAt: row.LastUsedAt,
+		RevokedAt:  row.RevokedAt,
+	}
+}
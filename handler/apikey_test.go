@@ -0,0 +1,312 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/handler/middleware"
+	"github.com/google/uuid"
+)
+
+func TestAPIKeyHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        testRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{
+			name:       "create",
+			req:        testRequest{method: http.MethodPost, path: "/", body: `{"name":"deploy","scopes":["users:read","groups:read"]}`},
+			wantStatus: http.StatusCreated,
+			wantBody:   `"scopes":["users:read","groups:read"]`,
+		},
+		{name: "create without name", req: testRequest{method: http.MethodPost, path: "/", body: `{"name":" "}`}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "create with blank scope", req: testRequest{method: http.MethodPost, path: "/", body: `{"name":"ci","scopes":["users:read groups:read"]}`}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "create expired", req: testRequest{method: http.MethodPost, path: "/", body: `{"name":"ci","expires_at":"2000-01-01T00:00:00Z"}`}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "get", req: testRequest{method: http.MethodGet, path: "/{id}"}, wantStatus: http.StatusOK, wantBody: `"name":"ci"`},
+		{name: "get unknown", req: testRequest{method: http.MethodGet, path: "/unknown"}, wantStatus: http.StatusNotFound},
+		{name: "list", req: testRequest{method: http.MethodGet, path: "/"}, wantStatus: http.StatusOK, wantBody: `"id":"{id}"`},
+		{name: "revoke", req: testRequest{method: http.MethodDelete, path: "/{id}"}, wantStatus: http.StatusNoContent},
+		{name: "revoke unknown", req: testRequest{method: http.MethodDelete, path: "/unknown"}, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewAPIKeyHandler(testOpts{db: newTestDB(t), cache: newTestCache()}).Routes()
+
+			id := mustCreate(t, h, "/", `{"name":"ci","scopes":["users:read"]}`)
+
+			tt.req.path = strings.ReplaceAll(tt.req.path, "{id}", id)
+
+			rw := tt.req.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if want := strings.ReplaceAll(tt.wantBody, "{id}", id); !strings.Contains(rw.Body.String(), want) {
+				t.Errorf("body = %s, want it to contain %s", rw.Body, want)
+			}
+
+			if strings.Contains(rw.Body.String(), "hash") {
+				t.Errorf("body = %s discloses the hash of a key", rw.Body)
+			}
+		})
+	}
+}
+
+func TestAPIKeyHandlerCreateDisclosesKeyOnce(t *testing.T) {
+	h := NewAPIKeyHandler(testOpts{db: newTestDB(t), cache: newTestCache()}).Routes()
+
+	rw := testRequest{method: http.MethodPost, path: "/", body: `{"name":"ci"}`}.serve(h)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body = %s", rw.Code, rw.Body)
+	}
+
+	if cc := rw.Header().Get("Cache-Control"); cc != "no-store" {
+		t.Errorf("Cache-Control = %q, want no-store", cc)
+	}
+
+	var created APIKeyCreated
+	if err := json.Unmarshal(rw.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	if prefix, ok := auth.ParseAPIKey(created.Key); !ok || prefix != created.Prefix {
+		t.Errorf("key = %q, prefix = %q", created.Key, created.Prefix)
+	}
+
+	if rw := (testRequest{method: http.MethodGet, path: "/" + created.ID}).serve(h); strings.Contains(rw.Body.String(), created.Key) {
+		t.Errorf("GET discloses the key: %s", rw.Body)
+	}
+}
+
+func TestAPIKeyAuthenticate(t *testing.T) {
+	ctx := context.Background()
+	opts := testOpts{db: newTestDB(t)}
+	repo := database.NewAPIKeyRepository(opts.DB())
+
+	// newKey stores a key directly, which allows it to be issued expired.
+	newKey := func(t *testing.T, expiresAt *time.Time) string {
+		t.Helper()
+
+		key, prefix, err := auth.NewAPIKey()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		err = repo.Create(ctx, &database.APIKey{
+			ID:        uuid.NewString(),
+			Name:      "ci",
+			Prefix:    prefix,
+			KeyHash:   auth.HashAPIKey(key),
+			Scopes:    "users:read",
+			CreatedAt: time.Now().UTC(),
+			ExpiresAt: expiresAt,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return key
+	}
+
+	past, future := time.Now().Add(-time.Hour).UTC(), time.Now().Add(time.Hour).UTC()
+
+	tests := []struct {
+		name       string
+		key        func(t *testing.T, s APIKeyService) string
+		wantStatus int
+	}{
+		{
+			name:       "valid",
+			key:        func(t *testing.T, _ APIKeyService) string { return newKey(t, &future) },
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "expired",
+			key:        func(t *testing.T, _ APIKeyService) string { return newKey(t, &past) },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "revoked",
+			key: func(t *testing.T, s APIKeyService) string {
+				key := newKey(t, nil)
+				prefix, _ := auth.ParseAPIKey(key)
+
+				row, err := repo.GetByPrefix(ctx, prefix)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				if err := s.RevokeAPIKey(ctx, row.ID); err != nil {
+					t.Fatal(err)
+				}
+
+				return key
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "wrong secret",
+			key: func(t *testing.T, _ APIKeyService) string {
+				key := newKey(t, nil)
+				return key[:len(key)-1] + "x"
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "unknown prefix",
+			key:        func(*testing.T, APIKeyService) string { return "xak_aaaaaaaa_secret" },
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewAPIKeyService(opts.DB(), newTestCache(), 0, opts.Logger())
+			h := middleware.Authenticate(opts.Logger(), s)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+			req := testRequest{method: http.MethodGet, path: "/", header: http.Header{"Authorization": {"ApiKey " + tt.key(t, s)}}}
+
+			// The second request is served from the cache.
+			for i := 0; i < 2; i++ {
+				if rw := req.serve(h); rw.Code != tt.wantStatus {
+					t.Errorf("request %d: status = %d, want %d", i, rw.Code, tt.wantStatus)
+				}
+			}
+		})
+	}
+}
+
+// racingCache revokes a key right before its entry is read or written, as
+// a revocation on another instance could.
+type racingCache struct {
+	*testCache
+	key    string
+	write  bool
+	revoke func()
+}
+
+func (c *racingCache) race(key string) {
+	if key == c.key && c.revoke != nil {
+		revoke := c.revoke
+		c.revoke = nil
+		revoke()
+	}
+}
+
+func (c *racingCache) Get(ctx context.Context, key string) (string, error) {
+	v, err := c.testCache.Get(ctx, key)
+	if !c.write && err == nil {
+		c.race(key)
+	}
+
+	return v, err
+}
+
+func (c *racingCache) Set(ctx context.Context, key, value string, ttl time.Duration) error {
+	if c.write {
+		c.race(key)
+	}
+
+	return c.testCache.Set(ctx, key, value, ttl)
+}
+
+func (c *racingCache) Add(ctx context.Context, key, value string, ttl time.Duration) (bool, error) {
+	if c.write {
+		c.race(key)
+	}
+
+	return c.testCache.Add(ctx, key, value, ttl)
+}
+
+func TestAPIKeyRevokedWhileInUse(t *testing.T) {
+	tests := []struct {
+		name  string
+		write bool
+	}{
+		// The request read the key from the database before the revocation
+		// and caches it after.
+		{name: "revoked while looked up", write: true},
+		// The request read the key from the cache before the revocation and
+		// records its use after.
+		{name: "revoked while used"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			opts := testOpts{db: newTestDB(t)}
+			cache := &racingCache{testCache: newTestCache(), write: tt.write}
+			s := NewAPIKeyService(opts.DB(), cache, 0, opts.Logger())
+
+			created, err := s.CreateAPIKey(ctx, APIKeyCreate{Name: "ci"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			h := middleware.Authenticate(opts.Logger(), s)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+			req := func(key string) testRequest {
+				return testRequest{method: http.MethodGet, path: "/", header: http.Header{"Authorization": {"ApiKey " + key}}}
+			}
+
+			if !tt.write {
+				// A wrong secret caches the entry without using the key.
+				if rw := req(created.Key[:len(created.Key)-1] + "x").serve(h); rw.Code != http.StatusUnauthorized {
+					t.Fatalf("wrong secret: status = %d", rw.Code)
+				}
+			}
+
+			cache.key = apiKeyCacheKey(created.Prefix)
+			cache.revoke = func() {
+				if err := s.RevokeAPIKey(ctx, created.ID); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// The request in flight during the revocation may still pass.
+			req(created.Key).serve(h)
+
+			if cache.revoke != nil {
+				t.Fatal("the key was not revoked during the request")
+			}
+
+			if rw := req(created.Key).serve(h); rw.Code != http.StatusUnauthorized {
+				t.Errorf("after revocation: status = %d, want %d", rw.Code, http.StatusUnauthorized)
+			}
+		})
+	}
+}
+
+func TestAPIKeyLastUsed(t *testing.T) {
+	ctx := context.Background()
+	opts := testOpts{db: newTestDB(t), cache: newTestCache()}
+	s := NewAPIKeyService(opts.DB(), opts.Cache(), 0, opts.Logger())
+
+	created, err := s.CreateAPIKey(ctx, APIKeyCreate{Name: "ci"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 3; i++ {
+		if _, err := s.Authenticate(ctx, created.Key); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	key, err := s.GetAPIKey(ctx, created.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if key.LastUsedAt == nil || key.LastUsedAt.Before(created.CreatedAt) {
+		t.Errorf("last_used_at = %v, want it set", key.LastUsedAt)
+	}
+}
@@ -0,0 +1,89 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// NewAuditHandler serves the audit log, which requires audit:read. It
+// belongs on the admin server.
+func NewAuditHandler(opts HandlerOpts) *AuditHandler {
+	return &AuditHandler{
+		opts:    opts,
+		service: NewAuditService(opts.DB()),
+	}
+}
+
+type AuditHandler struct {
+	opts    HandlerOpts
+	service AuditService
+}
+
+// ListEntries returns the newest entries first. They can be filtered by
+// actor, request, action, resource, outcome and time.
+func (h AuditHandler) ListEntries(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "audit.ListEntries")
+	defer span.End()
+
+	q, err := pagination.Parse(r.URL.Query(), database.AuditPagination)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	page, err := h.service.ListEntries(ctx, q)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writePage(ctx, h.opts.Logger(), rw, r, page)
+}
+
+func (h AuditHandler) GetEntry(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "audit.GetEntry")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("audit_id").String(id))
+
+	entry, err := h.service.GetEntry(ctx, id)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusOK, entry)
+}
+
+func (h AuditHandler) Routes() *chi.Mux {
+	r := chi.NewRouter()
+	r.Use(Authorize(h.opts, "audit:read"))
+
+	r.Get("/", h.ListEntries)
+	r.Get("/{id}", h.GetEntry)
+
+	return r
+}
+
+type AuditEntry struct {
+	ID        string                  `json:"id"`
+	Time      time.Time               `json:"time"`
+	ActorID   string                  `json:"actor_id"`
+	ActorKind string                  `json:"actor_kind"`
+	RequestID string                  `json:"request_id"`
+	IP        string                  `json:"ip"`
+	Action    string                  `json:"action"`
+	Resource  string                  `json:"resource"`
+	Outcome   string                  `json:"outcome"`
+	Detail    string                  `json:"detail,omitempty"`
+	Changes   map[string]audit.Change `json:"changes,omitempty"`
+}
@@ -0,0 +1,174 @@
+package handler
+
+import (
+	"context"
+	"time"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/google/uuid"
+)
+
+// recordTimeout bounds the write of an audit entry. Entries are written even
+// when the request they describe has been cancelled.
+const recordTimeout = 5 * time.Second
+
+// AuditService stores audit entries in the database and reads them back.
+type AuditService interface {
+	audit.Recorder
+	GetEntry(ctx context.Context, id string) (*AuditEntry, error)
+	ListEntries(ctx context.Context, q *pagination.Query) (*pagination.Page[AuditEntry], error)
+}
+
+func NewAuditService(db *database.DB) AuditService {
+	return &auditService{
+		repo: database.NewAuditRepository(db),
+	}
+}
+
+type auditService struct {
+	repo *database.AuditRepository
+}
+
+func (s *auditService) Record(ctx context.Context, e audit.Entry) error {
+	row := &database.AuditEntry{
+		ID:         uuid.NewString(),
+		OccurredAt: e.Time.UTC().Truncate(time.Microsecond),
+		ActorID:    e.ActorID,
+		ActorKind:  e.ActorKind,
+		RequestID:  e.RequestID,
+		IP:         e.IP,
+		Action:     e.Action,
+		Resource:   e.Resource,
+		Outcome:    string(e.Outcome),
+		Detail:     e.Detail,
+	}
+
+	if len(e.Changes) > 0 {
+		b, err := json.Marshal(e.Changes)
+		if err != nil {
+			return err
+		}
+
+		changes := string(b)
+		row.Changes = &changes
+	}
+
+	ctx, cancel := context.WithTimeout(detach(ctx), recordTimeout)
+	defer cancel()
+
+	return s.repo.Create(ctx, row)
+}
+
+func (s *auditService) GetEntry(ctx context.Context, id string) (*AuditEntry, error) {
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toAuditEntry(row)
+}
+
+func (s *auditService) ListEntries(ctx context.Context, q *pagination.Query) (*pagination.Page[AuditEntry], error) {
+	rows, next, err := s.repo.List(ctx, q)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	page := &pagination.Page[AuditEntry]{
+		Data:       make([]AuditEntry, 0, len(rows)),
+		NextCursor: next,
+	}
+
+	for i := range rows {
+		e, err := toAuditEntry(&rows[i])
+		if err != nil {
+			return nil, err
+		}
+
+		page.Data = append(page.Data, *e)
+	}
+
+	return page, nil
+}
+
+func toAuditEntry(row *database.AuditEntry) (*AuditEntry, error) {
+	e := &AuditEntry{
+		ID:        row.ID,
+		Time:      row.OccurredAt,
+		ActorID:   row.ActorID,
+		ActorKind: row.ActorKind,
+		RequestID: row.RequestID,
+		IP:        row.IP,
+		Action:    row.Action,
+		Resource:  row.Resource,
+		Outcome:   row.Outcome,
+		Detail:    row.Detail,
+	}
+
+	if row.Changes != nil {
+		if err := json.Unmarshal([]byte(*row.Changes), &e.Changes); err != nil {
+			return nil, err
+		}
+	}
+
+	return e, nil
+}
+
+// record audits a mutation of resource that ended with err. before and after
+// are the states of the resource around it, nil when it did not exist. The
+// mutation has happened or failed by now, so failing to record it is logged
+// rather than returned. A nil recorder records nothing.
+func record(ctx context.Context, recorder audit.Recorder, logger logging.Logger, action, resource string, before, after interface{}, err error) {
+	if recorder == nil {
+		return
+	}
+
+	e := audit.New(ctx, action, resource, audit.Succeeded)
+
+	if err != nil {
+		p := problem.From(err)
+
+		e.Outcome, e.Detail = audit.Failed, string(p.Code)
+		if p.Detail != "" {
+			e.Detail += ": " + p.Detail
+		}
+	} else if before != nil || after != nil {
+		changes, derr := audit.Diff(before, after)
+		if derr != nil {
+			logging.FromContext(ctx, logger).Error(derr)
+		}
+
+		e.Changes = changes
+	}
+
+	if err := recorder.Record(ctx, e); err != nil {
+		logging.FromContext(ctx, logger).Error(err)
+	}
+}
+
+// detached keeps the values of a context but not its deadline and
+// cancellation.
+type detached struct {
+	context.Context
+}
+
+func detach(ctx context.Context) context.Context {
+	return detached{ctx}
+}
+
+func (detached) Deadline() (time.Time, bool) {
+	return time.Time{}, false
+}
+
+func (detached) Done() <-chan struct{} {
+	return nil
+}
+
+func (detached) Err() error {
+	return nil
+}
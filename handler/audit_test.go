@@ -0,0 +1,412 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/authz"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/handler/middleware"
+	"github.com/go-chi/chi/v5"
+)
+
+// auditOpts record audit entries in the database.
+type auditOpts struct {
+	testOpts
+	authorizer *authz.Authorizer
+}
+
+func (o auditOpts) Authorizer() *authz.Authorizer { return o.authorizer }
+func (o auditOpts) AuditRecorder() audit.Recorder { return NewAuditService(o.DB()) }
+
+// listAudit returns the entries of an audit list request.
+func listAudit(t *testing.T, h http.Handler, query string) *auditPage {
+	t.Helper()
+
+	rw := testRequest{method: http.MethodGet, path: "/audit?" + query}.serve(h)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET /audit?%s: status = %d, body = %s", query, rw.Code, rw.Body)
+	}
+
+	var page auditPage
+	if err := json.Unmarshal(rw.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	page.link = rw.Header().Get("Link")
+
+	return &page
+}
+
+type auditPage struct {
+	Data       []AuditEntry `json:"data"`
+	NextCursor string       `json:"next_cursor"`
+	link       string
+}
+
+func TestAuditMutations(t *testing.T) {
+	tests := []struct {
+		name        string
+		req         testRequest
+		wantAction  string
+		wantTarget  string
+		wantOutcome audit.Outcome
+		wantDetail  string
+		wantChanges []string
+	}{
+		{
+			name:        "create user",
+			req:         testRequest{method: http.MethodPost, path: "/users", body: `{"email":"grace@example.com","name":"Grace"}`},
+			wantAction:  "user.create",
+			wantOutcome: audit.Succeeded,
+			wantChanges: []string{"created_at", "email", "id", "name", "updated_at"},
+		},
+		{
+			name:        "update user",
+			req:         testRequest{method: http.MethodPut, path: "/users/{ada}", body: `{"email":"ada@example.com","name":"Ada Lovelace"}`},
+			wantAction:  "user.update",
+			wantTarget:  "users/{ada}",
+			wantOutcome: audit.Succeeded,
+			wantChanges: []string{"name", "updated_at"},
+		},
+		{
+			name:        "update with stale version",
+			req:         testRequest{method: http.MethodPut, path: "/users/{ada}", body: `{"email":"ada@example.com","name":"Ada Lovelace"}`, header: http.Header{"If-Match": {`"41"`}}},
+			wantAction:  "user.update",
+			wantTarget:  "users/{ada}",
+			wantOutcome: audit.Failed,
+			wantDetail:  "precondition_failed",
+		},
+		{
+			name:        "delete user",
+			req:         testRequest{method: http.MethodDelete, path: "/users/{ada}"},
+			wantAction:  "user.delete",
+			wantTarget:  "users/{ada}",
+			wantOutcome: audit.Succeeded,
+			wantChanges: []string{"deleted_at", "updated_at"},
+		},
+		{
+			name:        "delete unknown user",
+			req:         testRequest{method: http.MethodDelete, path: "/users/unknown"},
+			wantAction:  "user.delete",
+			wantTarget:  "users/unknown",
+			wantOutcome: audit.Failed,
+			wantDetail:  "not_found",
+		},
+		{
+			name:        "create group",
+			req:         testRequest{method: http.MethodPost, path: "/groups", body: `{"name":"admins"}`},
+			wantAction:  "group.create",
+			wantOutcome: audit.Succeeded,
+			wantChanges: []string{"created_at", "description", "id", "name", "updated_at"},
+		},
+		{
+			name:        "add member",
+			req:         testRequest{method: http.MethodPost, path: "/groups/{staff}/members", body: `{"user_id":"{ada}"}`},
+			wantAction:  "group.member.add",
+			wantTarget:  "groups/{staff}/members/{ada}",
+			wantOutcome: audit.Succeeded,
+			wantChanges: []string{"created_at", "group_id", "user_id"},
+		},
+		{
+			name:        "add role",
+			req:         testRequest{method: http.MethodPut, path: "/groups/{staff}/roles/viewer"},
+			wantAction:  "group.role.add",
+			wantTarget:  "groups/{staff}/roles/viewer",
+			wantOutcome: audit.Succeeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := auditOpts{testOpts: testOpts{db: newTestDB(t)}}
+
+			router := chi.NewRouter()
+			router.Use(middleware.RequestID, middleware.AuditRequest)
+			router.Mount("/users", NewUserHandler(opts).Routes())
+			router.Mount("/groups", NewGroupHandler(opts).Routes())
+			router.Mount("/audit", NewAuditHandler(opts).Routes())
+
+			h := as(&auth.Principal{Subject: "root", Kind: auth.KindOperator}, router)
+
+			ids := map[string]string{
+				"{ada}":   mustCreate(t, h, "/users", `{"email":"ada@example.com","name":"Ada"}`),
+				"{staff}": mustCreate(t, h, "/groups", `{"name":"staff"}`),
+			}
+
+			var replacements []string
+			for k, v := range ids {
+				replacements = append(replacements, k, v)
+			}
+
+			replacer := strings.NewReplacer(replacements...)
+			tt.req.path = replacer.Replace(tt.req.path)
+			tt.req.body = replacer.Replace(tt.req.body)
+
+			rw := tt.req.serve(h)
+			requestID := rw.Header().Get("X-Request-ID")
+
+			page := listAudit(t, h, url.Values{"request_id": {requestID}}.Encode())
+			if len(page.Data) != 1 {
+				t.Fatalf("entries = %+v, want one for the request", page.Data)
+			}
+
+			e := page.Data[0]
+
+			wantTarget := replacer.Replace(tt.wantTarget)
+			if wantTarget == "" {
+				wantTarget = strings.TrimPrefix(rw.Header().Get("Location"), "/")
+			}
+
+			if e.Action != tt.wantAction || e.Resource != wantTarget || e.Outcome != string(tt.wantOutcome) {
+				t.Errorf("entry = %s %s %s, want %s %s %s", e.Action, e.Resource, e.Outcome, tt.wantAction, wantTarget, tt.wantOutcome)
+			}
+
+			if e.ActorID != "root" || e.ActorKind != string(auth.KindOperator) || e.RequestID != requestID || e.IP != "192.0.2.1" {
+				t.Errorf("entry = %+v, want root's request %s from 192.0.2.1", e, requestID)
+			}
+
+			if !strings.HasPrefix(e.Detail, tt.wantDetail) {
+				t.Errorf("detail = %q, want %q", e.Detail, tt.wantDetail)
+			}
+
+			changed := make([]string, 0, len(e.Changes))
+			for k := range e.Changes {
+				changed = append(changed, k)
+			}
+
+			sort.Strings(changed)
+
+			if strings.Join(changed, ",") != strings.Join(tt.wantChanges, ",") {
+				t.Errorf("changed = %v, want %v", changed, tt.wantChanges)
+			}
+
+			if rw := (testRequest{method: http.MethodGet, path: "/audit/" + e.ID}).serve(h); rw.Code != http.StatusOK {
+				t.Errorf("GET /audit/%s: status = %d", e.ID, rw.Code)
+			}
+		})
+	}
+}
+
+func TestAuditChangesHoldBeforeAndAfter(t *testing.T) {
+	opts := auditOpts{testOpts: testOpts{db: newTestDB(t)}}
+
+	router := chi.NewRouter()
+	router.Mount("/users", NewUserHandler(opts).Routes())
+	router.Mount("/audit", NewAuditHandler(opts).Routes())
+
+	id := mustCreate(t, router, "/users", `{"email":"ada@example.com","name":"Ada"}`)
+
+	if rw := (testRequest{method: http.MethodPut, path: "/users/" + id, body: `{"email":"ada@example.com","name":"Ada Lovelace"}`}).serve(router); rw.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rw.Code, rw.Body)
+	}
+
+	page := listAudit(t, router, "action=user.update")
+	if len(page.Data) != 1 {
+		t.Fatalf("entries = %+v, want one", page.Data)
+	}
+
+	want := audit.Change{Before: "Ada", After: "Ada Lovelace"}
+	if got := page.Data[0].Changes["name"]; !reflect.DeepEqual(got, want) {
+		t.Errorf("name change = %+v, want %+v", got, want)
+	}
+}
+
+func TestAuditList(t *testing.T) {
+	ctx := context.Background()
+	opts := auditOpts{testOpts: testOpts{db: newTestDB(t)}}
+	service := NewAuditService(opts.DB())
+
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	entries := []audit.Entry{
+		{Action: "user.create", Resource: "users/1", ActorID: "ada", ActorKind: "user", Outcome: audit.Succeeded},
+		{Action: "user.update", Resource: "users/1", ActorID: "ada", ActorKind: "user", Outcome: audit.Succeeded},
+		{Action: "user.update", Resource: "users/1", ActorID: "grace", ActorKind: "user", Outcome: audit.Failed, Detail: "conflict"},
+		{Action: "user.delete", Resource: "users/1", ActorID: "root", ActorKind: "operator", Outcome: audit.Succeeded},
+		{Action: "group.create", Resource: "groups/1", ActorID: "root", ActorKind: "operator", Outcome: audit.Succeeded},
+	}
+
+	for i, e := range entries {
+		e.Time = start.Add(time.Duration(i) * time.Hour)
+		e.RequestID = "request-" + string(rune('a'+i))
+
+		if err := service.Record(ctx, e); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	h := chi.NewRouter()
+	h.Mount("/audit", NewAuditHandler(opts).Routes())
+
+	tests := []struct {
+		name  string
+		query url.Values
+		want  []string
+	}{
+		{name: "newest first", query: url.Values{}, want: []string{"request-e", "request-d", "request-c", "request-b", "request-a"}},
+		{name: "oldest first", query: url.Values{"sort": {"occurred_at"}}, want: []string{"request-a", "request-b", "request-c", "request-d", "request-e"}},
+		{name: "by actor", query: url.Values{"actor_id": {"root"}}, want: []string{"request-e", "request-d"}},
+		{name: "by actor kind", query: url.Values{"actor_kind": {"user"}}, want: []string{"request-c", "request-b", "request-a"}},
+		{name: "by request", query: url.Values{"request_id": {"request-b"}}, want: []string{"request-b"}},
+		{name: "by action", query: url.Values{"action": {"user.update"}}, want: []string{"request-c", "request-b"}},
+		{name: "by resource", query: url.Values{"resource": {"groups/1"}}, want: []string{"request-e"}},
+		{name: "by outcome", query: url.Values{"outcome": {"failed"}}, want: []string{"request-c"}},
+		{
+			name:  "by time",
+			query: url.Values{"occurred_after": {start.Format(time.RFC3339)}, "occurred_before": {start.Add(3 * time.Hour).Format(time.RFC3339)}},
+			want:  []string{"request-c", "request-b"},
+		},
+		{name: "combined", query: url.Values{"resource": {"users/1"}, "outcome": {"succeeded"}, "actor_id": {"ada"}}, want: []string{"request-b", "request-a"}},
+		{name: "no match", query: url.Values{"action": {"user.restore"}}, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page := listAudit(t, h, tt.query.Encode())
+
+			got := make([]string, 0, len(page.Data))
+			for _, e := range page.Data {
+				got = append(got, e.RequestID)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("entries = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("pages", func(t *testing.T) {
+		var got []string
+
+		query := url.Values{"limit": {"2"}}
+		for pages := 0; ; pages++ {
+			if pages == len(entries) {
+				t.Fatal("pagination does not end")
+			}
+
+			page := listAudit(t, h, query.Encode())
+			for _, e := range page.Data {
+				got = append(got, e.RequestID)
+			}
+
+			if page.NextCursor == "" {
+				if page.link != "" {
+					t.Errorf("Link = %q on the last page", page.link)
+				}
+
+				break
+			}
+
+			if len(page.Data) != 2 || !strings.Contains(page.link, `rel="next"`) {
+				t.Errorf("page = %d entries, Link %q, want 2 and a next link", len(page.Data), page.link)
+			}
+
+			query.Set("cursor", page.NextCursor)
+		}
+
+		want := []string{"request-e", "request-d", "request-c", "request-b", "request-a"}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("entries = %v, want %v", got, want)
+		}
+	})
+
+	for _, query := range []string{"occurred_after=yesterday", "limit=0", "sort=actor_id", "cursor=garbage"} {
+		t.Run(query, func(t *testing.T) {
+			if rw := (testRequest{method: http.MethodGet, path: "/audit?" + query}).serve(h); rw.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rw.Code, http.StatusBadRequest)
+			}
+		})
+	}
+
+	t.Run("unknown entry", func(t *testing.T) {
+		if rw := (testRequest{method: http.MethodGet, path: "/audit/unknown"}).serve(h); rw.Code != http.StatusNotFound {
+			t.Errorf("status = %d, want %d", rw.Code, http.StatusNotFound)
+		}
+	})
+}
+
+func TestAuditPermission(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  *auth.Principal
+		wantStatus int
+	}{
+		{name: "unauthenticated", wantStatus: http.StatusUnauthorized},
+		{name: "operator", principal: &auth.Principal{Subject: "root", Kind: auth.KindOperator}, wantStatus: http.StatusOK},
+		{name: "admin", principal: &auth.Principal{Subject: "{admin}", Kind: auth.KindUser}, wantStatus: http.StatusOK},
+		{name: "auditor", principal: &auth.Principal{Subject: "{auditor}", Kind: auth.KindUser}, wantStatus: http.StatusOK},
+		{name: "editor", principal: &auth.Principal{Subject: "{editor}", Kind: auth.KindUser}, wantStatus: http.StatusForbidden},
+		{name: "API key in scope", principal: &auth.Principal{Subject: "key", Kind: auth.KindAPIKey, Scopes: []string{"audit:read"}}, wantStatus: http.StatusOK},
+		{name: "API key out of scope", principal: &auth.Principal{Subject: "key", Kind: auth.KindAPIKey, Scopes: []string{"users:read", "users:write"}}, wantStatus: http.StatusForbidden},
+		{name: "client in scope", principal: &auth.Principal{Subject: "ci", Kind: auth.KindClient, Scopes: []string{"audit:read"}}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			opts := auditOpts{
+				testOpts: testOpts{db: db},
+				authorizer: authz.New(authz.Options{
+					Roles: map[string][]string{
+						"editor":  {"users:read", "users:write", "groups:read", "groups:write"},
+						"auditor": {"audit:read"},
+						"admin":   {"*"},
+					},
+					Resolver: database.NewGroupRepository(db),
+					Logger:   testOpts{}.Logger(),
+				}),
+			}
+
+			router := chi.NewRouter()
+			router.Mount("/users", NewUserHandler(opts).Routes())
+			router.Mount("/groups", NewGroupHandler(opts).Routes())
+			router.Mount("/audit", NewAuditHandler(opts).Routes())
+
+			operator := as(&auth.Principal{Subject: "root", Kind: auth.KindOperator}, router)
+			ids := map[string]string{}
+
+			for _, role := range []string{"editor", "auditor", "admin"} {
+				user := mustCreate(t, operator, "/users", `{"email":"`+role+`@example.com","name":"`+role+`"}`)
+				group := mustCreate(t, operator, "/groups", `{"name":"`+role+`s"}`)
+
+				if rw := (testRequest{method: http.MethodPut, path: "/groups/" + group + "/roles/" + role}).serve(operator); rw.Code != http.StatusNoContent {
+					t.Fatalf("granting %s: status = %d, body = %s", role, rw.Code, rw.Body)
+				}
+
+				mustCreate(t, operator, "/groups/"+group+"/members", `{"user_id":"`+user+`"}`)
+
+				ids["{"+role+"}"] = user
+			}
+
+			var p *auth.Principal
+			if tt.principal != nil {
+				principal := *tt.principal
+				if id, ok := ids[principal.Subject]; ok {
+					principal.Subject = id
+				}
+
+				p = &principal
+			}
+
+			h := as(p, router)
+
+			if rw := (testRequest{method: http.MethodGet, path: "/audit"}).serve(h); rw.Code != tt.wantStatus {
+				t.Fatalf("GET /audit: status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			entry := listAudit(t, operator, "limit=1").Data[0]
+			if rw := (testRequest{method: http.MethodGet, path: "/audit/" + entry.ID}).serve(h); rw.Code != tt.wantStatus {
+				t.Errorf("GET /audit/{id}: status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+		})
+	}
+}
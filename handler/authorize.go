@@ -0,0 +1,39 @@
+package handler
+
+import (
+	"net/http"
+
+	"github.com/edalmi/x-api/handler/middleware"
+)
+
+// Authorize requires the principal of a request to hold permission, and so
+// refuses requests that were not authenticated. Routes are only open when
+// HandlerOpts has no authorizer, which the server always has.
+func Authorize(opts HandlerOpts, permission string) func(http.Handler) http.Handler {
+	return AuthorizeOrSelf(opts, permission, "")
+}
+
+// AuthorizeOrSelf is Authorize, except that users may also act on
+// themselves, identified by the URL parameter param.
+func AuthorizeOrSelf(opts HandlerOpts, permission, param string) func(http.Handler) http.Handler {
+	authorizer := opts.Authorizer()
+	if authorizer == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return middleware.RequireOrSelf(authorizer, opts.AuditRecorder(), opts.Logger(), permission, param)
+}
+
+// authorized returns nil when the principal of r holds permission, which
+// some requests need in addition to that of their route. Like routes,
+// every request is authorized when HandlerOpts has no authorizer.
+func authorized(r *http.Request, opts HandlerOpts, permission string) error {
+	authorizer := opts.Authorizer()
+	if authorizer == nil {
+		return nil
+	}
+
+	return middleware.Check(r, authorizer, opts.AuditRecorder(), opts.Logger(), permission)
+}
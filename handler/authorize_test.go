@@ -0,0 +1,164 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/authz"
+	"github.com/edalmi/x-api/database"
+	"github.com/go-chi/chi/v5"
+)
+
+// authzOpts are the HandlerOpts of a server that authorizes requests with
+// the roles users hold through their groups.
+type authzOpts struct {
+	testOpts
+	authorizer *authz.Authorizer
+}
+
+func (o authzOpts) Authorizer() *authz.Authorizer { return o.authorizer }
+func (o authzOpts) AuditRecorder() audit.Recorder { return audit.NewLogRecorder(o.Logger()) }
+
+// as serves requests made by p.
+func as(p *auth.Principal, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if p != nil {
+			r = r.WithContext(auth.WithPrincipal(r.Context(), p))
+		}
+
+		h.ServeHTTP(rw, r)
+	})
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name       string
+		principal  string
+		scopes     []string
+		req        testRequest
+		wantStatus int
+	}{
+		{name: "unauthenticated", req: testRequest{method: http.MethodGet, path: "/users"}, wantStatus: http.StatusUnauthorized},
+		{name: "operator", principal: "operator", req: testRequest{method: http.MethodGet, path: "/users"}, wantStatus: http.StatusOK},
+		{name: "user without roles", principal: "{ada}", req: testRequest{method: http.MethodGet, path: "/users"}, wantStatus: http.StatusForbidden},
+		{name: "viewer reads", principal: "{viewer}", req: testRequest{method: http.MethodGet, path: "/users"}, wantStatus: http.StatusOK},
+		{name: "viewer writes", principal: "{viewer}", req: testRequest{method: http.MethodDelete, path: "/users/{ada}"}, wantStatus: http.StatusForbidden},
+		{name: "editor writes", principal: "{editor}", req: testRequest{method: http.MethodDelete, path: "/users/{ada}"}, wantStatus: http.StatusNoContent},
+		{name: "editor includes deleted", principal: "{editor}", req: testRequest{method: http.MethodGet, path: "/users?include_deleted=true"}, wantStatus: http.StatusForbidden},
+		{name: "admin includes deleted", principal: "{admin}", req: testRequest{method: http.MethodGet, path: "/users?include_deleted=true"}, wantStatus: http.StatusOK},
+		{
+			name:       "user sets own password",
+			principal:  "{ada}",
+			req:        testRequest{method: http.MethodPost, path: "/users/{ada}/password", body: `{"password":"correct horse battery"}`},
+			wantStatus: http.StatusNoContent,
+		},
+		{
+			name:       "editor sets password of other user",
+			principal:  "{editor}",
+			req:        testRequest{method: http.MethodPost, path: "/users/{ada}/password", body: `{"password":"correct horse battery"}`},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "admin sets password of other user",
+			principal:  "{admin}",
+			req:        testRequest{method: http.MethodPost, path: "/users/{ada}/password", body: `{"password":"correct horse battery"}`},
+			wantStatus: http.StatusNoContent,
+		},
+		{name: "editor adds member to group without roles", principal: "{editor}", req: testRequest{method: http.MethodPost, path: "/groups/{plain}/members", body: `{"user_id":"{ada}"}`}, wantStatus: http.StatusCreated},
+		{name: "editor adds member to group with roles", principal: "{editor}", req: testRequest{method: http.MethodPost, path: "/groups/{admins}/members", body: `{"user_id":"{ada}"}`}, wantStatus: http.StatusForbidden},
+		{name: "editor removes member of group with roles", principal: "{editor}", req: testRequest{method: http.MethodDelete, path: "/groups/{admins}/members/{admin}"}, wantStatus: http.StatusForbidden},
+		{name: "editor deletes group with roles", principal: "{editor}", req: testRequest{method: http.MethodDelete, path: "/groups/{admins}"}, wantStatus: http.StatusForbidden},
+		{name: "editor grants role", principal: "{editor}", req: testRequest{method: http.MethodPut, path: "/groups/{plain}/roles/admin"}, wantStatus: http.StatusForbidden},
+		{name: "admin grants role", principal: "{admin}", req: testRequest{method: http.MethodPut, path: "/groups/{plain}/roles/admin"}, wantStatus: http.StatusNoContent},
+		{name: "viewer exports", principal: "{viewer}", req: testRequest{method: http.MethodGet, path: "/users:export"}, wantStatus: http.StatusOK},
+		{name: "user without roles exports", principal: "{ada}", req: testRequest{method: http.MethodGet, path: "/users:export"}, wantStatus: http.StatusForbidden},
+		{name: "editor exports deleted", principal: "{editor}", req: testRequest{method: http.MethodGet, path: "/users:export?include_deleted=true"}, wantStatus: http.StatusForbidden},
+		{
+			name:       "viewer imports",
+			principal:  "{viewer}",
+			req:        testRequest{method: http.MethodPost, path: "/users:import", body: `{"email":"grace@example.com","name":"Grace"}`, header: ndjson},
+			wantStatus: http.StatusForbidden,
+		},
+		{
+			name:       "editor imports",
+			principal:  "{editor}",
+			req:        testRequest{method: http.MethodPost, path: "/users:import", body: `{"email":"grace@example.com","name":"Grace"}`, header: ndjson},
+			wantStatus: http.StatusOK,
+		},
+		{name: "API key in scope", principal: "key", scopes: []string{"users:read"}, req: testRequest{method: http.MethodGet, path: "/users"}, wantStatus: http.StatusOK},
+		{name: "API key out of scope", principal: "key", scopes: []string{"users:read"}, req: testRequest{method: http.MethodGet, path: "/groups"}, wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			opts := authzOpts{
+				testOpts: testOpts{db: db},
+				authorizer: authz.New(authz.Options{
+					Roles: map[string][]string{
+						"viewer": {"users:read", "groups:read"},
+						"editor": {"users:read", "users:write", "groups:read", "groups:write"},
+						"admin":  {"*"},
+					},
+					Resolver: database.NewGroupRepository(db),
+					Logger:   testOpts{}.Logger(),
+				}),
+			}
+
+			users := NewUserHandler(opts)
+
+			h := chi.NewRouter()
+			h.Mount("/users", users.Routes())
+			h.With(Authorize(opts, "users:write")).Post("/users:import", users.ImportUsers)
+			h.With(Authorize(opts, "users:read")).Get("/users:export", users.ExportUsers)
+			h.Mount("/groups", NewGroupHandler(opts).Routes())
+
+			operator := as(&auth.Principal{Subject: "root", Kind: auth.KindOperator}, h)
+			ids := map[string]string{
+				"{ada}":   mustCreate(t, operator, "/users", `{"email":"ada@example.com","name":"Ada"}`),
+				"{plain}": mustCreate(t, operator, "/groups", `{"name":"plain"}`),
+			}
+
+			for _, role := range []string{"viewer", "editor", "admin"} {
+				user := mustCreate(t, operator, "/users", `{"email":"`+role+`@example.com","name":"`+role+`"}`)
+				group := mustCreate(t, operator, "/groups", `{"name":"`+role+`s"}`)
+
+				if rw := (testRequest{method: http.MethodPut, path: "/groups/" + group + "/roles/" + role}).serve(operator); rw.Code != http.StatusNoContent {
+					t.Fatalf("granting %s: status = %d, body = %s", role, rw.Code, rw.Body)
+				}
+
+				mustCreate(t, operator, "/groups/"+group+"/members", `{"user_id":"`+user+`"}`)
+
+				ids["{"+role+"}"] = user
+				ids["{"+role+"s}"] = group
+			}
+
+			var replacements []string
+			for k, v := range ids {
+				replacements = append(replacements, k, v)
+			}
+
+			replacer := strings.NewReplacer(replacements...)
+			tt.req.path = replacer.Replace(tt.req.path)
+			tt.req.body = replacer.Replace(tt.req.body)
+
+			var p *auth.Principal
+			switch tt.principal {
+			case "":
+			case "operator":
+				p = &auth.Principal{Subject: "root", Kind: auth.KindOperator}
+			case "key":
+				p = &auth.Principal{Subject: "key", Kind: auth.KindAPIKey, Scopes: tt.scopes}
+			default:
+				p = &auth.Principal{Subject: replacer.Replace(tt.principal), Kind: auth.KindUser}
+			}
+
+			if rw := tt.req.serve(as(p, h)); rw.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+		})
+	}
+}
@@ -0,0 +1,43 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/edalmi/x-api/logging"
+	"github.com/go-chi/chi/v5"
+)
+
+// CacheResponses caches the responses of route when the server caches
+// responses. The requests read the resource that resource returns.
+func CacheResponses(opts HandlerOpts, route string, resource func(r *http.Request) string) func(http.Handler) http.Handler {
+	cache := opts.ResponseCache()
+	if cache == nil {
+		return func(next http.Handler) http.Handler {
+			return next
+		}
+	}
+
+	return cache.Handler(route, resource)
+}
+
+// invalidate drops the cached responses of resource. It runs once the
+// resource has changed, so a failure is logged rather than returned.
+func invalidate(ctx context.Context, opts HandlerOpts, resource string) {
+	cache := opts.ResponseCache()
+	if cache == nil {
+		return
+	}
+
+	if err := cache.Invalidate(ctx, resource); err != nil {
+		logging.FromContext(ctx, opts.Logger()).Error(err)
+	}
+}
+
+// resourceParam returns a function naming the resource of a request by the
+// URL parameter param.
+func resourceParam(name func(id string) string, param string) func(r *http.Request) string {
+	return func(r *http.Request) string {
+		return name(chi.URLParam(r, param))
+	}
+}
@@ -0,0 +1,158 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/password"
+	"github.com/edalmi/x-api/problem"
+	"github.com/jmoiron/sqlx"
+)
+
+var errInvalidCredentials = problem.New(problem.CodeUnauthorized, "invalid credentials")
+
+type CredentialService interface {
+	SetPassword(ctx context.Context, userID string, in PasswordChange) error
+	VerifyPassword(ctx context.Context, userID, password string) error
+}
+
+// NewCredentialService returns a CredentialService that audits password
+// changes with recorder, which may be nil.
+func NewCredentialService(db *database.DB, hasher *password.Hasher, policy password.Policy, recorder audit.Recorder, logger logging.Logger) CredentialService {
+	return &credentialService{
+		db:       db,
+		users:    database.NewUserRepository(db),
+		repo:     database.NewCredentialRepository(db),
+		hasher:   hasher,
+		policy:   policy,
+		recorder: recorder,
+		logger:   logger,
+	}
+}
+
+type credentialService struct {
+	db       *database.DB
+	users    *database.UserRepository
+	repo     *database.CredentialRepository
+	hasher   *password.Hasher
+	policy   password.Policy
+	recorder audit.Recorder
+	logger   logging.Logger
+}
+
+// SetPassword sets the password of a user. Once a password is set, changing
+// it requires the current one. The entry it records never holds a hash.
+func (s *credentialService) SetPassword(ctx context.Context, userID string, in PasswordChange) (err error) {
+	defer func() {
+		record(ctx, s.recorder, s.logger, "user.password", userResource(userID), nil, nil, err)
+	}()
+
+	if err := s.policy.Check(in.Password); err != nil {
+		return passwordError(err)
+	}
+
+	hash, err := s.hasher.Hash(in.Password)
+	if err != nil {
+		return passwordError(err)
+	}
+
+	err = s.db.InTx(ctx, func(tx *sqlx.Tx) error {
+		if _, err := s.users.Tx(tx).GetForUpdate(ctx, userID); err != nil {
+			return err
+		}
+
+		repo := s.repo.Tx(tx)
+		now := now()
+
+		current, err := repo.Get(ctx, userID)
+		switch {
+		case errors.Is(err, database.ErrNotFound):
+			current = &database.Credential{UserID: userID, CreatedAt: now}
+		case err != nil:
+			return err
+		case in.CurrentPassword == "":
+			return problem.Fields{"current_password": "is required"}.Err()
+		default:
+			if _, err := s.hasher.Verify(in.CurrentPassword, current.PasswordHash); err != nil {
+				if errors.Is(err, password.ErrMismatch) {
+					return problem.New(problem.CodeForbidden, "current password is incorrect")
+				}
+
+				return err
+			}
+		}
+
+		current.PasswordHash = hash
+		current.UpdatedAt = now
+
+		return repo.Set(ctx, current)
+	})
+
+	return serviceError(err)
+}
+
+// VerifyPassword checks the password of a user and upgrades its hash when
+// the hashing parameters have changed since it was created.
+func (s *credentialService) VerifyPassword(ctx context.Context, userID, pw string) error {
+	cred, err := s.repo.Get(ctx, userID)
+	if errors.Is(err, database.ErrNotFound) {
+		// Hash anyway, so that the response time does not tell whether the
+		// user has a password.
+		if _, err := s.hasher.Hash(pw); err != nil {
+			logging.FromContext(ctx, s.logger).Error(err)
+		}
+
+		return errInvalidCredentials
+	}
+
+	if err != nil {
+		return err
+	}
+
+	rehash, err := s.hasher.Verify(pw, cred.PasswordHash)
+	if errors.Is(err, password.ErrMismatch) {
+		return errInvalidCredentials
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if rehash {
+		// The password is correct, so a failed upgrade must not fail the
+		// login. It is retried on the next one.
+		if err := s.rehash(ctx, cred, pw); err != nil {
+			logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"user_id": userID}).Error(err)
+		}
+	}
+
+	return nil
+}
+
+func (s *credentialService) rehash(ctx context.Context, cred *database.Credential, pw string) error {
+	hash, err := s.hasher.Hash(pw)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.repo.Rehash(ctx, cred.UserID, cred.PasswordHash, hash, now())
+
+	return err
+}
+
+// passwordError turns a rejected password into a validation error.
+func passwordError(err error) error {
+	var perr *password.PolicyError
+	switch {
+	case errors.As(err, &perr):
+		return problem.Fields{"password": strings.Join(perr.Violations, ", ")}.Err()
+	case errors.Is(err, password.ErrTooLong):
+		return problem.Fields{"password": "is too long"}.Err()
+	default:
+		return err
+	}
+}
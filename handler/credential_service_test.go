@@ -0,0 +1,212 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/password"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestSetPassword(t *testing.T) {
+	const current = "correct horse battery"
+
+	tests := []struct {
+		name        string
+		hasPassword bool
+		user        string
+		body        string
+		wantStatus  int
+		wantValid   string
+	}{
+		{name: "first password", body: `{"password":"correct horse battery"}`, wantStatus: http.StatusNoContent, wantValid: current},
+		{name: "policy violation", body: `{"password":"short"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "too long to hash", body: `{"password":"` + strings.Repeat("a", 73) + `"}`, wantStatus: http.StatusUnprocessableEntity},
+		{name: "unknown user", user: "unknown", body: `{"password":"correct horse battery"}`, wantStatus: http.StatusNotFound},
+		{
+			name:        "change",
+			hasPassword: true,
+			body:        `{"password":"battery staple horse","current_password":"correct horse battery"}`,
+			wantStatus:  http.StatusNoContent,
+			wantValid:   "battery staple horse",
+		},
+		{
+			name:        "change without current password",
+			hasPassword: true,
+			body:        `{"password":"battery staple horse"}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantValid:   current,
+		},
+		{
+			name:        "change with wrong current password",
+			hasPassword: true,
+			body:        `{"password":"battery staple horse","current_password":"correct horse staple"}`,
+			wantStatus:  http.StatusForbidden,
+			wantValid:   current,
+		},
+		{
+			name:        "change violating the policy",
+			hasPassword: true,
+			body:        `{"password":"short","current_password":"correct horse battery"}`,
+			wantStatus:  http.StatusUnprocessableEntity,
+			wantValid:   current,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOpts{db: newTestDB(t)}
+			h := NewUserHandler(opts).Routes()
+
+			id := mustCreate(t, h, "/", `{"email":"ada@example.com","name":"Ada"}`)
+
+			if tt.hasPassword {
+				if rw := (testRequest{method: http.MethodPost, path: "/" + id + "/password", body: `{"password":"` + current + `"}`}).serve(h); rw.Code != http.StatusNoContent {
+					t.Fatalf("setting password: status = %d, body = %s", rw.Code, rw.Body)
+				}
+			}
+
+			if tt.user == "" {
+				tt.user = id
+			}
+
+			rw := testRequest{method: http.MethodPost, path: "/" + tt.user + "/password", body: tt.body}.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if tt.wantValid == "" {
+				return
+			}
+
+			credentials := NewCredentialService(opts.DB(), opts.PasswordHasher(), opts.PasswordPolicy(), nil, opts.Logger())
+			if err := credentials.VerifyPassword(context.Background(), id, tt.wantValid); err != nil {
+				t.Errorf("VerifyPassword(%q) error = %v", tt.wantValid, err)
+			}
+		})
+	}
+}
+
+func TestVerifyPassword(t *testing.T) {
+	const pw = "correct horse battery"
+
+	older := mustTestHasher(t, bcrypt.MinCost)
+	newer := mustTestHasher(t, bcrypt.MinCost+1)
+
+	tests := []struct {
+		name       string
+		hashedWith *password.Hasher
+		verifyWith *password.Hasher
+		user       string
+		password   string
+		wantErr    error
+		wantRehash bool
+	}{
+		{name: "valid", hashedWith: older, verifyWith: older, password: pw},
+		{name: "wrong password", hashedWith: older, verifyWith: older, password: "correct horse staple", wantErr: errInvalidCredentials},
+		{name: "without password", verifyWith: older, password: pw, wantErr: errInvalidCredentials},
+		{name: "unknown user", hashedWith: older, verifyWith: older, user: "unknown", password: pw, wantErr: errInvalidCredentials},
+		{name: "outdated parameters", hashedWith: older, verifyWith: newer, password: pw, wantRehash: true},
+		{name: "outdated parameters and wrong password", hashedWith: older, verifyWith: newer, password: "correct horse staple", wantErr: errInvalidCredentials},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			opts := testOpts{db: newTestDB(t)}
+			id := mustCreate(t, NewUserHandler(opts).Routes(), "/", `{"email":"ada@example.com","name":"Ada"}`)
+
+			if tt.hashedWith != nil {
+				s := NewCredentialService(opts.DB(), tt.hashedWith, opts.PasswordPolicy(), nil, opts.Logger())
+				if err := s.SetPassword(ctx, id, PasswordChange{Password: pw}); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			repo := database.NewCredentialRepository(opts.DB())
+			before, _ := repo.Get(ctx, id)
+
+			if tt.user == "" {
+				tt.user = id
+			}
+
+			s := NewCredentialService(opts.DB(), tt.verifyWith, opts.PasswordPolicy(), nil, opts.Logger())
+			if err := s.VerifyPassword(ctx, tt.user, tt.password); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("VerifyPassword() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if before == nil {
+				return
+			}
+
+			after, err := repo.Get(ctx, id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if rehashed := after.PasswordHash != before.PasswordHash; rehashed != tt.wantRehash {
+				t.Errorf("rehashed = %v, want %v", rehashed, tt.wantRehash)
+			}
+
+			if err := s.VerifyPassword(ctx, id, pw); err != nil {
+				t.Errorf("VerifyPassword() after rehash error = %v", err)
+			}
+		})
+	}
+}
+
+// TestVerifyPasswordWithoutPassword checks that users without a password
+// take about as long to turn down as users with one, so that the response
+// time does not tell them apart.
+func TestVerifyPasswordWithoutPassword(t *testing.T) {
+	ctx := context.Background()
+	opts := testOpts{db: newTestDB(t)}
+	users := NewUserHandler(opts).Routes()
+
+	withPassword := mustCreate(t, users, "/", `{"email":"ada@example.com","name":"Ada"}`)
+	withoutPassword := mustCreate(t, users, "/", `{"email":"grace@example.com","name":"Grace"}`)
+
+	// A cost well above the minimum makes hashing dominate.
+	s := NewCredentialService(opts.DB(), mustTestHasher(t, bcrypt.MinCost+4), opts.PasswordPolicy(), nil, opts.Logger())
+	if err := s.SetPassword(ctx, withPassword, PasswordChange{Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	fastest := func(userID string) time.Duration {
+		var min time.Duration
+
+		for i := 0; i < 3; i++ {
+			start := time.Now()
+			if err := s.VerifyPassword(ctx, userID, "correct horse staple"); !errors.Is(err, errInvalidCredentials) {
+				t.Fatalf("VerifyPassword() error = %v, want errInvalidCredentials", err)
+			}
+
+			if d := time.Since(start); i == 0 || d < min {
+				min = d
+			}
+		}
+
+		return min
+	}
+
+	with, without := fastest(withPassword), fastest(withoutPassword)
+	if without < with/4 {
+		t.Errorf("turning down a user without a password took %v, with one %v", without, with)
+	}
+}
+
+func mustTestHasher(t *testing.T, cost int) *password.Hasher {
+	t.Helper()
+
+	h, err := password.NewHasher(password.Params{Algorithm: password.Bcrypt, BcryptCost: cost})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
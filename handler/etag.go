@@ -0,0 +1,69 @@
+package handler
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Precondition reports whether a change may be applied to a resource
+// currently at the given version.
+type Precondition func(version int64) bool
+
+func etag(version int64) string {
+	return `"` + strconv.FormatInt(version, 10) + `"`
+}
+
+// ifMatch returns the precondition expressed by the If-Match header, or
+// nil when the request is unconditional. Weak tags never match.
+func ifMatch(r *http.Request) Precondition {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return nil
+	}
+
+	tags := splitTags(header)
+
+	return func(version int64) bool {
+		current := etag(version)
+
+		for _, tag := range tags {
+			if tag == "*" || tag == current {
+				return true
+			}
+		}
+
+		return false
+	}
+}
+
+// notModified reports whether the If-None-Match header matches the version
+// using the weak comparison function.
+func notModified(r *http.Request, version int64) bool {
+	header := r.Header.Get("If-None-Match")
+	if header == "" {
+		return false
+	}
+
+	current := etag(version)
+
+	for _, tag := range splitTags(header) {
+		if tag == "*" || strings.TrimPrefix(tag, "W/") == current {
+			return true
+		}
+	}
+
+	return false
+}
+
+func splitTags(header string) []string {
+	var tags []string
+
+	for _, tag := range strings.Split(header, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
@@ -1,43 +1,315 @@
 package handler
 
 import (
-	"context"
 	"net/http"
+	"net/url"
+	"path"
+	"time"
 
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
 	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func NewGroupHandler(_ HandlerOpts) *GroupHandler {
-	return &GroupHandler{}
+func NewGroupHandler(opts HandlerOpts) *GroupHandler {
+	return &GroupHandler{
+		opts:    opts,
+		service: NewGroupService(opts.DB(), opts.Authorizer(), opts.Sessions(), opts.AuditRecorder(), opts.Logger()),
+	}
 }
 
 type GroupHandler struct {
-	opts HandlerOpts
+	opts    HandlerOpts
+	service GroupService
 }
 
-func (u GroupHandler) CreateGroup(rw http.ResponseWriter, r *http.Request) {}
+func (u GroupHandler) CreateGroup(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.CreateGroup")
+	defer span.End()
 
-func (u GroupHandler) ListGroups(rw http.ResponseWriter, r *http.Request) {}
+	var in GroupCreate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
 
-func (u GroupHandler) DeleteGroup(rw http.ResponseWriter, r *http.Request) {}
+	group, err := u.service.CreateGroup(ctx, in)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
 
-func (u GroupHandler) GetGroup(rw http.ResponseWriter, r *http.Request) {}
+	span.SetAttributes(attribute.Key("group_id").String(group.ID))
+
+	rw.Header().Set("Location", path.Join(r.URL.Path, url.PathEscape(group.ID)))
+	rw.Header().Set("ETag", etag(group.Version))
+	writeJSON(ctx, u.opts.Logger(), rw, http.StatusCreated, group)
+}
+
+func (u GroupHandler) ListGroups(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.ListGroups")
+	defer span.End()
+
+	q, err := pagination.Parse(r.URL.Query(), database.GroupPagination)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	page, err := u.service.ListGroups(ctx, q)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writePage(ctx, u.opts.Logger(), rw, r, page)
+}
+
+func (u GroupHandler) GetGroup(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.GetGroup")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("group_id").String(id))
+
+	group, err := u.service.GetGroup(ctx, id)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.Header().Set("ETag", etag(group.Version))
+
+	if notModified(r, group.Version) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(ctx, u.opts.Logger(), rw, http.StatusOK, group)
+}
+
+func (u GroupHandler) UpdateGroup(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.UpdateGroup")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("group_id").String(id))
+
+	var in GroupUpdate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	group, err := u.service.UpdateGroup(ctx, id, in, ifMatch(r))
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	invalidate(ctx, u.opts, groupResource(id))
+
+	rw.Header().Set("ETag", etag(group.Version))
+	writeJSON(ctx, u.opts.Logger(), rw, http.StatusOK, group)
+}
+
+func (u GroupHandler) DeleteGroup(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.DeleteGroup")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("group_id").String(id))
+
+	if err := u.service.DeleteGroup(ctx, id, ifMatch(r)); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	invalidate(ctx, u.opts, groupResource(id))
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (u GroupHandler) ListMembers(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.ListMembers")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("group_id").String(id))
+
+	users, err := u.service.ListMembers(ctx, id)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writeJSON(ctx, u.opts.Logger(), rw, http.StatusOK, users)
+}
+
+func (u GroupHandler) AddMember(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.AddMember")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+
+	var in MemberAdd
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Key("group_id").String(id),
+		attribute.Key("user_id").String(in.UserID),
+	)
+
+	member, err := u.service.AddMember(ctx, id, in)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.Header().Set("Location", path.Join(r.URL.Path, url.PathEscape(member.UserID)))
+	writeJSON(ctx, u.opts.Logger(), rw, http.StatusCreated, member)
+}
+
+func (u GroupHandler) RemoveMember(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.RemoveMember")
+	defer span.End()
+
+	var (
+		id     = chi.URLParam(r, "id")
+		userID = chi.URLParam(r, "userID")
+	)
+
+	span.SetAttributes(
+		attribute.Key("group_id").String(id),
+		attribute.Key("user_id").String(userID),
+	)
+
+	if err := u.service.RemoveMember(ctx, id, userID); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (u GroupHandler) ListRoles(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.ListRoles")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("group_id").String(id))
+
+	roles, err := u.service.ListRoles(ctx, id)
+	if err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writeJSON(ctx, u.opts.Logger(), rw, http.StatusOK, roles)
+}
+
+func (u GroupHandler) AddRole(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.AddRole")
+	defer span.End()
+
+	var (
+		id   = chi.URLParam(r, "id")
+		role = chi.URLParam(r, "role")
+	)
+
+	span.SetAttributes(
+		attribute.Key("group_id").String(id),
+		attribute.Key("role").String(role),
+	)
+
+	if err := u.service.AddRole(ctx, id, role); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (u GroupHandler) RemoveRole(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.opts.ID()).Start(r.Context(), "groups.RemoveRole")
+	defer span.End()
+
+	var (
+		id   = chi.URLParam(r, "id")
+		role = chi.URLParam(r, "role")
+	)
+
+	span.SetAttributes(
+		attribute.Key("group_id").String(id),
+		attribute.Key("role").String(role),
+	)
+
+	if err := u.service.RemoveRole(ctx, id, role); err != nil {
+		problem.Write(ctx, u.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
 
 func (u GroupHandler) Routes() *chi.Mux {
 	r := chi.NewRouter()
 
-	r.Get("/", u.ListGroups)
-	r.Get("/:id", u.GetGroup)
-	r.Post("/", u.CreateGroup)
-	r.Delete("/", u.DeleteGroup)
+	var (
+		read  = Authorize(u.opts, "groups:read")
+		write = Authorize(u.opts, "groups:write")
+		roles = Authorize(u.opts, "roles:write")
+	)
+
+	r.With(read).Get("/", u.ListGroups)
+	r.With(read, CacheResponses(u.opts, "GET /groups/{id}", resourceParam(groupResource, "id"))).Get("/{id}", u.GetGroup)
+	r.With(write).Post("/", u.CreateGroup)
+	r.With(write).Put("/{id}", u.UpdateGroup)
+	r.With(write).Delete("/{id}", u.DeleteGroup)
+
+	r.With(read).Get("/{id}/members", u.ListMembers)
+	r.With(write).Post("/{id}/members", u.AddMember)
+	r.With(write).Delete("/{id}/members/{userID}", u.RemoveMember)
+
+	r.With(read).Get("/{id}/roles", u.ListRoles)
+	r.With(roles).Put("/{id}/roles/{role}", u.AddRole)
+	r.With(roles).Delete("/{id}/roles/{role}", u.RemoveRole)
 
 	return r
 }
 
-type GroupCreate struct{}
+type GroupCreate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type GroupUpdate struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+}
+
+type Group struct {
+	ID          string    `json:"id"`
+	Name        string    `json:"name"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	Version     int64     `json:"-"`
+}
 
-type Group struct{}
+type MemberAdd struct {
+	UserID string `json:"user_id"`
+}
 
-type GroupService interface {
-	CreateUser(ctx context.Context, g GroupCreate) (*Group, error)
+type Member struct {
+	GroupID   string    `json:"group_id"`
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
 }
@@ -0,0 +1,442 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/authz"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/edalmi/x-api/session"
+	"github.com/google/uuid"
+)
+
+const (
+	maxDescriptionLength = 1024
+	maxRoleLength        = 64
+)
+
+type GroupService interface {
+	CreateGroup(ctx context.Context, g GroupCreate) (*Group, error)
+	GetGroup(ctx context.Context, id string) (*Group, error)
+	ListGroups(ctx context.Context, q *pagination.Query) (*pagination.Page[Group], error)
+	UpdateGroup(ctx context.Context, id string, g GroupUpdate, cond Precondition) (*Group, error)
+	DeleteGroup(ctx context.Context, id string, cond Precondition) error
+	AddMember(ctx context.Context, groupID string, m MemberAdd) (*Member, error)
+	RemoveMember(ctx context.Context, groupID, userID string) error
+	ListMembers(ctx context.Context, groupID string) ([]User, error)
+	AddRole(ctx context.Context, groupID, role string) error
+	RemoveRole(ctx context.Context, groupID, role string) error
+	ListRoles(ctx context.Context, groupID string) ([]string, error)
+}
+
+// NewGroupService returns a GroupService. Roles granted to groups must be
+// defined by the authorizer; without one any role name is accepted. The
+// authorizer also guards the members of groups holding roles: changing
+// them, or deleting the group, requires roles:write. Changes
+// to membership and roles are passed on to the authorizer and the session
+// store, either of which may be nil. Every change is audited with recorder,
+// which may be nil as well.
+func NewGroupService(db *database.DB, authorizer *authz.Authorizer, sessions *session.Store, recorder audit.Recorder, logger logging.Logger) GroupService {
+	return &groupService{
+		repo:       database.NewGroupRepository(db),
+		authorizer: authorizer,
+		sessions:   sessions,
+		recorder:   recorder,
+		logger:     logger,
+	}
+}
+
+type groupService struct {
+	repo       *database.GroupRepository
+	authorizer *authz.Authorizer
+	sessions   *session.Store
+	recorder   audit.Recorder
+	logger     logging.Logger
+}
+
+func (s *groupService) CreateGroup(ctx context.Context, in GroupCreate) (group *Group, err error) {
+	defer func() {
+		resource := "groups"
+		if group != nil {
+			resource = groupResource(group.ID)
+		}
+
+		record(ctx, s.recorder, s.logger, "group.create", resource, nil, group, err)
+	}()
+
+	name, description := normalizeGroup(in.Name, in.Description)
+	if err := validateGroup(name, description); err != nil {
+		return nil, err
+	}
+
+	now := now()
+	row := &database.Group{
+		ID:          uuid.NewString(),
+		Name:        name,
+		Description: description,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+		Version:     1,
+	}
+
+	if err := s.repo.Create(ctx, row); err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toGroup(row), nil
+}
+
+func (s *groupService) GetGroup(ctx context.Context, id string) (*Group, error) {
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toGroup(row), nil
+}
+
+func (s *groupService) ListGroups(ctx context.Context, q *pagination.Query) (*pagination.Page[Group], error) {
+	rows, next, err := s.repo.List(ctx, q)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	page := &pagination.Page[Group]{
+		Data:       make([]Group, 0, len(rows)),
+		NextCursor: next,
+	}
+
+	for i := range rows {
+		page.Data = append(page.Data, *toGroup(&rows[i]))
+	}
+
+	return page, nil
+}
+
+func (s *groupService) UpdateGroup(ctx context.Context, id string, in GroupUpdate, cond Precondition) (group *Group, err error) {
+	var before *Group
+	defer func() {
+		record(ctx, s.recorder, s.logger, "group.update", groupResource(id), before, group, err)
+	}()
+
+	name, description := normalizeGroup(in.Name, in.Description)
+	if err := validateGroup(name, description); err != nil {
+		return nil, err
+	}
+
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	if err := checkPrecondition(cond, row.Version); err != nil {
+		return nil, err
+	}
+
+	before = toGroup(row)
+
+	row.Name = name
+	row.Description = description
+	row.UpdatedAt = now()
+
+	if err := s.repo.Update(ctx, row); err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toGroup(row), nil
+}
+
+func (s *groupService) DeleteGroup(ctx context.Context, id string, cond Precondition) (err error) {
+	var before *Group
+	defer func() {
+		record(ctx, s.recorder, s.logger, "group.delete", groupResource(id), before, nil, err)
+	}()
+
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	if err := checkPrecondition(cond, row.Version); err != nil {
+		return err
+	}
+
+	if err := s.guardRoles(ctx, id); err != nil {
+		return err
+	}
+
+	// The memberships go with the group, so its members are read first.
+	members, err := s.memberIDs(ctx, id)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	// Without a precondition the group is deleted whatever its version.
+	var version int64
+	if cond != nil {
+		version = row.Version
+	}
+
+	if err := s.repo.Delete(ctx, id, version); err != nil {
+		return serviceError(err)
+	}
+
+	before = toGroup(row)
+
+	s.privilegesChanged(ctx, members...)
+
+	return nil
+}
+
+func (s *groupService) AddMember(ctx context.Context, groupID string, in MemberAdd) (member *Member, err error) {
+	defer func() {
+		record(ctx, s.recorder, s.logger, "group.member.add", memberResource(groupID, in.UserID), nil, member, err)
+	}()
+
+	userID := strings.TrimSpace(in.UserID)
+	if userID == "" {
+		verr := problem.Fields{}
+		verr.Add("user_id", "is required")
+
+		return nil, verr.Err()
+	}
+
+	if err := s.guardRoles(ctx, groupID); err != nil {
+		return nil, err
+	}
+
+	added := &Member{
+		GroupID:   groupID,
+		UserID:    userID,
+		CreatedAt: now(),
+	}
+
+	if err := s.repo.AddMember(ctx, added.GroupID, added.UserID, added.CreatedAt); err != nil {
+		return nil, serviceError(err)
+	}
+
+	s.privilegesChanged(ctx, added.UserID)
+
+	return added, nil
+}
+
+func (s *groupService) RemoveMember(ctx context.Context, groupID, userID string) (err error) {
+	defer func() {
+		record(ctx, s.recorder, s.logger, "group.member.remove", memberResource(groupID, userID), nil, nil, err)
+	}()
+
+	if err := s.guardRoles(ctx, groupID); err != nil {
+		return err
+	}
+
+	if err := s.repo.RemoveMember(ctx, groupID, userID); err != nil {
+		return serviceError(err)
+	}
+
+	s.privilegesChanged(ctx, userID)
+
+	return nil
+}
+
+func (s *groupService) ListMembers(ctx context.Context, groupID string) ([]User, error) {
+	rows, err := s.repo.ListMembers(ctx, groupID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	users := make([]User, 0, len(rows))
+	for i := range rows {
+		users = append(users, *toUser(&rows[i]))
+	}
+
+	return users, nil
+}
+
+// AddRole grants the role to the group. Granting a role the group already
+// has succeeds.
+func (s *groupService) AddRole(ctx context.Context, groupID, role string) (err error) {
+	defer func() {
+		record(ctx, s.recorder, s.logger, "group.role.add", roleResource(groupID, role), nil, nil, err)
+	}()
+
+	verr := problem.Fields{}
+	switch {
+	case role == "" || len(role) > maxRoleLength:
+		verr.Add("role", "must be between 1 and 64 characters")
+	case s.authorizer != nil && !s.authorizer.HasRole(role):
+		verr.Add("role", "is not defined")
+	}
+
+	if err := verr.Err(); err != nil {
+		return err
+	}
+
+	err = s.repo.AddRole(ctx, groupID, role, now())
+	switch {
+	case errors.Is(err, database.ErrConflict):
+		return nil
+	case err != nil:
+		return serviceError(err)
+	}
+
+	s.memberPrivilegesChanged(ctx, groupID)
+
+	return nil
+}
+
+func (s *groupService) RemoveRole(ctx context.Context, groupID, role string) (err error) {
+	defer func() {
+		record(ctx, s.recorder, s.logger, "group.role.remove", roleResource(groupID, role), nil, nil, err)
+	}()
+
+	if err := s.repo.RemoveRole(ctx, groupID, role); err != nil {
+		return serviceError(err)
+	}
+
+	s.memberPrivilegesChanged(ctx, groupID)
+
+	return nil
+}
+
+func (s *groupService) ListRoles(ctx context.Context, groupID string) ([]string, error) {
+	roles, err := s.repo.ListRoles(ctx, groupID)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return roles, nil
+}
+
+// privilegesChanged makes a change to the roles of users take effect
+// immediately and rotates their session IDs. The change itself has been
+// made, so failures are logged; cached roles expire on their own.
+func (s *groupService) privilegesChanged(ctx context.Context, userIDs ...string) {
+	for _, id := range userIDs {
+		if s.authorizer != nil {
+			if err := s.authorizer.Forget(ctx, id); err != nil {
+				logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"user_id": id}).Error(err)
+			}
+		}
+
+		if s.sessions != nil {
+			if err := s.sessions.PrivilegesChanged(ctx, id); err != nil {
+				logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"user_id": id}).Error(err)
+			}
+		}
+	}
+}
+
+func (s *groupService) memberPrivilegesChanged(ctx context.Context, groupID string) {
+	ids, err := s.memberIDs(ctx, groupID)
+	if err != nil {
+		logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"group_id": groupID}).Error(err)
+		return
+	}
+
+	s.privilegesChanged(ctx, ids...)
+}
+
+// memberIDs returns the ids of the members of a group, when there is an
+// authorizer or session store to tell about their privileges.
+func (s *groupService) memberIDs(ctx context.Context, groupID string) ([]string, error) {
+	if s.authorizer == nil && s.sessions == nil {
+		return nil, nil
+	}
+
+	members, err := s.repo.ListMembers(ctx, groupID)
+	if err != nil {
+		return nil, err
+	}
+
+	ids := make([]string, 0, len(members))
+	for _, m := range members {
+		ids = append(ids, m.ID)
+	}
+
+	return ids, nil
+}
+
+// guardRoles requires the principal of ctx to hold roles:write when the
+// group holds roles. Changing the members of such a group, or deleting it,
+// changes their privileges as much as granting or revoking its roles does.
+func (s *groupService) guardRoles(ctx context.Context, groupID string) error {
+	if s.authorizer == nil {
+		return nil
+	}
+
+	roles, err := s.repo.ListRoles(ctx, groupID)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	if len(roles) == 0 {
+		return nil
+	}
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return problem.New(problem.CodeUnauthorized, "authentication is required")
+	}
+
+	allowed, err := s.authorizer.Allowed(ctx, principal, "roles:write")
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		return problem.New(problem.CodeForbidden, "missing permission roles:write, as the group holds roles")
+	}
+
+	return nil
+}
+
+func normalizeGroup(name, description string) (string, string) {
+	return strings.TrimSpace(name), strings.TrimSpace(description)
+}
+
+func validateGroup(name, description string) error {
+	verr := problem.Fields{}
+
+	if name == "" {
+		verr.Add("name", "is required")
+	} else if len(name) > maxNameLength {
+		verr.Add("name", "is too long")
+	}
+
+	if len(description) > maxDescriptionLength {
+		verr.Add("description", "is too long")
+	}
+
+	return verr.Err()
+}
+
+// groupResource, memberResource and roleResource name groups and their
+// members and roles in audit entries.
+func groupResource(id string) string {
+	return "groups/" + id
+}
+
+func memberResource(groupID, userID string) string {
+	return groupResource(groupID) + "/members/" + strings.TrimSpace(userID)
+}
+
+func roleResource(groupID, role string) string {
+	return groupResource(groupID) + "/roles/" + role
+}
+
+func toGroup(row *database.Group) *Group {
+	return &Group{
+		ID:          row.ID,
+		Name:        row.Name,
+		Description: row.Description,
+		CreatedAt:   row.CreatedAt,
+		UpdatedAt:   row.UpdatedAt,
+		Version:     row.Version,
+	}
+}
@@ -0,0 +1,98 @@
+package handler
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+func TestGroupHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		member     bool
+		req        testRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "get", req: testRequest{method: http.MethodGet, path: "/groups/{group}"}, wantStatus: http.StatusOK, wantBody: `"name":"editors"`},
+		{name: "get unknown", req: testRequest{method: http.MethodGet, path: "/groups/unknown"}, wantStatus: http.StatusNotFound},
+		{name: "list", req: testRequest{method: http.MethodGet, path: "/groups"}, wantStatus: http.StatusOK, wantBody: `"name":"editors"`},
+		{name: "create", req: testRequest{method: http.MethodPost, path: "/groups", body: `{"name":"admins"}`}, wantStatus: http.StatusCreated, wantBody: `"name":"admins"`},
+		{name: "create taken name", req: testRequest{method: http.MethodPost, path: "/groups", body: `{"name":"editors"}`}, wantStatus: http.StatusConflict},
+		{name: "create without name", req: testRequest{method: http.MethodPost, path: "/groups", body: `{"description":"nameless"}`}, wantStatus: http.StatusUnprocessableEntity},
+		{
+			name:       "update",
+			req:        testRequest{method: http.MethodPut, path: "/groups/{group}", body: `{"name":"writers","description":"they write"}`},
+			wantStatus: http.StatusOK,
+			wantBody:   `"name":"writers"`,
+		},
+		{name: "delete", req: testRequest{method: http.MethodDelete, path: "/groups/{group}"}, wantStatus: http.StatusNoContent},
+		{name: "delete unknown", req: testRequest{method: http.MethodDelete, path: "/groups/unknown"}, wantStatus: http.StatusNotFound},
+		{name: "add member", req: testRequest{method: http.MethodPost, path: "/groups/{group}/members", body: `{"user_id":"{user}"}`}, wantStatus: http.StatusCreated, wantBody: `"user_id":"{user}"`},
+		{name: "add member twice", member: true, req: testRequest{method: http.MethodPost, path: "/groups/{group}/members", body: `{"user_id":"{user}"}`}, wantStatus: http.StatusConflict},
+		{name: "add unknown user", req: testRequest{method: http.MethodPost, path: "/groups/{group}/members", body: `{"user_id":"unknown"}`}, wantStatus: http.StatusNotFound},
+		{name: "add member to unknown group", req: testRequest{method: http.MethodPost, path: "/groups/unknown/members", body: `{"user_id":"{user}"}`}, wantStatus: http.StatusNotFound},
+		{name: "list members", member: true, req: testRequest{method: http.MethodGet, path: "/groups/{group}/members"}, wantStatus: http.StatusOK, wantBody: `"email":"ada@example.com"`},
+		{name: "remove member", member: true, req: testRequest{method: http.MethodDelete, path: "/groups/{group}/members/{user}"}, wantStatus: http.StatusNoContent},
+		{name: "remove non member", req: testRequest{method: http.MethodDelete, path: "/groups/{group}/members/{user}"}, wantStatus: http.StatusNotFound},
+		{name: "add role", req: testRequest{method: http.MethodPut, path: "/groups/{group}/roles/editor"}, wantStatus: http.StatusNoContent},
+		{name: "list roles", req: testRequest{method: http.MethodGet, path: "/groups/{group}/roles"}, wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts := testOpts{db: newTestDB(t)}
+
+			h := chi.NewRouter()
+			h.Mount("/users", NewUserHandler(opts).Routes())
+			h.Mount("/groups", NewGroupHandler(opts).Routes())
+
+			user := mustCreate(t, h, "/users", `{"email":"ada@example.com","name":"Ada"}`)
+			group := mustCreate(t, h, "/groups", `{"name":"editors"}`)
+
+			if tt.member {
+				mustCreate(t, h, "/groups/"+group+"/members", `{"user_id":"`+user+`"}`)
+			}
+
+			replacer := strings.NewReplacer("{user}", user, "{group}", group)
+			tt.req.path = replacer.Replace(tt.req.path)
+			tt.req.body = replacer.Replace(tt.req.body)
+
+			rw := tt.req.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if want := replacer.Replace(tt.wantBody); !strings.Contains(rw.Body.String(), want) {
+				t.Errorf("body = %s, want it to contain %s", rw.Body, want)
+			}
+		})
+	}
+}
+
+func TestGroupHandlerPreconditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        testRequest
+		wantStatus int
+	}{
+		{name: "update matching", req: testRequest{method: http.MethodPut, body: `{"name":"writers"}`, header: http.Header{"If-Match": {`"1"`}}}, wantStatus: http.StatusOK},
+		{name: "update stale", req: testRequest{method: http.MethodPut, body: `{"name":"writers"}`, header: http.Header{"If-Match": {`"2"`}}}, wantStatus: http.StatusPreconditionFailed},
+		{name: "delete matching", req: testRequest{method: http.MethodDelete, header: http.Header{"If-Match": {`"1"`}}}, wantStatus: http.StatusNoContent},
+		{name: "delete stale", req: testRequest{method: http.MethodDelete, header: http.Header{"If-Match": {`"2"`}}}, wantStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewGroupHandler(testOpts{db: newTestDB(t)}).Routes()
+
+			tt.req.path = "/" + mustCreate(t, h, "/", `{"name":"editors"}`)
+
+			if rw := tt.req.serve(h); rw.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+		})
+	}
+}
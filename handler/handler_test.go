@@ -0,0 +1,194 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/authz"
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/database/sqlite"
+	"github.com/edalmi/x-api/handler/middleware"
+	"github.com/edalmi/x-api/logging"
+	stdlog "github.com/edalmi/x-api/logging/log"
+	"github.com/edalmi/x-api/password"
+	"github.com/edalmi/x-api/pubsub"
+	"github.com/edalmi/x-api/queue"
+	"github.com/edalmi/x-api/session"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// testOpts are the HandlerOpts of a server without an authorizer, so every
+// route is open.
+type testOpts struct {
+	db    *database.DB
+	cache caching.Cache
+}
+
+func (testOpts) Queue() queue.Queue                       { return nil }
+func (testOpts) Pubsub() pubsub.Pubsub                    { return nil }
+func (o testOpts) Cache() caching.Cache                   { return o.cache }
+func (testOpts) Logger() logging.Logger                   { return stdlog.New(log.New(io.Discard, "", 0)) }
+func (testOpts) Prometheus() prometheus.Registerer        { return prometheus.NewRegistry() }
+func (o testOpts) DB() *database.DB                       { return o.db }
+func (testOpts) PasswordPolicy() password.Policy          { return password.DefaultPolicy }
+func (testOpts) Authorizer() *authz.Authorizer            { return nil }
+func (testOpts) AuditRecorder() audit.Recorder            { return nil }
+func (testOpts) Sessions() *session.Store                 { return nil }
+func (testOpts) ResponseCache() *middleware.ResponseCache { return nil }
+func (testOpts) ID() string                               { return "xapi" }
+
+func (testOpts) PasswordHasher() *password.Hasher {
+	h, err := password.NewHasher(password.Params{Algorithm: password.Bcrypt, BcryptCost: bcrypt.MinCost})
+	if err != nil {
+		panic(err)
+	}
+
+	return h
+}
+
+// testCache is an in-memory caching.Cache that ignores expiry.
+type testCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newTestCache() *testCache {
+	return &testCache{values: make(map[string]string)}
+}
+
+func (c *testCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.values[key]
+	if !ok {
+		return "", caching.ErrMiss
+	}
+
+	return v, nil
+}
+
+func (c *testCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+
+	return nil
+}
+
+func (c *testCache) Add(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+
+	c.values[key] = value
+
+	return true, nil
+}
+
+func (c *testCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+// newTestDB returns a migrated SQLite database in a temporary directory.
+func newTestDB(t *testing.T) *database.DB {
+	t.Helper()
+
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "x-api.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../database/sqlite/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(files)
+
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(b) == 0 {
+			continue
+		}
+
+		if _, err := db.Exec(string(b)); err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+	}
+
+	return db
+}
+
+// testRequest is a request made by a test against a handler.
+type testRequest struct {
+	method string
+	path   string
+	body   string
+	header http.Header
+}
+
+func (tr testRequest) serve(h http.Handler) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(tr.method, tr.path, strings.NewReader(tr.body))
+	if tr.body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+
+	for k, v := range tr.header {
+		r.Header[k] = v
+	}
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+
+	return rw
+}
+
+// mustCreate makes a POST request that must create a resource and returns
+// the ID of the resource.
+func mustCreate(t *testing.T, h http.Handler, path, body string) string {
+	t.Helper()
+
+	rw := testRequest{method: http.MethodPost, path: path, body: body}.serve(h)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("POST %s: status = %d, body = %s", path, rw.Code, rw.Body)
+	}
+
+	var created struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &created); err != nil {
+		t.Fatal(err)
+	}
+
+	return created.ID
+}
@@ -0,0 +1,69 @@
+package middleware
+
+import (
+	"math/rand"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/edalmi/x-api/logging"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type AccessLogOptions struct {
+	Logger logging.Logger
+	// SampleRate is the share of requests that are logged, from 0 to 1.
+	// Server errors are always logged.
+	SampleRate float64
+	// Exclude lists the paths whose requests are never logged.
+	Exclude []string
+}
+
+// AccessLog logs every request once it has been served, with its method,
+// route pattern, status, size, latency, client IP, user agent, request ID
+// and trace ID. It must run after RequestID, and before any chi router so
+// that it sees the pattern the router matched.
+func AccessLog(opts AccessLogOptions) func(http.Handler) http.Handler {
+	exclude := make(map[string]bool, len(opts.Exclude))
+	for _, path := range opts.Exclude {
+		exclude[path] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if exclude[r.URL.Path] {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			r, rctx := withRouteContext(r)
+
+			var (
+				start = time.Now()
+				sw    = &statusWriter{ResponseWriter: rw}
+			)
+
+			next.ServeHTTP(sw, r)
+
+			if sw.code() < http.StatusInternalServerError && opts.SampleRate < 1 && rand.Float64() >= opts.SampleRate {
+				return
+			}
+
+			fields := logging.Fields{
+				"method":     r.Method,
+				"route":      routePattern(rctx),
+				"status":     strconv.Itoa(sw.code()),
+				"bytes":      strconv.FormatInt(sw.bytes, 10),
+				"latency_ms": strconv.FormatFloat(float64(time.Since(start))/float64(time.Millisecond), 'f', 3, 64),
+				"ip":         clientIP(r),
+				"user_agent": r.UserAgent(),
+			}
+
+			if sc := trace.SpanContextFromContext(r.Context()); sc.HasTraceID() {
+				fields["trace_id"] = sc.TraceID().String()
+			}
+
+			logging.FromContext(r.Context(), opts.Logger).WithFields(fields).Info("access")
+		})
+	}
+}
@@ -0,0 +1,158 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/logging"
+	"github.com/go-chi/chi/v5"
+)
+
+// entriesLogger records the messages logged with it, with their fields.
+type entriesLogger struct {
+	logging.Logger
+	fields  logging.Fields
+	entries *[]logging.Fields
+}
+
+func newEntriesLogger() *entriesLogger {
+	return &entriesLogger{entries: &[]logging.Fields{}}
+}
+
+func (l *entriesLogger) WithFields(fields logging.Fields) logging.Logger {
+	merged := logging.Fields{}
+	for k, v := range l.fields {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return &entriesLogger{fields: merged, entries: l.entries}
+}
+
+func (l *entriesLogger) Info(v ...interface{}) {
+	*l.entries = append(*l.entries, l.fields)
+}
+
+func TestAccessLog(t *testing.T) {
+	router := chi.NewRouter()
+	router.Post("/users/{id}/password", func(rw http.ResponseWriter, r *http.Request) {
+		time.Sleep(5 * time.Millisecond)
+		rw.WriteHeader(http.StatusAccepted)
+		rw.Write([]byte("accepted"))
+	})
+	router.Get("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte(`{"id":"1"}`))
+	})
+	router.Delete("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {})
+	router.Get("/fail", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusInternalServerError)
+	})
+	router.Get("/healthz", func(rw http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name       string
+		sampleRate float64
+		method     string
+		path       string
+		want       logging.Fields
+		minLatency time.Duration
+	}{
+		{
+			name:       "explicit status",
+			sampleRate: 1,
+			method:     http.MethodPost,
+			path:       "/users/42/password",
+			want:       logging.Fields{"method": "POST", "route": "/users/{id}/password", "status": "202", "bytes": "8"},
+			minLatency: 5 * time.Millisecond,
+		},
+		{
+			name:       "status of a write",
+			sampleRate: 1,
+			method:     http.MethodGet,
+			path:       "/users/42",
+			want:       logging.Fields{"method": "GET", "route": "/users/{id}", "status": "200", "bytes": "10"},
+		},
+		{
+			name:       "nothing written",
+			sampleRate: 1,
+			method:     http.MethodDelete,
+			path:       "/users/42",
+			want:       logging.Fields{"method": "DELETE", "route": "/users/{id}", "status": "200", "bytes": "0"},
+		},
+		{
+			name:       "no route",
+			sampleRate: 1,
+			method:     http.MethodGet,
+			path:       "/unknown",
+			want:       logging.Fields{"method": "GET", "route": "-", "status": "404"},
+		},
+		{name: "excluded", sampleRate: 1, method: http.MethodGet, path: "/healthz"},
+		{name: "not sampled", method: http.MethodGet, path: "/users/42"},
+		{
+			name:   "server error not sampled",
+			method: http.MethodGet,
+			path:   "/fail",
+			want:   logging.Fields{"method": "GET", "route": "/fail", "status": "500", "bytes": "0"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logger := newEntriesLogger()
+
+			h := RequestID(AccessLog(AccessLogOptions{
+				Logger:     logger,
+				SampleRate: tt.sampleRate,
+				Exclude:    []string{"/healthz"},
+			})(router))
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.Header.Set("X-Request-ID", "req-1")
+			r.Header.Set("User-Agent", "x-api-test")
+			r.RemoteAddr = "192.0.2.1:1234"
+
+			h.ServeHTTP(httptest.NewRecorder(), r)
+
+			entries := *logger.entries
+			if tt.want == nil {
+				if len(entries) != 0 {
+					t.Errorf("entries = %v, want none", entries)
+				}
+
+				return
+			}
+
+			if len(entries) != 1 {
+				t.Fatalf("entries = %v, want one", entries)
+			}
+
+			got := entries[0]
+
+			want := logging.Fields{"request_id": "req-1", "ip": "192.0.2.1", "user_agent": "x-api-test"}
+			for k, v := range tt.want {
+				want[k] = v
+			}
+
+			for k, v := range want {
+				if got[k] != v {
+					t.Errorf("%s = %q, want %q", k, got[k], v)
+				}
+			}
+
+			latency, err := strconv.ParseFloat(got["latency_ms"], 64)
+			if err != nil {
+				t.Fatalf("latency_ms = %q: %v", got["latency_ms"], err)
+			}
+
+			if d := time.Duration(latency * float64(time.Millisecond)); d < tt.minLatency {
+				t.Errorf("latency = %v, want at least %v", d, tt.minLatency)
+			}
+		})
+	}
+}
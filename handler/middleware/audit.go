@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net"
+	"net/http"
+
+	"github.com/edalmi/x-api/audit"
+)
+
+// AuditRequest adds the ID and the client IP of a request to its context,
+// so that the audit entries recorded while serving it can be traced back to
+// it. It must run after RequestID.
+func AuditRequest(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id, _ := RequestIDFromContext(r.Context())
+		ctx := audit.WithRequest(r.Context(), audit.Request{ID: id, IP: clientIP(r)})
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// clientIP returns the address of the peer of a request. Proxies are not
+// trusted, so X-Forwarded-For is ignored.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
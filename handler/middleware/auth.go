@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/problem"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Authenticate requires every request to carry an Authorization header
+// accepted by one of the authenticators, and stores the principal in the
+// request context, where loggers find it too. Requests authenticated by an
+// earlier middleware, such as Session, pass through.
+func Authenticate(logger logging.Logger, authenticators ...auth.Authenticator) func(http.Handler) http.Handler {
+	schemes := make([]string, 0, len(authenticators))
+	for _, a := range authenticators {
+		schemes = append(schemes, a.Scheme())
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			if _, ok := auth.FromContext(ctx); ok {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			scheme, credentials, _ := strings.Cut(r.Header.Get("Authorization"), " ")
+
+			var authenticator auth.Authenticator
+			for _, a := range authenticators {
+				if strings.EqualFold(scheme, a.Scheme()) {
+					authenticator = a
+					break
+				}
+			}
+
+			if authenticator == nil {
+				unauthorized(rw, r, logger, schemes, "", problem.New(problem.CodeUnauthorized, "authentication is required"))
+				return
+			}
+
+			principal, err := authenticator.Authenticate(ctx, strings.TrimSpace(credentials))
+			if err != nil {
+				if !errors.Is(err, auth.ErrUnauthenticated) {
+					problem.Write(ctx, logger, rw, r, err)
+					return
+				}
+
+				unauthorized(rw, r, logger, schemes, authenticator.Scheme(), &problem.Error{Code: problem.CodeUnauthorized, Detail: "invalid credentials", Err: err})
+				return
+			}
+
+			trace.SpanFromContext(ctx).SetAttributes(
+				attribute.Key("enduser.id").String(principal.Subject),
+				attribute.Key("enduser.scope").String(strings.Join(principal.Scopes, " ")),
+			)
+
+			next.ServeHTTP(rw, r.WithContext(withPrincipal(ctx, principal)))
+		})
+	}
+}
+
+// withPrincipal stores the principal in ctx, for authorization and for the
+// loggers of logging.FromContext.
+func withPrincipal(ctx context.Context, p *auth.Principal) context.Context {
+	ctx = logging.ContextWithFields(ctx, logging.Fields{
+		"principal":      p.Subject,
+		"principal_kind": string(p.Kind),
+	})
+
+	return auth.WithPrincipal(ctx, p)
+}
+
+// requester identifies who made a request: its principal, such as a user or
+// an API key, or else its client IP.
+func requester(r *http.Request) string {
+	if p, ok := auth.FromContext(r.Context()); ok {
+		return string(p.Kind) + ":" + p.Subject
+	}
+
+	return "ip:" + clientIP(r)
+}
+
+// unauthorized writes a 401 challenging the client with every accepted
+// scheme. A rejected bearer token is flagged as RFC 6750 requires.
+func unauthorized(rw http.ResponseWriter, r *http.Request, logger logging.Logger, schemes []string, failed string, err error) {
+	for _, s := range schemes {
+		challenge := s + ` realm="x-api"`
+		if s == failed && s == "Bearer" {
+			challenge += `, error="invalid_token"`
+		}
+
+		rw.Header().Add("WWW-Authenticate", challenge)
+	}
+
+	problem.Write(r.Context(), logger, rw, r, err)
+}
@@ -0,0 +1,117 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/logging"
+)
+
+// tokenAuthenticator accepts the credentials in its principals.
+type tokenAuthenticator struct {
+	scheme     string
+	principals map[string]*auth.Principal
+}
+
+func (a tokenAuthenticator) Scheme() string {
+	return a.scheme
+}
+
+func (a tokenAuthenticator) Authenticate(_ context.Context, credentials string) (*auth.Principal, error) {
+	if credentials == "broken" {
+		return nil, errors.New("database is down")
+	}
+
+	p, ok := a.principals[credentials]
+	if !ok {
+		return nil, fmt.Errorf("%w: unknown token", auth.ErrUnauthenticated)
+	}
+
+	return p, nil
+}
+
+func TestAuthenticate(t *testing.T) {
+	var (
+		user   = &auth.Principal{Subject: "u1", Kind: auth.KindUser}
+		apiKey = &auth.Principal{Subject: "k1", Kind: auth.KindAPIKey}
+		bearer = tokenAuthenticator{scheme: "Bearer", principals: map[string]*auth.Principal{"t1": user}}
+		keys   = tokenAuthenticator{scheme: "ApiKey", principals: map[string]*auth.Principal{"k1": apiKey}}
+	)
+
+	challenges := []string{`Bearer realm="x-api"`, `ApiKey realm="x-api"`}
+
+	tests := []struct {
+		name           string
+		authorization  string
+		authenticated  *auth.Principal
+		wantStatus     int
+		wantPrincipal  *auth.Principal
+		wantChallenges []string
+	}{
+		{name: "bearer", authorization: "Bearer t1", wantStatus: http.StatusOK, wantPrincipal: user},
+		{name: "scheme in other case", authorization: "bearer t1", wantStatus: http.StatusOK, wantPrincipal: user},
+		{name: "api key", authorization: "ApiKey k1", wantStatus: http.StatusOK, wantPrincipal: apiKey},
+		{name: "already authenticated", authenticated: apiKey, wantStatus: http.StatusOK, wantPrincipal: apiKey},
+		{name: "missing", wantStatus: http.StatusUnauthorized, wantChallenges: challenges},
+		{name: "unknown scheme", authorization: "Basic dTpw", wantStatus: http.StatusUnauthorized, wantChallenges: challenges},
+		{
+			name:           "invalid token",
+			authorization:  "Bearer t2",
+			wantStatus:     http.StatusUnauthorized,
+			wantChallenges: []string{`Bearer realm="x-api", error="invalid_token"`, `ApiKey realm="x-api"`},
+		},
+		{name: "invalid key", authorization: "ApiKey k2", wantStatus: http.StatusUnauthorized, wantChallenges: challenges},
+		{name: "authenticator failure", authorization: "Bearer broken", wantStatus: http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				principal *auth.Principal
+				logger    = &fieldsLogger{}
+			)
+
+			h := Authenticate(discardLogger, bearer, keys)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				principal, _ = auth.FromContext(r.Context())
+				logging.FromContext(r.Context(), logger)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			if tt.authenticated != nil {
+				r = r.WithContext(withPrincipal(r.Context(), tt.authenticated))
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			if rw.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+
+			if principal != tt.wantPrincipal {
+				t.Errorf("principal = %+v, want %+v", principal, tt.wantPrincipal)
+			}
+
+			if got := rw.Header().Values("WWW-Authenticate"); !reflect.DeepEqual(got, tt.wantChallenges) {
+				t.Errorf("WWW-Authenticate = %q, want %q", got, tt.wantChallenges)
+			}
+
+			if p := tt.wantPrincipal; p != nil {
+				want := logging.Fields{"principal": p.Subject, "principal_kind": string(p.Kind)}
+				if !reflect.DeepEqual(logger.fields, want) {
+					t.Errorf("log fields = %v, want %v", logger.fields, want)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/authz"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/problem"
+	"github.com/go-chi/chi/v5"
+)
+
+// Require lets a request through when its principal was granted permission.
+// Denied requests get a 403 and are recorded by the recorder. It must run
+// after Authenticate.
+func Require(authorizer *authz.Authorizer, recorder audit.Recorder, logger logging.Logger, permission string) func(http.Handler) http.Handler {
+	return RequireOrSelf(authorizer, recorder, logger, permission, "")
+}
+
+// RequireOrSelf is Require, except that users are also let through when the
+// URL parameter param is their own id.
+func RequireOrSelf(authorizer *authz.Authorizer, recorder audit.Recorder, logger logging.Logger, permission, param string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			principal, ok := auth.FromContext(ctx)
+			if !ok {
+				problem.Write(ctx, logger, rw, r, problem.New(problem.CodeUnauthorized, "authentication is required"))
+				return
+			}
+
+			if param != "" && principal.Kind == auth.KindUser && chi.URLParam(r, param) == principal.Subject {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			if err := Check(r, authorizer, recorder, logger, permission); err != nil {
+				problem.Write(ctx, logger, rw, r, err)
+				return
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// Check reports whether the principal of r was granted permission, for
+// requests that need more than their route requires. Denials are recorded
+// by the recorder and returned as problems.
+func Check(r *http.Request, authorizer *authz.Authorizer, recorder audit.Recorder, logger logging.Logger, permission string) error {
+	ctx := r.Context()
+
+	principal, ok := auth.FromContext(ctx)
+	if !ok {
+		return problem.New(problem.CodeUnauthorized, "authentication is required")
+	}
+
+	allowed, err := authorizer.Allowed(ctx, principal, permission)
+	if err != nil {
+		return err
+	}
+
+	if !allowed {
+		entry := audit.New(ctx, "authorize", r.Method+" "+r.URL.Path, audit.Denied)
+		entry.Detail = "missing permission " + permission
+
+		if err := recorder.Record(ctx, entry); err != nil {
+			logging.FromContext(ctx, logger).Error(err)
+		}
+
+		return problem.New(problem.CodeForbidden, "missing permission "+permission)
+	}
+
+	return nil
+}
@@ -0,0 +1,93 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/authz"
+	"github.com/go-chi/chi/v5"
+)
+
+type staticRoles map[string][]string
+
+func (s staticRoles) UserRoles(_ context.Context, userID string) ([]string, error) {
+	return s[userID], nil
+}
+
+type entries []audit.Entry
+
+func (e *entries) Record(_ context.Context, entry audit.Entry) error {
+	*e = append(*e, entry)
+	return nil
+}
+
+func TestRequireOrSelf(t *testing.T) {
+	authorizer := authz.New(authz.Options{
+		Roles:    map[string][]string{"viewer": {"users:read"}, "admin": {"*"}},
+		Resolver: staticRoles{"alice": {"admin"}, "bob": {"viewer"}},
+	})
+
+	var (
+		alice    = &auth.Principal{Subject: "alice", Kind: auth.KindUser}
+		bob      = &auth.Principal{Subject: "bob", Kind: auth.KindUser}
+		operator = &auth.Principal{Subject: "ops", Kind: auth.KindOperator}
+		apiKey   = &auth.Principal{Subject: "bob", Kind: auth.KindAPIKey, Scopes: []string{"users:read"}}
+	)
+
+	tests := []struct {
+		name        string
+		principal   *auth.Principal
+		permission  string
+		path        string
+		wantStatus  int
+		wantDenials int
+	}{
+		{name: "granted by role", principal: bob, permission: "users:read", path: "/users/carol", wantStatus: http.StatusOK},
+		{name: "granted by admin role", principal: alice, permission: "users:write", path: "/users/carol", wantStatus: http.StatusOK},
+		{name: "operator", principal: operator, permission: "users:write", path: "/users/carol", wantStatus: http.StatusOK},
+		{name: "self", principal: bob, permission: "users:write", path: "/users/bob", wantStatus: http.StatusOK},
+		{name: "denied", principal: bob, permission: "users:write", path: "/users/carol", wantStatus: http.StatusForbidden, wantDenials: 1},
+		{name: "self of another kind", principal: apiKey, permission: "users:write", path: "/users/bob", wantStatus: http.StatusForbidden, wantDenials: 1},
+		{name: "unauthenticated", permission: "users:read", path: "/users/carol", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var denials entries
+
+			router := chi.NewRouter()
+			router.Use(func(next http.Handler) http.Handler {
+				return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+					if tt.principal != nil {
+						r = r.WithContext(auth.WithPrincipal(r.Context(), tt.principal))
+					}
+
+					next.ServeHTTP(rw, r)
+				})
+			})
+			router.With(RequireOrSelf(authorizer, &denials, discardLogger, tt.permission, "id")).
+				Get("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {})
+
+			rw := httptest.NewRecorder()
+			router.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, tt.path, nil))
+
+			if rw.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+
+			if len(denials) != tt.wantDenials {
+				t.Fatalf("recorded %d denials, want %d", len(denials), tt.wantDenials)
+			}
+
+			for _, e := range denials {
+				if e.Outcome != audit.Denied || e.Detail != "missing permission "+tt.permission {
+					t.Errorf("recorded %+v", e)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,232 @@
+package middleware
+
+import (
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSOptions struct {
+	// Origins are exact origins, wildcard subdomains such as
+	// https://*.example.com, or * for any origin.
+	Origins        []string
+	OriginPatterns []*regexp.Regexp
+	Methods        []string
+	Headers        []string
+	ExposedHeaders []string
+	Credentials    bool
+	MaxAge         time.Duration
+}
+
+// CORS answers preflight requests itself and adds the CORS headers to the
+// responses of the allowed origins. Requests of other origins are served
+// without them, which makes browsers withhold the responses. It must run
+// before authentication, as preflight requests carry no credentials.
+func CORS(opts CORSOptions) func(http.Handler) http.Handler {
+	c := newCORS(opts)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			origin := r.Header.Get("Origin")
+			if origin == "" {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			if r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != "" {
+				c.preflight(rw, r, origin)
+				return
+			}
+
+			h := rw.Header()
+			h.Add("Vary", "Origin")
+
+			if c.allowOrigin(origin) {
+				c.setOrigin(h, origin)
+
+				if len(c.exposed) > 0 {
+					h.Set("Access-Control-Expose-Headers", strings.Join(c.exposed, ", "))
+				}
+			}
+
+			next.ServeHTTP(rw, r)
+		})
+	}
+}
+
+// OriginMatcher returns whether CORS with opts allows an origin, so that
+// other middleware can trust the same origins.
+func OriginMatcher(opts CORSOptions) func(origin string) bool {
+	return newCORS(opts).allowOrigin
+}
+
+type cors struct {
+	anyOrigin   bool
+	origins     map[string]bool
+	wildcards   [][2]string
+	patterns    []*regexp.Regexp
+	methods     []string
+	anyHeader   bool
+	headers     map[string]bool
+	exposed     []string
+	credentials bool
+	maxAge      string
+}
+
+func newCORS(opts CORSOptions) *cors {
+	c := &cors{
+		origins:     map[string]bool{},
+		patterns:    opts.OriginPatterns,
+		methods:     opts.Methods,
+		headers:     map[string]bool{},
+		exposed:     opts.ExposedHeaders,
+		credentials: opts.Credentials,
+	}
+
+	for _, origin := range opts.Origins {
+		origin = strings.ToLower(origin)
+
+		switch {
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, _ := strings.Cut(origin, "*")
+			c.wildcards = append(c.wildcards, [2]string{prefix, suffix})
+		default:
+			c.origins[origin] = true
+		}
+	}
+
+	if len(c.methods) == 0 {
+		c.methods = []string{http.MethodGet, http.MethodHead, http.MethodPost}
+	}
+
+	for _, header := range opts.Headers {
+		if header == "*" {
+			c.anyHeader = true
+		}
+
+		c.headers[http.CanonicalHeaderKey(header)] = true
+	}
+
+	if opts.MaxAge > 0 {
+		c.maxAge = strconv.Itoa(int(opts.MaxAge.Seconds()))
+	}
+
+	return c
+}
+
+func (c *cors) preflight(rw http.ResponseWriter, r *http.Request, origin string) {
+	h := rw.Header()
+	h.Add("Vary", "Origin")
+	h.Add("Vary", "Access-Control-Request-Method")
+	h.Add("Vary", "Access-Control-Request-Headers")
+
+	// A preflight that is not allowed is answered without the CORS
+	// headers, which fails it.
+	if !c.allowOrigin(origin) || !c.allowMethod(r.Header.Get("Access-Control-Request-Method")) {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	requested := r.Header.Get("Access-Control-Request-Headers")
+	if !c.allowHeaders(requested) {
+		rw.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	c.setOrigin(h, origin)
+	h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+
+	if requested != "" {
+		h.Set("Access-Control-Allow-Headers", requested)
+	}
+
+	if c.maxAge != "" {
+		h.Set("Access-Control-Max-Age", c.maxAge)
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (c *cors) setOrigin(h http.Header, origin string) {
+	if c.anyOrigin && !c.credentials {
+		h.Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Set("Access-Control-Allow-Origin", origin)
+
+	if c.credentials {
+		h.Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *cors) allowOrigin(origin string) bool {
+	origin = strings.ToLower(origin)
+
+	if c.anyOrigin || c.origins[origin] {
+		return true
+	}
+
+	for _, w := range c.wildcards {
+		if subdomain(origin, w[0], w[1]) {
+			return true
+		}
+	}
+
+	for _, p := range c.patterns {
+		if p.MatchString(origin) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// subdomain reports whether origin is prefix, then a subdomain, then suffix,
+// as https://a.b.example.com is for https:// and .example.com.
+func subdomain(origin, prefix, suffix string) bool {
+	if len(origin) <= len(prefix)+len(suffix) || !strings.HasPrefix(origin, prefix) || !strings.HasSuffix(origin, suffix) {
+		return false
+	}
+
+	sub := origin[len(prefix) : len(origin)-len(suffix)]
+	if strings.HasPrefix(sub, ".") || strings.HasSuffix(sub, ".") {
+		return false
+	}
+
+	for _, r := range sub {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '.') {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *cors) allowMethod(method string) bool {
+	for _, m := range c.methods {
+		if m == "*" || m == method {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (c *cors) allowHeaders(requested string) bool {
+	if c.anyHeader {
+		return true
+	}
+
+	for _, header := range strings.Split(requested, ",") {
+		if header = strings.TrimSpace(header); header != "" && !c.headers[http.CanonicalHeaderKey(header)] {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,290 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/session"
+)
+
+func TestCORS(t *testing.T) {
+	opts := CORSOptions{
+		Origins:        []string{"https://app.example.com", "https://*.example.org"},
+		OriginPatterns: []*regexp.Regexp{regexp.MustCompile(`^https://pr-[0-9]+\.example\.net$`)},
+		Methods:        []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		Headers:        []string{"Authorization", "content-type"},
+		ExposedHeaders: []string{"Link", "X-Request-ID"},
+		Credentials:    true,
+		MaxAge:         10 * time.Minute,
+	}
+
+	type request struct {
+		method         string
+		origin         string
+		requestMethod  string
+		requestHeaders string
+	}
+
+	allowed := map[string]string{
+		"Access-Control-Allow-Origin":      "https://app.example.com",
+		"Access-Control-Allow-Credentials": "true",
+		"Access-Control-Expose-Headers":    "Link, X-Request-ID",
+	}
+
+	tests := []struct {
+		name       string
+		opts       CORSOptions
+		req        request
+		wantServed bool
+		want       map[string]string
+	}{
+		{
+			name:       "same origin",
+			opts:       opts,
+			req:        request{method: http.MethodGet},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "", "Vary": ""},
+		},
+		{
+			name:       "allowed origin",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://app.example.com"},
+			wantServed: true,
+			want:       allowed,
+		},
+		{
+			name:       "origin in other case",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://APP.example.com"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "https://APP.example.com"},
+		},
+		{
+			name:       "other origin",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://evil.example.com"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Expose-Headers": "", "Vary": "Origin"},
+		},
+		{
+			name:       "other scheme",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "http://app.example.com"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "wildcard subdomain",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://a.example.org"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "https://a.example.org"},
+		},
+		{
+			name:       "nested wildcard subdomain",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://a.b.example.org"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "https://a.b.example.org"},
+		},
+		{
+			name:       "wildcard domain itself",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://example.org"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "wildcard suffix without dot",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://evilexample.org"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "wildcard domain as subdomain",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://a.example.org.evil.com"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "wildcard suffix in a path",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://evil.com:443/.example.org"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": ""},
+		},
+		{
+			name:       "pattern",
+			opts:       opts,
+			req:        request{method: http.MethodGet, origin: "https://pr-42.example.net"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "https://pr-42.example.net"},
+		},
+		{
+			name:       "any origin",
+			opts:       CORSOptions{Origins: []string{"*"}},
+			req:        request{method: http.MethodGet, origin: "https://app.example.com"},
+			wantServed: true,
+			want:       map[string]string{"Access-Control-Allow-Origin": "*", "Access-Control-Allow-Credentials": ""},
+		},
+		{
+			name: "preflight",
+			opts: opts,
+			req: request{
+				method:         http.MethodOptions,
+				origin:         "https://app.example.com",
+				requestMethod:  http.MethodDelete,
+				requestHeaders: "authorization, Content-Type",
+			},
+			want: map[string]string{
+				"Access-Control-Allow-Origin":      "https://app.example.com",
+				"Access-Control-Allow-Credentials": "true",
+				"Access-Control-Allow-Methods":     "GET, POST, DELETE",
+				"Access-Control-Allow-Headers":     "authorization, Content-Type",
+				"Access-Control-Max-Age":           "600",
+			},
+		},
+		{
+			name: "preflight of other origin",
+			opts: opts,
+			req:  request{method: http.MethodOptions, origin: "https://evil.example.com", requestMethod: http.MethodGet},
+			want: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name: "preflight of other method",
+			opts: opts,
+			req:  request{method: http.MethodOptions, origin: "https://app.example.com", requestMethod: http.MethodPut},
+			want: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Methods": ""},
+		},
+		{
+			name: "preflight of other header",
+			opts: opts,
+			req:  request{method: http.MethodOptions, origin: "https://app.example.com", requestMethod: http.MethodGet, requestHeaders: "Authorization, X-Debug"},
+			want: map[string]string{"Access-Control-Allow-Origin": "", "Access-Control-Allow-Headers": ""},
+		},
+		{
+			name: "preflight of default methods",
+			opts: CORSOptions{Origins: []string{"https://app.example.com"}, Headers: []string{"*"}},
+			req:  request{method: http.MethodOptions, origin: "https://app.example.com", requestMethod: http.MethodHead, requestHeaders: "X-Debug"},
+			want: map[string]string{
+				"Access-Control-Allow-Origin":  "https://app.example.com",
+				"Access-Control-Allow-Methods": "GET, HEAD, POST",
+				"Access-Control-Allow-Headers": "X-Debug",
+				"Access-Control-Max-Age":       "",
+			},
+		},
+		{
+			name:       "OPTIONS that is not a preflight",
+			opts:       opts,
+			req:        request{method: http.MethodOptions, origin: "https://app.example.com"},
+			wantServed: true,
+			want:       allowed,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			served := false
+			h := CORS(tt.opts)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				served = true
+			}))
+
+			r := httptest.NewRequest(tt.req.method, "/users", nil)
+			if tt.req.origin != "" {
+				r.Header.Set("Origin", tt.req.origin)
+			}
+
+			if tt.req.requestMethod != "" {
+				r.Header.Set("Access-Control-Request-Method", tt.req.requestMethod)
+			}
+
+			if tt.req.requestHeaders != "" {
+				r.Header.Set("Access-Control-Request-Headers", tt.req.requestHeaders)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			if served != tt.wantServed {
+				t.Errorf("served = %v, want %v", served, tt.wantServed)
+			}
+
+			if !tt.wantServed && rw.Code != http.StatusNoContent {
+				t.Errorf("preflight status = %d, want %d", rw.Code, http.StatusNoContent)
+			}
+
+			for header, want := range tt.want {
+				if got := rw.Header().Get(header); got != want {
+					t.Errorf("%s = %q, want %q", header, got, want)
+				}
+			}
+		})
+	}
+}
+
+// TestCORSWithSession checks that the origins CORS lets send credentials can
+// make unsafe requests with a session cookie, as the server sets it up.
+func TestCORSWithSession(t *testing.T) {
+	opts := CORSOptions{
+		Origins:     []string{"https://app.example.com", "https://*.example.org"},
+		Methods:     []string{http.MethodGet, http.MethodPost, http.MethodDelete},
+		Credentials: true,
+	}
+
+	tests := []struct {
+		name       string
+		origin     string
+		wantStatus int
+		wantCORS   bool
+	}{
+		{name: "allowed origin", origin: "https://app.example.com", wantStatus: http.StatusOK, wantCORS: true},
+		{name: "allowed wildcard subdomain", origin: "https://a.example.org", wantStatus: http.StatusOK, wantCORS: true},
+		{name: "same origin", origin: "https://api.example.com", wantStatus: http.StatusOK},
+		{name: "other origin", origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestSessions(t)
+
+			sess, err := store.Create(context.Background(), "ada")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var user string
+
+			h := CORS(opts)(Session(store, OriginMatcher(opts), discardLogger)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if p, ok := auth.FromContext(r.Context()); ok {
+					user = p.Subject
+				}
+			})))
+
+			r := httptest.NewRequest(http.MethodDelete, "https://api.example.com/users/1", nil)
+			r.Header.Set("Origin", tt.origin)
+			r.AddCookie(&http.Cookie{Name: session.DefaultCookieName, Value: sess.ID})
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+
+			if tt.wantStatus == http.StatusOK && user != "ada" {
+				t.Errorf("user = %q, want ada", user)
+			}
+
+			if got := rw.Header().Get("Access-Control-Allow-Credentials") == "true"; got != tt.wantCORS {
+				t.Errorf("credentials allowed = %v, want %v", got, tt.wantCORS)
+			}
+		})
+	}
+}
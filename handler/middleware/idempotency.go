@@ -0,0 +1,265 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/problem"
+)
+
+const (
+	// DefaultIdempotencyTTL is how long responses are kept for retries.
+	DefaultIdempotencyTTL = 24 * time.Hour
+	// DefaultIdempotencyLockTimeout is how long a request holds its key.
+	// A duplicate arriving after it runs again.
+	DefaultIdempotencyLockTimeout = time.Minute
+
+	maxIdempotencyKeyLength = 255
+	// maxIdempotentBodySize bounds the bodies that are fingerprinted.
+	maxIdempotentBodySize = 1 << 20
+)
+
+type IdempotencyOptions struct {
+	Cache       caching.Cache
+	TTL         time.Duration
+	LockTimeout time.Duration
+	Logger      logging.Logger
+}
+
+// idempotentResponse is what is cached under an idempotency key. Status is
+// zero while the first request is in flight.
+type idempotentResponse struct {
+	Fingerprint string      `json:"fingerprint"`
+	Status      int         `json:"status,omitempty"`
+	Header      http.Header `json:"header,omitempty"`
+	Body        []byte      `json:"body,omitempty"`
+}
+
+// Idempotency makes POST requests with an Idempotency-Key header safe to
+// retry. The first request with a key holds it while it runs; its response
+// is then stored and replayed, with Idempotent-Replayed set, to retries with
+// the same method, path and body. Reusing a key for another request is a
+// 422 and retrying while the first request runs a 409.
+//
+// Keys belong to the principal, or to the client IP for anonymous requests,
+// so it must run after authentication. Server errors and responses that may
+// change on a retry, such as 401, 403 and 429, are not stored.
+func Idempotency(opts IdempotencyOptions) func(http.Handler) http.Handler {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultIdempotencyTTL
+	}
+
+	if opts.LockTimeout <= 0 {
+		opts.LockTimeout = DefaultIdempotencyLockTimeout
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			key := r.Header.Get("Idempotency-Key")
+			if r.Method != http.MethodPost || key == "" {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			if len(key) > maxIdempotencyKeyLength {
+				problem.Write(ctx, opts.Logger, rw, r, problem.New(problem.CodeBadRequest, "Idempotency-Key must be at most 255 characters"))
+				return
+			}
+
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxIdempotentBodySize+1))
+			if err != nil {
+				problem.Write(ctx, opts.Logger, rw, r, problem.BadRequest(err))
+				return
+			}
+
+			if len(body) > maxIdempotentBodySize {
+				problem.Write(ctx, opts.Logger, rw, r, problem.New(problem.CodeBadRequest, "body is too large for an idempotent request"))
+				return
+			}
+
+			r.Body = io.NopCloser(bytes.NewReader(body))
+
+			var (
+				cacheKey    = "idempotency:" + requester(r) + ":" + hash(key)
+				fingerprint = hash(r.Method + " " + r.URL.RequestURI() + "\n" + string(body))
+			)
+
+			stored, err := opts.acquire(r, cacheKey, fingerprint)
+			if err != nil {
+				problem.Write(ctx, opts.Logger, rw, r, err)
+				return
+			}
+
+			if stored != nil {
+				opts.replay(rw, r, stored, fingerprint)
+				return
+			}
+
+			rec := newResponseRecorder(rw)
+
+			// The key is released when the response is not stored, including
+			// when next panics, so that the request can be retried.
+			completed := false
+			defer func() {
+				if !completed {
+					if err := opts.Cache.Delete(ctx, cacheKey); err != nil {
+						logging.FromContext(ctx, opts.Logger).Error(err)
+					}
+				}
+			}()
+
+			next.ServeHTTP(rec, r)
+
+			if !storable(rec.status) {
+				return
+			}
+
+			if err := opts.store(r, cacheKey, fingerprint, rec); err != nil {
+				logging.FromContext(ctx, opts.Logger).Error(err)
+				return
+			}
+
+			completed = true
+		})
+	}
+}
+
+// acquire takes the key for a request. It returns the stored response of an
+// earlier request with the key instead, if there is one.
+func (opts IdempotencyOptions) acquire(r *http.Request, cacheKey, fingerprint string) (*idempotentResponse, error) {
+	lock, err := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+	if err != nil {
+		return nil, err
+	}
+
+	// The key may expire or be released between Add and Get, in which case
+	// it is free to take again.
+	for attempt := 0; attempt < 3; attempt++ {
+		ok, err := opts.Cache.Add(r.Context(), cacheKey, string(lock), opts.LockTimeout)
+		if err != nil || ok {
+			return nil, err
+		}
+
+		value, err := opts.Cache.Get(r.Context(), cacheKey)
+		if errors.Is(err, caching.ErrMiss) {
+			continue
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		var stored idempotentResponse
+		if err := json.Unmarshal([]byte(value), &stored); err != nil {
+			return nil, err
+		}
+
+		return &stored, nil
+	}
+
+	return nil, errors.New("idempotency: could not take the key")
+}
+
+func (opts IdempotencyOptions) replay(rw http.ResponseWriter, r *http.Request, stored *idempotentResponse, fingerprint string) {
+	switch {
+	case stored.Fingerprint != fingerprint:
+		problem.Write(r.Context(), opts.Logger, rw, r, problem.New(problem.CodeValidation, "Idempotency-Key was used for another request"))
+	case stored.Status == 0:
+		problem.Write(r.Context(), opts.Logger, rw, r, problem.New(problem.CodeConflict, "a request with this Idempotency-Key is in progress"))
+	default:
+		for k, v := range stored.Header {
+			rw.Header()[k] = v
+		}
+
+		rw.Header().Set("Idempotent-Replayed", "true")
+		rw.WriteHeader(stored.Status)
+
+		if _, err := rw.Write(stored.Body); err != nil {
+			logging.FromContext(r.Context(), opts.Logger).Error(err)
+		}
+	}
+}
+
+func (opts IdempotencyOptions) store(r *http.Request, cacheKey, fingerprint string, rec *responseRecorder) error {
+	value, err := json.Marshal(idempotentResponse{
+		Fingerprint: fingerprint,
+		Status:      rec.status,
+		Header:      rec.handlerHeader(),
+		Body:        rec.body.Bytes(),
+	})
+	if err != nil {
+		return err
+	}
+
+	return opts.Cache.Set(r.Context(), cacheKey, string(value), opts.TTL)
+}
+
+func storable(status int) bool {
+	switch status {
+	case 0, http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests:
+		return false
+	default:
+		return status < http.StatusInternalServerError
+	}
+}
+
+func hash(s string) string {
+	sum := sha256.Sum256([]byte(s))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// responseRecorder passes a response through while keeping a copy of it.
+type responseRecorder struct {
+	http.ResponseWriter
+	before http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseRecorder(rw http.ResponseWriter) *responseRecorder {
+	return &responseRecorder{ResponseWriter: rw, before: rw.Header().Clone()}
+}
+
+// handlerHeader returns the headers set after the recorder was created,
+// which are those of the handler rather than of middleware that runs on
+// every request. Cookies are left out, as they must not be shared.
+func (rec *responseRecorder) handlerHeader() http.Header {
+	header := http.Header{}
+	for k, v := range rec.Header() {
+		if k != "Set-Cookie" && !reflect.DeepEqual(rec.before[k], v) {
+			header[k] = v
+		}
+	}
+
+	return header
+}
+
+func (rec *responseRecorder) WriteHeader(status int) {
+	if rec.status == 0 {
+		rec.status = status
+	}
+
+	rec.ResponseWriter.WriteHeader(status)
+}
+
+func (rec *responseRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.WriteHeader(http.StatusOK)
+	}
+
+	rec.body.Write(b)
+
+	return rec.ResponseWriter.Write(b)
+}
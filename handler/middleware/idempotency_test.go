@@ -0,0 +1,314 @@
+package middleware
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/caching"
+)
+
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: make(map[string]string)}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.values[key]
+	if !ok {
+		return "", caching.ErrMiss
+	}
+
+	return v, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+
+	return nil
+}
+
+func (c *memoryCache) Add(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+
+	c.values[key] = value
+
+	return true, nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+type idempotentRequest struct {
+	method    string
+	path      string
+	key       string
+	body      string
+	principal string
+}
+
+func (ir idempotentRequest) build() *http.Request {
+	method := ir.method
+	if method == "" {
+		method = http.MethodPost
+	}
+
+	path := ir.path
+	if path == "" {
+		path = "/users"
+	}
+
+	r := httptest.NewRequest(method, path, strings.NewReader(ir.body))
+	r.RemoteAddr = "192.0.2.1:1234"
+
+	if ir.key != "" {
+		r.Header.Set("Idempotency-Key", ir.key)
+	}
+
+	if ir.principal != "" {
+		r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: ir.principal, Kind: auth.KindUser}))
+	}
+
+	return r
+}
+
+func TestIdempotency(t *testing.T) {
+	type step struct {
+		req          idempotentRequest
+		wantStatus   int
+		wantReplayed bool
+		wantCalls    int
+	}
+
+	created := idempotentRequest{key: "k1", body: `{"email":"a@example.com"}`}
+
+	tests := []struct {
+		name   string
+		status int
+		steps  []step
+	}{
+		{
+			name:   "replayed",
+			status: http.StatusCreated,
+			steps: []step{
+				{req: created, wantStatus: http.StatusCreated, wantCalls: 1},
+				{req: created, wantStatus: http.StatusCreated, wantReplayed: true, wantCalls: 1},
+				{req: created, wantStatus: http.StatusCreated, wantReplayed: true, wantCalls: 1},
+			},
+		},
+		{
+			name:   "client errors are replayed",
+			status: http.StatusUnprocessableEntity,
+			steps: []step{
+				{req: created, wantStatus: http.StatusUnprocessableEntity, wantCalls: 1},
+				{req: created, wantStatus: http.StatusUnprocessableEntity, wantReplayed: true, wantCalls: 1},
+			},
+		},
+		{
+			name:   "key reused for another body",
+			status: http.StatusCreated,
+			steps: []step{
+				{req: created, wantStatus: http.StatusCreated, wantCalls: 1},
+				{req: idempotentRequest{key: "k1", body: `{"email":"b@example.com"}`}, wantStatus: http.StatusUnprocessableEntity, wantCalls: 1},
+			},
+		},
+		{
+			name:   "key reused for another path",
+			status: http.StatusCreated,
+			steps: []step{
+				{req: created, wantStatus: http.StatusCreated, wantCalls: 1},
+				{req: idempotentRequest{path: "/groups", key: "k1", body: created.body}, wantStatus: http.StatusUnprocessableEntity, wantCalls: 1},
+			},
+		},
+		{
+			name:   "keys of other principals",
+			status: http.StatusCreated,
+			steps: []step{
+				{req: idempotentRequest{key: "k1", principal: "u1"}, wantStatus: http.StatusCreated, wantCalls: 1},
+				{req: idempotentRequest{key: "k1", principal: "u2"}, wantStatus: http.StatusCreated, wantCalls: 2},
+				{req: idempotentRequest{key: "k1"}, wantStatus: http.StatusCreated, wantCalls: 3},
+				{req: idempotentRequest{key: "k1", principal: "u1"}, wantStatus: http.StatusCreated, wantReplayed: true, wantCalls: 3},
+			},
+		},
+		{
+			name:   "server errors are not stored",
+			status: http.StatusInternalServerError,
+			steps: []step{
+				{req: created, wantStatus: http.StatusInternalServerError, wantCalls: 1},
+				{req: created, wantStatus: http.StatusInternalServerError, wantCalls: 2},
+			},
+		},
+		{
+			name:   "rate limited requests are not stored",
+			status: http.StatusTooManyRequests,
+			steps: []step{
+				{req: created, wantStatus: http.StatusTooManyRequests, wantCalls: 1},
+				{req: created, wantStatus: http.StatusTooManyRequests, wantCalls: 2},
+			},
+		},
+		{
+			name:   "without key",
+			status: http.StatusCreated,
+			steps: []step{
+				{req: idempotentRequest{body: created.body}, wantStatus: http.StatusCreated, wantCalls: 1},
+				{req: idempotentRequest{body: created.body}, wantStatus: http.StatusCreated, wantCalls: 2},
+			},
+		},
+		{
+			name:   "not a POST",
+			status: http.StatusOK,
+			steps: []step{
+				{req: idempotentRequest{method: http.MethodPut, key: "k1"}, wantStatus: http.StatusOK, wantCalls: 1},
+				{req: idempotentRequest{method: http.MethodPut, key: "k1"}, wantStatus: http.StatusOK, wantCalls: 2},
+			},
+		},
+		{
+			name:   "key too long",
+			status: http.StatusCreated,
+			steps: []step{
+				{req: idempotentRequest{key: strings.Repeat("k", 256)}, wantStatus: http.StatusBadRequest},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			calls := 0
+			h := Idempotency(IdempotencyOptions{
+				Cache:  newMemoryCache(),
+				Logger: discardLogger,
+			})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				calls++
+
+				body, _ := io.ReadAll(r.Body)
+
+				http.SetCookie(rw, &http.Cookie{Name: "session", Value: "secret"})
+				rw.Header().Set("Content-Type", "application/json")
+				rw.WriteHeader(tt.status)
+				_, _ = rw.Write(body)
+			}))
+
+			for i, s := range tt.steps {
+				rw := httptest.NewRecorder()
+				h.ServeHTTP(rw, s.req.build())
+
+				if rw.Code != s.wantStatus {
+					t.Errorf("request %d: status = %d, want %d", i, rw.Code, s.wantStatus)
+				}
+
+				replayed := rw.Header().Get("Idempotent-Replayed") == "true"
+				if replayed != s.wantReplayed {
+					t.Errorf("request %d: replayed = %v, want %v", i, replayed, s.wantReplayed)
+				}
+
+				if calls != s.wantCalls {
+					t.Errorf("request %d: handler called %d times, want %d", i, calls, s.wantCalls)
+				}
+
+				if !replayed {
+					continue
+				}
+
+				if got := rw.Body.String(); got != s.req.body {
+					t.Errorf("request %d: replayed body = %q, want %q", i, got, s.req.body)
+				}
+
+				if rw.Header().Get("Content-Type") != "application/json" || rw.Header().Get("Set-Cookie") != "" {
+					t.Errorf("request %d: replayed headers = %v", i, rw.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestIdempotencyInProgress(t *testing.T) {
+	var (
+		h        http.Handler
+		retry    *httptest.ResponseRecorder
+		req      = idempotentRequest{key: "k1", body: "{}"}
+		requests = 0
+	)
+
+	h = Idempotency(IdempotencyOptions{
+		Cache:  newMemoryCache(),
+		Logger: discardLogger,
+	})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		requests++
+
+		// A retry arrives while the first request runs.
+		retry = httptest.NewRecorder()
+		h.ServeHTTP(retry, req.build())
+
+		rw.WriteHeader(http.StatusCreated)
+	}))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req.build())
+
+	if rw.Code != http.StatusCreated || retry.Code != http.StatusConflict || requests != 1 {
+		t.Errorf("statuses = %d and %d after %d requests, want %d and %d after 1", rw.Code, retry.Code, requests, http.StatusCreated, http.StatusConflict)
+	}
+}
+
+func TestIdempotencyPanicReleasesKey(t *testing.T) {
+	var (
+		req    = idempotentRequest{key: "k1", body: "{}"}
+		panics = true
+	)
+
+	h := Idempotency(IdempotencyOptions{
+		Cache:  newMemoryCache(),
+		Logger: discardLogger,
+	})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if panics {
+			panics = false
+			panic("boom")
+		}
+
+		rw.WriteHeader(http.StatusCreated)
+	}))
+
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("the panic of the handler was swallowed")
+			}
+		}()
+
+		h.ServeHTTP(httptest.NewRecorder(), req.build())
+	}()
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, req.build())
+
+	if rw.Code != http.StatusCreated {
+		t.Errorf("retry status = %d, want %d", rw.Code, http.StatusCreated)
+	}
+}
@@ -0,0 +1,116 @@
+package middleware
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type HTTPMetricsOptions struct {
+	Namespace  string
+	Registerer prometheus.Registerer
+	// DurationBuckets and SizeBuckets are the buckets of the request
+	// duration, in seconds, and response size, in bytes, histograms.
+	DurationBuckets []float64
+	SizeBuckets     []float64
+}
+
+// HTTPMetrics are the request rate, error and duration metrics of the HTTP
+// servers. They are labeled by server, route pattern, method and status
+// class, such as 2xx.
+type HTTPMetrics struct {
+	requests *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	size     *prometheus.HistogramVec
+	inFlight *prometheus.GaugeVec
+}
+
+// DefaultSizeBuckets are the response size buckets, from 100B to 10MB.
+var DefaultSizeBuckets = prometheus.ExponentialBuckets(100, 10, 6)
+
+func NewHTTPMetrics(opts HTTPMetricsOptions) *HTTPMetrics {
+	if len(opts.DurationBuckets) == 0 {
+		opts.DurationBuckets = prometheus.DefBuckets
+	}
+
+	if len(opts.SizeBuckets) == 0 {
+		opts.SizeBuckets = DefaultSizeBuckets
+	}
+
+	labels := []string{"server", "route", "method", "status"}
+
+	m := &HTTPMetrics{
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_requests_total",
+			Help:      "Number of HTTP requests served",
+		}, labels),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_request_duration_seconds",
+			Help:      "Time taken to serve HTTP requests",
+			Buckets:   opts.DurationBuckets,
+		}, labels),
+		size: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_response_size_bytes",
+			Help:      "Size of HTTP response bodies",
+			Buckets:   opts.SizeBuckets,
+		}, labels),
+		inFlight: prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: opts.Namespace,
+			Name:      "http_requests_in_flight",
+			Help:      "Number of HTTP requests being served",
+		}, []string{"server"}),
+	}
+
+	opts.Registerer.MustRegister(m.requests, m.duration, m.size, m.inFlight)
+
+	return m
+}
+
+// Handler records the requests of server. It must run before any chi
+// router, so that it sees the pattern the router matched.
+func (m *HTTPMetrics) Handler(server string) func(http.Handler) http.Handler {
+	inFlight := m.inFlight.WithLabelValues(server)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			r, rctx := withRouteContext(r)
+
+			var (
+				start = time.Now()
+				sw    = &statusWriter{ResponseWriter: rw}
+			)
+
+			inFlight.Inc()
+			defer inFlight.Dec()
+
+			next.ServeHTTP(sw, r)
+
+			labels := prometheus.Labels{
+				"server": server,
+				"route":  routePattern(rctx),
+				"method": methodLabel(r.Method),
+				"status": strconv.Itoa(sw.code()/100) + "xx",
+			}
+
+			m.requests.With(labels).Inc()
+			m.duration.With(labels).Observe(time.Since(start).Seconds())
+			m.size.With(labels).Observe(float64(sw.bytes))
+		})
+	}
+}
+
+// methodLabel bounds the methods that are labels to the standard ones.
+func methodLabel(method string) string {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+		http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace:
+		return method
+	default:
+		return "OTHER"
+	}
+}
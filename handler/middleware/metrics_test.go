@@ -0,0 +1,129 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// series returns the metrics of the family name, keyed by their method,
+// route and status labels.
+func series(t *testing.T, registry *prometheus.Registry, name string) map[string]*dto.Metric {
+	t.Helper()
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+
+		metrics := make(map[string]*dto.Metric)
+
+		for _, metric := range f.GetMetric() {
+			labels := map[string]string{}
+			for _, l := range metric.GetLabel() {
+				labels[l.GetName()] = l.GetValue()
+			}
+
+			if labels["server"] != "public" {
+				t.Errorf("%s: server = %q, want public", name, labels["server"])
+			}
+
+			metrics[labels["method"]+" "+labels["route"]+" "+labels["status"]] = metric
+		}
+
+		return metrics
+	}
+
+	t.Fatalf("%s is not registered", name)
+
+	return nil
+}
+
+func TestHTTPMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	m := NewHTTPMetrics(HTTPMetricsOptions{Namespace: "xapi", Registerer: registry})
+
+	var inFlight float64
+
+	router := chi.NewRouter()
+	router.Get("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		inFlight = testutil.ToFloat64(m.inFlight.WithLabelValues("public"))
+		rw.Write([]byte("0123456789"))
+	})
+	router.Post("/users", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusCreated)
+	})
+	router.Delete("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusConflict)
+	})
+	router.Get("/fail", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	h := m.Handler("public")(router)
+
+	requests := []struct {
+		method string
+		path   string
+	}{
+		{http.MethodGet, "/users/1"},
+		{http.MethodGet, "/users/2"},
+		{http.MethodPost, "/users"},
+		{http.MethodDelete, "/users/3"},
+		{http.MethodGet, "/fail"},
+		{"PURGE", "/users/4"},
+		{http.MethodGet, "/unknown"},
+	}
+
+	for _, req := range requests {
+		h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(req.method, req.path, nil))
+	}
+
+	if inFlight != 1 {
+		t.Errorf("in flight while serving = %v, want 1", inFlight)
+	}
+
+	if got := testutil.ToFloat64(m.inFlight.WithLabelValues("public")); got != 0 {
+		t.Errorf("in flight after serving = %v, want 0", got)
+	}
+
+	// Routes are patterns rather than paths, so that labels stay bounded.
+	want := map[string]float64{
+		"GET /users/{id} 2xx":    2,
+		"POST /users 2xx":        1,
+		"DELETE /users/{id} 4xx": 1,
+		"GET /fail 5xx":          1,
+		"GET - 4xx":              1,
+		"OTHER - 4xx":            1,
+	}
+
+	got := map[string]float64{}
+	for key, metric := range series(t, registry, "xapi_http_requests_total") {
+		got[key] = metric.GetCounter().GetValue()
+	}
+
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("requests = %v, want %v", got, want)
+	}
+
+	durations := series(t, registry, "xapi_http_request_duration_seconds")
+	if n := durations["GET /users/{id} 2xx"].GetHistogram().GetSampleCount(); n != 2 {
+		t.Errorf("durations of GET /users/{id} = %d, want 2", n)
+	}
+
+	size := series(t, registry, "xapi_http_response_size_bytes")["GET /users/{id} 2xx"].GetHistogram()
+	if size.GetSampleCount() != 2 || size.GetSampleSum() != 20 {
+		t.Errorf("sizes of GET /users/{id} = %d summing to %v, want 2 summing to 20", size.GetSampleCount(), size.GetSampleSum())
+	}
+}
@@ -0,0 +1,164 @@
+package middleware
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/problem"
+	"github.com/edalmi/x-api/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// RateLimitRoute limits the requests whose path starts with Path and, if
+// Method is set, whose method is Method.
+type RateLimitRoute struct {
+	Method string
+	Path   string
+	Limit  ratelimit.Limit
+}
+
+func (r RateLimitRoute) name() string {
+	if r.Method == "" {
+		return r.Path
+	}
+
+	return r.Method + " " + r.Path
+}
+
+func (r RateLimitRoute) matches(req *http.Request) bool {
+	return (r.Method == "" || r.Method == req.Method) && strings.HasPrefix(req.URL.Path, r.Path)
+}
+
+type RateLimitOptions struct {
+	Limiter ratelimit.Limiter
+	// Default limits the requests that no route matches. Without it they
+	// are not limited.
+	Default *ratelimit.Limit
+	Routes  []RateLimitRoute
+	// Namespace and Registerer are those of the counter of rejected
+	// requests.
+	Namespace  string
+	Registerer prometheus.Registerer
+	Logger     logging.Logger
+}
+
+// RateLimit limits the requests of each principal, or of each client IP
+// when the request is anonymous, to the limit of the longest matching route.
+// Every route has buckets of its own. Responses carry the RateLimit-Limit,
+// RateLimit-Remaining and RateLimit-Reset headers; rejected ones are a 429
+// with Retry-After. When the limiter fails the request is let through, so
+// that an outage of its store does not take the API down. It must run after
+// authentication to see principals.
+func RateLimit(opts RateLimitOptions) func(http.Handler) http.Handler {
+	rejected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: opts.Namespace,
+		Name:      "rate_limited_requests_total",
+		Help:      "Number of requests rejected by the rate limiter",
+	}, []string{"route"})
+
+	opts.Registerer.MustRegister(rejected)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			name, limit, ok := opts.limit(r)
+			if !ok {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			if allow(rw, r, opts, rejected, name, "ratelimit:"+name+":"+requester(r), limit) {
+				next.ServeHTTP(rw, r)
+			}
+		})
+	}
+}
+
+// RateLimitAuthentication limits the requests of each client IP that reach
+// authentication, so that guessing credentials is throttled too: RateLimit
+// only sees the requests that authenticated. It counts every request that
+// an earlier middleware, such as Session, has not authenticated, and must
+// run before Authenticate. Only the limiter, metrics and logging options
+// are used.
+func RateLimitAuthentication(opts RateLimitOptions, limit ratelimit.Limit) func(http.Handler) http.Handler {
+	rejected := prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: opts.Namespace,
+		Name:      "authentication_rate_limited_requests_total",
+		Help:      "Number of requests rejected by the rate limiter before authentication",
+	}, []string{"route"})
+
+	opts.Registerer.MustRegister(rejected)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if _, ok := auth.FromContext(r.Context()); ok {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			if allow(rw, r, opts, rejected, "authentication", "ratelimit:authentication:ip:"+clientIP(r), limit) {
+				next.ServeHTTP(rw, r)
+			}
+		})
+	}
+}
+
+// allow takes a request from the bucket of key and sets the rate limit
+// headers. It writes the 429 of rejected requests and reports whether r may
+// be served.
+func allow(rw http.ResponseWriter, r *http.Request, opts RateLimitOptions, rejected *prometheus.CounterVec, name, key string, limit ratelimit.Limit) bool {
+	ctx := r.Context()
+
+	res, err := opts.Limiter.Allow(ctx, key, limit)
+	if err != nil {
+		logging.FromContext(ctx, opts.Logger).Error(err)
+		return true
+	}
+
+	h := rw.Header()
+	h.Set("RateLimit-Limit", strconv.Itoa(res.Limit))
+	h.Set("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("RateLimit-Reset", seconds(res.Reset))
+
+	if !res.Allowed {
+		rejected.WithLabelValues(name).Inc()
+
+		h.Set("Retry-After", seconds(res.RetryAfter))
+		problem.Write(ctx, opts.Logger, rw, r, problem.New(problem.CodeRateLimited, "too many requests, retry in "+seconds(res.RetryAfter)+"s"))
+
+		return false
+	}
+
+	return true
+}
+
+// limit returns the name and the limit of the route r belongs to. Of the
+// routes of the same path, the one of the method of r wins.
+func (opts RateLimitOptions) limit(r *http.Request) (string, ratelimit.Limit, bool) {
+	var match *RateLimitRoute
+
+	for i, route := range opts.Routes {
+		if route.matches(r) && (match == nil || len(route.Path) > len(match.Path) ||
+			len(route.Path) == len(match.Path) && match.Method == "") {
+			match = &opts.Routes[i]
+		}
+	}
+
+	switch {
+	case match != nil:
+		return match.name(), match.Limit, true
+	case opts.Default != nil:
+		return "default", *opts.Default, true
+	default:
+		return "", ratelimit.Limit{}, false
+	}
+}
+
+// seconds rounds d up to whole seconds, as the headers expect.
+func seconds(d time.Duration) string {
+	return strconv.FormatInt(int64(math.Ceil(d.Seconds())), 10)
+}
@@ -0,0 +1,310 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	logginglog "github.com/edalmi/x-api/logging/log"
+	"github.com/edalmi/x-api/ratelimit"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var discardLogger = logginglog.New(log.New(io.Discard, "", 0))
+
+// recordingLimiter records the keys and limits it is asked about.
+type recordingLimiter struct {
+	keys   []string
+	limits []ratelimit.Limit
+	err    error
+}
+
+func (l *recordingLimiter) Allow(_ context.Context, key string, limit ratelimit.Limit) (*ratelimit.Result, error) {
+	l.keys = append(l.keys, key)
+	l.limits = append(l.limits, limit)
+
+	if l.err != nil {
+		return nil, l.err
+	}
+
+	return ratelimit.NewResult(limit, true, limit.Period/time.Duration(limit.Requests), 0), nil
+}
+
+func TestRateLimitRoutes(t *testing.T) {
+	var (
+		def    = ratelimit.Limit{Requests: 100, Period: time.Minute}
+		users  = ratelimit.Limit{Requests: 10, Period: time.Minute}
+		create = ratelimit.Limit{Requests: 5, Period: time.Minute}
+		token  = ratelimit.Limit{Requests: 1, Period: time.Minute}
+		routes = []RateLimitRoute{
+			{Path: "/users", Limit: users},
+			{Method: http.MethodPost, Path: "/users", Limit: create},
+			{Path: "/oauth/token", Limit: token},
+		}
+	)
+
+	tests := []struct {
+		name      string
+		def       *ratelimit.Limit
+		method    string
+		path      string
+		principal *auth.Principal
+		wantKey   string
+		wantLimit *ratelimit.Limit
+	}{
+		{
+			name:      "route",
+			method:    http.MethodGet,
+			path:      "/users/1",
+			wantKey:   "ratelimit:/users:ip:192.0.2.1",
+			wantLimit: &users,
+		},
+		{
+			name:      "route of the method",
+			method:    http.MethodPost,
+			path:      "/users",
+			wantKey:   "ratelimit:POST /users:ip:192.0.2.1",
+			wantLimit: &create,
+		},
+		{
+			name:      "longest route",
+			method:    http.MethodPost,
+			path:      "/oauth/token",
+			wantKey:   "ratelimit:/oauth/token:ip:192.0.2.1",
+			wantLimit: &token,
+		},
+		{
+			name:      "principal",
+			method:    http.MethodGet,
+			path:      "/users",
+			principal: &auth.Principal{Subject: "u1", Kind: auth.KindUser},
+			wantKey:   "ratelimit:/users:user:u1",
+			wantLimit: &users,
+		},
+		{
+			name:      "default",
+			def:       &def,
+			method:    http.MethodGet,
+			path:      "/groups",
+			wantKey:   "ratelimit:default:ip:192.0.2.1",
+			wantLimit: &def,
+		},
+		{
+			name:   "not limited",
+			method: http.MethodGet,
+			path:   "/groups",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			limiter := &recordingLimiter{}
+			h := RateLimit(RateLimitOptions{
+				Limiter:    limiter,
+				Default:    tt.def,
+				Routes:     routes,
+				Registerer: prometheus.NewRegistry(),
+				Logger:     discardLogger,
+			})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			r.RemoteAddr = "192.0.2.1:1234"
+
+			if tt.principal != nil {
+				r = r.WithContext(auth.WithPrincipal(r.Context(), tt.principal))
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			if rw.Code != http.StatusOK {
+				t.Errorf("status = %d, want %d", rw.Code, http.StatusOK)
+			}
+
+			if tt.wantLimit == nil {
+				if len(limiter.keys) != 0 {
+					t.Errorf("limiter asked about %v, want no request limited", limiter.keys)
+				}
+
+				return
+			}
+
+			if len(limiter.keys) != 1 || limiter.keys[0] != tt.wantKey || limiter.limits[0] != *tt.wantLimit {
+				t.Errorf("limiter asked about %v with %v, want %q with %v", limiter.keys, limiter.limits, tt.wantKey, *tt.wantLimit)
+			}
+		})
+	}
+}
+
+func TestRateLimitHeaders(t *testing.T) {
+	h := RateLimit(RateLimitOptions{
+		Limiter:    ratelimit.NewMemory(),
+		Default:    &ratelimit.Limit{Requests: 2, Period: time.Minute},
+		Registerer: prometheus.NewRegistry(),
+		Logger:     discardLogger,
+	})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {}))
+
+	steps := []struct {
+		wantStatus     int
+		wantRemaining  string
+		wantReset      string
+		wantRetryAfter string
+	}{
+		{wantStatus: http.StatusOK, wantRemaining: "1", wantReset: "30"},
+		{wantStatus: http.StatusOK, wantRemaining: "0", wantReset: "60"},
+		{wantStatus: http.StatusTooManyRequests, wantRemaining: "0", wantReset: "60", wantRetryAfter: "30"},
+	}
+
+	for i, s := range steps {
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		rw := httptest.NewRecorder()
+		h.ServeHTTP(rw, r)
+
+		got := rw.Result()
+		if got.StatusCode != s.wantStatus {
+			t.Errorf("request %d: status = %d, want %d", i, got.StatusCode, s.wantStatus)
+		}
+
+		for header, want := range map[string]string{
+			"RateLimit-Limit":     "2",
+			"RateLimit-Remaining": s.wantRemaining,
+			"RateLimit-Reset":     s.wantReset,
+			"Retry-After":         s.wantRetryAfter,
+		} {
+			if v := got.Header.Get(header); v != want {
+				t.Errorf("request %d: %s = %q, want %q", i, header, v, want)
+			}
+		}
+	}
+}
+
+func TestRateLimitFailsOpen(t *testing.T) {
+	served := false
+	h := RateLimit(RateLimitOptions{
+		Limiter:    &recordingLimiter{err: errors.New("redis is down")},
+		Default:    &ratelimit.Limit{Requests: 1, Period: time.Minute},
+		Registerer: prometheus.NewRegistry(),
+		Logger:     discardLogger,
+	})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		served = true
+	}))
+
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+	if !served || rw.Code != http.StatusOK {
+		t.Errorf("served = %v, status = %d, want the request served", served, rw.Code)
+	}
+}
+
+func TestRateLimitAuthentication(t *testing.T) {
+	authenticator := tokenAuthenticator{
+		scheme:     "Bearer",
+		principals: map[string]*auth.Principal{"valid": {Subject: "ci", Kind: auth.KindAPIKey}},
+	}
+
+	type request struct {
+		ip            string
+		authorization string
+		session       bool
+	}
+
+	tests := []struct {
+		name     string
+		requests []request
+		want     []int
+	}{
+		{
+			name:     "failures",
+			requests: []request{{ip: "192.0.2.1", authorization: "Bearer guess"}, {ip: "192.0.2.1", authorization: "Bearer guess"}, {ip: "192.0.2.1", authorization: "Bearer guess"}},
+			want:     []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			name:     "no credentials",
+			requests: []request{{ip: "192.0.2.1"}, {ip: "192.0.2.1"}, {ip: "192.0.2.1"}},
+			want:     []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			name:     "valid credentials after failures",
+			requests: []request{{ip: "192.0.2.1", authorization: "Bearer guess"}, {ip: "192.0.2.1", authorization: "Bearer guess"}, {ip: "192.0.2.1", authorization: "Bearer valid"}},
+			want:     []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests},
+		},
+		{
+			name:     "per client IP",
+			requests: []request{{ip: "192.0.2.1", authorization: "Bearer guess"}, {ip: "192.0.2.1", authorization: "Bearer guess"}, {ip: "192.0.2.2", authorization: "Bearer guess"}},
+			want:     []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized},
+		},
+		{
+			name:     "authenticated by an earlier middleware",
+			requests: []request{{ip: "192.0.2.1", session: true}, {ip: "192.0.2.1", session: true}, {ip: "192.0.2.1", session: true}},
+			want:     []int{http.StatusOK, http.StatusOK, http.StatusOK},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			registry := prometheus.NewRegistry()
+
+			limit := RateLimitAuthentication(RateLimitOptions{
+				Limiter:    ratelimit.NewMemory(),
+				Registerer: registry,
+				Logger:     discardLogger,
+			}, ratelimit.Limit{Requests: 2, Period: time.Minute})
+
+			h := limit(Authenticate(discardLogger, authenticator)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {})))
+
+			for i, req := range tt.requests {
+				r := httptest.NewRequest(http.MethodGet, "/users", nil)
+				r.RemoteAddr = req.ip + ":1234"
+
+				if req.authorization != "" {
+					r.Header.Set("Authorization", req.authorization)
+				}
+
+				if req.session {
+					r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: "ada", Kind: auth.KindUser}))
+				}
+
+				rw := httptest.NewRecorder()
+				h.ServeHTTP(rw, r)
+
+				if rw.Code != tt.want[i] {
+					t.Errorf("request %d: status = %d, want %d", i, rw.Code, tt.want[i])
+				}
+
+				if rw.Code == http.StatusTooManyRequests && rw.Header().Get("Retry-After") == "" {
+					t.Errorf("request %d: Retry-After is not set", i)
+				}
+			}
+
+			rejected := 0
+			for _, code := range tt.want {
+				if code == http.StatusTooManyRequests {
+					rejected++
+				}
+			}
+
+			families, err := registry.Gather()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			counted := 0
+			for _, f := range families {
+				if f.GetName() == "authentication_rate_limited_requests_total" {
+					counted = int(f.GetMetric()[0].GetCounter().GetValue())
+				}
+			}
+
+			if counted != rejected {
+				t.Errorf("rejected requests counted = %d, want %d", counted, rejected)
+			}
+		})
+	}
+}
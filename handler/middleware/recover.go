@@ -0,0 +1,102 @@
+package middleware
+
+import (
+	"fmt"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+type RecovererOptions struct {
+	// Namespace and Registerer are those of the counter of panics.
+	Namespace  string
+	Registerer prometheus.Registerer
+	Logger     logging.Logger
+}
+
+// Recoverer turns the panics of handlers into 500 responses.
+type Recoverer struct {
+	logger logging.Logger
+	panics *prometheus.CounterVec
+}
+
+func NewRecoverer(opts RecovererOptions) *Recoverer {
+	rc := &Recoverer{
+		logger: opts.Logger,
+		panics: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "panics_total",
+			Help:      "Number of panics recovered from handlers",
+		}, []string{"server"}),
+	}
+
+	opts.Registerer.MustRegister(rc.panics)
+
+	return rc
+}
+
+// Handler recovers the panics of the handlers of server. They are logged
+// with their stack, recorded on the span of the request and answered with
+// an internal error problem, unless the response has already started. With
+// exposeStack the problem details the panic and its stack, which is only
+// meant for development.
+func (rc *Recoverer) Handler(server string, exposeStack bool) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			sw := &statusWriter{ResponseWriter: rw}
+
+			defer func() {
+				v := recover()
+				if v == nil {
+					return
+				}
+
+				// ErrAbortHandler aborts the response on purpose.
+				if v == http.ErrAbortHandler {
+					panic(v)
+				}
+
+				var (
+					ctx   = r.Context()
+					err   = fmt.Errorf("panic: %v", v)
+					stack = string(debug.Stack())
+				)
+
+				rc.panics.WithLabelValues(server).Inc()
+
+				logging.FromContext(ctx, rc.logger).WithFields(logging.Fields{
+					"method": r.Method,
+					"path":   r.URL.Path,
+					"stack":  stack,
+				}).Error(err)
+
+				span := trace.SpanFromContext(ctx)
+				span.RecordError(err, trace.WithAttributes(semconv.ExceptionStacktraceKey.String(stack)))
+				span.SetStatus(codes.Error, err.Error())
+
+				if sw.status != 0 {
+					return
+				}
+
+				p := problem.From(err)
+				p.Instance = r.URL.Path
+
+				if exposeStack {
+					p.Detail = err.Error() + "\n\n" + stack
+				}
+
+				if err := problem.Render(rw, p); err != nil {
+					logging.FromContext(ctx, rc.logger).Error(err)
+				}
+			}()
+
+			next.ServeHTTP(sw, r)
+		})
+	}
+}
@@ -0,0 +1,105 @@
+package middleware
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edalmi/x-api/problem"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecoverer(t *testing.T) {
+	tests := []struct {
+		name        string
+		handler     http.HandlerFunc
+		exposeStack bool
+		wantStatus  int
+		wantPanics  float64
+		wantDetail  string
+	}{
+		{
+			name:       "no panic",
+			handler:    func(rw http.ResponseWriter, r *http.Request) { rw.WriteHeader(http.StatusCreated) },
+			wantStatus: http.StatusCreated,
+		},
+		{
+			name:       "panic",
+			handler:    func(rw http.ResponseWriter, r *http.Request) { panic("boom") },
+			wantStatus: http.StatusInternalServerError,
+			wantPanics: 1,
+		},
+		{
+			name:        "panic with stack exposed",
+			handler:     func(rw http.ResponseWriter, r *http.Request) { panic("boom") },
+			exposeStack: true,
+			wantStatus:  http.StatusInternalServerError,
+			wantPanics:  1,
+			wantDetail:  "panic: boom\n\ngoroutine ",
+		},
+		{
+			name: "panic after the response started",
+			handler: func(rw http.ResponseWriter, r *http.Request) {
+				rw.WriteHeader(http.StatusAccepted)
+				panic("boom")
+			},
+			wantStatus: http.StatusAccepted,
+			wantPanics: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rc := NewRecoverer(RecovererOptions{
+				Registerer: prometheus.NewRegistry(),
+				Logger:     discardLogger,
+			})
+
+			rw := httptest.NewRecorder()
+			rc.Handler("public", tt.exposeStack)(tt.handler).ServeHTTP(rw, httptest.NewRequest(http.MethodGet, "/users", nil))
+
+			if rw.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+
+			if got := testutil.ToFloat64(rc.panics.WithLabelValues("public")); got != tt.wantPanics {
+				t.Errorf("panics = %v, want %v", got, tt.wantPanics)
+			}
+
+			if tt.wantStatus != http.StatusInternalServerError {
+				return
+			}
+
+			var p problem.Problem
+			if err := json.NewDecoder(rw.Body).Decode(&p); err != nil {
+				t.Fatal(err)
+			}
+
+			if p.Code != problem.CodeInternal || p.Instance != "/users" || !strings.HasPrefix(p.Detail, tt.wantDetail) {
+				t.Errorf("problem = %+v", p)
+			}
+		})
+	}
+}
+
+func TestRecovererAbortHandler(t *testing.T) {
+	rc := NewRecoverer(RecovererOptions{
+		Registerer: prometheus.NewRegistry(),
+		Logger:     discardLogger,
+	})
+
+	h := rc.Handler("public", false)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if v := recover(); v != http.ErrAbortHandler {
+			t.Errorf("recovered %v, want http.ErrAbortHandler", v)
+		}
+	}()
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/users", nil))
+}
@@ -0,0 +1,63 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/edalmi/x-api/logging"
+	"github.com/google/uuid"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// maxRequestIDLength bounds the X-Request-ID values that are accepted.
+const maxRequestIDLength = 128
+
+// RequestIDAttribute is the span attribute of the request ID.
+const RequestIDAttribute = attribute.Key("request_id")
+
+type requestIDKey struct{}
+
+// RequestID gives every request an ID, taken from its X-Request-ID header
+// or generated when the header is missing or malformed. The ID is echoed in
+// the X-Request-ID response header, set on the current span and added to
+// the fields of logging.FromContext.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get("X-Request-ID")
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		rw.Header().Set("X-Request-ID", id)
+
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		ctx = logging.ContextWithFields(ctx, logging.Fields{"request_id": id})
+
+		trace.SpanFromContext(ctx).SetAttributes(RequestIDAttribute.String(id))
+
+		next.ServeHTTP(rw, r.WithContext(ctx))
+	})
+}
+
+// RequestIDFromContext returns the ID RequestID gave to the request of ctx.
+func RequestIDFromContext(ctx context.Context) (string, bool) {
+	id, ok := ctx.Value(requestIDKey{}).(string)
+	return id, ok
+}
+
+// validRequestID reports whether id is short and printable, so that it can
+// be logged and echoed as is.
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLength {
+		return false
+	}
+
+	for i := 0; i < len(id); i++ {
+		if id[i] < '!' || id[i] > '~' {
+			return false
+		}
+	}
+
+	return true
+}
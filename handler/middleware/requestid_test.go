@@ -0,0 +1,76 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/edalmi/x-api/logging"
+	"github.com/google/uuid"
+)
+
+// fieldsLogger records the fields it was given.
+type fieldsLogger struct {
+	logging.Logger
+	fields logging.Fields
+}
+
+func (l *fieldsLogger) WithFields(fields logging.Fields) logging.Logger {
+	l.fields = fields
+	return l
+}
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name       string
+		header     string
+		wantEchoed bool
+	}{
+		{name: "given", header: "3f2c1b9e-req", wantEchoed: true},
+		{name: "longest", header: strings.Repeat("a", 128), wantEchoed: true},
+		{name: "missing"},
+		{name: "too long", header: strings.Repeat("a", 129)},
+		{name: "space", header: "abc def"},
+		{name: "newline", header: "abc\ndef"},
+		{name: "not ASCII", header: "abcé"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				fromContext string
+				logger      = &fieldsLogger{}
+			)
+
+			h := RequestID(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				fromContext, _ = RequestIDFromContext(r.Context())
+				logging.FromContext(r.Context(), logger)
+			}))
+
+			r := httptest.NewRequest(http.MethodGet, "/users", nil)
+			if tt.header != "" {
+				r.Header["X-Request-Id"] = []string{tt.header}
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			id := rw.Header().Get("X-Request-ID")
+
+			if tt.wantEchoed && id != tt.header {
+				t.Errorf("X-Request-ID = %q, want %q", id, tt.header)
+			}
+
+			if !tt.wantEchoed {
+				if _, err := uuid.Parse(id); err != nil {
+					t.Errorf("X-Request-ID = %q, want a generated UUID", id)
+				}
+			}
+
+			if fromContext != id || logger.fields["request_id"] != id {
+				t.Errorf("request ID of the context %q and of the logs %q, want %q", fromContext, logger.fields["request_id"], id)
+			}
+		})
+	}
+}
@@ -0,0 +1,264 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// DefaultResponseCacheTTL is how long responses are cached.
+const DefaultResponseCacheTTL = time.Minute
+
+type ResponseCacheOptions struct {
+	Cache caching.Cache
+	TTL   time.Duration
+	// Namespace and Registerer are those of the hit and miss counters.
+	Namespace  string
+	Registerer prometheus.Registerer
+	Logger     logging.Logger
+}
+
+// ResponseCache caches the 200 responses of GET routes in the cache
+// provider. Responses are cached per principal, or per client IP for
+// anonymous requests, and per value of the request headers they Vary on.
+//
+// Each response belongs to a resource. Invalidate drops every response of a
+// resource by moving it to a new generation, which the cache keys include,
+// so that the old entries are never read again and expire on their own.
+type ResponseCache struct {
+	opts   ResponseCacheOptions
+	hits   *prometheus.CounterVec
+	misses *prometheus.CounterVec
+}
+
+// cachedResponse is what is cached for a request. When the response Varies,
+// the entry of the request only holds the Vary header names, and the
+// response is cached under a key that includes their values.
+type cachedResponse struct {
+	Vary   []string    `json:"vary,omitempty"`
+	Header http.Header `json:"header,omitempty"`
+	Body   []byte      `json:"body,omitempty"`
+}
+
+func NewResponseCache(opts ResponseCacheOptions) *ResponseCache {
+	if opts.TTL <= 0 {
+		opts.TTL = DefaultResponseCacheTTL
+	}
+
+	c := &ResponseCache{
+		opts: opts,
+		hits: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "response_cache_hits_total",
+			Help:      "Number of responses served from the response cache",
+		}, []string{"route"}),
+		misses: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: opts.Namespace,
+			Name:      "response_cache_misses_total",
+			Help:      "Number of responses not found in the response cache",
+		}, []string{"route"}),
+	}
+
+	opts.Registerer.MustRegister(c.hits, c.misses)
+
+	return c
+}
+
+// Handler caches the responses of route, whose requests read the resource
+// that resource returns. It must run after authentication and
+// authorization, so that cached responses are only served to principals
+// allowed to read them. When the cache fails requests are served as if it
+// were empty.
+func (c *ResponseCache) Handler(route string, resource func(r *http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			if r.Method != http.MethodGet {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			key, err := c.key(r, resource(r))
+			if err != nil {
+				logging.FromContext(r.Context(), c.opts.Logger).Error(err)
+				next.ServeHTTP(rw, r)
+
+				return
+			}
+
+			cached, err := c.lookup(r, key)
+			if err != nil && !errors.Is(err, caching.ErrMiss) {
+				logging.FromContext(r.Context(), c.opts.Logger).Error(err)
+			}
+
+			if cached != nil {
+				c.hits.WithLabelValues(route).Inc()
+				c.serve(rw, r, cached)
+
+				return
+			}
+
+			c.misses.WithLabelValues(route).Inc()
+
+			rec := newResponseRecorder(rw)
+			next.ServeHTTP(rec, r)
+
+			if err := c.store(r, key, rec); err != nil {
+				logging.FromContext(r.Context(), c.opts.Logger).Error(err)
+			}
+		})
+	}
+}
+
+// Invalidate drops the cached responses of resource.
+func (c *ResponseCache) Invalidate(ctx context.Context, resource string) error {
+	// The generation outlives the entries that include it, so that it
+	// cannot expire and bring them back.
+	return c.opts.Cache.Set(ctx, generationKey(resource), uuid.NewString(), 2*c.opts.TTL)
+}
+
+// key returns the cache key of the responses to r. A resource that was
+// never invalidated has the empty generation.
+func (c *ResponseCache) key(r *http.Request, resource string) (string, error) {
+	gen, err := c.opts.Cache.Get(r.Context(), generationKey(resource))
+	if err != nil && !errors.Is(err, caching.ErrMiss) {
+		return "", err
+	}
+
+	return "response:" + hash(resource+"\n"+gen+"\n"+requester(r)+"\n"+r.URL.RequestURI()), nil
+}
+
+func (c *ResponseCache) lookup(r *http.Request, key string) (*cachedResponse, error) {
+	cached, err := c.get(r.Context(), key)
+	if err != nil || len(cached.Vary) == 0 {
+		return cached, err
+	}
+
+	return c.get(r.Context(), variantKey(key, cached.Vary, r))
+}
+
+func (c *ResponseCache) get(ctx context.Context, key string) (*cachedResponse, error) {
+	value, err := c.opts.Cache.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedResponse
+	if err := json.Unmarshal([]byte(value), &cached); err != nil {
+		return nil, err
+	}
+
+	return &cached, nil
+}
+
+func (c *ResponseCache) serve(rw http.ResponseWriter, r *http.Request, cached *cachedResponse) {
+	if tag := cached.Header.Get("ETag"); tag != "" && etagMatch(r.Header.Get("If-None-Match"), tag) {
+		rw.Header().Set("ETag", tag)
+		rw.WriteHeader(http.StatusNotModified)
+
+		return
+	}
+
+	for k, v := range cached.Header {
+		rw.Header()[k] = v
+	}
+
+	rw.WriteHeader(http.StatusOK)
+
+	if _, err := rw.Write(cached.Body); err != nil {
+		logging.FromContext(r.Context(), c.opts.Logger).Error(err)
+	}
+}
+
+func (c *ResponseCache) store(r *http.Request, key string, rec *responseRecorder) error {
+	if rec.status != http.StatusOK {
+		return nil
+	}
+
+	header := rec.handlerHeader()
+	if strings.Contains(header.Get("Cache-Control"), "no-store") {
+		return nil
+	}
+
+	vary := varyHeaders(header)
+	for _, name := range vary {
+		if name == "*" {
+			return nil
+		}
+	}
+
+	response := cachedResponse{Header: header, Body: rec.body.Bytes()}
+
+	if len(vary) > 0 {
+		if err := c.set(r.Context(), key, cachedResponse{Vary: vary}); err != nil {
+			return err
+		}
+
+		key = variantKey(key, vary, r)
+	}
+
+	return c.set(r.Context(), key, response)
+}
+
+func (c *ResponseCache) set(ctx context.Context, key string, cached cachedResponse) error {
+	value, err := json.Marshal(cached)
+	if err != nil {
+		return err
+	}
+
+	return c.opts.Cache.Set(ctx, key, string(value), c.opts.TTL)
+}
+
+func generationKey(resource string) string {
+	return "response:gen:" + hash(resource)
+}
+
+// variantKey returns the key of the response to r among those cached under
+// key that Vary on vary.
+func variantKey(key string, vary []string, r *http.Request) string {
+	var b strings.Builder
+	for _, name := range vary {
+		b.WriteString(name + ":" + strings.Join(r.Header.Values(name), ",") + "\n")
+	}
+
+	return key + ":" + hash(b.String())
+}
+
+// varyHeaders returns the canonical, sorted names of the Vary header.
+func varyHeaders(header http.Header) []string {
+	var names []string
+	for _, v := range header.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			if name = strings.TrimSpace(name); name != "" {
+				names = append(names, http.CanonicalHeaderKey(name))
+			}
+		}
+	}
+
+	sort.Strings(names)
+
+	return names
+}
+
+// etagMatch reports whether an If-None-Match header matches tag, using the
+// weak comparison.
+func etagMatch(header, tag string) bool {
+	tag = strings.TrimPrefix(tag, "W/")
+
+	for _, t := range strings.Split(header, ",") {
+		t = strings.TrimSpace(t)
+		if t == "*" || strings.TrimPrefix(t, "W/") == tag {
+			return true
+		}
+	}
+
+	return false
+}
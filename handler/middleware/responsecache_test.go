@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestResponseCache(t *testing.T) {
+	type step struct {
+		path        string
+		principal   string
+		header      http.Header
+		invalidate  string
+		wantStatus  int
+		wantCalls   int
+		wantVersion string
+	}
+
+	tests := []struct {
+		name    string
+		status  int
+		headers http.Header
+		steps   []step
+	}{
+		{
+			name:   "cached",
+			status: http.StatusOK,
+			steps: []step{
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1?fields=email", wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "2"},
+				{path: "/users/2", wantStatus: http.StatusOK, wantCalls: 3, wantVersion: "3"},
+			},
+		},
+		{
+			name:   "per principal",
+			status: http.StatusOK,
+			steps: []step{
+				{path: "/users/1", principal: "u1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1", principal: "u2", wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "2"},
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 3, wantVersion: "3"},
+				{path: "/users/1", principal: "u1", wantStatus: http.StatusOK, wantCalls: 3, wantVersion: "1"},
+			},
+		},
+		{
+			name:   "invalidated",
+			status: http.StatusOK,
+			steps: []step{
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/2", wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "2"},
+				{path: "/users/1", invalidate: "user:1", wantStatus: http.StatusOK, wantCalls: 3, wantVersion: "3"},
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 3, wantVersion: "3"},
+				{path: "/users/2", wantStatus: http.StatusOK, wantCalls: 3, wantVersion: "2"},
+			},
+		},
+		{
+			name:   "not modified",
+			status: http.StatusOK,
+			steps: []step{
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1", header: http.Header{"If-None-Match": {`W/"1"`}}, wantStatus: http.StatusNotModified, wantCalls: 1},
+				{path: "/users/1", header: http.Header{"If-None-Match": {`"2"`}}, wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+			},
+		},
+		{
+			name:    "vary",
+			status:  http.StatusOK,
+			headers: http.Header{"Vary": {"accept-language"}},
+			steps: []step{
+				{path: "/users/1", header: http.Header{"Accept-Language": {"en"}}, wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1", header: http.Header{"Accept-Language": {"fr"}}, wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "2"},
+				{path: "/users/1", header: http.Header{"Accept-Language": {"en"}}, wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "1"},
+			},
+		},
+		{
+			name:    "vary on everything",
+			status:  http.StatusOK,
+			headers: http.Header{"Vary": {"*"}},
+			steps: []step{
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "2"},
+			},
+		},
+		{
+			name:    "no-store",
+			status:  http.StatusOK,
+			headers: http.Header{"Cache-Control": {"private, no-store"}},
+			steps: []step{
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 1, wantVersion: "1"},
+				{path: "/users/1", wantStatus: http.StatusOK, wantCalls: 2, wantVersion: "2"},
+			},
+		},
+		{
+			name:   "errors are not cached",
+			status: http.StatusNotFound,
+			steps: []step{
+				{path: "/users/1", wantStatus: http.StatusNotFound, wantCalls: 1},
+				{path: "/users/1", wantStatus: http.StatusNotFound, wantCalls: 2},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewResponseCache(ResponseCacheOptions{
+				Cache:      newMemoryCache(),
+				Registerer: prometheus.NewRegistry(),
+				Logger:     discardLogger,
+			})
+
+			calls := 0
+			h := c.Handler("/users/{id}", func(r *http.Request) string {
+				return "user:" + r.URL.Path[len("/users/"):]
+			})(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				calls++
+
+				version := strconv.Itoa(calls)
+
+				for k, v := range tt.headers {
+					rw.Header()[k] = v
+				}
+
+				rw.Header().Set("ETag", `"`+version+`"`)
+				rw.WriteHeader(tt.status)
+				_, _ = rw.Write([]byte(version))
+			}))
+
+			for i, s := range tt.steps {
+				if s.invalidate != "" {
+					if err := c.Invalidate(context.Background(), s.invalidate); err != nil {
+						t.Fatal(err)
+					}
+				}
+
+				r := httptest.NewRequest(http.MethodGet, s.path, nil)
+				for k, v := range s.header {
+					r.Header[k] = v
+				}
+
+				if s.principal != "" {
+					r = r.WithContext(auth.WithPrincipal(r.Context(), &auth.Principal{Subject: s.principal, Kind: auth.KindUser}))
+				}
+
+				rw := httptest.NewRecorder()
+				h.ServeHTTP(rw, r)
+
+				if rw.Code != s.wantStatus {
+					t.Errorf("request %d: status = %d, want %d", i, rw.Code, s.wantStatus)
+				}
+
+				if calls != s.wantCalls {
+					t.Errorf("request %d: handler called %d times, want %d", i, calls, s.wantCalls)
+				}
+
+				if s.wantVersion != "" && rw.Body.String() != s.wantVersion {
+					t.Errorf("request %d: body = %q, want %q", i, rw.Body.String(), s.wantVersion)
+				}
+			}
+		})
+	}
+}
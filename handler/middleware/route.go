@@ -0,0 +1,73 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// withRouteContext returns r with a chi route context, and the context. A
+// router fills in a route context it finds rather than one of its own, which
+// would be gone once it returns, so middleware running before the router can
+// read the pattern it matched.
+func withRouteContext(r *http.Request) (*http.Request, *chi.Context) {
+	if rctx := chi.RouteContext(r.Context()); rctx != nil {
+		return r, rctx
+	}
+
+	rctx := chi.NewRouteContext()
+
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx)), rctx
+}
+
+// routePattern returns the pattern a router matched, or - when none did.
+func routePattern(rctx *chi.Context) string {
+	if pattern := rctx.RoutePattern(); pattern != "" {
+		return pattern
+	}
+
+	return "-"
+}
+
+// statusWriter passes a response through while counting its status and
+// size. The status is 200 once the handler has returned without setting one.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *statusWriter) code() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	if w.status == 0 {
+		w.status = status
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+
+	return n, err
+}
+
+// Flush lets streamed responses through.
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
@@ -0,0 +1,96 @@
+package middleware
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/problem"
+	"github.com/edalmi/x-api/session"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Session authenticates requests that carry a session cookie and no
+// Authorization header, and stores the session and its user in the request
+// context. Requests with an unknown or expired session continue
+// unauthenticated and have the cookie cleared. A session whose user's
+// privileges changed gets a new ID.
+//
+// Cookies are sent with cross-site requests that SameSite does not stop, so
+// unsafe requests from another origin are refused unless allowOrigin, when
+// not nil, accepts the origin. It should be the matcher of a CORS policy
+// that allows credentials.
+func Session(store *session.Store, allowOrigin func(origin string) bool, logger logging.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+
+			id := store.ReadCookie(r)
+			if id == "" || r.Header.Get("Authorization") != "" {
+				next.ServeHTTP(rw, r)
+				return
+			}
+
+			sess, err := store.Get(ctx, id)
+			if errors.Is(err, session.ErrNotFound) {
+				store.ClearCookie(rw)
+				next.ServeHTTP(rw, r)
+
+				return
+			}
+
+			if err != nil {
+				problem.Write(ctx, logger, rw, r, err)
+				return
+			}
+
+			if !safeMethod(r.Method) && !trustedOrigin(r, allowOrigin) {
+				problem.Write(ctx, logger, rw, r, problem.New(problem.CodeForbidden, "cross-origin request"))
+				return
+			}
+
+			if sess.Rotate {
+				if sess, err = store.Rotate(ctx, sess); err != nil {
+					problem.Write(ctx, logger, rw, r, err)
+					return
+				}
+
+				store.WriteCookie(rw, sess)
+			}
+
+			trace.SpanFromContext(ctx).SetAttributes(attribute.Key("enduser.id").String(sess.UserID))
+
+			ctx = withPrincipal(ctx, &auth.Principal{Subject: sess.UserID, Kind: auth.KindUser})
+			ctx = session.WithSession(ctx, sess)
+
+			next.ServeHTTP(rw, r.WithContext(ctx))
+		})
+	}
+}
+
+func safeMethod(method string) bool {
+	switch method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	default:
+		return false
+	}
+}
+
+// trustedOrigin reports whether the Origin header, when present, names the
+// host the request was sent to or an origin allowOrigin accepts.
+func trustedOrigin(r *http.Request, allowOrigin func(origin string) bool) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	if u, err := url.Parse(origin); err == nil && u.Host == r.Host {
+		return true
+	}
+
+	return allowOrigin != nil && allowOrigin(origin)
+}
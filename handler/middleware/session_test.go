@@ -0,0 +1,173 @@
+package middleware
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/session"
+)
+
+func newTestSessions(t *testing.T) *session.Store {
+	t.Helper()
+
+	store, err := session.NewStore(newMemoryCache(), session.Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return store
+}
+
+func TestSession(t *testing.T) {
+	allowOrigin := func(origin string) bool {
+		return origin == "https://app.example.com"
+	}
+
+	tests := []struct {
+		name          string
+		method        string
+		cookie        string
+		authorization string
+		origin        string
+		allowOrigin   func(string) bool
+		wantStatus    int
+		wantUser      string
+		wantCleared   bool
+	}{
+		{name: "no cookie", method: http.MethodGet, wantStatus: http.StatusOK},
+		{name: "session", method: http.MethodGet, cookie: "ada", wantStatus: http.StatusOK, wantUser: "ada"},
+		{name: "unknown session", method: http.MethodGet, cookie: "unknown", wantStatus: http.StatusOK, wantCleared: true},
+		{name: "authorization header wins", method: http.MethodGet, cookie: "ada", authorization: "Bearer token", wantStatus: http.StatusOK},
+		{name: "unsafe without origin", method: http.MethodPost, cookie: "ada", wantStatus: http.StatusOK, wantUser: "ada"},
+		{name: "unsafe from same origin", method: http.MethodDelete, cookie: "ada", origin: "https://api.example.com", wantStatus: http.StatusOK, wantUser: "ada"},
+		{name: "unsafe from other origin", method: http.MethodPost, cookie: "ada", origin: "https://evil.example.com", wantStatus: http.StatusForbidden},
+		{
+			name:        "unsafe from allowed origin",
+			method:      http.MethodPost,
+			cookie:      "ada",
+			origin:      "https://app.example.com",
+			allowOrigin: allowOrigin,
+			wantStatus:  http.StatusOK,
+			wantUser:    "ada",
+		},
+		{
+			name:        "unsafe from origin not allowed",
+			method:      http.MethodPut,
+			cookie:      "ada",
+			origin:      "https://evil.example.com",
+			allowOrigin: allowOrigin,
+			wantStatus:  http.StatusForbidden,
+		},
+		{name: "safe from other origin", method: http.MethodGet, cookie: "ada", origin: "https://evil.example.com", wantStatus: http.StatusOK, wantUser: "ada"},
+		{name: "unsafe from other origin without session", method: http.MethodPost, origin: "https://evil.example.com", wantStatus: http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			store := newTestSessions(t)
+
+			sess, err := store.Create(context.Background(), "ada")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var user string
+
+			h := Session(store, tt.allowOrigin, discardLogger)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+				if p, ok := auth.FromContext(r.Context()); ok && p.Kind == auth.KindUser {
+					user = p.Subject
+				}
+
+				if s, ok := session.FromContext(r.Context()); ok && s.UserID != user {
+					t.Errorf("session of %q for principal %q", s.UserID, user)
+				}
+			}))
+
+			r := httptest.NewRequest(tt.method, "https://api.example.com/users", nil)
+
+			switch tt.cookie {
+			case "":
+			case "ada":
+				r.AddCookie(&http.Cookie{Name: session.DefaultCookieName, Value: sess.ID})
+			default:
+				r.AddCookie(&http.Cookie{Name: session.DefaultCookieName, Value: tt.cookie})
+			}
+
+			if tt.authorization != "" {
+				r.Header.Set("Authorization", tt.authorization)
+			}
+
+			if tt.origin != "" {
+				r.Header.Set("Origin", tt.origin)
+			}
+
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, r)
+
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+
+			if user != tt.wantUser {
+				t.Errorf("user = %q, want %q", user, tt.wantUser)
+			}
+
+			cleared := false
+			for _, c := range rec.Result().Cookies() {
+				cleared = cleared || c.Name == session.DefaultCookieName && c.MaxAge < 0
+			}
+
+			if cleared != tt.wantCleared {
+				t.Errorf("cookie cleared = %v, want %v", cleared, tt.wantCleared)
+			}
+		})
+	}
+}
+
+func TestSessionRotates(t *testing.T) {
+	ctx := context.Background()
+	store := newTestSessions(t)
+
+	sess, err := store.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Only changes after the session was issued make it rotate.
+	time.Sleep(time.Millisecond)
+
+	if err := store.PrivilegesChanged(ctx, "ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	var id string
+
+	h := Session(store, nil, discardLogger)(http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+		if s, ok := session.FromContext(r.Context()); ok {
+			id = s.ID
+		}
+	}))
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(&http.Cookie{Name: session.DefaultCookieName, Value: sess.ID})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	if id == "" || id == sess.ID {
+		t.Fatalf("session ID = %q, want a new ID", id)
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Value != id {
+		t.Errorf("cookies = %v, want the new ID", cookies)
+	}
+
+	if _, err := store.Get(ctx, sess.ID); err == nil {
+		t.Error("the old ID is still valid")
+	}
+}
@@ -0,0 +1,49 @@
+package middleware
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/semconv/v1.17.0/httpconv"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Trace starts a server span for every request, continuing the trace of its
+// traceparent, tracestate and baggage headers as read by the global
+// propagator. The span is named after the method and the route pattern the
+// router matched, and records the status; server errors mark it as failed.
+// It must run before any chi router and before RequestID, so that the span
+// carries the request ID.
+func Trace(tracer string) func(http.Handler) http.Handler {
+	t := otel.Tracer(tracer)
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(rw http.ResponseWriter, r *http.Request) {
+			ctx := otel.GetTextMapPropagator().Extract(r.Context(), propagation.HeaderCarrier(r.Header))
+
+			ctx, span := t.Start(ctx, r.Method,
+				trace.WithSpanKind(trace.SpanKindServer),
+				trace.WithAttributes(httpconv.ServerRequest("", r)...),
+			)
+			defer span.End()
+
+			r, rctx := withRouteContext(r.WithContext(ctx))
+			sw := &statusWriter{ResponseWriter: rw}
+
+			next.ServeHTTP(sw, r)
+
+			if route := rctx.RoutePattern(); route != "" {
+				span.SetName(r.Method + " " + route)
+				span.SetAttributes(semconv.HTTPRouteKey.String(route))
+			}
+
+			span.SetAttributes(
+				semconv.HTTPStatusCodeKey.Int(sw.code()),
+				semconv.HTTPResponseContentLengthKey.Int64(sw.bytes),
+			)
+			span.SetStatus(httpconv.ServerStatus(sw.code()))
+		})
+	}
+}
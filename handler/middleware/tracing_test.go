@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+	semconv "go.opentelemetry.io/otel/semconv/v1.17.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// withSpanRecorder installs a tracer provider that records every ended span
+// and the W3C trace context propagator, restoring the globals afterwards.
+func withSpanRecorder(t *testing.T) *tracetest.SpanRecorder {
+	t.Helper()
+
+	provider, propagator := otel.GetTracerProvider(), otel.GetTextMapPropagator()
+	t.Cleanup(func() {
+		otel.SetTracerProvider(provider)
+		otel.SetTextMapPropagator(propagator)
+	})
+
+	recorder := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(recorder)))
+	otel.SetTextMapPropagator(propagation.TraceContext{})
+
+	return recorder
+}
+
+func TestTrace(t *testing.T) {
+	recorder := withSpanRecorder(t)
+
+	router := chi.NewRouter()
+	router.Get("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		rw.Write([]byte("user"))
+	})
+	router.Delete("/users/{id}", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusConflict)
+	})
+	router.Get("/fail", func(rw http.ResponseWriter, r *http.Request) {
+		rw.WriteHeader(http.StatusServiceUnavailable)
+	})
+
+	h := Trace("test")(router)
+
+	const (
+		traceID = "4bf92f3577b34da6a3ce929d0e0e4736"
+		spanID  = "00f067aa0ba902b7"
+	)
+
+	tests := []struct {
+		name        string
+		method      string
+		path        string
+		traceparent string
+		wantName    string
+		wantRoute   string
+		wantStatus  int
+		wantCode    codes.Code
+	}{
+		{
+			name:       "route pattern",
+			method:     http.MethodGet,
+			path:       "/users/1",
+			wantName:   "GET /users/{id}",
+			wantRoute:  "/users/{id}",
+			wantStatus: http.StatusOK,
+			wantCode:   codes.Unset,
+		},
+		{
+			name:        "traceparent",
+			method:      http.MethodGet,
+			path:        "/users/2",
+			traceparent: "00-" + traceID + "-" + spanID + "-01",
+			wantName:    "GET /users/{id}",
+			wantRoute:   "/users/{id}",
+			wantStatus:  http.StatusOK,
+			wantCode:    codes.Unset,
+		},
+		{
+			name:       "client error",
+			method:     http.MethodDelete,
+			path:       "/users/1",
+			wantName:   "DELETE /users/{id}",
+			wantRoute:  "/users/{id}",
+			wantStatus: http.StatusConflict,
+			wantCode:   codes.Unset,
+		},
+		{
+			name:       "server error",
+			method:     http.MethodGet,
+			path:       "/fail",
+			wantName:   "GET /fail",
+			wantRoute:  "/fail",
+			wantStatus: http.StatusServiceUnavailable,
+			wantCode:   codes.Error,
+		},
+		{
+			name:       "no route",
+			method:     http.MethodGet,
+			path:       "/missing",
+			wantName:   "GET",
+			wantStatus: http.StatusNotFound,
+			wantCode:   codes.Unset,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := len(recorder.Ended())
+
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			if tt.traceparent != "" {
+				r.Header.Set("traceparent", tt.traceparent)
+			}
+
+			rw := httptest.NewRecorder()
+			h.ServeHTTP(rw, r)
+
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rw.Code, tt.wantStatus)
+			}
+
+			spans := recorder.Ended()[before:]
+			if len(spans) != 1 {
+				t.Fatalf("spans = %d, want 1", len(spans))
+			}
+
+			span := spans[0]
+
+			if span.Name() != tt.wantName {
+				t.Errorf("name = %q, want %q", span.Name(), tt.wantName)
+			}
+
+			if span.SpanKind() != trace.SpanKindServer {
+				t.Errorf("kind = %v, want %v", span.SpanKind(), trace.SpanKindServer)
+			}
+
+			if span.Status().Code != tt.wantCode {
+				t.Errorf("status code = %v, want %v", span.Status().Code, tt.wantCode)
+			}
+
+			attrs := map[string]interface{}{}
+			for _, kv := range span.Attributes() {
+				attrs[string(kv.Key)] = kv.Value.AsInterface()
+			}
+
+			if got := attrs[string(semconv.HTTPStatusCodeKey)]; got != int64(tt.wantStatus) {
+				t.Errorf("%s = %v, want %d", semconv.HTTPStatusCodeKey, got, tt.wantStatus)
+			}
+
+			if got, ok := attrs[string(semconv.HTTPRouteKey)]; tt.wantRoute == "" && ok {
+				t.Errorf("%s = %v, want none", semconv.HTTPRouteKey, got)
+			} else if tt.wantRoute != "" && got != tt.wantRoute {
+				t.Errorf("%s = %v, want %q", semconv.HTTPRouteKey, got, tt.wantRoute)
+			}
+
+			parent := span.Parent()
+
+			if tt.traceparent == "" {
+				if parent.IsValid() {
+					t.Errorf("parent = %s, want none", parent.SpanID())
+				}
+
+				return
+			}
+
+			if !parent.IsRemote() {
+				t.Error("parent is not remote")
+			}
+
+			if got := parent.TraceID().String(); got != traceID {
+				t.Errorf("parent trace ID = %s, want %s", got, traceID)
+			}
+
+			if got := parent.SpanID().String(); got != spanID {
+				t.Errorf("parent span ID = %s, want %s", got, spanID)
+			}
+
+			if got := span.SpanContext().TraceID().String(); got != traceID {
+				t.Errorf("trace ID = %s, want %s", got, traceID)
+			}
+		})
+	}
+}
@@ -0,0 +1,181 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"net/url"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/problem"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// maxFormSize limits the bodies of the token and introspection requests.
+const maxFormSize = 64 << 10
+
+// NewOAuthHandler serves the OAuth token and introspection endpoints. They
+// authenticate clients themselves and must not be behind the
+// authentication middleware.
+func NewOAuthHandler(opts HandlerOpts, service OAuthService) *OAuthHandler {
+	return &OAuthHandler{
+		opts:    opts,
+		service: service,
+	}
+}
+
+type OAuthHandler struct {
+	opts    HandlerOpts
+	service OAuthService
+}
+
+// Token implements the client credentials grant of RFC 6749 section 4.4.
+// Clients authenticate with HTTP Basic or with client_id and client_secret
+// in the body.
+func (h OAuthHandler) Token(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "oauth.Token")
+	defer span.End()
+
+	clientID, secret, err := readClientForm(rw, r)
+	if err != nil {
+		h.writeError(rw, r, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Key("client_id").String(clientID))
+
+	if grant := r.PostForm.Get("grant_type"); grant != "client_credentials" {
+		h.writeError(rw, r, oauthError(http.StatusBadRequest, "unsupported_grant_type", "grant_type must be client_credentials"))
+		return
+	}
+
+	token, err := h.service.IssueToken(ctx, clientID, secret, r.PostForm.Get("scope"))
+	if err != nil {
+		h.writeError(rw, r, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	rw.Header().Set("Pragma", "no-cache")
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusOK, token)
+}
+
+// Introspect implements RFC 7662. Any active client may introspect tokens.
+func (h OAuthHandler) Introspect(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "oauth.Introspect")
+	defer span.End()
+
+	clientID, secret, err := readClientForm(rw, r)
+	if err != nil {
+		h.writeError(rw, r, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Key("client_id").String(clientID))
+
+	token := r.PostForm.Get("token")
+	if token == "" {
+		h.writeError(rw, r, oauthError(http.StatusBadRequest, "invalid_request", "token is required"))
+		return
+	}
+
+	out, err := h.service.Introspect(ctx, clientID, secret, token)
+	if err != nil {
+		h.writeError(rw, r, err)
+		return
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusOK, out)
+}
+
+func (h OAuthHandler) Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Post("/token", h.Token)
+	r.Post("/introspect", h.Introspect)
+
+	return r
+}
+
+// readClientForm parses a form encoded body and returns the credentials of
+// the client, which may use only one way to authenticate.
+func readClientForm(rw http.ResponseWriter, r *http.Request) (string, string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mediaType != "application/x-www-form-urlencoded" {
+		return "", "", oauthError(http.StatusBadRequest, "invalid_request", "body must be application/x-www-form-urlencoded")
+	}
+
+	r.Body = http.MaxBytesReader(rw, r.Body, maxFormSize)
+	if err := r.ParseForm(); err != nil {
+		return "", "", oauthError(http.StatusBadRequest, "invalid_request", err.Error())
+	}
+
+	user, password, basic := r.BasicAuth()
+	formID, formSecret := r.PostForm.Get("client_id"), r.PostForm.Get("client_secret")
+
+	switch {
+	case basic && formSecret != "":
+		return "", "", oauthError(http.StatusBadRequest, "invalid_request", "client authenticated in more than one way")
+	case !basic:
+		return formID, formSecret, nil
+	}
+
+	// RFC 6749 section 2.3.1 form encodes the credentials before they are
+	// base64 encoded.
+	clientID, err := url.QueryUnescape(user)
+	if err != nil {
+		return "", "", errInvalidClient
+	}
+
+	secret, err := url.QueryUnescape(password)
+	if err != nil {
+		return "", "", errInvalidClient
+	}
+
+	return clientID, secret, nil
+}
+
+// writeError writes OAuth errors in the format of RFC 6749 section 5.2 and
+// other errors as problems.
+func (h OAuthHandler) writeError(rw http.ResponseWriter, r *http.Request, err error) {
+	var oerr *OAuthError
+	if !errors.As(err, &oerr) {
+		problem.Write(r.Context(), h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	if oerr.Status == http.StatusUnauthorized {
+		rw.Header().Set("WWW-Authenticate", `Basic realm="x-api"`)
+	}
+
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(r.Context(), h.opts.Logger(), rw, oerr.Status, oerr)
+}
+
+// Token is the response of a successful token request.
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int64  `json:"expires_in"`
+	Scope       string `json:"scope,omitempty"`
+}
+
+// Introspection is the response of an introspection request. Inactive
+// tokens carry nothing but active set to false.
+type Introspection struct {
+	Active    bool      `json:"active"`
+	Scope     string    `json:"scope,omitempty"`
+	ClientID  string    `json:"client_id,omitempty"`
+	Subject   string    `json:"sub,omitempty"`
+	Kind      auth.Kind `json:"kind,omitempty"`
+	TokenType string    `json:"token_type,omitempty"`
+	ExpiresAt int64     `json:"exp,omitempty"`
+	IssuedAt  int64     `json:"iat,omitempty"`
+	NotBefore int64     `json:"nbf,omitempty"`
+	Issuer    string    `json:"iss,omitempty"`
+	Audience  []string  `json:"aud,omitempty"`
+	ID        string    `json:"jti,omitempty"`
+}
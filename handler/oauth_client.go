@@ -0,0 +1,137 @@
+package handler
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// NewOAuthClientHandler serves the administration of OAuth clients. It
+// belongs on the admin server.
+func NewOAuthClientHandler(opts HandlerOpts) *OAuthClientHandler {
+	return &OAuthClientHandler{
+		opts:    opts,
+		service: NewOAuthService(opts.DB(), opts.Cache(), nil, nil, 0, opts.Logger()),
+	}
+}
+
+type OAuthClientHandler struct {
+	opts    HandlerOpts
+	service OAuthService
+}
+
+// CreateClient registers a client. The response is the only time its secret
+// is disclosed.
+func (h OAuthClientHandler) CreateClient(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "oauthclients.CreateClient")
+	defer span.End()
+
+	var in OAuthClientCreate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	client, err := h.service.CreateClient(ctx, in)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Key("client_id").String(client.ID))
+
+	rw.Header().Set("Location", path.Join(r.URL.Path, url.PathEscape(client.ID)))
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusCreated, client)
+}
+
+func (h OAuthClientHandler) ListClients(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "oauthclients.ListClients")
+	defer span.End()
+
+	q, err := pagination.Parse(r.URL.Query(), database.OAuthClientPagination)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	page, err := h.service.ListClients(ctx, q)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writePage(ctx, h.opts.Logger(), rw, r, page)
+}
+
+func (h OAuthClientHandler) GetClient(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "oauthclients.GetClient")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("client_id").String(id))
+
+	client, err := h.service.GetClient(ctx, id)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusOK, client)
+}
+
+// RevokeClient revokes a client. Revoked clients stay listed with
+// revoked_at set.
+func (h OAuthClientHandler) RevokeClient(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "oauthclients.RevokeClient")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("client_id").String(id))
+
+	if err := h.service.RevokeClient(ctx, id); err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h OAuthClientHandler) Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Get("/", h.ListClients)
+	r.Post("/", h.CreateClient)
+	r.Get("/{id}", h.GetClient)
+	r.Delete("/{id}", h.RevokeClient)
+
+	return r
+}
+
+type OAuthClientCreate struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+type OAuthClient struct {
+	ID        string     `json:"id"`
+	Name      string     `json:"name"`
+	Scopes    []string   `json:"scopes"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// OAuthClientCreated is a registered client together with its secret.
+type OAuthClientCreated struct {
+	OAuthClient
+	ClientSecret string `json:"client_secret"`
+}
@@ -0,0 +1,399 @@
+package handler
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const (
+	// DefaultTokenTTL is how long issued tokens are valid. The tokens of a
+	// revoked client are refused once its cache entry is replaced, which
+	// takes up to a minute on other instances, so they should be short
+	// lived all the same.
+	DefaultTokenTTL = 5 * time.Minute
+
+	oauthClientCacheTTL = time.Minute
+)
+
+// OAuthError is an error response of the token and introspection endpoints,
+// as defined by RFC 6749 section 5.2.
+type OAuthError struct {
+	Status      int    `json:"-"`
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+}
+
+func (e *OAuthError) Error() string {
+	return "oauth: " + e.Code + ": " + e.Description
+}
+
+func oauthError(status int, code, description string) *OAuthError {
+	return &OAuthError{Status: status, Code: code, Description: description}
+}
+
+var errInvalidClient = oauthError(http.StatusUnauthorized, "invalid_client", "client authentication failed")
+
+// OAuthService manages OAuth clients and issues and introspects the tokens
+// of the client credentials grant.
+type OAuthService interface {
+	CreateClient(ctx context.Context, in OAuthClientCreate) (*OAuthClientCreated, error)
+	GetClient(ctx context.Context, id string) (*OAuthClient, error)
+	ListClients(ctx context.Context, q *pagination.Query) (*pagination.Page[OAuthClient], error)
+	RevokeClient(ctx context.Context, id string) error
+	IssueToken(ctx context.Context, clientID, secret, scope string) (*Token, error)
+	Introspect(ctx context.Context, clientID, secret, token string) (*Introspection, error)
+	// ClientActive lets the JWT verifier refuse the tokens of revoked
+	// clients.
+	ClientActive(ctx context.Context, clientID string) (bool, error)
+}
+
+// NewOAuthService returns an OAuthService. signer and verifier are only
+// needed to issue and introspect tokens and may be nil otherwise.
+func NewOAuthService(db *database.DB, cache caching.Cache, signer *auth.JWTSigner, verifier *auth.JWTVerifier, ttl time.Duration, logger logging.Logger) OAuthService {
+	if ttl <= 0 {
+		ttl = DefaultTokenTTL
+	}
+
+	return &oauthService{
+		repo:     database.NewOAuthClientRepository(db),
+		cache:    cache,
+		signer:   signer,
+		verifier: verifier,
+		ttl:      ttl,
+		logger:   logger,
+	}
+}
+
+type oauthService struct {
+	repo     *database.OAuthClientRepository
+	cache    caching.Cache
+	signer   *auth.JWTSigner
+	verifier *auth.JWTVerifier
+	ttl      time.Duration
+	logger   logging.Logger
+}
+
+func (s *oauthService) CreateClient(ctx context.Context, in OAuthClientCreate) (*OAuthClientCreated, error) {
+	name := strings.TrimSpace(in.Name)
+
+	verr := problem.Fields{}
+	if name == "" {
+		verr.Add("name", "is required")
+	} else if len(name) > maxNameLength {
+		verr.Add("name", "is too long")
+	}
+
+	if len(in.Scopes) > maxScopes {
+		verr.Add("scopes", "has too many entries")
+	}
+
+	for _, scope := range in.Scopes {
+		if scope == "" || strings.ContainsAny(scope, " \t\r\n") {
+			verr.Add("scopes", "must not contain empty or blank separated scopes")
+			break
+		}
+	}
+
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	secret, err := auth.NewClientSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	row := &database.OAuthClient{
+		ID:         uuid.NewString(),
+		Name:       name,
+		SecretHash: auth.HashAPIKey(secret),
+		Scopes:     strings.Join(in.Scopes, " "),
+		CreatedAt:  now(),
+	}
+
+	if err := s.repo.Create(ctx, row); err != nil {
+		return nil, serviceError(err)
+	}
+
+	return &OAuthClientCreated{OAuthClient: *toOAuthClient(row), ClientSecret: secret}, nil
+}
+
+func (s *oauthService) GetClient(ctx context.Context, id string) (*OAuthClient, error) {
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toOAuthClient(row), nil
+}
+
+func (s *oauthService) ListClients(ctx context.Context, q *pagination.Query) (*pagination.Page[OAuthClient], error) {
+	rows, next, err := s.repo.List(ctx, q)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	page := &pagination.Page[OAuthClient]{
+		Data:       make([]OAuthClient, 0, len(rows)),
+		NextCursor: next,
+	}
+
+	for i := range rows {
+		page.Data = append(page.Data, *toOAuthClient(&rows[i]))
+	}
+
+	return page, nil
+}
+
+// RevokeClient revokes the client and replaces its cache entry, so that it
+// can no longer obtain tokens and its tokens stop introspecting as active.
+func (s *oauthService) RevokeClient(ctx context.Context, id string) error {
+	if err := s.repo.Revoke(ctx, id, now()); err != nil {
+		return serviceError(err)
+	}
+
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	s.store(ctx, id, newOAuthClientEntry(row))
+
+	return nil
+}
+
+// IssueToken grants the client credentials grant. An empty scope requests
+// every scope of the client.
+func (s *oauthService) IssueToken(ctx context.Context, clientID, secret, scope string) (*Token, error) {
+	client, err := s.authenticate(ctx, clientID, secret)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := strings.Fields(scope)
+	if len(scopes) == 0 {
+		scopes = client.Scopes
+	}
+
+	for _, requested := range scopes {
+		if !contains(client.Scopes, requested) {
+			return nil, oauthError(http.StatusBadRequest, "invalid_scope", "scope "+requested+" is not granted to the client")
+		}
+	}
+
+	var (
+		issuedAt  = time.Now()
+		expiresAt = issuedAt.Add(s.ttl)
+	)
+
+	token, err := s.signer.Sign(auth.Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			ID:        uuid.NewString(),
+			Subject:   clientID,
+			IssuedAt:  jwt.NewNumericDate(issuedAt),
+			NotBefore: jwt.NewNumericDate(issuedAt),
+			ExpiresAt: jwt.NewNumericDate(expiresAt),
+		},
+		Scope: strings.Join(scopes, " "),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Token{
+		AccessToken: token,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(s.ttl / time.Second),
+		Scope:       strings.Join(scopes, " "),
+	}, nil
+}
+
+// Introspect describes a token to an authenticated client as RFC 7662
+// defines. Tokens that do not verify, and tokens of revoked clients, are
+// inactive.
+func (s *oauthService) Introspect(ctx context.Context, clientID, secret, token string) (*Introspection, error) {
+	if _, err := s.authenticate(ctx, clientID, secret); err != nil {
+		return nil, err
+	}
+
+	claims, err := s.verifier.Verify(token)
+	if err != nil {
+		return &Introspection{}, nil
+	}
+
+	out := &Introspection{
+		Active:    true,
+		Scope:     claims.Scope,
+		Subject:   claims.Subject,
+		Kind:      claims.Kind,
+		TokenType: "Bearer",
+		Issuer:    claims.Issuer,
+		Audience:  []string(claims.Audience),
+		ID:        claims.ID,
+		ExpiresAt: numericDate(claims.ExpiresAt),
+		IssuedAt:  numericDate(claims.IssuedAt),
+		NotBefore: numericDate(claims.NotBefore),
+	}
+
+	if claims.Kind == auth.KindClient {
+		entry, err := s.lookup(ctx, claims.Subject)
+		if err != nil {
+			return nil, err
+		}
+
+		if !entry.active() {
+			return &Introspection{}, nil
+		}
+
+		out.ClientID = claims.Subject
+	}
+
+	return out, nil
+}
+
+// ClientActive reports whether the client exists and is not revoked, as
+// read from its cache entry.
+func (s *oauthService) ClientActive(ctx context.Context, clientID string) (bool, error) {
+	entry, err := s.lookup(ctx, clientID)
+	if err != nil {
+		return false, err
+	}
+
+	return entry.active(), nil
+}
+
+// authenticate returns the cache entry of an active client whose secret
+// matches.
+func (s *oauthService) authenticate(ctx context.Context, clientID, secret string) (*oauthClientEntry, error) {
+	if _, err := uuid.Parse(clientID); err != nil || secret == "" {
+		return nil, errInvalidClient
+	}
+
+	entry, err := s.lookup(ctx, clientID)
+	if err != nil {
+		return nil, err
+	}
+
+	hash := auth.HashAPIKey(secret)
+	if subtle.ConstantTimeCompare([]byte(hash), []byte(entry.SecretHash)) != 1 || entry.RevokedAt != nil {
+		return nil, errInvalidClient
+	}
+
+	return entry, nil
+}
+
+// oauthClientEntry is what the cache holds for a client id. Unknown ids are
+// cached too, with an empty SecretHash.
+type oauthClientEntry struct {
+	SecretHash string     `json:"secret_hash,omitempty"`
+	Scopes     []string   `json:"scopes,omitempty"`
+	RevokedAt  *time.Time `json:"revoked_at,omitempty"`
+}
+
+func (e *oauthClientEntry) active() bool {
+	return e.SecretHash != "" && e.RevokedAt == nil
+}
+
+func newOAuthClientEntry(row *database.OAuthClient) *oauthClientEntry {
+	return &oauthClientEntry{
+		SecretHash: row.SecretHash,
+		Scopes:     strings.Fields(row.Scopes),
+		RevokedAt:  row.RevokedAt,
+	}
+}
+
+func oauthClientCacheKey(id string) string {
+	return "oauth_client:" + id
+}
+
+// lookup reads the entry of a client from the cache, falling back to the
+// database. Cache failures are logged and treated as misses.
+func (s *oauthService) lookup(ctx context.Context, id string) (*oauthClientEntry, error) {
+	if s.cache != nil {
+		v, err := s.cache.Get(ctx, oauthClientCacheKey(id))
+		if err == nil {
+			var entry oauthClientEntry
+			if err := json.Unmarshal([]byte(v), &entry); err == nil {
+				return &entry, nil
+			}
+		} else if !errors.Is(err, caching.ErrMiss) {
+			logging.FromContext(ctx, s.logger).Error(err)
+		}
+	}
+
+	entry := &oauthClientEntry{}
+
+	row, err := s.repo.Get(ctx, id)
+	switch {
+	case err == nil:
+		entry = newOAuthClientEntry(row)
+	case !errors.Is(err, database.ErrNotFound):
+		return nil, err
+	}
+
+	s.store(ctx, id, entry)
+
+	return entry, nil
+}
+
+func (s *oauthService) store(ctx context.Context, id string, entry *oauthClientEntry) {
+	if s.cache == nil {
+		return
+	}
+
+	b, err := json.Marshal(entry)
+	if err == nil {
+		err = s.cache.Set(ctx, oauthClientCacheKey(id), string(b), oauthClientCacheTTL)
+	}
+
+	if err != nil {
+		logging.FromContext(ctx, s.logger).Error(err)
+	}
+}
+
+func numericDate(d *jwt.NumericDate) int64 {
+	if d == nil {
+		return 0
+	}
+
+	return d.Unix()
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+
+	return false
+}
+
+func toOAuthClient(row *database.OAuthClient) *OAuthClient {
+	scopes := strings.Fields(row.Scopes)
+	if scopes == nil {
+		scopes = []string{}
+	}
+
+	return &OAuthClient{
+		ID:        row.ID,
+		Name:      row.Name,
+		Scopes:    scopes,
+		CreatedAt: row.CreatedAt,
+		RevokedAt: row.RevokedAt,
+	}
+}
@@ -0,0 +1,326 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testUserIssuer   = "https://idp.example.com"
+	testClientIssuer = "https://x-api.example.com/oauth"
+)
+
+var (
+	testUserKey   = auth.Key{ID: "users", Algorithm: auth.HS256, Key: []byte("0123456789abcdef0123456789abcdef")}
+	testClientKey = auth.Key{ID: "clients", Algorithm: auth.HS256, Key: []byte("fedcba9876543210fedcba9876543210")}
+	testAudience  = []string{"x-api"}
+)
+
+// oauthTest is an OAuth handler with an active client, ci, and a revoked
+// one.
+type oauthTest struct {
+	handler http.Handler
+	service OAuthService
+	secrets map[string]string
+	ids     map[string]string
+}
+
+func newOAuthTest(t *testing.T) *oauthTest {
+	t.Helper()
+
+	signer, err := auth.NewJWTSigner(testClientKey, testClientIssuer, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Like the server, introspection checks for revoked clients itself.
+	verifier, err := auth.NewJWTVerifier(auth.JWTOptions{
+		Keys:     []auth.Key{testUserKey},
+		Issuer:   testUserIssuer,
+		Audience: testAudience,
+		Clients:  &auth.ClientTokens{Key: testClientKey, Issuer: testClientIssuer},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := testOpts{db: newTestDB(t), cache: newTestCache()}
+	service := NewOAuthService(opts.DB(), opts.Cache(), signer, verifier, 0, opts.Logger())
+
+	ot := &oauthTest{
+		handler: NewOAuthHandler(opts, service).Routes(),
+		service: service,
+		secrets: make(map[string]string),
+		ids:     make(map[string]string),
+	}
+
+	for _, name := range []string{"ci", "revoked"} {
+		c, err := service.CreateClient(context.Background(), OAuthClientCreate{Name: name, Scopes: []string{"users:read", "groups:read"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ot.ids[name], ot.secrets[name] = c.ID, c.ClientSecret
+	}
+
+	if err := service.RevokeClient(context.Background(), ot.ids["revoked"]); err != nil {
+		t.Fatal(err)
+	}
+
+	return ot
+}
+
+// oauthRequest is a form request to an OAuth endpoint. client names a
+// client of oauthTest, whose credentials are sent with HTTP Basic or, with
+// inForm, in the body.
+type oauthRequest struct {
+	path   string
+	client string
+	secret string
+	inForm bool
+	form   url.Values
+	header http.Header
+}
+
+func (ot *oauthTest) serve(req oauthRequest) *http.Response {
+	form := url.Values{}
+	for k, v := range req.form {
+		form[k] = v
+	}
+
+	id, secret := ot.ids[req.client], ot.secrets[req.client]
+	if id == "" {
+		id = req.client
+	}
+
+	if req.secret != "" {
+		secret = req.secret
+	}
+
+	header := http.Header{"Content-Type": {"application/x-www-form-urlencoded"}}
+	for k, v := range req.header {
+		header[k] = v
+	}
+
+	tr := testRequest{method: http.MethodPost, path: req.path, body: form.Encode(), header: header}
+
+	switch {
+	case req.client == "":
+	case req.inForm:
+		form.Set("client_id", id)
+		form.Set("client_secret", secret)
+		tr.body = form.Encode()
+	default:
+		r, _ := http.NewRequest(http.MethodPost, "/", nil)
+		r.SetBasicAuth(url.QueryEscape(id), url.QueryEscape(secret))
+		tr.header.Set("Authorization", r.Header.Get("Authorization"))
+	}
+
+	return tr.serve(ot.handler).Result()
+}
+
+func TestOAuthToken(t *testing.T) {
+	grant := url.Values{"grant_type": {"client_credentials"}}
+
+	tests := []struct {
+		name       string
+		req        oauthRequest
+		wantStatus int
+		wantError  string
+		wantScope  string
+	}{
+		{name: "basic", req: oauthRequest{client: "ci", form: grant}, wantStatus: http.StatusOK, wantScope: "users:read groups:read"},
+		{name: "form", req: oauthRequest{client: "ci", inForm: true, form: grant}, wantStatus: http.StatusOK, wantScope: "users:read groups:read"},
+		{
+			name:       "requested scope",
+			req:        oauthRequest{client: "ci", form: url.Values{"grant_type": {"client_credentials"}, "scope": {"groups:read"}}},
+			wantStatus: http.StatusOK,
+			wantScope:  "groups:read",
+		},
+		{
+			name:       "scope not granted",
+			req:        oauthRequest{client: "ci", form: url.Values{"grant_type": {"client_credentials"}, "scope": {"users:write"}}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_scope",
+		},
+		{name: "bad secret", req: oauthRequest{client: "ci", secret: "guess", form: grant}, wantStatus: http.StatusUnauthorized, wantError: "invalid_client"},
+		{name: "bad secret in form", req: oauthRequest{client: "ci", secret: "guess", inForm: true, form: grant}, wantStatus: http.StatusUnauthorized, wantError: "invalid_client"},
+		{name: "revoked client", req: oauthRequest{client: "revoked", form: grant}, wantStatus: http.StatusUnauthorized, wantError: "invalid_client"},
+		{name: "unknown client", req: oauthRequest{client: "3b8d5b1e-2a57-4d5e-9c39-1f1f0c1a6d10", secret: "guess", form: grant}, wantStatus: http.StatusUnauthorized, wantError: "invalid_client"},
+		{name: "no client", req: oauthRequest{form: grant}, wantStatus: http.StatusUnauthorized, wantError: "invalid_client"},
+		{
+			name:       "authenticated twice",
+			req:        oauthRequest{client: "ci", form: url.Values{"grant_type": {"client_credentials"}, "client_secret": {"guess"}}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_request",
+		},
+		{name: "other grant", req: oauthRequest{client: "ci", form: url.Values{"grant_type": {"password"}}}, wantStatus: http.StatusBadRequest, wantError: "unsupported_grant_type"},
+		{
+			name:       "not a form",
+			req:        oauthRequest{client: "ci", form: grant, header: http.Header{"Content-Type": {"application/json"}}},
+			wantStatus: http.StatusBadRequest,
+			wantError:  "invalid_request",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := newOAuthTest(t)
+
+			tt.req.path = "/token"
+			res := ot.serve(tt.req)
+
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+
+			if cc := res.Header.Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cc)
+			}
+
+			if tt.wantStatus == http.StatusUnauthorized && res.Header.Get("WWW-Authenticate") == "" {
+				t.Error("WWW-Authenticate is not set")
+			}
+
+			var body struct {
+				Token
+				Error string `json:"error"`
+			}
+			if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+				t.Fatal(err)
+			}
+
+			if body.Error != tt.wantError {
+				t.Errorf("error = %q, want %q", body.Error, tt.wantError)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			if body.TokenType != "Bearer" || body.Scope != tt.wantScope || body.ExpiresIn != int64(DefaultTokenTTL/time.Second) {
+				t.Errorf("token = %+v, want a bearer token with scope %q", body.Token, tt.wantScope)
+			}
+
+			claims := jwt.MapClaims{}
+			if _, _, err := jwt.NewParser().ParseUnverified(body.AccessToken, claims); err != nil {
+				t.Fatal(err)
+			}
+
+			if claims["sub"] != ot.ids[tt.req.client] || claims["iss"] != testClientIssuer || claims["scope"] != tt.wantScope {
+				t.Errorf("claims = %v", claims)
+			}
+		})
+	}
+}
+
+func TestOAuthIntrospect(t *testing.T) {
+	userSigner, err := auth.NewJWTSigner(testUserKey, testUserIssuer, testAudience)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	userToken, err := userSigner.Sign(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "ada",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expiredToken, err := userSigner.Sign(auth.Claims{RegisteredClaims: jwt.RegisteredClaims{
+		Subject:   "ada",
+		ExpiresAt: jwt.NewNumericDate(time.Now().Add(-time.Hour)),
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		token      string
+		revoke     bool
+		client     string
+		secret     string
+		wantStatus int
+		want       Introspection
+	}{
+		{name: "client token", token: "{client}", client: "ci", wantStatus: http.StatusOK, want: Introspection{Active: true, Kind: auth.KindClient, ClientID: "{ci}", Subject: "{ci}"}},
+		{name: "user token", token: userToken, client: "ci", wantStatus: http.StatusOK, want: Introspection{Active: true, Kind: auth.KindUser, Subject: "ada"}},
+		{name: "token of revoked client", token: "{client}", revoke: true, client: "other", wantStatus: http.StatusOK},
+		{name: "expired token", token: expiredToken, client: "ci", wantStatus: http.StatusOK},
+		{name: "malformed token", token: "not-a-token", client: "ci", wantStatus: http.StatusOK},
+		{name: "no token", client: "ci", wantStatus: http.StatusBadRequest},
+		{name: "bad secret", token: "{client}", client: "ci", secret: "guess", wantStatus: http.StatusUnauthorized},
+		{name: "revoked client", token: userToken, client: "revoked", wantStatus: http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ot := newOAuthTest(t)
+			ctx := context.Background()
+
+			other, err := ot.service.CreateClient(ctx, OAuthClientCreate{Name: "other"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ot.ids["other"], ot.secrets["other"] = other.ID, other.ClientSecret
+
+			if tt.token == "{client}" {
+				token, err := ot.service.IssueToken(ctx, ot.ids["ci"], ot.secrets["ci"], "")
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				tt.token = token.AccessToken
+			}
+
+			if tt.revoke {
+				if err := ot.service.RevokeClient(ctx, ot.ids["ci"]); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			form := url.Values{}
+			if tt.token != "" {
+				form.Set("token", tt.token)
+			}
+
+			res := ot.serve(oauthRequest{path: "/introspect", client: tt.client, secret: tt.secret, form: form})
+			if res.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", res.StatusCode, tt.wantStatus)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var got Introspection
+			if err := json.NewDecoder(res.Body).Decode(&got); err != nil {
+				t.Fatal(err)
+			}
+
+			want := tt.want
+			want.ClientID = strings.ReplaceAll(want.ClientID, "{ci}", ot.ids["ci"])
+			want.Subject = strings.ReplaceAll(want.Subject, "{ci}", ot.ids["ci"])
+
+			if got.Active != want.Active || got.Kind != want.Kind || got.ClientID != want.ClientID || got.Subject != want.Subject {
+				t.Errorf("introspection = %+v, want %+v", got, want)
+			}
+
+			if !got.Active && !reflect.DeepEqual(got, Introspection{}) {
+				t.Errorf("inactive introspection = %+v, want nothing but active", got)
+			}
+		})
+	}
+}
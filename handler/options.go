@@ -1,11 +1,16 @@
 package handler
 
 import (
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/authz"
 	"github.com/edalmi/x-api/caching"
 	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/handler/middleware"
 	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/password"
 	"github.com/edalmi/x-api/pubsub"
 	"github.com/edalmi/x-api/queue"
+	"github.com/edalmi/x-api/session"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -16,5 +21,12 @@ type HandlerOpts interface {
 	Logger() logging.Logger
 	Prometheus() prometheus.Registerer
 	DB() *database.DB
+	PasswordHasher() *password.Hasher
+	PasswordPolicy() password.Policy
+	Authorizer() *authz.Authorizer
+	AuditRecorder() audit.Recorder
+	Sessions() *session.Store
+	// ResponseCache is nil when responses are not cached.
+	ResponseCache() *middleware.ResponseCache
 	ID() string
 }
@@ -0,0 +1,75 @@
+package handler
+
+import (
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/problem"
+)
+
+// acceptPatch lists the patch formats understood by PATCH endpoints.
+var acceptPatch = strings.Join([]string{json.MergePatchContentType, json.PatchContentType}, ", ")
+
+// Patch transforms the JSON representation of a resource.
+type Patch func(doc []byte) ([]byte, error)
+
+// readPatch decodes the request body into a Patch according to its
+// Content-Type.
+func readPatch(r *http.Request) (Patch, error) {
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		return nil, problem.ErrUnsupportedMediaType
+	}
+
+	body, err := json.ReadAll(r)
+	if err != nil {
+		return nil, problem.BadRequest(err)
+	}
+
+	switch mediaType {
+	case json.MergePatchContentType:
+		if _, err := json.MergePatch([]byte("{}"), body); err != nil {
+			return nil, problem.BadRequest(err)
+		}
+
+		return func(doc []byte) ([]byte, error) {
+			return json.MergePatch(doc, body)
+		}, nil
+	case json.PatchContentType:
+		ops, err := json.DecodePatch(body)
+		if err != nil {
+			return nil, problem.BadRequest(err)
+		}
+
+		return ops.Apply, nil
+	default:
+		return nil, problem.New(problem.CodeUnsupportedMediaType, "use one of "+acceptPatch)
+	}
+}
+
+// applyPatch applies patch to the representation of v and decodes the
+// result into out.
+func applyPatch(patch Patch, v, out interface{}) error {
+	doc, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+
+	patched, err := patch(doc)
+	if err != nil {
+		if errors.Is(err, json.ErrTestFailed) {
+			return &problem.Error{Code: problem.CodeConflict, Detail: err.Error(), Err: err}
+		}
+
+		return &problem.Error{Code: problem.CodeValidation, Detail: err.Error(), Err: err}
+	}
+
+	if err := json.Unmarshal(patched, out); err != nil {
+		return &problem.Error{Code: problem.CodeValidation, Detail: err.Error(), Err: err}
+	}
+
+	return nil
+}
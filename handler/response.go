@@ -0,0 +1,24 @@
+package handler
+
+import (
+	"context"
+	"net/http"
+
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+)
+
+func writeJSON(ctx context.Context, logger logging.Logger, rw http.ResponseWriter, status int, v interface{}) {
+	if err := json.Write(rw, status, v); err != nil {
+		logging.FromContext(ctx, logger).Error(err)
+	}
+}
+
+func writePage[T any](ctx context.Context, logger logging.Logger, rw http.ResponseWriter, r *http.Request, page *pagination.Page[T]) {
+	if page.NextCursor != "" {
+		rw.Header().Set("Link", pagination.Link(r.URL, page.NextCursor))
+	}
+
+	writeJSON(ctx, logger, rw, http.StatusOK, page)
+}
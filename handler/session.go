@@ -0,0 +1,127 @@
+package handler
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/problem"
+	"github.com/edalmi/x-api/session"
+	"github.com/go-chi/chi/v5"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// NewSessionHandler serves logging in and out with cookie sessions. It must
+// be behind the session middleware but not behind authentication.
+func NewSessionHandler(opts HandlerOpts) *SessionHandler {
+	credentials := NewCredentialService(opts.DB(), opts.PasswordHasher(), opts.PasswordPolicy(), opts.AuditRecorder(), opts.Logger())
+
+	return &SessionHandler{
+		opts:    opts,
+		service: NewSessionService(opts.DB(), opts.Sessions(), credentials, opts.PasswordHasher(), opts.Logger()),
+	}
+}
+
+type SessionHandler struct {
+	opts    HandlerOpts
+	service SessionService
+}
+
+// Login starts a session and sets its cookie. A session the client already
+// had is ended, so that a session ID planted before login is never
+// authenticated.
+func (h SessionHandler) Login(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "sessions.Login")
+	defer span.End()
+
+	var in SessionCreate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	store := h.opts.Sessions()
+
+	if id := store.ReadCookie(r); id != "" {
+		if err := h.service.Logout(ctx, id); err != nil {
+			problem.Write(ctx, h.opts.Logger(), rw, r, err)
+			return
+		}
+	}
+
+	sess, err := h.service.Login(ctx, in)
+	if err != nil {
+		problem.Write(ctx, h.opts.Logger(), rw, r, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(sess.UserID))
+
+	store.WriteCookie(rw, sess)
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusCreated, toSession(store, sess))
+}
+
+func (h SessionHandler) GetSession(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "sessions.GetSession")
+	defer span.End()
+
+	sess, ok := session.FromContext(ctx)
+	if !ok {
+		problem.Write(ctx, h.opts.Logger(), rw, r, problem.New(problem.CodeUnauthorized, "no session"))
+		return
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(sess.UserID))
+
+	rw.Header().Set("Cache-Control", "no-store")
+	writeJSON(ctx, h.opts.Logger(), rw, http.StatusOK, toSession(h.opts.Sessions(), sess))
+}
+
+// Logout ends the session of the cookie and clears the cookie.
+func (h SessionHandler) Logout(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(h.opts.ID()).Start(r.Context(), "sessions.Logout")
+	defer span.End()
+
+	store := h.opts.Sessions()
+
+	if id := store.ReadCookie(r); id != "" {
+		if err := h.service.Logout(ctx, id); err != nil {
+			problem.Write(ctx, h.opts.Logger(), rw, r, err)
+			return
+		}
+	}
+
+	store.ClearCookie(rw)
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (h SessionHandler) Routes() *chi.Mux {
+	r := chi.NewRouter()
+
+	r.Post("/", h.Login)
+	r.Get("/", h.GetSession)
+	r.Delete("/", h.Logout)
+
+	return r
+}
+
+type SessionCreate struct {
+	Email    string `json:"email"`
+	Password string `json:"password"`
+}
+
+type Session struct {
+	UserID    string    `json:"user_id"`
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+func toSession(store *session.Store, sess *session.Session) *Session {
+	return &Session{
+		UserID:    sess.UserID,
+		CreatedAt: sess.CreatedAt,
+		ExpiresAt: store.ExpiresAt(sess),
+	}
+}
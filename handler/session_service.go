@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"errors"
+
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/password"
+	"github.com/edalmi/x-api/session"
+)
+
+type SessionService interface {
+	Login(ctx context.Context, in SessionCreate) (*session.Session, error)
+	Logout(ctx context.Context, id string) error
+	// LogoutUser ends every session of a user. When current is a session of
+	// that user, it is replaced by a new one, which is returned.
+	LogoutUser(ctx context.Context, userID string, current *session.Session) (*session.Session, error)
+}
+
+func NewSessionService(db *database.DB, store *session.Store, credentials CredentialService, hasher *password.Hasher, logger logging.Logger) SessionService {
+	return &sessionService{
+		users:       database.NewUserRepository(db),
+		store:       store,
+		credentials: credentials,
+		hasher:      hasher,
+		logger:      logger,
+	}
+}
+
+type sessionService struct {
+	users       *database.UserRepository
+	store       *session.Store
+	credentials CredentialService
+	hasher      *password.Hasher
+	logger      logging.Logger
+}
+
+// Login starts a session for the user with the email and password.
+func (s *sessionService) Login(ctx context.Context, in SessionCreate) (*session.Session, error) {
+	email, _ := normalizeUser(in.Email, "")
+
+	user, err := s.users.GetByEmail(ctx, email)
+	if errors.Is(err, database.ErrNotFound) {
+		// Hash anyway, so that the response time does not tell whether the
+		// email is registered.
+		if _, err := s.hasher.Hash(in.Password); err != nil {
+			logging.FromContext(ctx, s.logger).Error(err)
+		}
+
+		return nil, errInvalidCredentials
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.credentials.VerifyPassword(ctx, user.ID, in.Password); err != nil {
+		return nil, err
+	}
+
+	return s.store.Create(ctx, user.ID)
+}
+
+func (s *sessionService) Logout(ctx context.Context, id string) error {
+	return s.store.Delete(ctx, id)
+}
+
+func (s *sessionService) LogoutUser(ctx context.Context, userID string, current *session.Session) (*session.Session, error) {
+	if err := s.store.DeleteUser(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	if current == nil || current.UserID != userID {
+		return nil, nil
+	}
+
+	if err := s.store.Delete(ctx, current.ID); err != nil {
+		return nil, err
+	}
+
+	return s.store.Create(ctx, userID)
+}
@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/handler/middleware"
+	"github.com/edalmi/x-api/session"
+	"github.com/go-chi/chi/v5"
+)
+
+type sessionOpts struct {
+	testOpts
+	store *session.Store
+}
+
+func (o sessionOpts) Sessions() *session.Store { return o.store }
+
+// newSessionTest returns the session routes behind the session middleware,
+// with ada@example.com registered with the password "correct horse battery"
+// and grace@example.com without a password.
+func newSessionTest(t *testing.T, sessOpts session.Options) (http.Handler, sessionOpts, string) {
+	t.Helper()
+
+	store, err := session.NewStore(newTestCache(), sessOpts)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	opts := sessionOpts{testOpts: testOpts{db: newTestDB(t)}, store: store}
+	users := NewUserHandler(opts).Routes()
+
+	id := mustCreate(t, users, "/", `{"email":"ada@example.com","name":"Ada"}`)
+	mustCreate(t, users, "/", `{"email":"grace@example.com","name":"Grace"}`)
+
+	credentials := NewCredentialService(opts.DB(), opts.PasswordHasher(), opts.PasswordPolicy(), nil, opts.Logger())
+	if err := credentials.SetPassword(context.Background(), id, PasswordChange{Password: "correct horse battery"}); err != nil {
+		t.Fatal(err)
+	}
+
+	router := chi.NewRouter()
+	router.Use(middleware.Session(store, nil, opts.Logger()))
+	router.Mount("/session", NewSessionHandler(opts).Routes())
+
+	return router, opts, id
+}
+
+// sessionCookie returns the session cookie set by a response, if any.
+func sessionCookie(rw http.ResponseWriter) *http.Cookie {
+	for _, c := range (&http.Response{Header: rw.Header()}).Cookies() {
+		if c.Name == session.DefaultCookieName {
+			return c
+		}
+	}
+
+	return nil
+}
+
+func withSession(id string) http.Header {
+	return http.Header{"Cookie": {(&http.Cookie{Name: session.DefaultCookieName, Value: id}).String()}}
+}
+
+func TestSessionLogin(t *testing.T) {
+	tests := []struct {
+		name       string
+		body       string
+		wantStatus int
+	}{
+		{name: "valid", body: `{"email":"ada@example.com","password":"correct horse battery"}`, wantStatus: http.StatusCreated},
+		{name: "email in other case", body: `{"email":" Ada@Example.com","password":"correct horse battery"}`, wantStatus: http.StatusCreated},
+		{name: "wrong password", body: `{"email":"ada@example.com","password":"correct horse staple"}`, wantStatus: http.StatusUnauthorized},
+		{name: "unknown email", body: `{"email":"nobody@example.com","password":"correct horse battery"}`, wantStatus: http.StatusUnauthorized},
+		{name: "user without password", body: `{"email":"grace@example.com","password":""}`, wantStatus: http.StatusUnauthorized},
+		{name: "malformed", body: `{"email":`, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, opts, id := newSessionTest(t, session.Options{})
+
+			rw := testRequest{method: http.MethodPost, path: "/session", body: tt.body}.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			cookie := sessionCookie(rw)
+			if tt.wantStatus != http.StatusCreated {
+				if cookie != nil {
+					t.Errorf("cookie = %v, want none", cookie)
+				}
+
+				return
+			}
+
+			if cookie == nil || !cookie.HttpOnly || !cookie.Secure {
+				t.Fatalf("cookie = %v, want a secure HTTP-only session cookie", cookie)
+			}
+
+			if cc := rw.Header().Get("Cache-Control"); cc != "no-store" {
+				t.Errorf("Cache-Control = %q, want no-store", cc)
+			}
+
+			var got Session
+			if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.UserID != id || !got.ExpiresAt.After(got.CreatedAt) {
+				t.Errorf("session = %+v, want one of %s", got, id)
+			}
+
+			sess, err := opts.store.Get(context.Background(), cookie.Value)
+			if err != nil || sess.UserID != id {
+				t.Errorf("stored session = %+v, %v, want one of %s", sess, err, id)
+			}
+		})
+	}
+}
+
+func TestSessionLoginEndsPreviousSession(t *testing.T) {
+	h, opts, id := newSessionTest(t, session.Options{})
+
+	planted, err := opts.store.Create(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := testRequest{
+		method: http.MethodPost,
+		path:   "/session",
+		body:   `{"email":"ada@example.com","password":"correct horse battery"}`,
+		header: withSession(planted.ID),
+	}.serve(h)
+	if rw.Code != http.StatusCreated {
+		t.Fatalf("status = %d, body = %s", rw.Code, rw.Body)
+	}
+
+	if c := sessionCookie(rw); c == nil || c.Value == planted.ID {
+		t.Errorf("cookie = %v, want a new session", c)
+	}
+
+	if _, err := opts.store.Get(context.Background(), planted.ID); !errors.Is(err, session.ErrNotFound) {
+		t.Errorf("previous session: error = %v, want %v", err, session.ErrNotFound)
+	}
+}
+
+func TestSessionLogout(t *testing.T) {
+	tests := []struct {
+		name        string
+		header      http.Header
+		noSession   bool
+		wantStatus  int
+		wantCleared bool
+		wantEnded   bool
+	}{
+		{name: "logout", wantStatus: http.StatusNoContent, wantCleared: true, wantEnded: true},
+		{name: "logout from other origin", header: http.Header{"Origin": {"https://evil.example.com"}}, wantStatus: http.StatusForbidden},
+		{name: "logout without session", noSession: true, wantStatus: http.StatusNoContent, wantCleared: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h, opts, id := newSessionTest(t, session.Options{})
+
+			sess, err := opts.store.Create(context.Background(), id)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			header := withSession(sess.ID)
+			if tt.noSession {
+				header = http.Header{}
+			}
+
+			for k, v := range tt.header {
+				header[k] = v
+			}
+
+			rw := testRequest{method: http.MethodDelete, path: "/session", header: header}.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if c := sessionCookie(rw); tt.wantCleared != (c != nil && c.MaxAge < 0) {
+				t.Errorf("cookie = %v, want cleared %v", c, tt.wantCleared)
+			}
+
+			wantStatus := http.StatusOK
+			if tt.wantEnded {
+				wantStatus = http.StatusUnauthorized
+			}
+
+			if rw := (testRequest{method: http.MethodGet, path: "/session", header: withSession(sess.ID)}).serve(h); rw.Code != wantStatus {
+				t.Errorf("GET after logout: status = %d, want %d", rw.Code, wantStatus)
+			}
+		})
+	}
+}
+
+func TestSessionExpires(t *testing.T) {
+	h, opts, id := newSessionTest(t, session.Options{IdleTimeout: 20 * time.Millisecond})
+
+	sess, err := opts.store.Create(context.Background(), id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rw := testRequest{method: http.MethodGet, path: "/session", header: withSession(sess.ID)}.serve(h)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rw.Code, rw.Body)
+	}
+
+	var got Session
+	if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+
+	if got.UserID != id || got.ExpiresAt.Sub(got.CreatedAt) > 20*time.Millisecond {
+		t.Errorf("session = %+v, want one of %s expiring when idle", got, id)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+
+	rw = testRequest{method: http.MethodGet, path: "/session", header: withSession(sess.ID)}.serve(h)
+	if rw.Code != http.StatusUnauthorized {
+		t.Errorf("status = %d, want %d", rw.Code, http.StatusUnauthorized)
+	}
+
+	if c := sessionCookie(rw); c == nil || c.MaxAge >= 0 {
+		t.Errorf("cookie = %v, want it cleared", c)
+	}
+}
+
+func TestLogoutUser(t *testing.T) {
+	ctx := context.Background()
+	_, opts, id := newSessionTest(t, session.Options{})
+	s := NewSessionService(opts.DB(), opts.store, nil, opts.PasswordHasher(), opts.Logger())
+
+	create := func(userID string) *session.Session {
+		sess, err := opts.store.Create(ctx, userID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		return sess
+	}
+
+	current, other, someoneElse := create(id), create(id), create("grace")
+
+	next, err := s.LogoutUser(ctx, id, current)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next == nil || next.ID == current.ID || next.UserID != id {
+		t.Fatalf("LogoutUser() = %+v, want a new session of %s", next, id)
+	}
+
+	for name, sess := range map[string]*session.Session{"current": current, "other": other} {
+		if _, err := opts.store.Get(ctx, sess.ID); !errors.Is(err, session.ErrNotFound) {
+			t.Errorf("%s session: error = %v, want %v", name, err, session.ErrNotFound)
+		}
+	}
+
+	for name, sess := range map[string]*session.Session{"replacement": next, "other user's": someoneElse} {
+		if _, err := opts.store.Get(ctx, sess.ID); err != nil {
+			t.Errorf("%s session: error = %v", name, err)
+		}
+	}
+
+	// An operator logging a user out keeps their own session.
+	next, err = s.LogoutUser(ctx, id, someoneElse)
+	if err != nil || next != nil {
+		t.Errorf("LogoutUser() of another user = %+v, %v, want nil", next, err)
+	}
+}
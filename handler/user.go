@@ -1,136 +1,442 @@
 package handler
 
 import (
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
+	"strconv"
 	"sync"
 	"time"
 
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
 	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/edalmi/x-api/session"
 	"github.com/go-chi/chi/v5"
-	"github.com/google/uuid"
 	"github.com/prometheus/client_golang/prometheus"
 	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/attribute"
 )
 
-var reqs int64
-
 func NewUserHandler(opts HandlerOpts) *UserHandler {
-	return &UserHandler{
+	h := &UserHandler{
 		UserMetrics: newUserMetrics(opts.ID(), opts.Prometheus()),
+		Service:     NewUserService(opts.DB(), opts.Authorizer(), opts.Sessions(), opts.AuditRecorder(), opts.Logger()),
+		Credentials: NewCredentialService(opts.DB(), opts.PasswordHasher(), opts.PasswordPolicy(), opts.AuditRecorder(), opts.Logger()),
 		Options:     opts,
 	}
+
+	if store := opts.Sessions(); store != nil {
+		h.Sessions = NewSessionService(opts.DB(), store, h.Credentials, opts.PasswordHasher(), opts.Logger())
+	}
+
+	return h
 }
 
 type UserHandler struct {
 	UserMetrics UserMetrics
-	Options     HandlerOpts
+	Service     UserService
+	Credentials CredentialService
+	// Sessions is nil when cookie sessions are disabled.
+	Sessions SessionService
+	Options  HandlerOpts
 }
 
 func (u *UserHandler) CreateUser(rw http.ResponseWriter, r *http.Request) {
-	_, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.CreateUser")
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.CreateUser")
 	defer span.End()
 
-	u.Options.Logger().Info(r.URL.Path)
+	var in UserCreate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
 
+	user, err := u.Service.CreateUser(ctx, in)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	span.SetAttributes(attribute.Key("user_id").String(user.ID))
 	u.UserMetrics.IncrementUsersCreated()
+
+	rw.Header().Set("Location", path.Join(r.URL.Path, url.PathEscape(user.ID)))
+	rw.Header().Set("ETag", etag(user.Version))
+	writeJSON(ctx, u.Options.Logger(), rw, http.StatusCreated, user)
 }
 
 func (u UserHandler) ListUsers(rw http.ResponseWriter, r *http.Request) {
-	_, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.ListUsers")
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.ListUsers")
 	defer span.End()
 
-	u.Options.Logger().WithFields(logging.Fields{
-		"app": "/users",
-		"req": "1",
-	}).Info(r.URL.Path)
-
-	time.Sleep(3 * time.Second)
-
-	func() {
-		span.AddEvent("start_wait")
-		defer span.AddEvent("end_wait")
-
-		time.Sleep(2 * time.Second)
-	}()
+	q, err := pagination.Parse(r.URL.Query(), database.UserPagination)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
 
-	func() {
-		span.AddEvent("start_wait")
-		defer span.AddEvent("end_wait")
+	withDeleted, err := u.includeDeleted(r)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
 
-		time.Sleep(1 * time.Second)
-	}()
+	page, err := u.Service.ListUsers(ctx, q, withDeleted)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
 
-	u.UserMetrics.IncrementUsersCreated()
+	writePage(ctx, u.Options.Logger(), rw, r, page)
 }
 
 func (u UserHandler) DeleteUser(rw http.ResponseWriter, r *http.Request) {
-	rid := uuid.NewString()
 	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.DeleteUser")
 	defer span.End()
 
-	u.Options.Logger().Infof("Request-ID: %v", rid)
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
 
-	span.SetAttributes(attribute.Key("request_id").String(rid))
-
-	u.Options.Logger().Info(r.URL.Path)
-
-	time.Sleep(2 * time.Second)
-
-	func() {
-		_, span := otel.Tracer(u.Options.ID()).Start(ctx, "users.ListUsers.Wait")
-		defer span.End()
-
-		time.Sleep(3 * time.Second)
-	}()
+	if err := u.Service.DeleteUser(ctx, id, ifMatch(r)); err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
 
-	time.Sleep(1 * time.Second)
+	invalidate(ctx, u.Options, userResource(id))
 
 	u.UserMetrics.IncrementUsersDeleted()
+
+	rw.WriteHeader(http.StatusNoContent)
 }
 
 func (u UserHandler) GetUser(rw http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.GetUser")
 	defer span.End()
 
-	time.Sleep(5 * time.Second)
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
 
-	func() {
-		_, span := otel.Tracer(u.Options.ID()).Start(ctx, "users.ListUsers.Wait")
-		defer span.End()
+	withDeleted, err := u.includeDeleted(r)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
 
-		time.Sleep(5 * time.Second)
-	}()
+	user, err := u.Service.GetUser(ctx, id, withDeleted)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	rw.Header().Set("ETag", etag(user.Version))
+
+	if notModified(r, user.Version) {
+		rw.WriteHeader(http.StatusNotModified)
+		return
+	}
+
+	writeJSON(ctx, u.Options.Logger(), rw, http.StatusOK, user)
 }
 
 func (u UserHandler) UpdateUser(rw http.ResponseWriter, r *http.Request) {
 	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.UpdateUser")
 	defer span.End()
 
-	time.Sleep(5 * time.Second)
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
+
+	var in UserUpdate
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	user, err := u.Service.UpdateUser(ctx, id, in, ifMatch(r))
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	invalidate(ctx, u.Options, userResource(id))
+
+	rw.Header().Set("ETag", etag(user.Version))
+	writeJSON(ctx, u.Options.Logger(), rw, http.StatusOK, user)
+}
+
+func (u UserHandler) PatchUser(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.PatchUser")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
+
+	rw.Header().Set("Accept-Patch", acceptPatch)
+
+	patch, err := readPatch(r)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	user, err := u.Service.PatchUser(ctx, id, patch, ifMatch(r))
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	invalidate(ctx, u.Options, userResource(id))
+
+	rw.Header().Set("ETag", etag(user.Version))
+	writeJSON(ctx, u.Options.Logger(), rw, http.StatusOK, user)
+}
+
+func (u UserHandler) RestoreUser(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.RestoreUser")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
+
+	user, err := u.Service.RestoreUser(ctx, id)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
 
-	func() {
-		_, span := otel.Tracer(u.Options.ID()).Start(ctx, "users.ListUsers.Wait")
-		defer span.End()
+	invalidate(ctx, u.Options, userResource(id))
+
+	rw.Header().Set("ETag", etag(user.Version))
+	writeJSON(ctx, u.Options.Logger(), rw, http.StatusOK, user)
+}
 
-		time.Sleep(5 * time.Second)
+// SetPassword sets or changes the password of a user. Changing an existing
+// password requires current_password.
+func (u UserHandler) SetPassword(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.SetPassword")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
+
+	var in PasswordChange
+	if err := json.Read(r, &in); err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	if err := u.Credentials.SetPassword(ctx, id, in); err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	// A new password ends the sessions opened with the old one. The password
+	// has changed by now, so a failure is logged rather than returned.
+	if u.Sessions != nil {
+		if err := u.logoutUser(rw, r.WithContext(ctx), id); err != nil {
+			span.RecordError(err)
+			logging.FromContext(ctx, u.Options.Logger()).Error(err)
+		}
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+// DeleteSessions logs a user out everywhere. When the request was made with
+// one of the user's sessions, that session continues with a new ID.
+func (u UserHandler) DeleteSessions(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.DeleteSessions")
+	defer span.End()
+
+	id := chi.URLParam(r, "id")
+	span.SetAttributes(attribute.Key("user_id").String(id))
+
+	if err := u.logoutUser(rw, r.WithContext(ctx), id); err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	rw.WriteHeader(http.StatusNoContent)
+}
+
+func (u UserHandler) logoutUser(rw http.ResponseWriter, r *http.Request, userID string) error {
+	current, _ := session.FromContext(r.Context())
+
+	next, err := u.Sessions.LogoutUser(r.Context(), userID, current)
+	if err != nil {
+		return err
+	}
+
+	if next != nil {
+		u.Options.Sessions().WriteCookie(rw, next)
+	}
+
+	return nil
+}
+
+// ImportUsers creates users from a newline delimited JSON body and reports
+// the lines that could not be imported. ?dry_run=true only validates.
+func (u UserHandler) ImportUsers(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.ImportUsers")
+	defer span.End()
+
+	mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || mediaType != json.NDJSONContentType {
+		problem.Write(ctx, u.Options.Logger(), rw, r, problem.New(problem.CodeUnsupportedMediaType, "use "+json.NDJSONContentType))
+		return
+	}
+
+	var dryRun bool
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			problem.Write(ctx, u.Options.Logger(), rw, r, problem.New(problem.CodeBadRequest, "dry_run must be a boolean"))
+			return
+		}
+	}
+
+	report, err := u.Service.ImportUsers(ctx, r.Body, ImportOptions{DryRun: dryRun})
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	span.SetAttributes(
+		attribute.Key("import.lines").Int(report.Lines),
+		attribute.Key("import.created").Int(report.Created),
+		attribute.Key("import.failed").Int(report.Failed),
+		attribute.Key("import.dry_run").Bool(report.DryRun),
+	)
+
+	if !report.DryRun {
+		u.UserMetrics.AddUsersCreated(report.Created)
+	}
+
+	writeJSON(ctx, u.Options.Logger(), rw, http.StatusOK, report)
+}
+
+// ExportUsers streams users as newline delimited JSON. It accepts the
+// filters, sort and include_deleted parameters of ListUsers and walks every
+// page, so the export is consistent per page but not across pages.
+func (u UserHandler) ExportUsers(rw http.ResponseWriter, r *http.Request) {
+	ctx, span := otel.Tracer(u.Options.ID()).Start(r.Context(), "users.ExportUsers")
+	defer span.End()
+
+	values := r.URL.Query()
+	values.Del("limit")
+
+	q, err := pagination.Parse(values, database.UserPagination)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, problem.BadRequest(err))
+		return
+	}
+
+	q.Limit = exportPageSize
+
+	withDeleted, err := u.includeDeleted(r)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	page, err := u.Service.ListUsers(ctx, q, withDeleted)
+	if err != nil {
+		problem.Write(ctx, u.Options.Logger(), rw, r, err)
+		return
+	}
+
+	rw.Header().Set("Content-Type", json.NDJSONContentType)
+	rw.WriteHeader(http.StatusOK)
+
+	var (
+		w     = json.NewLineWriter(rw)
+		total int
+	)
+
+	defer func() {
+		span.SetAttributes(attribute.Key("export.users").Int(total))
 	}()
+
+	for {
+		for i := range page.Data {
+			if err := w.Write(page.Data[i]); err != nil {
+				logging.FromContext(ctx, u.Options.Logger()).Error(err)
+				return
+			}
+
+			total++
+		}
+
+		if page.NextCursor == "" {
+			return
+		}
+
+		// The status has been sent, so failures can only end the stream.
+		values.Set("cursor", page.NextCursor)
+
+		if q, err = pagination.Parse(values, database.UserPagination); err == nil {
+			q.Limit = exportPageSize
+			page, err = u.Service.ListUsers(ctx, q, withDeleted)
+		}
+
+		if err != nil {
+			span.RecordError(err)
+			logging.FromContext(ctx, u.Options.Logger()).Error(err)
+
+			return
+		}
+	}
 }
 
 func (u UserHandler) Routes() *chi.Mux {
 	r := chi.NewRouter()
 
-	r.Get("/", u.ListUsers)
-	r.Get("/{id}", u.GetUser)
-	r.Post("/", u.CreateUser)
-	r.Delete("/{id}", u.DeleteUser)
-	r.Put("/{id}", u.UpdateUser)
+	var (
+		read  = Authorize(u.Options, "users:read")
+		write = Authorize(u.Options, "users:write")
+	)
+
+	r.With(read).Get("/", u.ListUsers)
+	r.With(read, CacheResponses(u.Options, "GET /users/{id}", resourceParam(userResource, "id"))).Get("/{id}", u.GetUser)
+	r.With(write).Post("/", u.CreateUser)
+	r.With(write).Delete("/{id}", u.DeleteUser)
+	r.With(write).Put("/{id}", u.UpdateUser)
+	r.With(write).Patch("/{id}", u.PatchUser)
+	r.With(write).Post("/{id}:restore", u.RestoreUser)
+	// Setting the password of another user lets the caller sign in as
+	// them, so it takes more than users:write.
+	r.With(AuthorizeOrSelf(u.Options, "credentials:write", "id")).Post("/{id}/password", u.SetPassword)
+
+	if u.Sessions != nil {
+		r.With(AuthorizeOrSelf(u.Options, "users:write", "id")).Delete("/{id}/sessions", u.DeleteSessions)
+	}
 
 	return r
 }
 
+// exportPageSize is the number of users ExportUsers reads per query.
+const exportPageSize = 1000
+
+// includeDeleted reports whether soft deleted users were requested with
+// ?include_deleted=true, which requires the users:admin permission.
+func (u UserHandler) includeDeleted(r *http.Request) (bool, error) {
+	v, _ := strconv.ParseBool(r.URL.Query().Get("include_deleted"))
+	if !v {
+		return false, nil
+	}
+
+	if err := authorized(r, u.Options, "users:admin"); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 type UserMetrics interface {
 	IncrementUsersCreated()
+	AddUsersCreated(n int)
 	IncrementUsersDeleted()
 }
 
@@ -147,6 +453,13 @@ func (u *userMetrics) IncrementUsersCreated() {
 	u.createdUsers.Inc()
 }
 
+func (u *userMetrics) AddUsersCreated(n int) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.createdUsers.Add(float64(n))
+}
+
 func (u *userMetrics) IncrementUsersDeleted() {
 	u.mu.Lock()
 	defer u.mu.Unlock()
@@ -172,3 +485,29 @@ func newUserMetrics(app string, reg prometheus.Registerer) *userMetrics {
 
 	return m
 }
+
+type User struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	Name      string     `json:"name"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+	Version   int64      `json:"-"`
+}
+
+type UserCreate struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+type UserUpdate struct {
+	Email string `json:"email"`
+	Name  string `json:"name"`
+}
+
+// PasswordChange is the body of POST /users/{id}/password.
+type PasswordChange struct {
+	Password        string `json:"password"`
+	CurrentPassword string `json:"current_password"`
+}
@@ -0,0 +1,252 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/problem"
+	"github.com/google/uuid"
+)
+
+// UserImport is a line of an import. updated_at and deleted_at are accepted
+// so that the output of an export can be imported again, but are ignored.
+type UserImport struct {
+	ID        string     `json:"id"`
+	Email     string     `json:"email"`
+	Name      string     `json:"name"`
+	CreatedAt *time.Time `json:"created_at"`
+	UpdatedAt *time.Time `json:"updated_at"`
+	DeletedAt *time.Time `json:"deleted_at"`
+}
+
+type ImportOptions struct {
+	// DryRun validates the input and checks it for conflicts without
+	// writing anything.
+	DryRun bool
+}
+
+// ImportReport summarizes an import. In a dry run Created counts the users
+// that would have been created.
+type ImportReport struct {
+	DryRun  bool          `json:"dry_run"`
+	Lines   int           `json:"lines"`
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// ImportError describes why a line was not imported.
+type ImportError struct {
+	Line   int               `json:"line"`
+	Code   problem.Code      `json:"code"`
+	Detail string            `json:"detail,omitempty"`
+	Errors map[string]string `json:"errors,omitempty"`
+}
+
+func (r *ImportReport) fail(line int, err error) {
+	p := problem.From(err)
+
+	r.Failed++
+	r.Errors = append(r.Errors, ImportError{
+		Line:   line,
+		Code:   p.Code,
+		Detail: p.Detail,
+		Errors: p.Errors,
+	})
+}
+
+type importRow struct {
+	line int
+	user database.User
+}
+
+// ImportUsers reads users as newline delimited JSON and inserts them in
+// batches. Invalid and conflicting lines are reported and skipped, the
+// remaining ones are imported. Reading stops at a line that cannot be read
+// at all, such as one that is too long.
+func (s *userService) ImportUsers(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error) {
+	var (
+		report = &ImportReport{DryRun: opts.DryRun, Errors: []ImportError{}}
+		lines  = json.NewLineReader(r)
+		size   = s.repo.BatchSize()
+		batch  = make([]importRow, 0, size)
+		ids    = make(map[string]bool)
+		emails = make(map[string]bool)
+	)
+
+	for lines.Next() {
+		report.Lines++
+
+		row, err := decodeImportLine(lines.Bytes())
+		if err != nil {
+			report.fail(lines.Line(), err)
+			continue
+		}
+
+		switch {
+		case ids[row.ID]:
+			report.fail(lines.Line(), problem.New(problem.CodeConflict, "id appears earlier in the import"))
+			continue
+		case emails[row.Email]:
+			report.fail(lines.Line(), problem.New(problem.CodeConflict, "email appears earlier in the import"))
+			continue
+		}
+
+		ids[row.ID], emails[row.Email] = true, true
+		batch = append(batch, importRow{line: lines.Line(), user: *row})
+
+		if len(batch) == size {
+			if err := s.importBatch(ctx, batch, report, opts.DryRun); err != nil {
+				return nil, err
+			}
+
+			batch = batch[:0]
+		}
+	}
+
+	if err := lines.Err(); err != nil {
+		report.fail(lines.Line()+1, problem.BadRequest(err))
+	}
+
+	if err := s.importBatch(ctx, batch, report, opts.DryRun); err != nil {
+		return nil, err
+	}
+
+	sort.SliceStable(report.Errors, func(i, j int) bool {
+		return report.Errors[i].Line < report.Errors[j].Line
+	})
+
+	return report, nil
+}
+
+func decodeImportLine(b []byte) (*database.User, error) {
+	var in UserImport
+	if err := json.Unmarshal(b, &in); err != nil {
+		return nil, problem.BadRequest(err)
+	}
+
+	email, name := normalizeUser(in.Email, in.Name)
+
+	verr := validateUserFields(email, name)
+	if in.ID == "" {
+		in.ID = uuid.NewString()
+	} else if _, err := uuid.Parse(in.ID); err != nil {
+		verr.Add("id", "is not a valid UUID")
+	}
+
+	if err := verr.Err(); err != nil {
+		return nil, err
+	}
+
+	now := now()
+	createdAt := now
+	if in.CreatedAt != nil {
+		createdAt = in.CreatedAt.UTC().Truncate(time.Microsecond)
+	}
+
+	return &database.User{
+		ID:        in.ID,
+		Email:     email,
+		Name:      name,
+		CreatedAt: createdAt,
+		UpdatedAt: now,
+		Version:   1,
+	}, nil
+}
+
+// importBatch drops the rows that conflict with existing users and inserts
+// the others with a single statement.
+func (s *userService) importBatch(ctx context.Context, batch []importRow, report *ImportReport, dryRun bool) error {
+	if len(batch) == 0 {
+		return nil
+	}
+
+	ids := make([]string, 0, len(batch))
+	emails := make([]string, 0, len(batch))
+
+	for _, row := range batch {
+		ids, emails = append(ids, row.user.ID), append(emails, row.user.Email)
+	}
+
+	existing, err := s.repo.FindConflicts(ctx, ids, emails)
+	if err != nil {
+		return err
+	}
+
+	takenIDs := make(map[string]bool, len(existing))
+	takenEmails := make(map[string]bool, len(existing))
+
+	for _, u := range existing {
+		takenIDs[u.ID] = true
+
+		if u.DeletedAt == nil {
+			takenEmails[u.Email] = true
+		}
+	}
+
+	rows := make([]importRow, 0, len(batch))
+	for _, row := range batch {
+		switch {
+		case takenIDs[row.user.ID]:
+			report.fail(row.line, problem.New(problem.CodeConflict, "a user with this id already exists"))
+		case takenEmails[row.user.Email]:
+			report.fail(row.line, problem.New(problem.CodeConflict, "a user with this email already exists"))
+		default:
+			rows = append(rows, row)
+		}
+	}
+
+	if dryRun {
+		report.Created += len(rows)
+		return nil
+	}
+
+	users := make([]database.User, 0, len(rows))
+	for _, row := range rows {
+		users = append(users, row.user)
+	}
+
+	err = s.repo.CreateBatch(ctx, users)
+	if err == nil {
+		report.Created += len(rows)
+
+		for i := range users {
+			s.recordImport(ctx, &users[i])
+		}
+
+		return nil
+	}
+
+	if !errors.Is(err, database.ErrConflict) {
+		return err
+	}
+
+	// A concurrent writer took an id or email after the check. Insert the
+	// rows one by one to find out which.
+	for i, row := range rows {
+		if err := s.repo.Create(ctx, &users[i]); err != nil {
+			if !errors.Is(err, database.ErrConflict) {
+				return err
+			}
+
+			report.fail(row.line, problem.New(problem.CodeConflict, "a user with this id or email already exists"))
+			continue
+		}
+
+		report.Created++
+		s.recordImport(ctx, &users[i])
+	}
+
+	return nil
+}
+
+// recordImport audits the creation of an imported user. Lines that were not
+// imported are only reported.
+func (s *userService) recordImport(ctx context.Context, u *database.User) {
+	record(ctx, s.recorder, s.logger, "user.import", userResource(u.ID), nil, toUser(u), nil)
+}
@@ -0,0 +1,256 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/go-chi/chi/v5"
+)
+
+var ndjson = http.Header{"Content-Type": {"application/x-ndjson"}}
+
+// userIOHandler serves the user routes along with import and export, which
+// the server mounts next to them.
+func userIOHandler(opts HandlerOpts) http.Handler {
+	h := NewUserHandler(opts)
+
+	r := chi.NewRouter()
+	r.Mount("/users", h.Routes())
+	r.With(Authorize(opts, "users:write")).Post("/users:import", h.ImportUsers)
+	r.With(Authorize(opts, "users:read")).Get("/users:export", h.ExportUsers)
+
+	return r
+}
+
+func TestImportUsers(t *testing.T) {
+	const (
+		grace = `{"email":"grace@example.com","name":"Grace"}`
+		alan  = `{"id":"5f0c6d1e-8f8a-4c36-9b0e-8f0f8d0e6a11","email":"alan@example.com","name":"Alan"}`
+	)
+
+	tests := []struct {
+		name        string
+		path        string
+		header      http.Header
+		lines       []string
+		wantStatus  int
+		wantCreated int
+		wantErrors  map[int]string
+		wantUsers   int
+	}{
+		{
+			name:        "import",
+			lines:       []string{grace, alan},
+			wantCreated: 2,
+			wantUsers:   3,
+		},
+		{
+			name:        "dry run",
+			path:        "/users:import?dry_run=true",
+			lines:       []string{grace, alan},
+			wantCreated: 2,
+			wantUsers:   1,
+		},
+		{
+			name:        "dry run reports conflicts",
+			path:        "/users:import?dry_run=true",
+			lines:       []string{grace, `{"email":"ada@example.com","name":"Ada"}`},
+			wantCreated: 1,
+			wantErrors:  map[int]string{2: "conflict"},
+			wantUsers:   1,
+		},
+		{
+			name:        "conflicts within the import",
+			lines:       []string{grace, alan, `{"email":"grace@example.com","name":"Grace Hopper"}`, alan},
+			wantCreated: 2,
+			wantErrors:  map[int]string{3: "conflict", 4: "conflict"},
+			wantUsers:   3,
+		},
+		{
+			name:        "conflicts with the database",
+			lines:       []string{`{"email":"ada@example.com","name":"Ada"}`, `{"id":"{ada}","email":"ada2@example.com","name":"Ada"}`, grace},
+			wantCreated: 1,
+			wantErrors:  map[int]string{1: "conflict", 2: "conflict"},
+			wantUsers:   2,
+		},
+		{
+			name:        "email of a deleted user",
+			lines:       []string{`{"email":"deleted@example.com","name":"Deleted"}`},
+			wantCreated: 1,
+			wantUsers:   2,
+		},
+		{
+			name:        "invalid lines",
+			lines:       []string{`{"email":"grace","name":"Grace"}`, `{"id":"1","email":"alan@example.com","name":"Alan"}`, `{"email":`, `{"admin":true}`, grace},
+			wantCreated: 1,
+			wantErrors:  map[int]string{1: "validation_failed", 2: "validation_failed", 3: "bad_request", 4: "bad_request"},
+			wantUsers:   2,
+		},
+		{
+			name:        "blank lines",
+			lines:       []string{"", grace, "  ", alan, ""},
+			wantCreated: 2,
+			wantUsers:   3,
+		},
+		{name: "not NDJSON", header: http.Header{"Content-Type": {"application/json"}}, lines: []string{grace}, wantStatus: http.StatusUnsupportedMediaType},
+		{name: "invalid dry run", path: "/users:import?dry_run=maybe", lines: []string{grace}, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			db := newTestDB(t)
+			// Small batches make the import span several of them.
+			db.BatchSize = 2
+
+			h := userIOHandler(testOpts{db: db})
+
+			ada := mustCreate(t, h, "/users", `{"email":"ada@example.com","name":"Ada"}`)
+			deleted := mustCreate(t, h, "/users", `{"email":"deleted@example.com","name":"Deleted"}`)
+
+			if rw := (testRequest{method: http.MethodDelete, path: "/users/" + deleted}).serve(h); rw.Code != http.StatusNoContent {
+				t.Fatalf("deleting user: status = %d", rw.Code)
+			}
+
+			req := testRequest{
+				method: http.MethodPost,
+				path:   tt.path,
+				body:   strings.ReplaceAll(strings.Join(tt.lines, "\n"), "{ada}", ada),
+				header: tt.header,
+			}
+
+			if req.path == "" {
+				req.path = "/users:import"
+			}
+
+			if req.header == nil {
+				req.header = ndjson
+			}
+
+			rw := req.serve(h)
+
+			if tt.wantStatus == 0 {
+				tt.wantStatus = http.StatusOK
+			}
+
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if tt.wantStatus != http.StatusOK {
+				return
+			}
+
+			var report ImportReport
+			if err := json.Unmarshal(rw.Body.Bytes(), &report); err != nil {
+				t.Fatal(err)
+			}
+
+			if report.Created != tt.wantCreated || report.Failed != len(tt.wantErrors) || len(report.Errors) != len(tt.wantErrors) {
+				t.Errorf("report = %+v, want %d created and %d failed", report, tt.wantCreated, len(tt.wantErrors))
+			}
+
+			for _, e := range report.Errors {
+				if want := tt.wantErrors[e.Line]; string(e.Code) != want {
+					t.Errorf("line %d: code = %q, want %q", e.Line, e.Code, want)
+				}
+			}
+
+			if got := len(listUsers(t, h, "/users")); got != tt.wantUsers {
+				t.Errorf("%d users after the import, want %d", got, tt.wantUsers)
+			}
+		})
+	}
+}
+
+func TestExportUsers(t *testing.T) {
+	db := newTestDB(t)
+	h := userIOHandler(testOpts{db: db})
+
+	for _, body := range []string{
+		`{"email":"ada@example.com","name":"Ada"}`,
+		`{"email":"grace@example.com","name":"Grace"}`,
+		`{"email":"alan@example.com","name":"Alan"}`,
+	} {
+		mustCreate(t, h, "/users", body)
+	}
+
+	deleted := mustCreate(t, h, "/users", `{"email":"deleted@example.com","name":"Deleted"}`)
+	if rw := (testRequest{method: http.MethodDelete, path: "/users/" + deleted}).serve(h); rw.Code != http.StatusNoContent {
+		t.Fatalf("deleting user: status = %d", rw.Code)
+	}
+
+	tests := []struct {
+		name      string
+		path      string
+		wantLines int
+	}{
+		{name: "all", path: "/users:export", wantLines: 3},
+		{name: "limit is ignored", path: "/users:export?limit=1", wantLines: 3},
+		{name: "filtered", path: "/users:export?email=grace@example.com", wantLines: 1},
+		{name: "deleted included", path: "/users:export?include_deleted=true", wantLines: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rw := testRequest{method: http.MethodGet, path: tt.path}.serve(h)
+			if rw.Code != http.StatusOK {
+				t.Fatalf("status = %d, body = %s", rw.Code, rw.Body)
+			}
+
+			if ct := rw.Header().Get("Content-Type"); ct != "application/x-ndjson" {
+				t.Errorf("Content-Type = %q", ct)
+			}
+
+			if got := strings.Count(rw.Body.String(), "\n"); got != tt.wantLines {
+				t.Errorf("exported %d lines, want %d:\n%s", got, tt.wantLines, rw.Body)
+			}
+		})
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		export := testRequest{method: http.MethodGet, path: "/users:export"}.serve(h)
+
+		other := userIOHandler(testOpts{db: newTestDB(t)})
+
+		rw := testRequest{method: http.MethodPost, path: "/users:import", body: export.Body.String(), header: ndjson}.serve(other)
+		if rw.Code != http.StatusOK {
+			t.Fatalf("import: status = %d, body = %s", rw.Code, rw.Body)
+		}
+
+		want, got := listUsers(t, h, "/users?sort=id"), listUsers(t, other, "/users?sort=id")
+		if len(got) != len(want) {
+			t.Fatalf("imported %d users, want %d", len(got), len(want))
+		}
+
+		for i := range want {
+			if got[i].ID != want[i].ID || got[i].Email != want[i].Email || !got[i].CreatedAt.Equal(want[i].CreatedAt) {
+				t.Errorf("user %d = %+v, want %+v", i, got[i], want[i])
+			}
+		}
+
+		if rw := (testRequest{method: http.MethodPost, path: "/users:import", body: export.Body.String(), header: ndjson}).serve(other); !strings.Contains(rw.Body.String(), `"created":0`) {
+			t.Errorf("importing again: body = %s, want nothing created", rw.Body)
+		}
+	})
+}
+
+// listUsers returns the first page of users listed by path.
+func listUsers(t *testing.T, h http.Handler, path string) []User {
+	t.Helper()
+
+	rw := testRequest{method: http.MethodGet, path: path}.serve(h)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("GET %s: status = %d, body = %s", path, rw.Code, rw.Body)
+	}
+
+	var page struct {
+		Data []User `json:"data"`
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+
+	return page.Data
+}
@@ -0,0 +1,367 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/mail"
+	"strings"
+	"time"
+
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/authz"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/logging"
+	"github.com/edalmi/x-api/pagination"
+	"github.com/edalmi/x-api/problem"
+	"github.com/edalmi/x-api/session"
+	"github.com/google/uuid"
+	"github.com/jmoiron/sqlx"
+)
+
+const maxNameLength = 255
+
+type UserService interface {
+	CreateUser(ctx context.Context, u UserCreate) (*User, error)
+	GetUser(ctx context.Context, id string, withDeleted bool) (*User, error)
+	ListUsers(ctx context.Context, q *pagination.Query, withDeleted bool) (*pagination.Page[User], error)
+	UpdateUser(ctx context.Context, id string, u UserUpdate, cond Precondition) (*User, error)
+	PatchUser(ctx context.Context, id string, patch Patch, cond Precondition) (*User, error)
+	DeleteUser(ctx context.Context, id string, cond Precondition) error
+	RestoreUser(ctx context.Context, id string) (*User, error)
+	ImportUsers(ctx context.Context, r io.Reader, opts ImportOptions) (*ImportReport, error)
+}
+
+// NewUserService returns a UserService that audits every change to users
+// with recorder, which may be nil. Deleted users lose their cached roles in
+// the authorizer and their sessions in the session store, either of which
+// may be nil as well.
+func NewUserService(db *database.DB, authorizer *authz.Authorizer, sessions *session.Store, recorder audit.Recorder, logger logging.Logger) UserService {
+	return &userService{
+		db:         db,
+		repo:       database.NewUserRepository(db),
+		authorizer: authorizer,
+		sessions:   sessions,
+		recorder:   recorder,
+		logger:     logger,
+	}
+}
+
+type userService struct {
+	db         *database.DB
+	repo       *database.UserRepository
+	authorizer *authz.Authorizer
+	sessions   *session.Store
+	recorder   audit.Recorder
+	logger     logging.Logger
+}
+
+func (s *userService) CreateUser(ctx context.Context, in UserCreate) (user *User, err error) {
+	defer func() {
+		resource := "users"
+		if user != nil {
+			resource = userResource(user.ID)
+		}
+
+		record(ctx, s.recorder, s.logger, "user.create", resource, nil, user, err)
+	}()
+
+	email, name := normalizeUser(in.Email, in.Name)
+	if err := validateUser(email, name); err != nil {
+		return nil, err
+	}
+
+	now := now()
+	row := &database.User{
+		ID:        uuid.NewString(),
+		Email:     email,
+		Name:      name,
+		CreatedAt: now,
+		UpdatedAt: now,
+		Version:   1,
+	}
+
+	if err := s.repo.Create(ctx, row); err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toUser(row), nil
+}
+
+func (s *userService) GetUser(ctx context.Context, id string, withDeleted bool) (*User, error) {
+	get := s.repo.Get
+	if withDeleted {
+		get = s.repo.GetWithDeleted
+	}
+
+	row, err := get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toUser(row), nil
+}
+
+func (s *userService) ListUsers(ctx context.Context, q *pagination.Query, withDeleted bool) (*pagination.Page[User], error) {
+	rows, next, err := s.repo.List(ctx, q, withDeleted)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	page := &pagination.Page[User]{
+		Data:       make([]User, 0, len(rows)),
+		NextCursor: next,
+	}
+
+	for i := range rows {
+		page.Data = append(page.Data, *toUser(&rows[i]))
+	}
+
+	return page, nil
+}
+
+func (s *userService) UpdateUser(ctx context.Context, id string, in UserUpdate, cond Precondition) (user *User, err error) {
+	var before *User
+	defer func() {
+		record(ctx, s.recorder, s.logger, "user.update", userResource(id), before, user, err)
+	}()
+
+	email, name := normalizeUser(in.Email, in.Name)
+	if err := validateUser(email, name); err != nil {
+		return nil, err
+	}
+
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	if err := checkPrecondition(cond, row.Version); err != nil {
+		return nil, err
+	}
+
+	before = toUser(row)
+
+	row.Email = email
+	row.Name = name
+	row.UpdatedAt = now()
+
+	if err := s.repo.Update(ctx, row); err != nil {
+		return nil, serviceError(err)
+	}
+
+	return toUser(row), nil
+}
+
+// PatchUser applies patch to the user inside a transaction, so that the
+// user is read, patched, validated and written atomically.
+func (s *userService) PatchUser(ctx context.Context, id string, patch Patch, cond Precondition) (user *User, err error) {
+	var before *User
+	defer func() {
+		record(ctx, s.recorder, s.logger, "user.update", userResource(id), before, user, err)
+	}()
+
+	err = s.db.InTx(ctx, func(tx *sqlx.Tx) error {
+		repo := s.repo.Tx(tx)
+
+		row, err := repo.GetForUpdate(ctx, id)
+		if err != nil {
+			return err
+		}
+
+		if err := checkPrecondition(cond, row.Version); err != nil {
+			return err
+		}
+
+		current := toUser(row)
+
+		var patched User
+		if err := applyPatch(patch, current, &patched); err != nil {
+			return err
+		}
+
+		email, name := normalizeUser(patched.Email, patched.Name)
+
+		verr := validateUserFields(email, name)
+		if patched.ID != current.ID {
+			verr.Add("id", "is read-only")
+		}
+
+		if !patched.CreatedAt.Equal(current.CreatedAt) {
+			verr.Add("created_at", "is read-only")
+		}
+
+		if !patched.UpdatedAt.Equal(current.UpdatedAt) {
+			verr.Add("updated_at", "is read-only")
+		}
+
+		if err := verr.Err(); err != nil {
+			return err
+		}
+
+		row.Email = email
+		row.Name = name
+		row.UpdatedAt = now()
+
+		if err := repo.Update(ctx, row); err != nil {
+			return err
+		}
+
+		before, user = current, toUser(row)
+
+		return nil
+	})
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	return user, nil
+}
+
+// DeleteUser soft deletes the user. It is purged by the worker once the
+// retention period has passed.
+func (s *userService) DeleteUser(ctx context.Context, id string, cond Precondition) (err error) {
+	var before, after *User
+	defer func() {
+		record(ctx, s.recorder, s.logger, "user.delete", userResource(id), before, after, err)
+	}()
+
+	row, err := s.repo.Get(ctx, id)
+	if err != nil {
+		return serviceError(err)
+	}
+
+	if err := checkPrecondition(cond, row.Version); err != nil {
+		return err
+	}
+
+	// Without a precondition the user is deleted whatever its version.
+	var version int64
+	if cond != nil {
+		version = row.Version
+	}
+
+	at := now()
+	if err := s.repo.SoftDelete(ctx, id, version, at); err != nil {
+		return serviceError(err)
+	}
+
+	before, after = toUser(row), toUser(row)
+	after.UpdatedAt, after.DeletedAt = at, &at
+
+	s.signOut(ctx, id)
+
+	return nil
+}
+
+func (s *userService) RestoreUser(ctx context.Context, id string) (user *User, err error) {
+	var before *User
+	defer func() {
+		record(ctx, s.recorder, s.logger, "user.restore", userResource(id), before, user, err)
+	}()
+
+	row, err := s.repo.GetWithDeleted(ctx, id)
+	if err != nil {
+		return nil, serviceError(err)
+	}
+
+	err = s.repo.Restore(ctx, id, now())
+	switch {
+	case errors.Is(err, database.ErrConflict):
+		return nil, &problem.Error{Code: problem.CodeConflict, Detail: "a user with this email already exists", Err: err}
+	case err != nil:
+		return nil, serviceError(err)
+	}
+
+	before = toUser(row)
+
+	return s.GetUser(ctx, id, false)
+}
+
+// signOut ends the sessions of a deleted user and drops its cached roles,
+// so that it can no longer act. The user has been deleted, so failures are
+// logged; cached roles expire on their own.
+func (s *userService) signOut(ctx context.Context, id string) {
+	if s.authorizer != nil {
+		if err := s.authorizer.Forget(ctx, id); err != nil {
+			logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"user_id": id}).Error(err)
+		}
+	}
+
+	if s.sessions != nil {
+		if err := s.sessions.DeleteUser(ctx, id); err != nil {
+			logging.FromContext(ctx, s.logger).WithFields(logging.Fields{"user_id": id}).Error(err)
+		}
+	}
+}
+
+func normalizeUser(email, name string) (string, string) {
+	return strings.ToLower(strings.TrimSpace(email)), strings.TrimSpace(name)
+}
+
+func validateUser(email, name string) error {
+	return validateUserFields(email, name).Err()
+}
+
+func validateUserFields(email, name string) problem.Fields {
+	verr := problem.Fields{}
+
+	if email == "" {
+		verr.Add("email", "is required")
+	} else if addr, err := mail.ParseAddress(email); err != nil || addr.Address != email {
+		verr.Add("email", "is not a valid address")
+	}
+
+	if name == "" {
+		verr.Add("name", "is required")
+	} else if len(name) > maxNameLength {
+		verr.Add("name", "is too long")
+	}
+
+	return verr
+}
+
+// userResource names a user in audit entries.
+func userResource(id string) string {
+	return "users/" + id
+}
+
+func toUser(row *database.User) *User {
+	return &User{
+		ID:        row.ID,
+		Email:     row.Email,
+		Name:      row.Name,
+		CreatedAt: row.CreatedAt,
+		UpdatedAt: row.UpdatedAt,
+		DeletedAt: row.DeletedAt,
+		Version:   row.Version,
+	}
+}
+
+// serviceError maps repository errors to the errors understood by handlers.
+func serviceError(err error) error {
+	switch {
+	case errors.Is(err, database.ErrNotFound):
+		return problem.Wrap(problem.CodeNotFound, err)
+	case errors.Is(err, database.ErrConflict):
+		return problem.Wrap(problem.CodeConflict, err)
+	case errors.Is(err, database.ErrVersionMismatch):
+		return problem.Wrap(problem.CodePreconditionFailed, err)
+	default:
+		return err
+	}
+}
+
+func checkPrecondition(cond Precondition, version int64) error {
+	if cond != nil && !cond(version) {
+		return problem.New(problem.CodePreconditionFailed, "resource has been modified")
+	}
+
+	return nil
+}
+
+// now returns the current time truncated to the precision every supported
+// dialect can store.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
@@ -0,0 +1,184 @@
+package handler
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestUserHandler(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        testRequest
+		wantStatus int
+		wantEmail  string
+	}{
+		{name: "get", req: testRequest{method: http.MethodGet, path: "/{id}"}, wantStatus: http.StatusOK, wantEmail: "ada@example.com"},
+		{name: "get unknown", req: testRequest{method: http.MethodGet, path: "/unknown"}, wantStatus: http.StatusNotFound},
+		{name: "list", req: testRequest{method: http.MethodGet, path: "/?email=ada@example.com"}, wantStatus: http.StatusOK},
+		{name: "list by unknown sort", req: testRequest{method: http.MethodGet, path: "/?sort=password"}, wantStatus: http.StatusBadRequest},
+		{
+			name:       "create",
+			req:        testRequest{method: http.MethodPost, path: "/", body: `{"email":"grace@example.com","name":"Grace"}`},
+			wantStatus: http.StatusCreated,
+			wantEmail:  "grace@example.com",
+		},
+		{name: "create taken email", req: testRequest{method: http.MethodPost, path: "/", body: `{"email":"ada@example.com","name":"Ada"}`}, wantStatus: http.StatusConflict},
+		{name: "create invalid", req: testRequest{method: http.MethodPost, path: "/", body: `{"email":"ada","name":""}`}, wantStatus: http.StatusUnprocessableEntity},
+		{name: "create unknown field", req: testRequest{method: http.MethodPost, path: "/", body: `{"email":"a@example.com","name":"A","admin":true}`}, wantStatus: http.StatusBadRequest},
+		{name: "create without body", req: testRequest{method: http.MethodPost, path: "/"}, wantStatus: http.StatusBadRequest},
+		{
+			name:       "update",
+			req:        testRequest{method: http.MethodPut, path: "/{id}", body: `{"email":"lovelace@example.com","name":"Ada Lovelace"}`},
+			wantStatus: http.StatusOK,
+			wantEmail:  "lovelace@example.com",
+		},
+		{name: "update unknown", req: testRequest{method: http.MethodPut, path: "/unknown", body: `{"email":"a@example.com","name":"A"}`}, wantStatus: http.StatusNotFound},
+		{name: "delete", req: testRequest{method: http.MethodDelete, path: "/{id}"}, wantStatus: http.StatusNoContent},
+		{name: "delete unknown", req: testRequest{method: http.MethodDelete, path: "/unknown"}, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(testOpts{db: newTestDB(t)}).Routes()
+
+			created := testRequest{method: http.MethodPost, path: "/", body: `{"email":"ada@example.com","name":"Ada"}`}.serve(h)
+			if created.Code != http.StatusCreated {
+				t.Fatalf("creating user: status = %d, body = %s", created.Code, created.Body)
+			}
+
+			var user User
+			if err := json.Unmarshal(created.Body.Bytes(), &user); err != nil {
+				t.Fatal(err)
+			}
+
+			tt.req.path = strings.ReplaceAll(tt.req.path, "{id}", user.ID)
+
+			rw := tt.req.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if tt.wantEmail == "" {
+				return
+			}
+
+			var got User
+			if err := json.Unmarshal(rw.Body.Bytes(), &got); err != nil {
+				t.Fatal(err)
+			}
+
+			if got.Email != tt.wantEmail || got.ID == "" {
+				t.Errorf("user = %+v, want email %q", got, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestUserHandlerPreconditions(t *testing.T) {
+	tests := []struct {
+		name       string
+		req        testRequest
+		wantStatus int
+		wantETag   string
+	}{
+		{name: "get", req: testRequest{method: http.MethodGet}, wantStatus: http.StatusOK, wantETag: `"1"`},
+		{name: "get not modified", req: testRequest{method: http.MethodGet, header: http.Header{"If-None-Match": {`"1"`}}}, wantStatus: http.StatusNotModified, wantETag: `"1"`},
+		{name: "get weak not modified", req: testRequest{method: http.MethodGet, header: http.Header{"If-None-Match": {`"0", W/"1"`}}}, wantStatus: http.StatusNotModified},
+		{name: "get modified", req: testRequest{method: http.MethodGet, header: http.Header{"If-None-Match": {`"0"`}}}, wantStatus: http.StatusOK},
+		{name: "update", req: testRequest{method: http.MethodPut, body: `{"email":"ada@example.com","name":"Ada Lovelace"}`}, wantStatus: http.StatusOK, wantETag: `"2"`},
+		{
+			name:       "update matching",
+			req:        testRequest{method: http.MethodPut, body: `{"email":"ada@example.com","name":"Ada Lovelace"}`, header: http.Header{"If-Match": {`"1"`}}},
+			wantStatus: http.StatusOK,
+			wantETag:   `"2"`,
+		},
+		{
+			name:       "update any",
+			req:        testRequest{method: http.MethodPut, body: `{"email":"ada@example.com","name":"Ada Lovelace"}`, header: http.Header{"If-Match": {"*"}}},
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "update stale",
+			req:        testRequest{method: http.MethodPut, body: `{"email":"ada@example.com","name":"Ada Lovelace"}`, header: http.Header{"If-Match": {`"0"`}}},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{
+			name:       "update weak",
+			req:        testRequest{method: http.MethodPut, body: `{"email":"ada@example.com","name":"Ada Lovelace"}`, header: http.Header{"If-Match": {`W/"1"`}}},
+			wantStatus: http.StatusPreconditionFailed,
+		},
+		{name: "delete matching", req: testRequest{method: http.MethodDelete, header: http.Header{"If-Match": {`"0", "1"`}}}, wantStatus: http.StatusNoContent},
+		{name: "delete stale", req: testRequest{method: http.MethodDelete, header: http.Header{"If-Match": {`"2"`}}}, wantStatus: http.StatusPreconditionFailed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(testOpts{db: newTestDB(t)}).Routes()
+
+			tt.req.path = "/" + mustCreate(t, h, "/", `{"email":"ada@example.com","name":"Ada"}`)
+
+			rw := tt.req.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if got := rw.Header().Get("ETag"); tt.wantETag != "" && got != tt.wantETag {
+				t.Errorf("ETag = %s, want %s", got, tt.wantETag)
+			}
+		})
+	}
+}
+
+func TestUserHandlerSoftDelete(t *testing.T) {
+	tests := []struct {
+		name    string
+		deleted bool
+		// retaken creates another user with the email of the deleted one.
+		retaken    bool
+		req        testRequest
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "get deleted", deleted: true, req: testRequest{method: http.MethodGet, path: "/{id}"}, wantStatus: http.StatusNotFound},
+		{name: "get deleted included", deleted: true, req: testRequest{method: http.MethodGet, path: "/{id}?include_deleted=true"}, wantStatus: http.StatusOK, wantBody: `"deleted_at":`},
+		{name: "list deleted", deleted: true, req: testRequest{method: http.MethodGet, path: "/"}, wantStatus: http.StatusOK, wantBody: `"data":[]`},
+		{name: "list deleted included", deleted: true, req: testRequest{method: http.MethodGet, path: "/?include_deleted=true"}, wantStatus: http.StatusOK, wantBody: `"id":"{id}"`},
+		{name: "update deleted", deleted: true, req: testRequest{method: http.MethodPut, path: "/{id}", body: `{"email":"ada@example.com","name":"Ada"}`}, wantStatus: http.StatusNotFound},
+		{name: "delete deleted", deleted: true, req: testRequest{method: http.MethodDelete, path: "/{id}"}, wantStatus: http.StatusNotFound},
+		{name: "email of deleted user", deleted: true, req: testRequest{method: http.MethodPost, path: "/", body: `{"email":"ada@example.com","name":"Ada"}`}, wantStatus: http.StatusCreated},
+		{name: "restore", deleted: true, req: testRequest{method: http.MethodPost, path: "/{id}:restore"}, wantStatus: http.StatusOK, wantBody: `"id":"{id}"`},
+		{name: "restore retaken email", deleted: true, retaken: true, req: testRequest{method: http.MethodPost, path: "/{id}:restore"}, wantStatus: http.StatusConflict},
+		{name: "restore unknown", req: testRequest{method: http.MethodPost, path: "/unknown:restore"}, wantStatus: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := NewUserHandler(testOpts{db: newTestDB(t)}).Routes()
+
+			id := mustCreate(t, h, "/", `{"email":"ada@example.com","name":"Ada"}`)
+
+			if tt.deleted {
+				if rw := (testRequest{method: http.MethodDelete, path: "/" + id}).serve(h); rw.Code != http.StatusNoContent {
+					t.Fatalf("deleting user: status = %d, body = %s", rw.Code, rw.Body)
+				}
+			}
+
+			if tt.retaken {
+				mustCreate(t, h, "/", `{"email":"ada@example.com","name":"Ada"}`)
+			}
+
+			tt.req.path = strings.ReplaceAll(tt.req.path, "{id}", id)
+
+			rw := tt.req.serve(h)
+			if rw.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d, body = %s", rw.Code, tt.wantStatus, rw.Body)
+			}
+
+			if want := strings.ReplaceAll(tt.wantBody, "{id}", id); !strings.Contains(rw.Body.String(), want) {
+				t.Errorf("body = %s, want it to contain %s", rw.Body, want)
+			}
+		})
+	}
+}
@@ -50,6 +50,25 @@ func New() *cobra.Command {
 
 	cmd.AddCommand(NewCmdStart())
 	cmd.AddCommand(NewCmdMigrate())
+	cmd.AddCommand(NewCmdWorker())
+
+	bindFlags(cmd)
+
+	return cmd
+}
+
+// NewWorker returns the root command of x-worker.
+func NewWorker() *cobra.Command {
+	cmd := NewCmdWorker()
+	cmd.Use = "x-worker"
+	cmd.SilenceUsage = true
+
+	bindFlags(cmd)
+
+	return cmd
+}
+
+func bindFlags(cmd *cobra.Command) {
 	cobra.OnInitialize(configLoad(v))
 
 	cmd.PersistentFlags().StringVarP(&configFile, flagConfig, "c", "", "Configuration file")
@@ -59,8 +78,6 @@ func New() *cobra.Command {
 	if err := v.BindPFlags(cmd.PersistentFlags()); err != nil {
 		panic(err)
 	}
-
-	return cmd
 }
 
 func configLoad(v *viper.Viper) func() {
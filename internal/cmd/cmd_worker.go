@@ -0,0 +1,48 @@
+// Copyright 2023 Edson Michaque
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+//
+// SPDX-License-Identifier: Apache-2.0
+
+package cmd
+
+import (
+	"context"
+
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/server"
+	"github.com/spf13/cobra"
+)
+
+func NewCmdWorker() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "worker",
+		Short: "Start background worker",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			cfg, err := config.New(v)
+			if err != nil {
+				return err
+			}
+
+			worker, err := server.NewWorker(cfg)
+			if err != nil {
+				return err
+			}
+
+			return worker.Start(context.Background())
+		},
+	}
+
+	return cmd
+}
@@ -1 +1,73 @@
 package json
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+)
+
+const (
+	ContentType = "application/json"
+
+	maxBodySize = 1 << 20
+)
+
+var ErrEmptyBody = errors.New("json: empty request body")
+
+func Write(rw http.ResponseWriter, status int, v interface{}) error {
+	rw.Header().Set("Content-Type", ContentType)
+	rw.WriteHeader(status)
+
+	return json.NewEncoder(rw).Encode(v)
+}
+
+func Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal is like json.Unmarshal but rejects unknown fields.
+func Unmarshal(b []byte, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.DisallowUnknownFields()
+
+	return dec.Decode(v)
+}
+
+// ReadAll reads a request body of at most 1 MiB.
+func ReadAll(r *http.Request) ([]byte, error) {
+	b, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(b) > maxBodySize {
+		return nil, errors.New("json: request body too large")
+	}
+
+	if len(b) == 0 {
+		return nil, ErrEmptyBody
+	}
+
+	return b, nil
+}
+
+func Read(r *http.Request, v interface{}) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+
+	if err := dec.Decode(v); err != nil {
+		if errors.Is(err, io.EOF) {
+			return ErrEmptyBody
+		}
+
+		return err
+	}
+
+	if dec.More() {
+		return errors.New("json: request body must contain a single value")
+	}
+
+	return nil
+}
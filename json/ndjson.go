@@ -0,0 +1,86 @@
+package json
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+)
+
+// NDJSONContentType is the media type of newline delimited JSON, one value
+// per line.
+const NDJSONContentType = "application/x-ndjson"
+
+// LineReader reads newline delimited JSON one line at a time. Lines may be
+// at most 1 MiB long.
+type LineReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+func NewLineReader(r io.Reader) *LineReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), maxBodySize)
+
+	return &LineReader{scanner: scanner}
+}
+
+// Next advances to the next non-blank line and reports whether there is
+// one. Once it returns false, Err reports why.
+func (r *LineReader) Next() bool {
+	for r.scanner.Scan() {
+		r.line++
+
+		if len(bytes.TrimSpace(r.scanner.Bytes())) > 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Line returns the 1-based number of the current line, counting blank
+// lines. After Next returns false it is the number of lines read.
+func (r *LineReader) Line() int {
+	return r.line
+}
+
+// Bytes returns the current line. It is only valid until the next call to
+// Next.
+func (r *LineReader) Bytes() []byte {
+	return r.scanner.Bytes()
+}
+
+func (r *LineReader) Err() error {
+	return r.scanner.Err()
+}
+
+// LineWriter writes values as newline delimited JSON, flushing after each
+// value when w supports it so that long streams reach the client
+// incrementally.
+type LineWriter struct {
+	enc     *json.Encoder
+	flusher http.Flusher
+}
+
+func NewLineWriter(w io.Writer) *LineWriter {
+	flusher, _ := w.(http.Flusher)
+
+	return &LineWriter{
+		enc:     json.NewEncoder(w),
+		flusher: flusher,
+	}
+}
+
+func (w *LineWriter) Write(v interface{}) error {
+	if err := w.enc.Encode(v); err != nil {
+		return err
+	}
+
+	if w.flusher != nil {
+		w.flusher.Flush()
+	}
+
+	return nil
+}
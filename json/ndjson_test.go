@@ -0,0 +1,101 @@
+package json
+
+import (
+	"bufio"
+	"errors"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestLineReader(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		wantLines []string
+		wantNums  []int
+		wantLast  int
+		wantErr   error
+	}{
+		{
+			name:      "lines",
+			input:     "{\"a\":1}\n{\"a\":2}\n",
+			wantLines: []string{`{"a":1}`, `{"a":2}`},
+			wantNums:  []int{1, 2},
+			wantLast:  2,
+		},
+		{
+			name:      "blank lines",
+			input:     "\n{\"a\":1}\n  \n\r\n{\"a\":2}",
+			wantLines: []string{`{"a":1}`, `{"a":2}`},
+			wantNums:  []int{2, 5},
+			wantLast:  5,
+		},
+		{
+			name:      "CRLF",
+			input:     "{\"a\":1}\r\n{\"a\":2}\r\n",
+			wantLines: []string{`{"a":1}`, `{"a":2}`},
+			wantNums:  []int{1, 2},
+			wantLast:  2,
+		},
+		{
+			name:  "empty",
+			input: "",
+		},
+		{
+			name:      "line too long",
+			input:     "{\"a\":1}\n" + strings.Repeat("x", maxBodySize+1) + "\n",
+			wantLines: []string{`{"a":1}`},
+			wantNums:  []int{1},
+			wantLast:  1,
+			wantErr:   bufio.ErrTooLong,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var (
+				r     = NewLineReader(strings.NewReader(tt.input))
+				lines []string
+				nums  []int
+			)
+
+			for r.Next() {
+				lines = append(lines, string(r.Bytes()))
+				nums = append(nums, r.Line())
+			}
+
+			if !errors.Is(r.Err(), tt.wantErr) {
+				t.Errorf("Err() = %v, want %v", r.Err(), tt.wantErr)
+			}
+
+			if !reflect.DeepEqual(lines, tt.wantLines) || !reflect.DeepEqual(nums, tt.wantNums) {
+				t.Errorf("read lines %q at %v, want %q at %v", lines, nums, tt.wantLines, tt.wantNums)
+			}
+
+			if r.Line() != tt.wantLast {
+				t.Errorf("Line() after the last line = %d, want %d", r.Line(), tt.wantLast)
+			}
+		})
+	}
+}
+
+func TestLineWriter(t *testing.T) {
+	rw := httptest.NewRecorder()
+	w := NewLineWriter(rw)
+
+	for _, v := range []interface{}{map[string]int{"a": 1}, []string{"b"}, "c"} {
+		if err := w.Write(v); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if want := "{\"a\":1}\n[\"b\"]\n\"c\"\n"; rw.Body.String() != want {
+		t.Errorf("wrote %q, want %q", rw.Body.String(), want)
+	}
+
+	if !rw.Flushed {
+		t.Error("the response was not flushed")
+	}
+}
@@ -0,0 +1,36 @@
+package logging
+
+import "context"
+
+type fieldsKey struct{}
+
+// ContextWithFields returns a copy of ctx carrying fields, in addition to
+// those ctx already carries, for the loggers returned by FromContext.
+func ContextWithFields(ctx context.Context, fields Fields) context.Context {
+	merged := Fields{}
+	for k, v := range fieldsFromContext(ctx) {
+		merged[k] = v
+	}
+
+	for k, v := range fields {
+		merged[k] = v
+	}
+
+	return context.WithValue(ctx, fieldsKey{}, merged)
+}
+
+// FromContext returns l logging the fields of ctx, such as the ID of the
+// request being served, so that the lines of a request can be told apart.
+func FromContext(ctx context.Context, l Logger) Logger {
+	fields := fieldsFromContext(ctx)
+	if l == nil || len(fields) == 0 {
+		return l
+	}
+
+	return l.WithFields(fields)
+}
+
+func fieldsFromContext(ctx context.Context) Fields {
+	fields, _ := ctx.Value(fieldsKey{}).(Fields)
+	return fields
+}
@@ -3,6 +3,8 @@ package log
 import (
 	"fmt"
 	"log"
+	"sort"
+	"strings"
 
 	"github.com/edalmi/x-api/logging"
 )
@@ -15,40 +17,58 @@ func New(l *log.Logger) *Logger {
 
 type Logger struct {
 	logger *log.Logger
+	// fields is appended to every line, as sorted key=value pairs.
+	fields string
 }
 
 func (l *Logger) Debug(v ...interface{}) {
-	l.logger.Println("DEBUG", fmt.Sprint(v...))
+	l.println("DEBUG", fmt.Sprint(v...))
 }
 
 func (l *Logger) Debugf(f string, v ...interface{}) {
-	l.logger.Println("DEBUG", fmt.Sprintf(f, v...))
+	l.println("DEBUG", fmt.Sprintf(f, v...))
 }
 
 func (l *Logger) Info(v ...interface{}) {
-	l.logger.Println("INFO", fmt.Sprint(v...))
+	l.println("INFO", fmt.Sprint(v...))
 }
 
 func (l *Logger) Infof(f string, v ...interface{}) {
-	l.logger.Println("INFO", fmt.Sprintf(f, v...))
+	l.println("INFO", fmt.Sprintf(f, v...))
 }
 
 func (l *Logger) Warn(v ...interface{}) {
-	l.logger.Println("WARN", fmt.Sprint(v...))
+	l.println("WARN", fmt.Sprint(v...))
 }
 
 func (l *Logger) Warnf(f string, v ...interface{}) {
-	l.logger.Println("WARN", fmt.Sprintf(f, v...))
+	l.println("WARN", fmt.Sprintf(f, v...))
 }
 
 func (l *Logger) Error(v ...interface{}) {
-	l.logger.Println("ERROR", fmt.Sprint(v...))
+	l.println("ERROR", fmt.Sprint(v...))
 }
 
 func (l *Logger) Errorf(f string, v ...interface{}) {
-	l.logger.Println("ERROR", fmt.Sprintf(f, v...))
+	l.println("ERROR", fmt.Sprintf(f, v...))
 }
 
 func (l *Logger) WithFields(f logging.Fields) logging.Logger {
-	return l
+	pairs := make([]string, 0, len(f))
+	for k, v := range f {
+		pairs = append(pairs, k+"="+v)
+	}
+
+	sort.Strings(pairs)
+
+	return &Logger{logger: l.logger, fields: strings.TrimSpace(l.fields + " " + strings.Join(pairs, " "))}
+}
+
+func (l *Logger) println(level, msg string) {
+	if l.fields == "" {
+		l.logger.Println(level, msg)
+		return
+	}
+
+	l.logger.Println(level, msg, l.fields)
 }
@@ -50,5 +50,10 @@ func (l Logger) Errorf(f string, v ...interface{}) {
 }
 
 func (l *Logger) WithFields(f logging.Fields) logging.Logger {
-	return l
+	args := make([]any, 0, 2*len(f))
+	for k, v := range f {
+		args = append(args, k, v)
+	}
+
+	return &Logger{logger: l.logger.With(args...)}
 }
@@ -0,0 +1,74 @@
+package pagination
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/edalmi/x-api/json"
+)
+
+var errMalformedCursor = errors.New("malformed cursor")
+
+type cursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(spec string, sorts []Sort, values []interface{}) (string, error) {
+	c := cursor{
+		Sort:   spec,
+		Values: make([]string, 0, len(values)),
+	}
+
+	for i, v := range values {
+		switch v := v.(type) {
+		case time.Time:
+			c.Values = append(c.Values, v.UTC().Format(time.RFC3339Nano))
+		case string:
+			c.Values = append(c.Values, v)
+		default:
+			return "", fmt.Errorf("pagination: unsupported cursor value %T for %q", v, sorts[i].Field.Name)
+		}
+	}
+
+	b, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func decodeCursor(s, spec string, sorts []Sort) ([]interface{}, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, errMalformedCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(b, &c); err != nil {
+		return nil, errMalformedCursor
+	}
+
+	if c.Sort != spec {
+		return nil, errors.New("cursor was issued for a different sort order")
+	}
+
+	if len(c.Values) != len(sorts) {
+		return nil, errMalformedCursor
+	}
+
+	values := make([]interface{}, 0, len(sorts))
+	for i, s := range sorts {
+		v, err := s.Field.parse(c.Values[i])
+		if err != nil {
+			return nil, errMalformedCursor
+		}
+
+		values = append(values, v)
+	}
+
+	return values, nil
+}
@@ -0,0 +1,61 @@
+package pagination
+
+import (
+	"fmt"
+	"net/url"
+	"reflect"
+	"strings"
+
+	"github.com/jmoiron/sqlx/reflectx"
+)
+
+// mapper resolves columns the same way sqlx does when scanning rows.
+var mapper = reflectx.NewMapperFunc("db", strings.ToLower)
+
+type Page[T any] struct {
+	Data       []T    `json:"data"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Paginate trims the extra row requested by Build and returns the cursor
+// of the next page, or an empty string on the last page. Rows must be
+// structs whose db tags name the sorted fields.
+func Paginate[T any](q *Query, rows []T) ([]T, string, error) {
+	if len(rows) <= q.Limit {
+		return rows, "", nil
+	}
+
+	rows = rows[:q.Limit]
+
+	last := reflect.Indirect(reflect.ValueOf(rows[len(rows)-1]))
+	values := make([]interface{}, 0, len(q.sorts))
+
+	for _, s := range q.sorts {
+		v := mapper.FieldByName(last, s.Field.Name)
+		if !v.IsValid() {
+			return nil, "", fmt.Errorf("pagination: %T has no field %q", rows[0], s.Field.Name)
+		}
+
+		values = append(values, v.Interface())
+	}
+
+	next, err := encodeCursor(q.spec, q.sorts, values)
+	if err != nil {
+		return nil, "", err
+	}
+
+	return rows, next, nil
+}
+
+// Link returns the value of a Link header pointing to the next page of u.
+func Link(u *url.URL, next string) string {
+	values := u.Query()
+	values.Set(paramCursor, next)
+
+	link := url.URL{
+		Path:     u.Path,
+		RawQuery: values.Encode(),
+	}
+
+	return fmt.Sprintf(`<%s>; rel="next"`, link.String())
+}
@@ -0,0 +1,313 @@
+package pagination
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 20
+	MaxLimit     = 100
+)
+
+const (
+	paramLimit  = "limit"
+	paramCursor = "cursor"
+	paramSort   = "sort"
+)
+
+type Type int
+
+const (
+	String Type = iota
+	Time
+)
+
+type Operator string
+
+const (
+	Eq Operator = "="
+	Gt Operator = ">"
+	Lt Operator = "<"
+)
+
+// Field is a column that can be filtered or sorted on.
+type Field struct {
+	// Name is the db tag of the column in the scanned row struct.
+	Name string
+	// Column is the SQL expression used in queries. It defaults to Name.
+	Column string
+	Type   Type
+}
+
+func (f Field) column() string {
+	if f.Column != "" {
+		return f.Column
+	}
+
+	return f.Name
+}
+
+func (f Field) parse(v string) (interface{}, error) {
+	switch f.Type {
+	case Time:
+		t, err := time.Parse(time.RFC3339Nano, v)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an RFC 3339 timestamp", v)
+		}
+
+		return t.UTC(), nil
+	default:
+		return v, nil
+	}
+}
+
+// Filter whitelists a query parameter that narrows the result set.
+type Filter struct {
+	Param string
+	Field Field
+	Op    Operator
+}
+
+// Schema describes how a collection can be paginated, filtered and sorted.
+type Schema struct {
+	// Key is a unique column appended to every sort so that the ordering
+	// is total and cursors stay stable.
+	Key     Field
+	Sorts   map[string]Field
+	Filters []Filter
+	// DefaultSort is used when the request has no sort parameter, e.g.
+	// "-created_at".
+	DefaultSort  string
+	DefaultLimit int
+	MaxLimit     int
+}
+
+type Sort struct {
+	Field Field
+	Desc  bool
+}
+
+type filterValue struct {
+	filter Filter
+	value  interface{}
+}
+
+type Query struct {
+	Limit int
+
+	sorts   []Sort
+	spec    string
+	filters []filterValue
+	after   []interface{}
+}
+
+// Error is returned for malformed pagination, filter or sort parameters.
+type Error struct {
+	Param string
+	Err   error
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("invalid %s parameter: %v", e.Param, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func Parse(values url.Values, s Schema) (*Query, error) {
+	q := &Query{
+		Limit: s.DefaultLimit,
+	}
+
+	if q.Limit <= 0 {
+		q.Limit = DefaultLimit
+	}
+
+	maxLimit := s.MaxLimit
+	if maxLimit <= 0 {
+		maxLimit = MaxLimit
+	}
+
+	if v := values.Get(paramLimit); v != "" {
+		limit, err := strconv.Atoi(v)
+		if err != nil || limit < 1 {
+			return nil, &Error{Param: paramLimit, Err: errors.New("must be a positive integer")}
+		}
+
+		if limit > maxLimit {
+			limit = maxLimit
+		}
+
+		q.Limit = limit
+	}
+
+	spec := values.Get(paramSort)
+	if spec == "" {
+		spec = s.DefaultSort
+	}
+
+	if err := q.parseSort(spec, s); err != nil {
+		return nil, &Error{Param: paramSort, Err: err}
+	}
+
+	for _, f := range s.Filters {
+		v := values.Get(f.Param)
+		if v == "" {
+			continue
+		}
+
+		value, err := f.Field.parse(v)
+		if err != nil {
+			return nil, &Error{Param: f.Param, Err: err}
+		}
+
+		q.filters = append(q.filters, filterValue{filter: f, value: value})
+	}
+
+	if v := values.Get(paramCursor); v != "" {
+		after, err := decodeCursor(v, q.spec, q.sorts)
+		if err != nil {
+			return nil, &Error{Param: paramCursor, Err: err}
+		}
+
+		q.after = after
+	}
+
+	return q, nil
+}
+
+func (q *Query) parseSort(spec string, s Schema) error {
+	var (
+		seen = make(map[string]bool)
+		keys []string
+	)
+
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+
+		name := strings.TrimPrefix(key, "-")
+		field, ok := s.Sorts[name]
+		if !ok {
+			return fmt.Errorf("cannot sort by %q", name)
+		}
+
+		if seen[name] {
+			return fmt.Errorf("%q is sorted more than once", name)
+		}
+
+		seen[name] = true
+		keys = append(keys, key)
+		q.sorts = append(q.sorts, Sort{Field: field, Desc: strings.HasPrefix(key, "-")})
+	}
+
+	if !seen[s.Key.Name] {
+		q.sorts = append(q.sorts, Sort{Field: s.Key})
+	}
+
+	q.spec = strings.Join(keys, ",")
+
+	return nil
+}
+
+// Condition is an additional predicate that the caller requires, written
+// with ? placeholders.
+type Condition struct {
+	Expr string
+	Args []interface{}
+}
+
+func Where(expr string, args ...interface{}) Condition {
+	return Condition{Expr: expr, Args: args}
+}
+
+// Build appends the filter, cursor, ordering and limit clauses of q to a
+// SELECT ... FROM statement. Placeholders are written as ? and must be
+// rebound for the target dialect. One extra row is requested so that Page
+// can tell whether there is a next page.
+func (q *Query) Build(base string, conds ...Condition) (string, []interface{}) {
+	var (
+		where []string
+		args  []interface{}
+	)
+
+	for _, c := range conds {
+		where = append(where, "("+c.Expr+")")
+		args = append(args, c.Args...)
+	}
+
+	for _, f := range q.filters {
+		where = append(where, fmt.Sprintf("%s %s ?", f.filter.Field.column(), f.filter.Op))
+		args = append(args, f.value)
+	}
+
+	if q.after != nil {
+		expr, keysetArgs := q.keyset()
+		where = append(where, expr)
+		args = append(args, keysetArgs...)
+	}
+
+	var sb strings.Builder
+
+	sb.WriteString(base)
+
+	if len(where) > 0 {
+		sb.WriteString(" WHERE ")
+		sb.WriteString(strings.Join(where, " AND "))
+	}
+
+	order := make([]string, 0, len(q.sorts))
+	for _, s := range q.sorts {
+		dir := "ASC"
+		if s.Desc {
+			dir = "DESC"
+		}
+
+		order = append(order, s.Field.column()+" "+dir)
+	}
+
+	sb.WriteString(" ORDER BY ")
+	sb.WriteString(strings.Join(order, ", "))
+	sb.WriteString(fmt.Sprintf(" LIMIT %d", q.Limit+1))
+
+	return sb.String(), args
+}
+
+// keyset expands the row comparison (a, b, c) > (x, y, z) into
+// a > x OR (a = x AND b > y) OR (a = x AND b = y AND c > z), which every
+// dialect supports and which allows mixed sort directions.
+func (q *Query) keyset() (string, []interface{}) {
+	var (
+		ors  []string
+		args []interface{}
+	)
+
+	for i, s := range q.sorts {
+		var ands []string
+
+		for j := 0; j < i; j++ {
+			ands = append(ands, q.sorts[j].Field.column()+" = ?")
+			args = append(args, q.after[j])
+		}
+
+		op := ">"
+		if s.Desc {
+			op = "<"
+		}
+
+		ands = append(ands, fmt.Sprintf("%s %s ?", s.Field.column(), op))
+		args = append(args, q.after[i])
+
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
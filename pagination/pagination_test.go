@@ -0,0 +1,207 @@
+package pagination
+
+import (
+	"errors"
+	"net/url"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type row struct {
+	ID        string    `db:"id"`
+	Email     string    `db:"email"`
+	CreatedAt time.Time `db:"created_at"`
+}
+
+var testSchema = Schema{
+	Key: Field{Name: "id"},
+	Sorts: map[string]Field{
+		"email":      {Name: "email"},
+		"created_at": {Name: "created_at", Type: Time},
+	},
+	Filters: []Filter{
+		{Param: "email", Field: Field{Name: "email"}, Op: Eq},
+		{Param: "created_after", Field: Field{Name: "created_at", Column: "u.created_at", Type: Time}, Op: Gt},
+	},
+	DefaultSort:  "-created_at",
+	DefaultLimit: 10,
+	MaxLimit:     50,
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name      string
+		query     string
+		wantLimit int
+		wantSQL   string
+		wantArgs  []interface{}
+		wantParam string
+	}{
+		{
+			name:      "defaults",
+			wantLimit: 10,
+			wantSQL:   "SELECT * FROM users ORDER BY created_at DESC, id ASC LIMIT 11",
+		},
+		{
+			name:      "limit",
+			query:     "limit=5",
+			wantLimit: 5,
+			wantSQL:   "SELECT * FROM users ORDER BY created_at DESC, id ASC LIMIT 6",
+		},
+		{
+			name:      "limit capped",
+			query:     "limit=500",
+			wantLimit: 50,
+			wantSQL:   "SELECT * FROM users ORDER BY created_at DESC, id ASC LIMIT 51",
+		},
+		{
+			name:      "sort",
+			query:     "sort=email,-created_at",
+			wantLimit: 10,
+			wantSQL:   "SELECT * FROM users ORDER BY email ASC, created_at DESC, id ASC LIMIT 11",
+		},
+		{
+			name:      "filters",
+			query:     "email=a@example.com&created_after=2026-01-02T03:04:05Z",
+			wantLimit: 10,
+			wantSQL:   "SELECT * FROM users WHERE email = ? AND u.created_at > ? ORDER BY created_at DESC, id ASC LIMIT 11",
+			wantArgs:  []interface{}{"a@example.com", time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)},
+		},
+		{name: "zero limit", query: "limit=0", wantParam: "limit"},
+		{name: "malformed limit", query: "limit=ten", wantParam: "limit"},
+		{name: "unknown sort", query: "sort=password", wantParam: "sort"},
+		{name: "repeated sort", query: "sort=email,-email", wantParam: "sort"},
+		{name: "malformed filter", query: "created_after=yesterday", wantParam: "created_after"},
+		{name: "malformed cursor", query: "cursor=!!!", wantParam: "cursor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			values, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			q, err := Parse(values, testSchema)
+			if tt.wantParam != "" {
+				var perr *Error
+				if !errors.As(err, &perr) || perr.Param != tt.wantParam {
+					t.Fatalf("Parse() error = %v, want an error of parameter %q", err, tt.wantParam)
+				}
+
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("Parse() error = %v", err)
+			}
+
+			if q.Limit != tt.wantLimit {
+				t.Errorf("Limit = %d, want %d", q.Limit, tt.wantLimit)
+			}
+
+			sql, args := q.Build("SELECT * FROM users")
+			if sql != tt.wantSQL {
+				t.Errorf("Build() sql = %q, want %q", sql, tt.wantSQL)
+			}
+
+			if !reflect.DeepEqual(args, tt.wantArgs) {
+				t.Errorf("Build() args = %v, want %v", args, tt.wantArgs)
+			}
+		})
+	}
+}
+
+func TestPaginate(t *testing.T) {
+	created := time.Date(2026, 1, 2, 3, 4, 5, 6, time.UTC)
+	rows := []row{
+		{ID: "c", Email: "c@example.com", CreatedAt: created.Add(2 * time.Hour)},
+		{ID: "b", Email: "b@example.com", CreatedAt: created},
+		{ID: "a", Email: "a@example.com", CreatedAt: created.Add(-time.Hour)},
+	}
+
+	tests := []struct {
+		name     string
+		limit    string
+		wantRows int
+		wantNext bool
+	}{
+		{name: "more rows", limit: "2", wantRows: 2, wantNext: true},
+		{name: "last page", limit: "3", wantRows: 3},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := Parse(url.Values{"limit": {tt.limit}}, testSchema)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got, next, err := Paginate(q, rows)
+			if err != nil {
+				t.Fatalf("Paginate() error = %v", err)
+			}
+
+			if len(got) != tt.wantRows {
+				t.Errorf("Paginate() returned %d rows, want %d", len(got), tt.wantRows)
+			}
+
+			if (next != "") != tt.wantNext {
+				t.Fatalf("Paginate() next = %q, want a cursor: %v", next, tt.wantNext)
+			}
+
+			if next == "" {
+				return
+			}
+
+			q, err = Parse(url.Values{"limit": {tt.limit}, "cursor": {next}}, testSchema)
+			if err != nil {
+				t.Fatalf("Parse() of the next cursor error = %v", err)
+			}
+
+			sql, args := q.Build("SELECT * FROM users")
+			wantSQL := "SELECT * FROM users WHERE ((created_at < ?) OR (created_at = ? AND id > ?)) ORDER BY created_at DESC, id ASC LIMIT 3"
+			if sql != wantSQL {
+				t.Errorf("Build() sql = %q, want %q", sql, wantSQL)
+			}
+
+			wantArgs := []interface{}{created, created, "b"}
+			if !reflect.DeepEqual(args, wantArgs) {
+				t.Errorf("Build() args = %v, want %v", args, wantArgs)
+			}
+		})
+	}
+}
+
+func TestCursorSort(t *testing.T) {
+	q, err := Parse(url.Values{"limit": {"1"}}, testSchema)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, next, err := Paginate(q, []row{{ID: "b"}, {ID: "a"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A cursor only continues the sort order it was issued for.
+	_, err = Parse(url.Values{"sort": {"email"}, "cursor": {next}}, testSchema)
+
+	var perr *Error
+	if !errors.As(err, &perr) || perr.Param != "cursor" {
+		t.Fatalf("Parse() error = %v, want an error of parameter cursor", err)
+	}
+}
+
+func TestLink(t *testing.T) {
+	u, err := url.Parse("https://api.example.com/users?limit=5&cursor=old&sort=email")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `</users?cursor=next&limit=5&sort=email>; rel="next"`
+	if got := Link(u, "next"); got != want {
+		t.Errorf("Link() = %q, want %q", got, want)
+	}
+}
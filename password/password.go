@@ -0,0 +1,219 @@
+// Package password hashes and verifies user passwords.
+//
+// Hashes are stored in a self describing format that records the algorithm
+// and its parameters, so that hashes created with older parameters keep
+// verifying and can be upgraded when the user next logs in.
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+type Algorithm string
+
+const (
+	Argon2id Algorithm = "argon2id"
+	Bcrypt   Algorithm = "bcrypt"
+)
+
+// bcryptMaxLength is the number of bytes bcrypt takes into account. Longer
+// passwords are rejected instead of being silently truncated.
+const bcryptMaxLength = 72
+
+var (
+	ErrMismatch      = errors.New("password: password does not match")
+	ErrTooLong       = errors.New("password: password is too long for the hashing algorithm")
+	ErrUnknownFormat = errors.New("password: unknown hash format")
+)
+
+// Argon2Params are the argon2id parameters. Memory is in KiB.
+type Argon2Params struct {
+	Memory      uint32
+	Iterations  uint32
+	Parallelism uint8
+	SaltLength  uint32
+	KeyLength   uint32
+}
+
+// Params selects the algorithm used for new hashes and its parameters.
+type Params struct {
+	Algorithm  Algorithm
+	Argon2     Argon2Params
+	BcryptCost int
+}
+
+// DefaultParams follow the OWASP recommendations for argon2id.
+var DefaultParams = Params{
+	Algorithm: Argon2id,
+	Argon2: Argon2Params{
+		Memory:      64 * 1024,
+		Iterations:  3,
+		Parallelism: 2,
+		SaltLength:  16,
+		KeyLength:   32,
+	},
+	BcryptCost: 12,
+}
+
+func (p Params) Validate() error {
+	switch p.Algorithm {
+	case Argon2id:
+		a := p.Argon2
+		if a.Memory == 0 || a.Iterations == 0 || a.Parallelism == 0 {
+			return errors.New("password: argon2 memory, iterations and parallelism must be positive")
+		}
+
+		if a.SaltLength < 8 || a.KeyLength < 16 {
+			return errors.New("password: argon2 salt must be at least 8 and key at least 16 bytes")
+		}
+	case Bcrypt:
+		if p.BcryptCost < bcrypt.MinCost || p.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("password: bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	default:
+		return fmt.Errorf("password: unknown algorithm %q", p.Algorithm)
+	}
+
+	return nil
+}
+
+type Hasher struct {
+	params Params
+}
+
+func NewHasher(p Params) (*Hasher, error) {
+	if err := p.Validate(); err != nil {
+		return nil, err
+	}
+
+	return &Hasher{params: p}, nil
+}
+
+// Hash returns the encoded hash of password using the current parameters.
+func (h *Hasher) Hash(password string) (string, error) {
+	if h.params.Algorithm == Bcrypt {
+		if len(password) > bcryptMaxLength {
+			return "", ErrTooLong
+		}
+
+		b, err := bcrypt.GenerateFromPassword([]byte(password), h.params.BcryptCost)
+		if err != nil {
+			return "", err
+		}
+
+		return string(b), nil
+	}
+
+	a := h.params.Argon2
+
+	salt := make([]byte, a.SaltLength)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+
+	return encodeArgon2(a, salt, key), nil
+}
+
+// Verify checks password against an encoded hash in constant time. It
+// returns ErrMismatch when the password is wrong. rehash reports whether the
+// hash was created with other parameters than the current ones and should be
+// replaced by Hash(password).
+func (h *Hasher) Verify(password, encoded string) (rehash bool, err error) {
+	switch {
+	case strings.HasPrefix(encoded, "$argon2id$"):
+		a, salt, key, err := decodeArgon2(encoded)
+		if err != nil {
+			return false, err
+		}
+
+		got := argon2.IDKey([]byte(password), salt, a.Iterations, a.Memory, a.Parallelism, a.KeyLength)
+		if subtle.ConstantTimeCompare(got, key) != 1 {
+			return false, ErrMismatch
+		}
+
+		return h.params.Algorithm != Argon2id || a != h.params.Argon2, nil
+	case isBcrypt(encoded):
+		err := bcrypt.CompareHashAndPassword([]byte(encoded), []byte(password))
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, ErrMismatch
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		cost, err := bcrypt.Cost([]byte(encoded))
+		if err != nil {
+			return false, err
+		}
+
+		return h.params.Algorithm != Bcrypt || cost != h.params.BcryptCost, nil
+	default:
+		return false, ErrUnknownFormat
+	}
+}
+
+func isBcrypt(encoded string) bool {
+	for _, prefix := range []string{"$2a$", "$2b$", "$2y$"} {
+		if strings.HasPrefix(encoded, prefix) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// encodeArgon2 writes the PHC string format used by the reference
+// implementation: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<key>.
+func encodeArgon2(a Argon2Params, salt, key []byte) string {
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version,
+		a.Memory,
+		a.Iterations,
+		a.Parallelism,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	)
+}
+
+func decodeArgon2(encoded string) (Argon2Params, []byte, []byte, error) {
+	var a Argon2Params
+
+	parts := strings.Split(encoded, "$")
+	if len(parts) != 6 {
+		return a, nil, nil, ErrUnknownFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return a, nil, nil, fmt.Errorf("%w: unsupported argon2 version", ErrUnknownFormat)
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &a.Memory, &a.Iterations, &a.Parallelism); err != nil {
+		return a, nil, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return a, nil, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return a, nil, nil, fmt.Errorf("%w: %v", ErrUnknownFormat, err)
+	}
+
+	a.SaltLength, a.KeyLength = uint32(len(salt)), uint32(len(key))
+
+	return a, salt, key, nil
+}
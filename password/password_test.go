@@ -0,0 +1,178 @@
+package password
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Cheap parameters keep the tests fast.
+var (
+	testArgon2 = Params{
+		Algorithm: Argon2id,
+		Argon2:    Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32},
+	}
+	testBcrypt = Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost}
+)
+
+func mustHasher(t *testing.T, p Params) *Hasher {
+	t.Helper()
+
+	h, err := NewHasher(p)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return h
+}
+
+func TestHasherVerify(t *testing.T) {
+	stronger := testArgon2
+	stronger.Argon2.Iterations = 2
+
+	costlier := testBcrypt
+	costlier.BcryptCost = bcrypt.MinCost + 1
+
+	tests := []struct {
+		name       string
+		hashedWith Params
+		verifyWith Params
+		password   string
+		wantRehash bool
+		wantErr    error
+	}{
+		{name: "argon2id", hashedWith: testArgon2, verifyWith: testArgon2, password: "correct horse"},
+		{name: "bcrypt", hashedWith: testBcrypt, verifyWith: testBcrypt, password: "correct horse"},
+		{name: "argon2id mismatch", hashedWith: testArgon2, verifyWith: testArgon2, password: "battery staple", wantErr: ErrMismatch},
+		{name: "bcrypt mismatch", hashedWith: testBcrypt, verifyWith: testBcrypt, password: "battery staple", wantErr: ErrMismatch},
+		{name: "older argon2id parameters", hashedWith: testArgon2, verifyWith: stronger, password: "correct horse", wantRehash: true},
+		{name: "older bcrypt cost", hashedWith: testBcrypt, verifyWith: costlier, password: "correct horse", wantRehash: true},
+		{name: "bcrypt to argon2id", hashedWith: testBcrypt, verifyWith: testArgon2, password: "correct horse", wantRehash: true},
+		{name: "argon2id to bcrypt", hashedWith: testArgon2, verifyWith: testBcrypt, password: "correct horse", wantRehash: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoded, err := mustHasher(t, tt.hashedWith).Hash("correct horse")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			rehash, err := mustHasher(t, tt.verifyWith).Verify(tt.password, encoded)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Verify() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if rehash != tt.wantRehash {
+				t.Errorf("Verify() rehash = %v, want %v", rehash, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestHashIsSalted(t *testing.T) {
+	h := mustHasher(t, testArgon2)
+
+	a, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := h.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if a == b || !strings.HasPrefix(a, "$argon2id$v=19$m=1024,t=1,p=1$") {
+		t.Errorf("Hash() = %q and %q, want two salted argon2id hashes", a, b)
+	}
+}
+
+func TestBcryptTooLong(t *testing.T) {
+	if _, err := mustHasher(t, testBcrypt).Hash(strings.Repeat("a", 73)); !errors.Is(err, ErrTooLong) {
+		t.Errorf("Hash() error = %v, want ErrTooLong", err)
+	}
+}
+
+func TestVerifyUnknownFormat(t *testing.T) {
+	h := mustHasher(t, testArgon2)
+
+	for _, encoded := range []string{
+		"",
+		"plaintext",
+		"$argon2i$v=19$m=1024,t=1,p=1$c2FsdA$a2V5",
+		"$argon2id$v=18$m=1024,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5",
+		"$argon2id$v=19$m=1024,t=1,p=1$!!!$a2V5a2V5a2V5a2V5",
+	} {
+		if _, err := h.Verify("correct horse", encoded); !errors.Is(err, ErrUnknownFormat) {
+			t.Errorf("Verify(%q) error = %v, want ErrUnknownFormat", encoded, err)
+		}
+	}
+}
+
+func TestParamsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		params  Params
+		wantErr bool
+	}{
+		{name: "default", params: DefaultParams},
+		{name: "bcrypt", params: testBcrypt},
+		{name: "unknown algorithm", params: Params{Algorithm: "scrypt"}, wantErr: true},
+		{name: "argon2id without memory", params: Params{Algorithm: Argon2id, Argon2: Argon2Params{Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 32}}, wantErr: true},
+		{name: "argon2id short salt", params: Params{Algorithm: Argon2id, Argon2: Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 4, KeyLength: 32}}, wantErr: true},
+		{name: "argon2id short key", params: Params{Algorithm: Argon2id, Argon2: Argon2Params{Memory: 1024, Iterations: 1, Parallelism: 1, SaltLength: 16, KeyLength: 8}}, wantErr: true},
+		{name: "bcrypt cost too low", params: Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MinCost - 1}, wantErr: true},
+		{name: "bcrypt cost too high", params: Params{Algorithm: Bcrypt, BcryptCost: bcrypt.MaxCost + 1}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.params.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyCheck(t *testing.T) {
+	strict := Policy{MinLength: 8, MaxLength: 16, RequireUpper: true, RequireLower: true, RequireDigit: true, RequireSymbol: true}
+
+	tests := []struct {
+		name           string
+		policy         Policy
+		password       string
+		wantViolations int
+	}{
+		{name: "default", policy: DefaultPolicy, password: "correct horse battery"},
+		{name: "default too short", policy: DefaultPolicy, password: "short", wantViolations: 1},
+		{name: "default too long", policy: DefaultPolicy, password: strings.Repeat("a", 129), wantViolations: 1},
+		{name: "characters are counted", policy: DefaultPolicy, password: strings.Repeat("é", 12)},
+		{name: "strict", policy: strict, password: "Tr0ub4dor&3"},
+		{name: "strict without symbol", policy: strict, password: "Tr0ub4dor3", wantViolations: 1},
+		{name: "strict space is a symbol", policy: strict, password: "Tr0ub4dor 3"},
+		{name: "strict all missing", policy: strict, password: "aaaaaaaa", wantViolations: 3},
+		{name: "strict empty", policy: strict, password: "", wantViolations: 5},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.policy.Check(tt.password)
+			if tt.wantViolations == 0 {
+				if err != nil {
+					t.Errorf("Check() error = %v", err)
+				}
+
+				return
+			}
+
+			var perr *PolicyError
+			if !errors.As(err, &perr) || len(perr.Violations) != tt.wantViolations {
+				t.Errorf("Check() error = %v, want %d violations", err, tt.wantViolations)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package problem
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/edalmi/x-api/json"
+	"github.com/edalmi/x-api/logging"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const ContentType = "application/problem+json"
+
+const typePrefix = "urn:x-api:problem:"
+
+// Code is a stable, machine readable identifier of a class of errors.
+type Code string
+
+const (
+	CodeBadRequest           Code = "bad_request"
+	CodeValidation           Code = "validation_failed"
+	CodeUnauthorized         Code = "unauthorized"
+	CodeForbidden            Code = "forbidden"
+	CodeNotFound             Code = "not_found"
+	CodeMethodNotAllowed     Code = "method_not_allowed"
+	CodeConflict             Code = "conflict"
+	CodePreconditionFailed   Code = "precondition_failed"
+	CodeUnsupportedMediaType Code = "unsupported_media_type"
+	CodeRateLimited          Code = "rate_limited"
+	CodeInternal             Code = "internal_error"
+)
+
+var statuses = map[Code]int{
+	CodeBadRequest:           http.StatusBadRequest,
+	CodeValidation:           http.StatusUnprocessableEntity,
+	CodeUnauthorized:         http.StatusUnauthorized,
+	CodeForbidden:            http.StatusForbidden,
+	CodeNotFound:             http.StatusNotFound,
+	CodeMethodNotAllowed:     http.StatusMethodNotAllowed,
+	CodeConflict:             http.StatusConflict,
+	CodePreconditionFailed:   http.StatusPreconditionFailed,
+	CodeUnsupportedMediaType: http.StatusUnsupportedMediaType,
+	CodeRateLimited:          http.StatusTooManyRequests,
+	CodeInternal:             http.StatusInternalServerError,
+}
+
+var (
+	ErrBadRequest           = &Error{Code: CodeBadRequest}
+	ErrUnauthorized         = &Error{Code: CodeUnauthorized}
+	ErrForbidden            = &Error{Code: CodeForbidden}
+	ErrNotFound             = &Error{Code: CodeNotFound}
+	ErrMethodNotAllowed     = &Error{Code: CodeMethodNotAllowed}
+	ErrConflict             = &Error{Code: CodeConflict}
+	ErrPreconditionFailed   = &Error{Code: CodePreconditionFailed}
+	ErrUnsupportedMediaType = &Error{Code: CodeUnsupportedMediaType}
+	ErrRateLimited          = &Error{Code: CodeRateLimited}
+)
+
+// Error is a domain error that can be rendered as a problem document.
+type Error struct {
+	Code   Code
+	Detail string
+	Fields map[string]string
+	Err    error
+}
+
+func (e *Error) Error() string {
+	msg := string(e.Code)
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+
+	return msg
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Is reports whether target is an *Error with the same code, so that
+// errors.Is(err, problem.ErrNotFound) matches any not found error.
+func (e *Error) Is(target error) bool {
+	t, ok := target.(*Error)
+
+	return ok && t.Code == e.Code
+}
+
+func (e *Error) Status() int {
+	if status, ok := statuses[e.Code]; ok {
+		return status
+	}
+
+	return http.StatusInternalServerError
+}
+
+func New(code Code, detail string) *Error {
+	return &Error{Code: code, Detail: detail}
+}
+
+func Wrap(code Code, err error) *Error {
+	return &Error{Code: code, Err: err}
+}
+
+func BadRequest(err error) *Error {
+	return &Error{Code: CodeBadRequest, Detail: err.Error(), Err: err}
+}
+
+// Fields collects per field validation messages.
+type Fields map[string]string
+
+func (f Fields) Add(field, msg string) {
+	f[field] = msg
+}
+
+// Err returns a validation error, or nil when no field failed.
+func (f Fields) Err() error {
+	if len(f) == 0 {
+		return nil
+	}
+
+	return &Error{
+		Code:   CodeValidation,
+		Detail: "one or more fields are invalid",
+		Fields: f,
+	}
+}
+
+// Problem is an RFC 7807 problem details document.
+type Problem struct {
+	Type     string            `json:"type"`
+	Title    string            `json:"title"`
+	Status   int               `json:"status"`
+	Detail   string            `json:"detail,omitempty"`
+	Instance string            `json:"instance,omitempty"`
+	Code     Code              `json:"code"`
+	Errors   map[string]string `json:"errors,omitempty"`
+}
+
+// From converts err to a problem document. Errors that are not an *Error
+// become internal errors whose details are not disclosed.
+func From(err error) Problem {
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Code: CodeInternal}
+	}
+
+	status := e.Status()
+	p := Problem{
+		Type:   typePrefix + string(e.Code),
+		Title:  http.StatusText(status),
+		Status: status,
+		Code:   e.Code,
+		Errors: e.Fields,
+	}
+
+	if status < http.StatusInternalServerError {
+		p.Detail = e.Detail
+	}
+
+	return p
+}
+
+// Write renders err as a problem document. The error is recorded on the
+// span active in ctx, and server errors are logged.
+func Write(ctx context.Context, logger logging.Logger, rw http.ResponseWriter, r *http.Request, err error) {
+	p := From(err)
+	p.Instance = r.URL.Path
+
+	span := trace.SpanFromContext(ctx)
+	span.RecordError(err)
+
+	if p.Status >= http.StatusInternalServerError {
+		span.SetStatus(codes.Error, err.Error())
+
+		fields := logging.Fields{
+			"method": r.Method,
+			"path":   r.URL.Path,
+			"status": fmt.Sprint(p.Status),
+		}
+
+		logging.FromContext(ctx, logger).WithFields(fields).Error(err)
+	}
+
+	if err := Render(rw, p); err != nil {
+		logging.FromContext(ctx, logger).Error(err)
+	}
+}
+
+// Render writes p as the response. Unlike Write, it neither records nor
+// logs anything, which is up to the caller.
+func Render(rw http.ResponseWriter, p Problem) error {
+	b, err := json.Marshal(p)
+	if err != nil {
+		return err
+	}
+
+	rw.Header().Set("Content-Type", ContentType)
+	rw.Header().Set("X-Content-Type-Options", "nosniff")
+	rw.WriteHeader(p.Status)
+
+	_, err = rw.Write(append(b, '\n'))
+
+	return err
+}
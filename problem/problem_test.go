@@ -0,0 +1,129 @@
+package problem
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestFrom(t *testing.T) {
+	fields := Fields{}
+	fields.Add("email", "must be a valid email address")
+
+	tests := []struct {
+		name string
+		err  error
+		want Problem
+	}{
+		{
+			name: "not found",
+			err:  New(CodeNotFound, "user not found"),
+			want: Problem{Type: "urn:x-api:problem:not_found", Title: "Not Found", Status: http.StatusNotFound, Detail: "user not found", Code: CodeNotFound},
+		},
+		{
+			name: "wrapped",
+			err:  fmt.Errorf("updating user: %w", New(CodeConflict, "email is taken")),
+			want: Problem{Type: "urn:x-api:problem:conflict", Title: "Conflict", Status: http.StatusConflict, Detail: "email is taken", Code: CodeConflict},
+		},
+		{
+			name: "validation",
+			err:  fields.Err(),
+			want: Problem{
+				Type:   "urn:x-api:problem:validation_failed",
+				Title:  "Unprocessable Entity",
+				Status: http.StatusUnprocessableEntity,
+				Detail: "one or more fields are invalid",
+				Code:   CodeValidation,
+				Errors: map[string]string{"email": "must be a valid email address"},
+			},
+		},
+		{
+			name: "bad request",
+			err:  BadRequest(errors.New("unexpected EOF")),
+			want: Problem{Type: "urn:x-api:problem:bad_request", Title: "Bad Request", Status: http.StatusBadRequest, Detail: "unexpected EOF", Code: CodeBadRequest},
+		},
+		{
+			name: "rate limited",
+			err:  ErrRateLimited,
+			want: Problem{Type: "urn:x-api:problem:rate_limited", Title: "Too Many Requests", Status: http.StatusTooManyRequests, Code: CodeRateLimited},
+		},
+		{
+			name: "internal details are not disclosed",
+			err:  &Error{Code: CodeInternal, Detail: "password of db is hunter2"},
+			want: Problem{Type: "urn:x-api:problem:internal_error", Title: "Internal Server Error", Status: http.StatusInternalServerError, Code: CodeInternal},
+		},
+		{
+			name: "other errors are internal",
+			err:  errors.New("dial tcp: connection refused"),
+			want: Problem{Type: "urn:x-api:problem:internal_error", Title: "Internal Server Error", Status: http.StatusInternalServerError, Code: CodeInternal},
+		},
+		{
+			name: "unknown code",
+			err:  New("teapot", "short and stout"),
+			want: Problem{Type: "urn:x-api:problem:teapot", Title: "Internal Server Error", Status: http.StatusInternalServerError, Code: "teapot"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := From(tt.err); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("From() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestErrorIs(t *testing.T) {
+	tests := []struct {
+		err    error
+		target error
+		want   bool
+	}{
+		{New(CodeNotFound, "user not found"), ErrNotFound, true},
+		{fmt.Errorf("wrapped: %w", New(CodeNotFound, "")), ErrNotFound, true},
+		{New(CodeNotFound, "user not found"), ErrConflict, false},
+		{Wrap(CodeConflict, context.Canceled), context.Canceled, true},
+		{errors.New("not found"), ErrNotFound, false},
+	}
+
+	for _, tt := range tests {
+		if got := errors.Is(tt.err, tt.target); got != tt.want {
+			t.Errorf("errors.Is(%v, %v) = %v, want %v", tt.err, tt.target, got, tt.want)
+		}
+	}
+}
+
+func TestFieldsErr(t *testing.T) {
+	if err := (Fields{}).Err(); err != nil {
+		t.Errorf("Err() of no fields = %v, want nil", err)
+	}
+}
+
+func TestWrite(t *testing.T) {
+	rw := httptest.NewRecorder()
+	r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+
+	Write(context.Background(), nil, rw, r, New(CodeNotFound, "user not found"))
+
+	if rw.Code != http.StatusNotFound {
+		t.Errorf("status = %d, want %d", rw.Code, http.StatusNotFound)
+	}
+
+	if ct := rw.Header().Get("Content-Type"); ct != ContentType {
+		t.Errorf("Content-Type = %q, want %q", ct, ContentType)
+	}
+
+	var p Problem
+	if err := json.NewDecoder(rw.Body).Decode(&p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Instance != "/users/1" || p.Code != CodeNotFound || p.Detail != "user not found" {
+		t.Errorf("Write() wrote %+v", p)
+	}
+}
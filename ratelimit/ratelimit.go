@@ -0,0 +1,126 @@
+// Package ratelimit limits how often a key may do something.
+//
+// Limiters implement the generic cell rate algorithm, a token bucket that
+// only stores the time at which the bucket will be full again. A limit of n
+// requests per period admits bursts of n requests and refills at a steady
+// n per period.
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Limit allows Requests per Period.
+type Limit struct {
+	Requests int
+	Period   time.Duration
+}
+
+func (l Limit) Validate() error {
+	if l.Requests <= 0 || l.Period <= 0 {
+		return errors.New("ratelimit: requests and period must be positive")
+	}
+
+	return nil
+}
+
+// interval is the time it takes to refill one request.
+func (l Limit) interval() time.Duration {
+	return l.Period / time.Duration(l.Requests)
+}
+
+// Result is the decision on a request. Reset is the time until the bucket
+// is full again and RetryAfter, for rejected requests, the time until the
+// next request is admitted.
+type Result struct {
+	Allowed    bool
+	Limit      int
+	Remaining  int
+	Reset      time.Duration
+	RetryAfter time.Duration
+}
+
+type Limiter interface {
+	// Allow takes a request from the bucket of key.
+	Allow(ctx context.Context, key string, l Limit) (*Result, error)
+}
+
+// NewResult builds the result of a decision from the time until the bucket
+// of l is full again. Limiters that run the algorithm elsewhere use it to
+// report their decisions.
+func NewResult(l Limit, allowed bool, untilFull, retryAfter time.Duration) *Result {
+	r := &Result{
+		Allowed:    allowed,
+		Limit:      l.Requests,
+		Reset:      untilFull,
+		RetryAfter: retryAfter,
+	}
+
+	if allowed {
+		r.Remaining = int((l.Period - untilFull) / l.interval())
+	}
+
+	return r
+}
+
+// sweepInterval is how often Memory drops the buckets that are full again.
+const sweepInterval = time.Minute
+
+// Memory is a Limiter that keeps buckets in process. Limits are per replica.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]time.Time
+	nextSweep time.Time
+	now       func() time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets: make(map[string]time.Time),
+		now:     time.Now,
+	}
+}
+
+func (m *Memory) Allow(_ context.Context, key string, l Limit) (*Result, error) {
+	if err := l.Validate(); err != nil {
+		return nil, err
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	m.sweep(now)
+
+	// tat is the theoretical arrival time: when the bucket is full again.
+	tat, ok := m.buckets[key]
+	if !ok || tat.Before(now) {
+		tat = now
+	}
+
+	next := tat.Add(l.interval())
+	if allowAt := next.Add(-l.Period); now.Before(allowAt) {
+		return NewResult(l, false, tat.Sub(now), allowAt.Sub(now)), nil
+	}
+
+	m.buckets[key] = next
+
+	return NewResult(l, true, next.Sub(now), 0), nil
+}
+
+func (m *Memory) sweep(now time.Time) {
+	if now.Before(m.nextSweep) {
+		return
+	}
+
+	for key, tat := range m.buckets {
+		if !tat.After(now) {
+			delete(m.buckets, key)
+		}
+	}
+
+	m.nextSweep = now.Add(sweepInterval)
+}
@@ -0,0 +1,99 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestLimitValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		limit   Limit
+		wantErr bool
+	}{
+		{name: "valid", limit: Limit{Requests: 10, Period: time.Minute}},
+		{name: "no requests", limit: Limit{Period: time.Minute}, wantErr: true},
+		{name: "negative requests", limit: Limit{Requests: -1, Period: time.Minute}, wantErr: true},
+		{name: "no period", limit: Limit{Requests: 10}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := tt.limit.Validate(); (err != nil) != tt.wantErr {
+				t.Errorf("Validate() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMemoryAllow(t *testing.T) {
+	var (
+		now   = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		m     = NewMemory()
+		limit = Limit{Requests: 3, Period: 3 * time.Second}
+	)
+
+	m.now = func() time.Time { return now }
+
+	steps := []struct {
+		name    string
+		advance time.Duration
+		key     string
+		want    Result
+	}{
+		{name: "first", key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{name: "burst", key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 1, Reset: 2 * time.Second}},
+		{name: "last of the burst", key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{name: "rejected", key: "a", want: Result{Limit: 3, Reset: 3 * time.Second, RetryAfter: time.Second}},
+		{name: "rejected later", advance: 500 * time.Millisecond, key: "a", want: Result{Limit: 3, Reset: 2500 * time.Millisecond, RetryAfter: 500 * time.Millisecond}},
+		{name: "other key", key: "b", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+		{name: "refilled one", advance: 500 * time.Millisecond, key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 0, Reset: 3 * time.Second}},
+		{name: "refilled all", advance: time.Hour, key: "a", want: Result{Allowed: true, Limit: 3, Remaining: 2, Reset: time.Second}},
+	}
+
+	for _, s := range steps {
+		now = now.Add(s.advance)
+
+		got, err := m.Allow(context.Background(), s.key, limit)
+		if err != nil {
+			t.Fatalf("%s: Allow() error = %v", s.name, err)
+		}
+
+		if *got != s.want {
+			t.Errorf("%s: Allow() = %+v, want %+v", s.name, *got, s.want)
+		}
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	var (
+		now   = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+		m     = NewMemory()
+		limit = Limit{Requests: 1, Period: time.Second}
+	)
+
+	m.now = func() time.Time { return now }
+
+	for _, key := range []string{"a", "b", "c"} {
+		if _, err := m.Allow(context.Background(), key, limit); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	now = now.Add(sweepInterval)
+
+	if _, err := m.Allow(context.Background(), "d", limit); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(m.buckets) != 1 {
+		t.Errorf("%d buckets kept after the sweep, want 1", len(m.buckets))
+	}
+}
+
+func TestMemoryAllowInvalidLimit(t *testing.T) {
+	if _, err := NewMemory().Allow(context.Background(), "a", Limit{}); err == nil {
+		t.Error("Allow() with an invalid limit succeeded, want an error")
+	}
+}
@@ -0,0 +1,73 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/edalmi/x-api/ratelimit"
+	"github.com/redis/go-redis/v9"
+)
+
+// allow runs the algorithm of ratelimit.Memory atomically, on the clock of
+// the Redis server so that replicas agree on the time. Times are in
+// microseconds. It returns whether the request is allowed, the time until
+// the bucket is full again and the time until a request is allowed.
+var allow = redis.NewScript(`
+local period = tonumber(ARGV[1])
+local interval = tonumber(ARGV[2])
+
+local clock = redis.call("TIME")
+local now = tonumber(clock[1]) * 1000000 + tonumber(clock[2])
+
+local tat = tonumber(redis.call("GET", KEYS[1]))
+if tat == nil or tat < now then
+	tat = now
+end
+
+local new_tat = tat + interval
+local allow_at = new_tat - period
+if now < allow_at then
+	return {0, tat - now, allow_at - now}
+end
+
+redis.call("SET", KEYS[1], new_tat, "PX", math.ceil((new_tat - now) / 1000))
+
+return {1, new_tat - now, 0}
+`)
+
+// Limiter is a ratelimit.Limiter whose buckets are shared by every replica
+// using the same Redis server.
+type Limiter struct {
+	client *redis.Client
+}
+
+func New(client *redis.Client) *Limiter {
+	return &Limiter{
+		client: client,
+	}
+}
+
+func (l *Limiter) Allow(ctx context.Context, key string, limit ratelimit.Limit) (*ratelimit.Result, error) {
+	if err := limit.Validate(); err != nil {
+		return nil, err
+	}
+
+	interval := limit.Period / time.Duration(limit.Requests)
+
+	res, err := allow.Run(ctx, l.client, []string{key}, limit.Period.Microseconds(), interval.Microseconds()).Int64Slice()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(res) != 3 {
+		return nil, fmt.Errorf("ratelimit: unexpected script result %v", res)
+	}
+
+	return ratelimit.NewResult(
+		limit,
+		res[0] == 1,
+		time.Duration(res[1])*time.Microsecond,
+		time.Duration(res[2])*time.Microsecond,
+	), nil
+}
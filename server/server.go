@@ -11,14 +11,22 @@ import (
 	"runtime"
 	"time"
 
+	"github.com/edalmi/x-api/audit"
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/authz"
 	"github.com/edalmi/x-api/caching"
 	"github.com/edalmi/x-api/config"
 	"github.com/edalmi/x-api/database"
 	"github.com/edalmi/x-api/handler"
+	"github.com/edalmi/x-api/handler/middleware"
 	"github.com/edalmi/x-api/logging"
 	stdlog "github.com/edalmi/x-api/logging/log"
+	"github.com/edalmi/x-api/password"
+	"github.com/edalmi/x-api/problem"
 	"github.com/edalmi/x-api/pubsub"
 	"github.com/edalmi/x-api/queue"
+	"github.com/edalmi/x-api/ratelimit"
+	"github.com/edalmi/x-api/session"
 	"github.com/go-chi/chi/v5"
 	prom "github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
@@ -50,6 +58,18 @@ func New(cfg *config.Config) (*Server, error) {
 		return nil, err
 	}
 
+	if err := srv.setupPassword(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.setupAudit(); err != nil {
+		return nil, err
+	}
+
+	if err := srv.setupRecoverer(); err != nil {
+		return nil, err
+	}
+
 	if err := srv.setupAdminServer(); err != nil {
 		return nil, err
 	}
@@ -77,9 +97,33 @@ func (s *Server) setupPrometheus() error {
 	s.logger.Info("setting up metrics provider")
 	s.prometheus = prom.NewRegistry()
 
+	opts := middleware.HTTPMetricsOptions{
+		Namespace:  s.namespace(),
+		Registerer: s.prometheus,
+	}
+
+	if cfg := s.config.Prometheus; cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		opts.DurationBuckets, opts.SizeBuckets = cfg.DurationBuckets, cfg.SizeBuckets
+	}
+
+	s.httpMetrics = middleware.NewHTTPMetrics(opts)
+
 	return nil
 }
 
+// namespace returns the namespace of the metrics of the server.
+func (s *Server) namespace() string {
+	if cfg := s.config.Prometheus; cfg != nil && cfg.Namespace != "" {
+		return cfg.Namespace
+	}
+
+	return s.id
+}
+
 func (s *Server) setupLogger() error {
 	logger, err := setupLogger(s.config.Mode, s.config.Logger)
 	if err != nil {
@@ -102,6 +146,35 @@ func (s *Server) setupDB() error {
 	return nil
 }
 
+func (s *Server) setupPassword() error {
+	hasher, policy, err := setupPassword(s.config.Password)
+	if err != nil {
+		return err
+	}
+
+	s.passwordHasher = hasher
+	s.passwordPolicy = policy
+	return nil
+}
+
+// setupAudit records audit entries in the database, where the admin server
+// serves them.
+func (s *Server) setupAudit() error {
+	s.auditRecorder = handler.NewAuditService(s.db)
+
+	return nil
+}
+
+func (s *Server) setupRecoverer() error {
+	s.recoverer = middleware.NewRecoverer(middleware.RecovererOptions{
+		Namespace:  s.namespace(),
+		Registerer: s.prometheus,
+		Logger:     s.logger,
+	})
+
+	return nil
+}
+
 func (s *Server) setupOtel() error {
 	t, err := setupOtel()
 	if err != nil {
@@ -131,7 +204,12 @@ func (s *Server) setupHealthzServer() error {
 	router := chi.NewRouter()
 	router.Mount("/healthz", handler.Routes())
 
-	srv, err := setupHTTPServer(s.config.Serve.Healthz, router)
+	h, err := s.withAuth("healthz", s.config.Serve.Healthz, router)
+	if err != nil {
+		return err
+	}
+
+	srv, err := s.setupHTTPServer("healthz", s.config.Serve.Healthz, h)
 	if err != nil {
 		return err
 	}
@@ -149,7 +227,12 @@ func (s *Server) setupMetrcisServer() error {
 		},
 	)
 
-	srv, err := setupHTTPServer(s.config.Serve.Metrics, handler)
+	h, err := s.withAuth("metrics", s.config.Serve.Metrics, handler)
+	if err != nil {
+		return err
+	}
+
+	srv, err := s.setupHTTPServer("metrics", s.config.Serve.Metrics, h)
 	if err != nil {
 		return err
 	}
@@ -160,17 +243,158 @@ func (s *Server) setupMetrcisServer() error {
 }
 
 func (s *Server) setupPublicServer() error {
+	authenticators, err := s.authenticators("public", s.config.Serve.Public.Auth)
+	if err != nil {
+		return err
+	}
+
+	if cfg := s.config.Serve.Public.Sessions; cfg != nil {
+		if s.sessions, err = setupSessions(cfg, s.cache); err != nil {
+			return err
+		}
+	}
+
+	// Routes are authorized whether or not requests are authenticated, so
+	// that without authentication they refuse every request rather than
+	// let anyone do anything.
+	s.authorizer = authz.New(authz.Options{
+		Roles:    s.config.RBAC.Roles,
+		Resolver: database.NewGroupRepository(s.db),
+		Cache:    s.cache,
+		CacheTTL: s.config.RBAC.CacheTTL,
+		Logger:   s.logger,
+	})
+
+	authenticated := len(authenticators) > 0 || s.sessions != nil
+	if !authenticated {
+		s.logger.Warn("public server has no authentication configured, so its users and groups routes refuse every request")
+	}
+
+	if cfg := s.config.Serve.Public.ResponseCache; cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		s.responseCache = middleware.NewResponseCache(middleware.ResponseCacheOptions{
+			Cache:      s.cache,
+			TTL:        cfg.TTL,
+			Namespace:  s.namespace(),
+			Registerer: s.prometheus,
+			Logger:     s.logger,
+		})
+	}
+
 	var (
 		usersHandler  = handler.NewUserHandler(s)
 		groupsHandler = handler.NewGroupHandler(s)
 	)
 
 	router := chi.NewRouter()
+	router.NotFound(func(rw http.ResponseWriter, r *http.Request) {
+		problem.Write(r.Context(), s.logger, rw, r, problem.ErrNotFound)
+	})
+	router.MethodNotAllowed(func(rw http.ResponseWriter, r *http.Request) {
+		problem.Write(r.Context(), s.logger, rw, r, problem.ErrMethodNotAllowed)
+	})
+
+	router.Use(middleware.AuditRequest)
+
+	if s.sessions != nil {
+		// Origins that CORS lets send credentials may also make unsafe
+		// requests with the session cookie.
+		var allowOrigin func(string) bool
+
+		if cfg := s.config.Serve.Public.CORS; cfg != nil && cfg.AllowCredentials {
+			opts, err := setupCORS(cfg)
+			if err != nil {
+				return err
+			}
+
+			allowOrigin = middleware.OriginMatcher(opts)
+		}
+
+		router.Use(middleware.Session(s.sessions, allowOrigin, s.logger))
+	}
+
+	// The rate limit runs after authentication, so that authenticated
+	// requests count against their principal. Requests are limited by
+	// client IP before authentication too, when configured, so that
+	// failing to authenticate is throttled as well.
+	rateLimit := func(next http.Handler) http.Handler {
+		return next
+	}
+	authLimit := rateLimit
+
+	if cfg := s.config.Serve.Public.RateLimit; cfg != nil {
+		opts, err := setupRateLimit(cfg, s.cache)
+		if err != nil {
+			return err
+		}
+
+		opts.Namespace, opts.Registerer, opts.Logger = s.namespace(), s.prometheus, s.logger
+		rateLimit = middleware.RateLimit(opts)
 
-	router.Mount("/users", usersHandler.Routes())
-	router.Mount("/groups", groupsHandler.Routes())
+		if a := cfg.Authentication; a != nil {
+			authLimit = middleware.RateLimitAuthentication(opts, ratelimit.Limit{Requests: a.Requests, Period: a.Period})
+		}
+	}
+
+	var idempotency func(http.Handler) http.Handler
+	if cfg := s.config.Serve.Public.Idempotency; cfg != nil {
+		if err := cfg.Validate(); err != nil {
+			return err
+		}
+
+		idempotency = middleware.Idempotency(middleware.IdempotencyOptions{
+			Cache:       s.cache,
+			TTL:         cfg.TTL,
+			LockTimeout: cfg.LockTimeout,
+			Logger:      s.logger,
+		})
+	}
+
+	var oauthHandler *handler.OAuthHandler
+	if cfg := s.config.Serve.Public.Auth; cfg != nil && cfg.OAuth != nil {
+		if oauthHandler, err = s.oauthHandler(cfg); err != nil {
+			return err
+		}
+	}
+
+	router.Group(func(r chi.Router) {
+		r.Use(rateLimit)
+
+		if s.sessions != nil {
+			r.Mount("/session", handler.NewSessionHandler(s).Routes())
+		}
+
+		if oauthHandler != nil {
+			r.Mount("/oauth", oauthHandler.Routes())
+		}
+	})
+
+	router.Group(func(r chi.Router) {
+		if authenticated {
+			r.Use(authLimit, middleware.Authenticate(s.logger, authenticators...))
+		}
+
+		r.Use(rateLimit)
 
-	srv, err := setupHTTPServer(s.config.Serve.Public, router)
+		// Imports stream bodies larger than idempotency buffers to
+		// fingerprint them, so they are left out of it.
+		r.With(handler.Authorize(s, "users:write")).Post("/users:import", usersHandler.ImportUsers)
+
+		r.Group(func(r chi.Router) {
+			if idempotency != nil {
+				r.Use(idempotency)
+			}
+
+			r.Mount("/users", usersHandler.Routes())
+			r.With(handler.Authorize(s, "users:read")).Get("/users:export", usersHandler.ExportUsers)
+			r.Mount("/groups", groupsHandler.Routes())
+		})
+	})
+
+	srv, err := s.setupHTTPServer("public", s.config.Serve.Public, router)
 	if err != nil {
 		return err
 	}
@@ -180,9 +404,95 @@ func (s *Server) setupPublicServer() error {
 	return nil
 }
 
+// oauthHandler returns the handler of the OAuth token endpoint, which
+// issues tokens the JWT authenticator of cfg accepts.
+func (s *Server) oauthHandler(cfg *config.Auth) (*handler.OAuthHandler, error) {
+	signer, err := setupTokenSigner(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// Introspection checks for revoked clients itself.
+	verifier, err := setupJWT(cfg.JWT, cfg.OAuth, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	service := handler.NewOAuthService(s.db, s.cache, signer, verifier, cfg.OAuth.TokenTTL, s.logger)
+
+	return handler.NewOAuthHandler(s, service), nil
+}
+
+// authenticators returns the authenticators configured for a server.
+// Without any, the server accepts anonymous requests.
+func (s *Server) authenticators(name string, cfg *config.Auth) ([]auth.Authenticator, error) {
+	if cfg == nil {
+		s.logger.Info(name + " server has no authentication configured")
+		return nil, nil
+	}
+
+	var authenticators []auth.Authenticator
+
+	if cfg.JWT != nil {
+		var clients auth.ClientResolver
+		if cfg.OAuth != nil {
+			clients = handler.NewOAuthService(s.db, s.cache, nil, nil, cfg.OAuth.TokenTTL, s.logger)
+		}
+
+		verifier, err := setupJWT(cfg.JWT, cfg.OAuth, clients)
+		if err != nil {
+			return nil, err
+		}
+
+		authenticators = append(authenticators, verifier)
+	}
+
+	if cfg.Basic != nil {
+		basic, err := setupBasicAuth(cfg.Basic)
+		if err != nil {
+			return nil, err
+		}
+
+		authenticators = append(authenticators, basic)
+	}
+
+	if cfg.APIKeys != nil {
+		authenticators = append(authenticators, handler.NewAPIKeyService(s.db, s.cache, cfg.APIKeys.CacheTTL, s.logger))
+	}
+
+	return authenticators, nil
+}
+
+// withAuth requires the requests to h to be authenticated when the server
+// has authentication configured.
+func (s *Server) withAuth(name string, cfg *config.Server, h http.Handler) (http.Handler, error) {
+	authenticators, err := s.authenticators(name, cfg.Auth)
+	if err != nil || len(authenticators) == 0 {
+		return h, err
+	}
+
+	return middleware.Authenticate(s.logger, authenticators...)(h), nil
+}
+
 func (s *Server) setupAdminServer() error {
-	router := http.NewServeMux()
-	srv, err := setupHTTPServer(s.config.Serve.Admin, router)
+	router := chi.NewRouter()
+	router.NotFound(func(rw http.ResponseWriter, r *http.Request) {
+		problem.Write(r.Context(), s.logger, rw, r, problem.ErrNotFound)
+	})
+	router.MethodNotAllowed(func(rw http.ResponseWriter, r *http.Request) {
+		problem.Write(r.Context(), s.logger, rw, r, problem.ErrMethodNotAllowed)
+	})
+
+	router.Mount("/api-keys", handler.NewAPIKeyHandler(s).Routes())
+	router.Mount("/oauth-clients", handler.NewOAuthClientHandler(s).Routes())
+	router.Mount("/audit", handler.NewAuditHandler(s).Routes())
+
+	h, err := s.withAuth("admin", s.config.Serve.Admin, router)
+	if err != nil {
+		return err
+	}
+
+	srv, err := s.setupHTTPServer("admin", s.config.Serve.Admin, h)
 	if err != nil {
 		return err
 	}
@@ -202,6 +512,15 @@ type Server struct {
 	pubsub     pubsub.Pubsub
 	queue      queue.Queue
 	prometheus prom.Registerer
+
+	passwordHasher *password.Hasher
+	passwordPolicy password.Policy
+	authorizer     *authz.Authorizer
+	auditRecorder  audit.Recorder
+	sessions       *session.Store
+	responseCache  *middleware.ResponseCache
+	httpMetrics    *middleware.HTTPMetrics
+	recoverer      *middleware.Recoverer
 	httpServers
 }
 
@@ -240,6 +559,30 @@ func (s Server) DB() *database.DB {
 	return s.db
 }
 
+func (s Server) PasswordHasher() *password.Hasher {
+	return s.passwordHasher
+}
+
+func (s Server) PasswordPolicy() password.Policy {
+	return s.passwordPolicy
+}
+
+func (s Server) Authorizer() *authz.Authorizer {
+	return s.authorizer
+}
+
+func (s Server) AuditRecorder() audit.Recorder {
+	return s.auditRecorder
+}
+
+func (s Server) Sessions() *session.Store {
+	return s.sessions
+}
+
+func (s Server) ResponseCache() *middleware.ResponseCache {
+	return s.responseCache
+}
+
 func (s Server) Prometheus() prom.Registerer {
 	return s.prometheus
 }
@@ -0,0 +1,224 @@
+package server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/database/sqlite"
+	stdlog "github.com/edalmi/x-api/logging/log"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// memoryCache is an in-memory caching.Cache that ignores expiry.
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.values[key]
+	if !ok {
+		return "", caching.ErrMiss
+	}
+
+	return v, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+
+	return nil
+}
+
+func (c *memoryCache) Add(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+
+	c.values[key] = value
+
+	return true, nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+// newTestPublicServer returns the handler of a public server with public as
+// its configuration, a migrated SQLite database and an in-memory cache.
+// Requests authenticate as the operator root, with the password secret.
+func newTestPublicServer(t *testing.T, public *config.Server) http.Handler {
+	t.Helper()
+
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	public.Auth = &config.Auth{Basic: &config.Basic{Users: []string{"root:" + string(hash)}}}
+
+	cfg := config.DefaultConfig()
+	cfg.App = "xapi"
+	cfg.Serve.Public = public
+	cfg.Password.Algorithm = "bcrypt"
+	cfg.Password.Bcrypt.Cost = bcrypt.MinCost
+
+	s := &Server{
+		id:     cfg.App,
+		config: &cfg,
+		logger: stdlog.New(log.New(io.Discard, "", 0)),
+		cache:  &memoryCache{values: make(map[string]string)},
+	}
+
+	db, err := sqlite.New(filepath.Join(t.TempDir(), "x-api.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob("../database/sqlite/migrations/*.up.sql")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(files)
+
+	for _, f := range files {
+		b, err := os.ReadFile(f)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if _, err := db.Exec(string(b)); len(b) > 0 && err != nil {
+			t.Fatalf("%s: %v", f, err)
+		}
+	}
+
+	s.db = db
+
+	for _, setup := range []func() error{s.setupPrometheus, s.setupPassword, s.setupAudit, s.setupRecoverer, s.setupPublicServer} {
+		if err := setup(); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return s.publicServer.Handler
+}
+
+func serve(h http.Handler, r *http.Request) *httptest.ResponseRecorder {
+	rw := httptest.NewRecorder()
+	h.ServeHTTP(rw, r)
+
+	return rw
+}
+
+func TestPublicServerImportIsNotIdempotent(t *testing.T) {
+	h := newTestPublicServer(t, &config.Server{Idempotency: &config.Idempotency{}})
+
+	// The body is larger than the idempotency middleware buffers.
+	var body strings.Builder
+	lines := 0
+
+	for body.Len() <= 1<<20 {
+		fmt.Fprintf(&body, `{"email":"user%d@example.com","name":"User %d"}`+"\n", lines, lines)
+		lines++
+	}
+
+	r := httptest.NewRequest(http.MethodPost, "/users:import?dry_run=true", strings.NewReader(body.String()))
+	r.SetBasicAuth("root", "secret")
+	r.Header.Set("Content-Type", "application/x-ndjson")
+	r.Header.Set("Idempotency-Key", "import")
+
+	rw := serve(h, r)
+	if rw.Code != http.StatusOK {
+		t.Fatalf("status = %d, want %d, body = %.200s", rw.Code, http.StatusOK, rw.Body)
+	}
+
+	var report struct {
+		Lines   int `json:"lines"`
+		Created int `json:"created"`
+	}
+	if err := json.Unmarshal(rw.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+
+	if report.Lines != lines || report.Created != lines {
+		t.Errorf("report = %+v, want %d lines created", report, lines)
+	}
+
+	// Other routes are still idempotent.
+	create := func() *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodPost, "/users", strings.NewReader(`{"email":"ada@example.com","name":"Ada"}`))
+		r.SetBasicAuth("root", "secret")
+		r.Header.Set("Content-Type", "application/json")
+		r.Header.Set("Idempotency-Key", "create")
+
+		return serve(h, r)
+	}
+
+	if rw := create(); rw.Code != http.StatusCreated {
+		t.Fatalf("status = %d, want %d, body = %s", rw.Code, http.StatusCreated, rw.Body)
+	}
+
+	if rw := create(); rw.Code != http.StatusCreated || rw.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry: status = %d, Idempotent-Replayed = %q, want the replayed 201", rw.Code, rw.Header().Get("Idempotent-Replayed"))
+	}
+}
+
+func TestPublicServerThrottlesFailedAuthentication(t *testing.T) {
+	h := newTestPublicServer(t, &config.Server{RateLimit: &config.RateLimit{
+		Requests:       100,
+		Period:         time.Minute,
+		Authentication: &config.RateLimitAuthentication{Requests: 3, Period: time.Minute},
+	}})
+
+	request := func(password string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(http.MethodGet, "/users", nil)
+		r.SetBasicAuth("root", password)
+
+		return serve(h, r)
+	}
+
+	for i := 0; i < 3; i++ {
+		if rw := request("guess"); rw.Code != http.StatusUnauthorized {
+			t.Fatalf("request %d: status = %d, want %d", i, rw.Code, http.StatusUnauthorized)
+		}
+	}
+
+	// Once throttled, not even valid credentials are checked.
+	for _, password := range []string{"guess", "secret"} {
+		rw := request(password)
+		if rw.Code != http.StatusTooManyRequests || rw.Header().Get("Retry-After") == "" {
+			t.Errorf("password %q: status = %d, want %d with Retry-After", password, rw.Code, http.StatusTooManyRequests)
+		}
+	}
+}
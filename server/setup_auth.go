@@ -0,0 +1,174 @@
+package server
+
+import (
+	"crypto"
+	"fmt"
+	"os"
+
+	"github.com/edalmi/x-api/auth"
+	"github.com/edalmi/x-api/config"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func setupBasicAuth(cfg *config.Basic) (*auth.BasicAuthenticator, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	entries := cfg.Users
+
+	if cfg.HtpasswdFile != "" {
+		f, err := os.Open(cfg.HtpasswdFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+
+		fromFile, err := auth.ReadHtpasswd(f)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, fromFile...)
+	}
+
+	return auth.NewBasicAuthenticator(entries)
+}
+
+// setupJWT returns the verifier of the bearer tokens of cfg. With oauth, it
+// also verifies the tokens of the token endpoint, and resolver, which may
+// be nil, tells which of their clients were revoked.
+func setupJWT(cfg *config.JWT, oauth *config.OAuth, resolver auth.ClientResolver) (*auth.JWTVerifier, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	keys := make([]auth.Key, 0, len(cfg.Keys))
+
+	for _, k := range cfg.Keys {
+		key, err := verificationKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, key)
+	}
+
+	if cfg.JWKSFile != "" {
+		b, err := os.ReadFile(cfg.JWKSFile)
+		if err != nil {
+			return nil, err
+		}
+
+		set, err := auth.ParseJWKS(b)
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, set...)
+	}
+
+	opts := auth.JWTOptions{
+		Keys:     keys,
+		Issuer:   cfg.Issuer,
+		Audience: cfg.Audience,
+		Leeway:   cfg.Leeway,
+	}
+
+	if oauth != nil {
+		if err := oauth.Validate(cfg); err != nil {
+			return nil, err
+		}
+
+		key, err := verificationKey(oauth.Key)
+		if err != nil {
+			return nil, err
+		}
+
+		opts.Clients = &auth.ClientTokens{Key: key, Issuer: oauth.Issuer, Resolver: resolver}
+	}
+
+	return auth.NewJWTVerifier(opts)
+}
+
+// verificationKey reads the key tokens are verified with.
+func verificationKey(k config.JWTKey) (auth.Key, error) {
+	key := auth.Key{ID: k.ID, Algorithm: k.Algorithm}
+
+	if k.Algorithm == auth.HS256 {
+		key.Key = []byte(k.Secret)
+		return key, nil
+	}
+
+	if k.PublicKeyFile == "" {
+		private, err := readPrivateKey(k)
+		if err != nil {
+			return key, err
+		}
+
+		key.Key = private.Public()
+
+		return key, nil
+	}
+
+	pem, err := os.ReadFile(k.PublicKeyFile)
+	if err != nil {
+		return key, err
+	}
+
+	if k.Algorithm == auth.RS256 {
+		key.Key, err = jwt.ParseRSAPublicKeyFromPEM(pem)
+	} else {
+		key.Key, err = jwt.ParseECPublicKeyFromPEM(pem)
+	}
+
+	if err != nil {
+		return key, fmt.Errorf("jwt key %s: %w", k.PublicKeyFile, err)
+	}
+
+	return key, nil
+}
+
+// setupTokenSigner returns the signer of the OAuth token endpoint, which
+// signs with the dedicated key and issuer of the OAuth configuration.
+func setupTokenSigner(cfg *config.Auth) (*auth.JWTSigner, error) {
+	if err := cfg.OAuth.Validate(cfg.JWT); err != nil {
+		return nil, err
+	}
+
+	k := cfg.OAuth.Key
+	key := auth.Key{ID: k.ID, Algorithm: k.Algorithm}
+
+	if k.Algorithm == auth.HS256 {
+		key.Key = []byte(k.Secret)
+	} else {
+		private, err := readPrivateKey(k)
+		if err != nil {
+			return nil, err
+		}
+
+		key.Key = private
+	}
+
+	return auth.NewJWTSigner(key, cfg.OAuth.Issuer, cfg.JWT.Audience)
+}
+
+func readPrivateKey(k config.JWTKey) (crypto.Signer, error) {
+	pem, err := os.ReadFile(k.PrivateKeyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var key crypto.Signer
+	if k.Algorithm == auth.RS256 {
+		key, err = jwt.ParseRSAPrivateKeyFromPEM(pem)
+	} else {
+		key, err = jwt.ParseECPrivateKeyFromPEM(pem)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("jwt key %s: %w", k.PrivateKeyFile, err)
+	}
+
+	return key, nil
+}
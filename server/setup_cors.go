@@ -0,0 +1,43 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/handler/middleware"
+)
+
+// setupCORS returns the CORS policy of cfg.
+func setupCORS(cfg *config.CORS) (middleware.CORSOptions, error) {
+	opts := middleware.CORSOptions{
+		Headers:        cfg.AllowedHeaders,
+		ExposedHeaders: cfg.ExposedHeaders,
+		Credentials:    cfg.AllowCredentials,
+		MaxAge:         cfg.MaxAge,
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return opts, err
+	}
+
+	for _, origin := range cfg.AllowedOrigins {
+		if !strings.HasPrefix(origin, "^") {
+			opts.Origins = append(opts.Origins, origin)
+			continue
+		}
+
+		re, err := regexp.Compile(origin)
+		if err != nil {
+			return opts, err
+		}
+
+		opts.OriginPatterns = append(opts.OriginPatterns, re)
+	}
+
+	for _, method := range cfg.AllowedMethods {
+		opts.Methods = append(opts.Methods, strings.ToUpper(method))
+	}
+
+	return opts, nil
+}
@@ -13,20 +13,34 @@ import (
 
 func setupDB(cfg *config.DB) (*database.DB, error) {
 	if cfg.Postgres != nil {
-		return postgres.New(cfg.Postgres.GetDSN())
+		db, err := postgres.New(cfg.Postgres.GetDSN())
+		return withBatchSize(db, err, cfg.Postgres.BatchSize)
 	}
 
 	if cfg.SQLite != nil {
-		return sqlite.New(cfg.SQLite.GetDSN())
+		db, err := sqlite.New(cfg.SQLite.GetDSN())
+		return withBatchSize(db, err, cfg.SQLite.BatchSize)
 	}
 
 	if cfg.MySQL != nil {
-		return mysql.New(cfg.MySQL.GetDSN())
+		db, err := mysql.New(cfg.MySQL.GetDSN())
+		return withBatchSize(db, err, cfg.MySQL.BatchSize)
 	}
 
 	if cfg.MariaDB != nil {
-		return mariadb.New(cfg.MariaDB.GetDSN())
+		db, err := mariadb.New(cfg.MariaDB.GetDSN())
+		return withBatchSize(db, err, cfg.MariaDB.BatchSize)
 	}
 
 	return nil, errors.New("no database configuration found")
 }
+
+func withBatchSize(db *database.DB, err error, size int) (*database.DB, error) {
+	if err != nil {
+		return nil, err
+	}
+
+	db.BatchSize = size
+
+	return db, nil
+}
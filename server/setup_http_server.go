@@ -7,13 +7,49 @@ import (
 	"time"
 
 	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/handler/middleware"
 )
 
-func setupHTTPServer(cfg *config.Server, handler http.Handler) (*httpServer, error) {
+// setupHTTPServer returns the server called name of handler. Every request it
+// serves is traced, given an ID, logged when cfg has an access log, and
+// recorded in the HTTP metrics; panics of handler become 500 responses. CORS
+// runs before handler, so that preflight requests are answered before they
+// reach its authentication and routes.
+func (s *Server) setupHTTPServer(name string, cfg *config.Server, handler http.Handler) (*httpServer, error) {
+	if cfg.CORS != nil {
+		opts, err := setupCORS(cfg.CORS)
+		if err != nil {
+			return nil, err
+		}
+
+		handler = middleware.CORS(opts)(handler)
+	}
+
+	handler = s.recoverer.Handler(name, cfg.StackTraces && s.config.Mode == config.ModeDev)(handler)
+	handler = s.httpMetrics.Handler(name)(handler)
+
+	if al := cfg.AccessLog; al != nil {
+		if err := al.Validate(); err != nil {
+			return nil, err
+		}
+
+		rate := al.SampleRate
+		if rate == 0 {
+			rate = 1
+		}
+
+		handler = middleware.AccessLog(middleware.AccessLogOptions{
+			Logger:     s.logger,
+			SampleRate: rate,
+			Exclude:    al.Exclude,
+		})(handler)
+	}
+
 	srv := &httpServer{
+		name: name,
 		Server: &http.Server{
 			Addr:         fmt.Sprintf("%s:%d", cfg.Host, cfg.Port),
-			Handler:      handler,
+			Handler:      middleware.Trace(s.id)(middleware.RequestID(handler)),
 			ReadTimeout:  time.Duration(cfg.ReadTimeout),
 			WriteTimeout: time.Duration(cfg.WriteTimeout),
 		},
@@ -1,7 +1,12 @@
 package server
 
 import (
+	"context"
+
+	"github.com/edalmi/x-api/handler/middleware"
+	"go.opentelemetry.io/otel"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
@@ -13,6 +18,7 @@ func setupOtel() (*sdktrace.TracerProvider, error) {
 		return nil, err
 	}
 	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSpanProcessor(requestIDProcessor{}),
 		sdktrace.WithBatcher(exp),
 		sdktrace.WithResource(resource.NewWithAttributes(
 			semconv.SchemaURL,
@@ -20,5 +26,26 @@ func setupOtel() (*sdktrace.TracerProvider, error) {
 			semconv.DeploymentEnvironmentKey.String("production"),
 		)),
 	)
+
+	// Traces are continued from and, by clients, propagated in the W3C
+	// traceparent, tracestate and baggage headers.
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+
 	return tp, nil
 }
+
+// requestIDProcessor sets the request ID on every span started while
+// serving a request, so that the spans of a request can be found by it.
+type requestIDProcessor struct{}
+
+func (requestIDProcessor) OnStart(parent context.Context, s sdktrace.ReadWriteSpan) {
+	if id, ok := middleware.RequestIDFromContext(parent); ok {
+		s.SetAttributes(middleware.RequestIDAttribute.String(id))
+	}
+}
+
+func (requestIDProcessor) OnEnd(sdktrace.ReadOnlySpan) {}
+
+func (requestIDProcessor) Shutdown(context.Context) error { return nil }
+
+func (requestIDProcessor) ForceFlush(context.Context) error { return nil }
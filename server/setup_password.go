@@ -0,0 +1,49 @@
+package server
+
+import (
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/password"
+)
+
+func setupPassword(cfg *config.Password) (*password.Hasher, password.Policy, error) {
+	if cfg == nil {
+		hasher, err := password.NewHasher(password.DefaultParams)
+		return hasher, password.DefaultPolicy, err
+	}
+
+	params := password.DefaultParams
+	params.Algorithm = password.Algorithm(cfg.Algorithm)
+
+	if cfg.Argon2 != nil {
+		params.Argon2 = password.Argon2Params{
+			Memory:      cfg.Argon2.Memory,
+			Iterations:  cfg.Argon2.Iterations,
+			Parallelism: cfg.Argon2.Parallelism,
+			SaltLength:  cfg.Argon2.SaltLength,
+			KeyLength:   cfg.Argon2.KeyLength,
+		}
+	}
+
+	if cfg.Bcrypt != nil {
+		params.BcryptCost = cfg.Bcrypt.Cost
+	}
+
+	policy := password.DefaultPolicy
+	if cfg.Policy != nil {
+		policy = password.Policy{
+			MinLength:     cfg.Policy.MinLength,
+			MaxLength:     cfg.Policy.MaxLength,
+			RequireUpper:  cfg.Policy.RequireUpper,
+			RequireLower:  cfg.Policy.RequireLower,
+			RequireDigit:  cfg.Policy.RequireDigit,
+			RequireSymbol: cfg.Policy.RequireSymbol,
+		}
+	}
+
+	hasher, err := password.NewHasher(params)
+	if err != nil {
+		return nil, policy, err
+	}
+
+	return hasher, policy, nil
+}
@@ -0,0 +1,47 @@
+package server
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/edalmi/x-api/caching"
+	redisprovider "github.com/edalmi/x-api/caching/redis"
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/handler/middleware"
+	"github.com/edalmi/x-api/ratelimit"
+	redislimiter "github.com/edalmi/x-api/ratelimit/redis"
+)
+
+// setupRateLimit returns the limiter and the limits of cfg. The caller sets
+// the metrics and logging options.
+func setupRateLimit(cfg *config.RateLimit, cache caching.Cache) (middleware.RateLimitOptions, error) {
+	var opts middleware.RateLimitOptions
+
+	if err := cfg.Validate(); err != nil {
+		return opts, err
+	}
+
+	opts.Limiter = ratelimit.NewMemory()
+	if cfg.Store == "redis" {
+		rc, ok := cache.(*redisprovider.Cache)
+		if !ok {
+			return opts, errors.New("rate limit store redis requires the redis cache provider")
+		}
+
+		opts.Limiter = redislimiter.New(rc.Client())
+	}
+
+	if cfg.Requests > 0 {
+		opts.Default = &ratelimit.Limit{Requests: cfg.Requests, Period: cfg.Period}
+	}
+
+	for _, r := range cfg.Routes {
+		opts.Routes = append(opts.Routes, middleware.RateLimitRoute{
+			Method: strings.ToUpper(r.Method),
+			Path:   r.Path,
+			Limit:  ratelimit.Limit{Requests: r.Requests, Period: r.Period},
+		})
+	}
+
+	return opts, nil
+}
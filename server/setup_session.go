@@ -0,0 +1,28 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/session"
+)
+
+func setupSessions(cfg *config.Sessions, cache caching.Cache) (*session.Store, error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	sameSite := http.SameSiteLaxMode
+	if cfg.SameSite == "strict" {
+		sameSite = http.SameSiteStrictMode
+	}
+
+	return session.NewStore(cache, session.Options{
+		CookieName:  cfg.CookieName,
+		IdleTimeout: cfg.IdleTimeout,
+		Lifetime:    cfg.Lifetime,
+		Insecure:    cfg.InsecureCookie,
+		SameSite:    sameSite,
+	})
+}
@@ -0,0 +1,116 @@
+package server
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/edalmi/x-api/config"
+	"github.com/edalmi/x-api/database"
+	"github.com/edalmi/x-api/logging"
+	stdlog "github.com/edalmi/x-api/logging/log"
+	"golang.org/x/sync/errgroup"
+)
+
+// NewWorker sets up the providers needed by the background jobs of
+// x-worker.
+func NewWorker(cfg *config.Config) (*Worker, error) {
+	w := &Worker{
+		config: cfg,
+		logger: stdlog.New(log.Default()),
+	}
+
+	logger, err := setupLogger(cfg.Mode, cfg.Logger)
+	if err != nil {
+		return nil, err
+	}
+
+	w.logger = logger
+
+	w.logger.Info("setting up database")
+
+	db, err := setupDB(cfg.DB)
+	if err != nil {
+		return nil, err
+	}
+
+	w.db = db
+
+	return w, nil
+}
+
+type Worker struct {
+	config *config.Config
+	logger logging.Logger
+	db     *database.DB
+}
+
+func (w *Worker) Start(ctx context.Context) error {
+	ctx, stop := signal.NotifyContext(ctx, os.Interrupt)
+	defer stop()
+
+	defer func() {
+		w.logger.Info("Tearing down database provider")
+		if err := release(w.db); err != nil {
+			w.logger.Error(err)
+		}
+
+		w.logger.Info("Tearing down logger provider")
+		if err := release(w.logger); err != nil {
+			w.logger.Error(err)
+		}
+	}()
+
+	g, ctx := errgroup.WithContext(ctx)
+
+	if purge := w.config.Worker.Purge; purge != nil {
+		if err := purge.Validate(); err != nil {
+			return err
+		}
+
+		w.logger.Infof("Scheduling user purge every %v with %v retention", purge.Interval, purge.Retention)
+
+		g.Go(func() error {
+			return w.every(ctx, purge.Interval, func(ctx context.Context) error {
+				return w.purgeUsers(ctx, purge)
+			})
+		})
+	}
+
+	err := g.Wait()
+	w.logger.Info("Shutting down worker")
+
+	return err
+}
+
+// every runs job immediately and then once per interval until ctx is done.
+// Failed runs are logged and retried on the next tick.
+func (w *Worker) every(ctx context.Context, interval time.Duration, job func(context.Context) error) error {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := job(ctx); err != nil && ctx.Err() == nil {
+			w.logger.Error(err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (w *Worker) purgeUsers(ctx context.Context, cfg *config.Purge) error {
+	before := time.Now().UTC().Add(-cfg.Retention)
+
+	n, err := database.NewUserRepository(w.db).Purge(ctx, before, cfg.BatchSize)
+	if n > 0 {
+		w.logger.Infof("Purged %d users deleted before %v", n, before.Format(time.RFC3339))
+	}
+
+	return err
+}
@@ -0,0 +1,365 @@
+// Package session keeps the sessions of browser clients in a cache.
+//
+// Sessions expire after IdleTimeout without use and, regardless of use,
+// Lifetime after they were created. Besides its sessions the cache holds a
+// record per user, whose generation every session must match: replacing it
+// ends every session of the user at once. Losing the record, for example to
+// eviction, ends them too.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/edalmi/x-api/caching"
+	"github.com/edalmi/x-api/json"
+)
+
+var ErrNotFound = errors.New("session: not found")
+
+const (
+	DefaultCookieName  = "xapi_session"
+	DefaultIdleTimeout = 30 * time.Minute
+	DefaultLifetime    = 12 * time.Hour
+
+	// touchResolution limits how often the expiration of a session in
+	// constant use is extended. It is lowered for idle timeouts shorter than
+	// two resolutions.
+	touchResolution = time.Minute
+)
+
+type Options struct {
+	CookieName  string
+	IdleTimeout time.Duration
+	Lifetime    time.Duration
+	// Insecure allows the cookie to be sent over plain HTTP.
+	Insecure bool
+	SameSite http.SameSite
+}
+
+// Session is the state of a session. CreatedAt is kept when the ID is
+// rotated, so that rotation does not extend the lifetime; IssuedAt is when
+// the current ID was issued.
+type Session struct {
+	ID         string    `json:"-"`
+	UserID     string    `json:"user_id"`
+	Generation string    `json:"generation"`
+	CreatedAt  time.Time `json:"created_at"`
+	IssuedAt   time.Time `json:"issued_at"`
+	LastSeenAt time.Time `json:"last_seen_at"`
+
+	// Rotate is set by Get when the privileges of the user changed after the
+	// ID was issued. The session should then be rotated.
+	Rotate bool `json:"-"`
+}
+
+// userState is the record kept per user. Sessions issued before
+// PrivilegedAt must be rotated.
+type userState struct {
+	Generation   string    `json:"generation"`
+	PrivilegedAt time.Time `json:"privileged_at"`
+}
+
+type Store struct {
+	cache      caching.Cache
+	opts       Options
+	touchAfter time.Duration
+}
+
+func NewStore(cache caching.Cache, opts Options) (*Store, error) {
+	if cache == nil {
+		return nil, errors.New("session: a cache is required")
+	}
+
+	if opts.CookieName == "" {
+		opts.CookieName = DefaultCookieName
+	}
+
+	if opts.IdleTimeout <= 0 {
+		opts.IdleTimeout = DefaultIdleTimeout
+	}
+
+	if opts.Lifetime <= 0 {
+		opts.Lifetime = DefaultLifetime
+	}
+
+	if opts.SameSite == 0 {
+		opts.SameSite = http.SameSiteLaxMode
+	}
+
+	touchAfter := touchResolution
+	if half := opts.IdleTimeout / 2; half < touchAfter {
+		touchAfter = half
+	}
+
+	return &Store{cache: cache, opts: opts, touchAfter: touchAfter}, nil
+}
+
+// ExpiresAt returns the time the session expires unless it is used again.
+func (s *Store) ExpiresAt(sess *Session) time.Time {
+	idle := sess.LastSeenAt.Add(s.opts.IdleTimeout)
+	if absolute := sess.CreatedAt.Add(s.opts.Lifetime); absolute.Before(idle) {
+		return absolute
+	}
+
+	return idle
+}
+
+// Create starts a session for a user.
+func (s *Store) Create(ctx context.Context, userID string) (*Session, error) {
+	state, err := s.state(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		state = &userState{}
+		state.Generation, err = newID()
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	// Saving the record again keeps it for as long as the new session lives.
+	if err := s.saveState(ctx, userID, state); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	sess := &Session{
+		UserID:     userID,
+		Generation: state.Generation,
+		CreatedAt:  now,
+		IssuedAt:   now,
+		LastSeenAt: now,
+	}
+
+	if sess.ID, err = newID(); err != nil {
+		return nil, err
+	}
+
+	if err := s.save(ctx, sess); err != nil {
+		return nil, err
+	}
+
+	return sess, nil
+}
+
+// Get returns a live session and extends its idle expiration. It returns
+// ErrNotFound for unknown, expired and ended sessions.
+func (s *Store) Get(ctx context.Context, id string) (*Session, error) {
+	v, err := s.cache.Get(ctx, cacheKey(id))
+	if errors.Is(err, caching.ErrMiss) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var sess Session
+	if err := json.Unmarshal([]byte(v), &sess); err != nil {
+		return nil, err
+	}
+
+	sess.ID = id
+	now := time.Now().UTC()
+
+	if !now.Before(s.ExpiresAt(&sess)) {
+		return nil, s.end(ctx, id)
+	}
+
+	state, err := s.state(ctx, sess.UserID)
+	if errors.Is(err, ErrNotFound) || (err == nil && state.Generation != sess.Generation) {
+		return nil, s.end(ctx, id)
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	sess.Rotate = sess.IssuedAt.Before(state.PrivilegedAt)
+
+	if now.Sub(sess.LastSeenAt) >= s.touchAfter {
+		sess.LastSeenAt = now
+		if err := s.save(ctx, &sess); err != nil {
+			return nil, err
+		}
+	}
+
+	return &sess, nil
+}
+
+// Rotate replaces the ID of a session and ends the old one.
+func (s *Store) Rotate(ctx context.Context, sess *Session) (*Session, error) {
+	id, err := newID()
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	next := *sess
+	next.ID, next.IssuedAt, next.LastSeenAt, next.Rotate = id, now, now, false
+
+	if err := s.save(ctx, &next); err != nil {
+		return nil, err
+	}
+
+	if err := s.Delete(ctx, sess.ID); err != nil {
+		return nil, err
+	}
+
+	return &next, nil
+}
+
+// Delete ends a session.
+func (s *Store) Delete(ctx context.Context, id string) error {
+	return s.cache.Delete(ctx, cacheKey(id))
+}
+
+// DeleteUser ends every session of a user.
+func (s *Store) DeleteUser(ctx context.Context, userID string) error {
+	gen, err := newID()
+	if err != nil {
+		return err
+	}
+
+	return s.saveState(ctx, userID, &userState{Generation: gen})
+}
+
+// PrivilegesChanged makes the sessions a user currently has rotate their
+// IDs on their next use.
+func (s *Store) PrivilegesChanged(ctx context.Context, userID string) error {
+	state, err := s.state(ctx, userID)
+	if errors.Is(err, ErrNotFound) {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	state.PrivilegedAt = time.Now().UTC()
+
+	return s.saveState(ctx, userID, state)
+}
+
+// ReadCookie returns the session ID sent by the client, if any.
+func (s *Store) ReadCookie(r *http.Request) string {
+	c, err := r.Cookie(s.opts.CookieName)
+	if err != nil {
+		return ""
+	}
+
+	return c.Value
+}
+
+func (s *Store) WriteCookie(rw http.ResponseWriter, sess *Session) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     s.opts.CookieName,
+		Value:    sess.ID,
+		Path:     "/",
+		Expires:  sess.CreatedAt.Add(s.opts.Lifetime),
+		Secure:   !s.opts.Insecure,
+		HttpOnly: true,
+		SameSite: s.opts.SameSite,
+	})
+}
+
+func (s *Store) ClearCookie(rw http.ResponseWriter) {
+	http.SetCookie(rw, &http.Cookie{
+		Name:     s.opts.CookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Secure:   !s.opts.Insecure,
+		HttpOnly: true,
+		SameSite: s.opts.SameSite,
+	})
+}
+
+// end deletes a session that is no longer valid and reports it as not
+// found.
+func (s *Store) end(ctx context.Context, id string) error {
+	if err := s.Delete(ctx, id); err != nil {
+		return err
+	}
+
+	return ErrNotFound
+}
+
+func (s *Store) save(ctx context.Context, sess *Session) error {
+	b, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.Set(ctx, cacheKey(sess.ID), string(b), time.Until(s.ExpiresAt(sess)))
+}
+
+func (s *Store) state(ctx context.Context, userID string) (*userState, error) {
+	v, err := s.cache.Get(ctx, userKey(userID))
+	if errors.Is(err, caching.ErrMiss) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	var state userState
+	if err := json.Unmarshal([]byte(v), &state); err != nil {
+		return nil, err
+	}
+
+	return &state, nil
+}
+
+// saveState stores the record of a user for as long as a session created
+// now may live.
+func (s *Store) saveState(ctx context.Context, userID string, state *userState) error {
+	b, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.Set(ctx, userKey(userID), string(b), s.opts.Lifetime)
+}
+
+// cacheKey hashes the session ID, so that the contents of the cache cannot
+// be used as session cookies.
+func cacheKey(id string) string {
+	sum := sha256.Sum256([]byte(id))
+
+	return "session:" + hex.EncodeToString(sum[:])
+}
+
+func userKey(userID string) string {
+	return "session:user:" + userID
+}
+
+// newID returns 256 random bits.
+func newID() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+type contextKey struct{}
+
+func WithSession(ctx context.Context, sess *Session) context.Context {
+	return context.WithValue(ctx, contextKey{}, sess)
+}
+
+// FromContext returns the session a request was authenticated with.
+func FromContext(ctx context.Context) (*Session, bool) {
+	sess, ok := ctx.Value(contextKey{}).(*Session)
+
+	return sess, ok
+}
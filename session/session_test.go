@@ -0,0 +1,378 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/edalmi/x-api/caching"
+)
+
+// memoryCache is an in-memory caching.Cache that ignores expiry, so that
+// expiration is left to the store.
+type memoryCache struct {
+	mu     sync.Mutex
+	values map[string]string
+}
+
+func newMemoryCache() *memoryCache {
+	return &memoryCache{values: make(map[string]string)}
+}
+
+func (c *memoryCache) Get(_ context.Context, key string) (string, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	v, ok := c.values[key]
+	if !ok {
+		return "", caching.ErrMiss
+	}
+
+	return v, nil
+}
+
+func (c *memoryCache) Set(_ context.Context, key, value string, _ time.Duration) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.values[key] = value
+
+	return nil
+}
+
+func (c *memoryCache) Add(_ context.Context, key, value string, _ time.Duration) (bool, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if _, ok := c.values[key]; ok {
+		return false, nil
+	}
+
+	c.values[key] = value
+
+	return true, nil
+}
+
+func (c *memoryCache) Delete(_ context.Context, key string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.values, key)
+
+	return nil
+}
+
+func newTestStore(t *testing.T, cache caching.Cache) *Store {
+	t.Helper()
+
+	s, err := NewStore(cache, Options{IdleTimeout: time.Hour, Lifetime: 4 * time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return s
+}
+
+// age moves the times of a stored session back by d.
+func age(t *testing.T, s *Store, sess *Session, d time.Duration) {
+	t.Helper()
+
+	aged := *sess
+	aged.CreatedAt = aged.CreatedAt.Add(-d)
+	aged.IssuedAt = aged.IssuedAt.Add(-d)
+	aged.LastSeenAt = aged.LastSeenAt.Add(-d)
+
+	if err := s.save(context.Background(), &aged); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStoreGet(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, s *Store, sess *Session)
+		wantErr error
+	}{
+		{name: "new", prepare: func(*testing.T, *Store, *Session) {}},
+		{
+			name: "used within the idle timeout",
+			prepare: func(t *testing.T, s *Store, sess *Session) {
+				age(t, s, sess, 59*time.Minute)
+			},
+		},
+		{
+			name: "idle",
+			prepare: func(t *testing.T, s *Store, sess *Session) {
+				age(t, s, sess, time.Hour)
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "past its lifetime",
+			prepare: func(t *testing.T, s *Store, sess *Session) {
+				aged := *sess
+				aged.CreatedAt = aged.CreatedAt.Add(-4 * time.Hour)
+
+				if err := s.save(context.Background(), &aged); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "deleted",
+			prepare: func(t *testing.T, s *Store, sess *Session) {
+				if err := s.Delete(context.Background(), sess.ID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "user logged out everywhere",
+			prepare: func(t *testing.T, s *Store, sess *Session) {
+				if err := s.DeleteUser(context.Background(), sess.UserID); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrNotFound,
+		},
+		{
+			name: "user record lost",
+			prepare: func(t *testing.T, s *Store, sess *Session) {
+				if err := s.cache.Delete(context.Background(), userKey(sess.UserID)); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: ErrNotFound,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			cache := newMemoryCache()
+			s := newTestStore(t, cache)
+
+			sess, err := s.Create(ctx, "ada")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tt.prepare(t, s, sess)
+
+			got, err := s.Get(ctx, sess.ID)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Get() error = %v, want %v", err, tt.wantErr)
+			}
+
+			if tt.wantErr != nil {
+				if _, ok := cache.values[cacheKey(sess.ID)]; ok {
+					t.Error("Get() kept the ended session")
+				}
+
+				return
+			}
+
+			if got.ID != sess.ID || got.UserID != "ada" || got.Rotate {
+				t.Errorf("Get() = %+v, want the session of ada", got)
+			}
+		})
+	}
+}
+
+func TestStoreGetExtendsIdleExpiration(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, newMemoryCache())
+
+	sess, err := s.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	age(t, s, sess, 50*time.Minute)
+
+	got, err := s.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if time.Since(got.LastSeenAt) > time.Minute {
+		t.Errorf("LastSeenAt = %v, want now", got.LastSeenAt)
+	}
+
+	// Without the extension the session would now be idle.
+	age(t, s, got, 20*time.Minute)
+
+	if _, err := s.Get(ctx, sess.ID); err != nil {
+		t.Errorf("Get() error = %v, want the extended session", err)
+	}
+}
+
+func TestStoreDeleteUserKeepsOtherUsers(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, newMemoryCache())
+
+	ada, err := s.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	bob, err := s.Create(ctx, "bob")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := s.DeleteUser(ctx, "ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, ada.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(ada) error = %v, want %v", err, ErrNotFound)
+	}
+
+	if _, err := s.Get(ctx, bob.ID); err != nil {
+		t.Errorf("Get(bob) error = %v", err)
+	}
+
+	// Sessions created afterwards are valid.
+	again, err := s.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := s.Get(ctx, again.ID); err != nil {
+		t.Errorf("Get(new session) error = %v", err)
+	}
+}
+
+func TestStoreRotate(t *testing.T) {
+	ctx := context.Background()
+	s := newTestStore(t, newMemoryCache())
+
+	sess, err := s.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	age(t, s, sess, time.Minute)
+
+	if err := s.PrivilegesChanged(ctx, "ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := s.Get(ctx, sess.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !got.Rotate {
+		t.Fatal("Get().Rotate = false after the privileges changed")
+	}
+
+	next, err := s.Rotate(ctx, got)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if next.ID == sess.ID || !next.CreatedAt.Equal(got.CreatedAt) {
+		t.Errorf("Rotate() = %+v, want a new ID and the old creation time %v", next, got.CreatedAt)
+	}
+
+	if _, err := s.Get(ctx, sess.ID); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get(old ID) error = %v, want %v", err, ErrNotFound)
+	}
+
+	rotated, err := s.Get(ctx, next.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if rotated.Rotate {
+		t.Error("Get(new ID).Rotate = true, want false")
+	}
+}
+
+func TestStorePrivilegesChangedWithoutSessions(t *testing.T) {
+	cache := newMemoryCache()
+	s := newTestStore(t, cache)
+
+	if err := s.PrivilegesChanged(context.Background(), "ada"); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(cache.values) != 0 {
+		t.Errorf("cache = %v, want nothing stored", cache.values)
+	}
+}
+
+func TestStoreCookies(t *testing.T) {
+	ctx := context.Background()
+
+	s, err := NewStore(newMemoryCache(), Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sess, err := s.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	s.WriteCookie(rec, sess)
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("cookies = %v, want one", cookies)
+	}
+
+	c := cookies[0]
+	if c.Name != DefaultCookieName || c.Value != sess.ID || c.Path != "/" || !c.Secure || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode {
+		t.Errorf("cookie = %+v, want a secure HTTP-only lax cookie with the session ID", c)
+	}
+
+	if want := sess.CreatedAt.Add(DefaultLifetime); c.Expires.Unix() != want.Unix() {
+		t.Errorf("cookie expires = %v, want %v", c.Expires, want)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.AddCookie(c)
+
+	if id := s.ReadCookie(r); id != sess.ID {
+		t.Errorf("ReadCookie() = %q, want %q", id, sess.ID)
+	}
+
+	if id := s.ReadCookie(httptest.NewRequest(http.MethodGet, "/", nil)); id != "" {
+		t.Errorf("ReadCookie() without a cookie = %q, want none", id)
+	}
+
+	rec = httptest.NewRecorder()
+	s.ClearCookie(rec)
+
+	if cleared := rec.Result().Cookies(); len(cleared) != 1 || cleared[0].MaxAge >= 0 || cleared[0].Value != "" {
+		t.Errorf("cleared cookies = %v, want one that expired", cleared)
+	}
+}
+
+func TestCacheKeyHidesID(t *testing.T) {
+	ctx := context.Background()
+	cache := newMemoryCache()
+	s := newTestStore(t, cache)
+
+	sess, err := s.Create(ctx, "ada")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for key, value := range cache.values {
+		if strings.Contains(key, sess.ID) || strings.Contains(value, sess.ID) {
+			t.Errorf("cache holds the session ID in %q", key)
+		}
+	}
+}